@@ -79,8 +79,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"io/ioutil"
+	"log"
 	"net/http"
 	// "os"
 
@@ -110,17 +113,34 @@ func main() {
 	http.HandleFunc("/", handleMain)
 	http.HandleFunc("/login", handleGoogleLogin)
 	http.HandleFunc("/callback", handleGoogleCallback)
-	fmt.Println(http.ListenAndServe(":8080", nil))
+	fmt.Println(http.ListenAndServe(":8080", securityHeaders(http.DefaultServeMux)))
 }
 
-func handleMain(w http.ResponseWriter, r *http.Request) {
-	var htmlIndex = `<html>
+// securityHeaders keeps the pages from being framed, sniffed or loading
+// anything but themselves.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'none'; base-uri 'none'; frame-ancestors 'none'; form-action 'self'")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		next.ServeHTTP(w, r)
+	})
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
 <body>
-	<a href="/login">Google Log In</a>
+	<a href="{{.LoginURL}}">Google Log In</a>
 </body>
-</html>`
+</html>`))
 
-	fmt.Fprintf(w, htmlIndex)
+func handleMain(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, struct{ LoginURL string }{"/login"}); err != nil {
+		log.Println("index:", err)
+	}
 }
 
 func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
@@ -128,36 +148,67 @@ func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
+// callbackError is a failed login as the user gets to see it: an RFC 6749
+// error code and a description. The cause is only logged.
+type callbackError struct {
+	code        string
+	description string
+	status      int
+	cause       error
+}
+
+func (e *callbackError) Error() string {
+	return fmt.Sprintf("%s: %s (%v)", e.code, e.description, e.cause)
+}
+
 func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
-	content, err := getUserInfo(r.FormValue("state"), r.FormValue("code"))
+	content, err := getUserInfo(r.FormValue("state"), r.FormValue("code"), r.FormValue("error"))
 	if err != nil {
-		fmt.Println(err.Error())
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		log.Println("callback:", err)
+		e, ok := err.(*callbackError)
+		if !ok {
+			e = &callbackError{code: "server_error", description: "The login could not be completed", status: http.StatusInternalServerError}
+		}
+		http.Error(w, fmt.Sprintf("%s (%s)", e.description, e.code), e.status)
 		return
 	}
 
+	// Plain text, so nothing from the provider is interpreted as HTML
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	fmt.Fprintf(w, "Content: %s\n", content)
 }
 
-func getUserInfo(state string, code string) ([]byte, error) {
+func getUserInfo(state string, code string, upstreamError string) ([]byte, error) {
 	if state != oauthStateString {
-		return nil, fmt.Errorf("invalid oauth state")
+		return nil, &callbackError{"invalid_request", "Invalid login state, please start again", http.StatusBadRequest, errors.New("invalid oauth state")}
+	}
+	// Google sends error=access_denied when the user declines
+	if upstreamError != "" {
+		cause := fmt.Errorf("google answered %q", upstreamError)
+		if upstreamError == "access_denied" {
+			return nil, &callbackError{"access_denied", "The login was cancelled or refused", http.StatusForbidden, cause}
+		}
+		return nil, &callbackError{"server_error", "Google could not complete the login", http.StatusBadGateway, cause}
 	}
 
 	token, err := googleOauthConfig.Exchange(oauth2.NoContext, code)
 	if err != nil {
-		return nil, fmt.Errorf("code exchange failed: %s", err.Error())
+		return nil, &callbackError{"server_error", "The login could not be completed with Google", http.StatusBadGateway,
+			fmt.Errorf("code exchange failed: %w", err)}
 	}
 
 	response, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting user info: %s", err.Error())
+		return nil, fmt.Errorf("failed getting user info: %w", err)
 	}
 
 	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed getting user info: %s", response.Status)
+	}
 	contents, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed reading response body: %s", err.Error())
+		return nil, fmt.Errorf("failed reading response body: %w", err)
 	}
 
 	return contents, nil
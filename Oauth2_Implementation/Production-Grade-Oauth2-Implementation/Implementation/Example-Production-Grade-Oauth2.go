@@ -12,10 +12,18 @@ Install the necessary dependencies:
 bash
 Copy code
 go get golang.org/x/oauth2
-go get github.com/golang-jwt/jwt/v4
+go get github.com/go-jose/go-jose/v4
 go get github.com/go-redis/redis/v8
-go get github.com/dgrijalva/jwt-go
 go get github.com/joho/godotenv
+go get github.com/lib/pq
+go get github.com/go-sql-driver/mysql
+go get go.mongodb.org/mongo-driver
+go get gopkg.in/yaml.v3
+go get github.com/BurntSushi/toml
+go get github.com/prometheus/client_golang
+go get go.opentelemetry.io/otel go.opentelemetry.io/otel/sdk
+go get go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp go.opentelemetry.io/otel/exporters/stdout/stdouttrace
+go get go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp
 2. Environment Setup
 Create a .env file in your project directory to store sensitive information like client ID, secret, etc.
 
@@ -187,149 +195,302 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
 	"github.com/go-redis/redis/v8"
-	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/admin"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/config"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/health"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/httpserver"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/metrics"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/server"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	statememory "oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/mongostate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/redisstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/resilient"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/mongostore"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/sqlstore"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tracing"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ui"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/vault"
 )
 
-var (
-	oauth2Config oauth2.Config
-	redisClient  *redis.Client
-	ctx          context.Context
-	jwtSecret    string
+// client is an entry of oauth.clients_file
+type client struct {
+	ID                string   `json:"client_id"`
+	Secret            string   `json:"client_secret"`
+	Name              string   `json:"name"`
+	RedirectURIs      []string `json:"redirect_uris"`
+	Scopes            []string `json:"scopes"`
+	AccessTokenFormat string   `json:"access_token_format"`
+	AccessTokenTTL    string   `json:"access_token_ttl"`
+	AllowPlainPKCE    bool     `json:"allow_plain_pkce"`
+	LegacyFlows       bool     `json:"legacy_flows"`
+	// ResponseEncryptionKey is a public JWK that JWT-secured authorization
+	// responses to the client are encrypted to
+	ResponseEncryptionKey json.RawMessage `json:"response_encryption_key"`
+}
+
+// Google publishes the keys for its ID tokens here
+const (
+	googleIssuer  = "https://accounts.google.com"
+	googleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
 )
 
-func init() {
-	// Load environment variables
-	err := godotenv.Load()
+func main() {
+	// Load the configuration: defaults, then the -config file (YAML or
+	// TOML), the environment including an optional .env, and flags
+	configLoader := &config.Loader{Args: os.Args[1:], DotEnv: ".env"}
+	cfg, err := configLoader.Load()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatal("invalid configuration:\n", err)
 	}
 
-	// Load JWT secret
-	jwtSecret = os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET is missing in .env")
+	// SIGINT and SIGTERM drain in-flight requests and close the stores
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Metrics are served on /metrics, next to the Go runtime and process
+	// collectors
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := metrics.New(registry)
+
+	// Spans go to an OTLP collector, stdout or a file, see tracing.exporter
+	tracer, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Build the token codec used for every token we hand out
+	tokenCodec, err := newTokenCodec(cfg.Tokens)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Initialize OAuth2 Config
-	oauth2Config = oauth2.Config{
-		ClientID:     os.Getenv("OAUTH_CLIENT_ID"),
-		ClientSecret: os.Getenv("OAUTH_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("OAUTH_REDIRECT_URL"),
-		Scopes:       strings.Split(os.Getenv("OAUTH_SCOPES"), " "),
+	oauth2Config := &oauth2.Config{
+		ClientID:     cfg.OAuth.ClientID,
+		ClientSecret: string(cfg.OAuth.ClientSecret),
+		RedirectURL:  cfg.OAuth.RedirectURL,
+		Scopes:       cfg.OAuth.Scopes,
 		Endpoint:     google.Endpoint,
 	}
 
-	// Initialize Redis client
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       0,
-	})
-
-	ctx = context.Background()
-}
-
-func main() {
-	http.HandleFunc("/", handleMain)
-	http.HandleFunc("/login", handleLogin)
-	http.HandleFunc("/callback", handleCallback)
-	http.HandleFunc("/logout", handleLogout)
-
-	fmt.Println("Server running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
-
-func handleMain(w http.ResponseWriter, r *http.Request) {
-	htmlIndex := `<html>
-	<body>
-	<a href="/login">Google Log in</a>
-	</body>
-	</html>`
-	fmt.Fprintf(w, htmlIndex)
-}
+	// Login state, opaque tokens and the vault live in the state store
+	// One Redis connection pool serves the state store and the rate limiter
+	var rdb redis.UniversalClient
+	if cfg.StateDriver() == "redis" {
+		if rdb, err = redisstate.NewClient(redisOptions(cfg.Redis)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	stateStore, err := newStateStore(ctx, cfg, rdb, m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The flow uses the traced store; health probes would only add noise
+	tracedState := tracing.InstrumentState(stateStore, tracer)
 
-func handleLogin(w http.ResponseWriter, r *http.Request) {
-	state := randomString(32)
-	codeVerifier := randomString(64)
-	codeChallenge := generateCodeChallenge(codeVerifier)
+	// Upstream tokens are kept in the vault, never inside our own tokens
+	tokenVault, err := newTokenVault(cfg.Vault, tracedState, oauth2Config)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Store code_verifier in Redis keyed by state
-	redisClient.Set(ctx, state, codeVerifier, time.Minute*5)
+	// A login has to come back to /callback in time, in the same browser
+	loginStates := loginstate.NewStore(tracedState, time.Duration(cfg.Login.StateTTL))
+	loginBinder, err := newLoginBinder(cfg.Login, loginStates.TTL(), oauth2Config.RedirectURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Logins started at /authorize end with a single-use code for the client
+	authCodes := authcode.NewStore(tracedState, time.Duration(cfg.Login.CodeTTL))
+	// Devices wait for their user at /device for up to login.device_code_ttl
+	devices := devicecode.NewStore(tracedState, time.Duration(cfg.Login.DeviceCodeTTL))
 
-	authURL := oauth2Config.AuthCodeURL(
-		state,
-		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
-		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
-	)
-	http.Redirect(w, r, authURL, http.StatusFound)
-}
-func handleCallback(w http.ResponseWriter, r *http.Request) {
-	state := r.URL.Query().Get("state")
-	code := r.URL.Query().Get("code")
+	// The pages users see, with their security headers and CSRF tokens
+	pages, err := newUI(cfg, oauth2Config.RedirectURL)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Retrieve code_verifier from Redis
-	codeVerifier, err := redisClient.Get(ctx, state).Result()
+	// Clients, users, grants and consents live in the durable store
+	store, err := newStore(ctx, cfg.Storage)
 	if err != nil {
-		http.Error(w, "Invalid or expired state", http.StatusUnauthorized)
-		return
+		log.Fatal(err)
 	}
 
-	// Exchange authorization code for tokens
-	token, err := oauth2Config.Exchange(r.Context(), code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	// Logins, consents, tokens and reloads go to the hash-chained audit trail
+	auditLog, err := newAuditLogger(cfg.Audit, store)
 	if err != nil {
-		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Fatal(err)
 	}
 
-	// Fetch user info from Google
-	client := oauth2Config.Client(ctx, token)
-	resp, err := client.Get("https://openidconnect.googleapis.com/v1/userinfo")
+	tokenIssuer := tokens.NewIssuer(tokenCodec, tracedState)
+	limiter := newRateLimiter(cfg, rdb, m)
+
+	keysCtx := oidc.ClientContext(ctx, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithTracerProvider(tracer)),
+	})
+	// ID tokens of the implicit and hybrid flows are verified by clients
+	// against the published JWKS, which an HMAC secret cannot be part of
+	var idTokenSigner server.Signer
+	if cfg.Tokens.SigningKeyFile != "" {
+		idTokenSigner = tokenCodec
+	}
+	srv, err := server.New(server.Options{
+		Upstream: oauth2Config,
+		IDTokenVerifier: oidc.NewVerifier(googleIssuer, oidc.NewRemoteKeySet(keysCtx, googleKeysURL),
+			&oidc.Config{ClientID: oauth2Config.ClientID}),
+		Store:       store,
+		Tokens:      tokenIssuer,
+		Vault:       tokenVault,
+		LoginStates: loginStates,
+		LoginBinder: loginBinder,
+		AuthCodes:   authCodes,
+		Devices:     devices,
+		UI:          pages,
+		GrantTTL:    time.Duration(cfg.Vault.TTL),
+		Metrics:     m,
+		Audit:       auditLog,
+		RateLimiter: limiter,
+		Signer:      idTokenSigner,
+		Issuer:      cfg.Tokens.Issuer,
+
+		TracerProvider: tracer,
+	})
 	if err != nil {
-		http.Error(w, "Failed to get user info: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Fatal(err)
+	}
+
+	// The clients file and the default token settings are applied now and
+	// again on SIGHUP; everything else needs a restart
+	applyClients := func(c *config.Config) error {
+		return loadClients(ctx, c, store, srv)
+	}
+	if err := applyClients(cfg); err != nil {
+		log.Fatal(err)
 	}
-	defer resp.Body.Close()
+	go configLoader.Watch(ctx, cfg, func(c *config.Config) error {
+		err := applyClients(c)
+		e := &audit.Event{Type: audit.EventAdmin, Details: map[string]string{"action": "config.reload", "source": "SIGHUP"}}
+		if err != nil {
+			e.Outcome = audit.OutcomeFailure
+			e.Details["reason"] = err.Error()
+		}
+		if err := auditLog.Record(ctx, e); err != nil {
+			log.Println(err)
+		}
+		return err
+	})
 
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		http.Error(w, "Failed to parse user info", http.StatusInternalServerError)
-		return
+	// /healthz only fails for what a restart can fix; /readyz also covers
+	// the dependencies of a login and fails as soon as shutdown starts
+	checks := health.New(5 * time.Second)
+	checks.AddLiveness("signing_key", health.SigningKey(tokenCodec))
+	checks.AddReadiness("state_store", health.StateStore(stateStore))
+	checks.AddReadiness("storage", health.Storage(store))
+	checks.AddReadiness("upstream_discovery", health.Discovery(nil, googleIssuer))
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", checks.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	if cfg.Admin.Enabled {
+		api, err := newAdminAPI(cfg.Admin, store, tokenIssuer, tokenVault, tokenCodec, auditLog, limiter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mux.Handle("/admin/v1/", http.StripPrefix("/admin/v1", api))
 	}
+	mux.Handle("/", srv)
+
+	opts := httpOptions(cfg.HTTP)
+	opts.OnShutdown = checks.SetDraining
+	err = httpserver.ListenAndServe(ctx, mux, opts)
+	stop()
 
-	// Generate JWT with user info inside
-	claims := jwt.MapClaims{
-		"access_token": token.AccessToken,
-		"exp":          time.Now().Add(time.Hour).Unix(),
-		"user":         userInfo, // Include user details
+	// Nothing uses the stores once the listener has drained
+	if err := stateStore.Close(); err != nil {
+		log.Println("closing state store:", err)
 	}
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedJWT, err := jwtToken.SignedString([]byte(jwtSecret))
+	if err := auditLog.Close(); err != nil {
+		log.Println("closing audit log:", err)
+	}
+	if err := store.Close(); err != nil {
+		log.Println("closing storage:", err)
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := tracer.Shutdown(flushCtx); err != nil {
+		log.Println("flushing traces:", err)
+	}
+	cancel()
 	if err != nil {
-		http.Error(w, "Failed to create JWT token", http.StatusInternalServerError)
-		return
+		log.Fatal(err)
 	}
+	log.Println("shut down cleanly")
+}
 
-	// Return JWT + user info in response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"jwt_token": signedJWT,
-		"user":      userInfo,
-	})
+// httpOptions maps the listener settings. TLS is used when both
+// http.tls.cert_file and http.tls.key_file are set.
+func httpOptions(c config.HTTP) httpserver.Options {
+	return httpserver.Options{
+		Addr:              c.Addr,
+		CertFile:          c.TLS.CertFile,
+		KeyFile:           c.TLS.KeyFile,
+		CertCheckInterval: time.Duration(c.TLS.ReloadInterval),
+		HTTP2:             c.HTTP2,
+		H2C:               c.H2C,
+		ReadHeaderTimeout: time.Duration(c.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(c.ReadTimeout),
+		WriteTimeout:      time.Duration(c.WriteTimeout),
+		IdleTimeout:       time.Duration(c.IdleTimeout),
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		MaxConnections:    c.MaxConnections,
+		ShutdownTimeout:   time.Duration(c.ShutdownTimeout),
+		DrainDelay:        time.Duration(c.DrainDelay),
+	}
 }
 
 // func handleCallback(w http.ResponseWriter, r *http.Request) {
@@ -363,35 +524,393 @@ func handleCallback(w http.ResponseWriter, r *http.Request) {
 // 	})
 // }
 
-func handleLogout(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token != "" {
-		redisClient.Del(ctx, token)
+// newTokenCodec signs with tokens.signing_key_file (RS256/ES256/EdDSA) when set
+// and falls back to HS256 with tokens.secret. When tokens.jwe_key_file is set
+// the signed token is additionally encrypted (RSA-OAEP-256 or ECDH-ES by
+// default, see tokens.jwe_alg) with A256GCM so that the claims are unreadable
+// to whoever holds the token.
+func newTokenCodec(c config.Tokens) (*tokens.RotatingCodec, error) {
+	// The signing key file is read again on every rotation, so replacing it
+	// and calling POST /admin/v1/keys/rotate switches keys without a restart
+	loadSigningKey := func() (jose.JSONWebKey, error) {
+		if c.SigningKeyFile == "" {
+			return tokens.HMACKey([]byte(c.Secret))
+		}
+		key, err := tokens.LoadPrivateKey(c.SigningKeyFile)
+		if err != nil {
+			return jose.JSONWebKey{}, fmt.Errorf("loading tokens.signing_key_file: %w", err)
+		}
+		return tokens.SigningKey(key)
+	}
+
+	var encrypt func(*tokens.SignedCodec) (tokens.Codec, error)
+	if c.JWEKeyFile != "" {
+		key, err := tokens.LoadPrivateKey(c.JWEKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading tokens.jwe_key_file: %w", err)
+		}
+		encKey, err := tokens.EncryptionKey(key, c.JWEAlg)
+		if err != nil {
+			return nil, err
+		}
+		encrypt = func(signed *tokens.SignedCodec) (tokens.Codec, error) {
+			return tokens.NewEncryptedCodec(signed, encKey)
+		}
 	}
-	w.Write([]byte("Logged out successfully"))
+
+	return tokens.NewRotatingCodec(loadSigningKey, tokenExpectations(c), encrypt)
+}
+
+// tokenExpectations are the issuer and audiences our access tokens are
+// stamped with and checked for.
+func tokenExpectations(c config.Tokens) tokens.Expectations {
+	return tokens.Expectations{Issuer: c.Issuer, Audience: c.Audience, Type: tokens.TypeAccessToken}
 }
 
-func generateJWT(secret string, accessToken string) (string, error) {
-	claims := jwt.MapClaims{
-		"access_token": accessToken,
-		"exp":          time.Now().Add(time.Hour).Unix(),
+// newAdminAPI serves the operator API to the users admin.roles names,
+// signed in with an access token that carries the admin scope.
+func newAdminAPI(c config.Admin, store storage.Store, issuer *tokens.Issuer, v *vault.Vault,
+	keys *tokens.RotatingCodec, auditLog *audit.Logger, limiter *ratelimit.Limiter) (*admin.API, error) {
+	roles, err := admin.ParseRoles(c.Roles)
+	if err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return admin.New(admin.Options{
+		Store:       store,
+		Tokens:      issuer,
+		Vault:       v,
+		Keys:        keys,
+		Roles:       roles,
+		Audit:       auditLog,
+		RateLimiter: limiter,
+	})
 }
 
-func randomString(length int) string {
-	b := make([]byte, length)
-	_, err := rand.Read(b)
+// newTokenVault seals upstream tokens with vault.kek (32 bytes, base64). Retired
+// keys listed in vault.previous_keks as id=key pairs can still open old records.
+func newTokenVault(c config.Vault, kv state.Store, upstream *oauth2.Config) (*vault.Vault, error) {
+	keys, err := vault.ParseKeyRing(c.KEKID, string(c.KEK), string(c.PreviousKEKs))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	return vault.New(kv, keys, upstream, time.Duration(c.TTL)), nil
+}
+
+// newStateStore picks the ephemeral state backend from state.driver: redis,
+// mongodb or memory. By default Redis is used when redis.addrs is set, so the
+// server also runs on a laptop without any external service. The memory
+// store is not shared, so it only suits a single replica; mongodb keeps the
+// state in a TTL-indexed collection of the storage database, for
+// deployments without Redis. Backend errors are counted in m; calls refused
+// by the open circuit breaker are not.
+func newStateStore(ctx context.Context, cfg *config.Config, rdb redis.UniversalClient, m *metrics.Metrics) (state.Store, error) {
+	var kv state.Store
+	switch cfg.StateDriver() {
+	case "memory":
+		return statememory.New(), nil
+	case "redis":
+		kv = redisstate.New(rdb)
+	case "mongodb":
+		db, err := mongostate.Open(ctx, string(cfg.Storage.DSN), cfg.Storage.Database)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.EnsureIndexes(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		kv = db
+	default:
+		return nil, fmt.Errorf("unknown state driver %q", cfg.StateDriver())
+	}
+	return resilient.New(metrics.InstrumentState(kv, m), resilient.Options{
+		OnStateChange: func(open bool) {
+			if open {
+				m.StateBreakerOpen.Set(1)
+				log.Println("state store failing, circuit breaker open")
+			} else {
+				m.StateBreakerOpen.Set(0)
+				log.Println("state store recovered, circuit breaker closed")
+			}
+		},
+	}), nil
+}
+
+// newAuditLogger opens the audit sinks. The chain in audit.file is
+// continued across restarts; audit.storage needs a backend with an audit
+// trail. audit.key (32 bytes, base64) makes the hashes HMACs.
+func newAuditLogger(c config.Audit, store storage.Store) (*audit.Logger, error) {
+	opts := audit.Options{}
+	if c.Key != "" {
+		encoded := string(c.Key)
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			if key, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+				return nil, fmt.Errorf("decoding audit.key: %w", err)
+			}
+		}
+		if len(key) < 32 {
+			return nil, fmt.Errorf("audit.key must be at least 32 bytes, got %d", len(key))
+		}
+		opts.Key = key
+	}
+	if c.File != "" {
+		last, err := audit.LastInFile(c.File)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := audit.NewFileSink(c.File)
+		if err != nil {
+			return nil, err
+		}
+		opts.Last = last
+		opts.Sinks = append(opts.Sinks, sink)
+	}
+	if c.Stdout {
+		opts.Sinks = append(opts.Sinks, audit.NewWriterSink(os.Stdout))
+	}
+	if c.Storage {
+		trail, ok := store.(storage.AuditStore)
+		if !ok {
+			return nil, errors.New("audit.storage: the storage driver cannot keep the audit trail")
+		}
+		opts.Sinks = append(opts.Sinks, audit.NewStoreSink(trail))
+	}
+	return audit.New(opts), nil
+}
+
+// newRateLimiter applies ratelimit.*, or returns nil when it is disabled. A
+// Redis limiter falls back to per-replica limits while Redis is down.
+func newRateLimiter(c *config.Config, rdb redis.UniversalClient, m *metrics.Metrics) *ratelimit.Limiter {
+	rl := c.RateLimit
+	if !rl.Enabled {
+		return nil
+	}
+	var backend ratelimit.Backend = ratelimit.NewMemory()
+	if c.RateLimitDriver() == "redis" {
+		backend = ratelimit.NewFallback(ratelimit.NewRedis(rdb), backend)
+	}
+	limit := func(r config.Rate) ratelimit.Limit {
+		return ratelimit.Limit{Rate: r.N, Period: r.Per}
+	}
+	rule := func(r config.RateRule) ratelimit.Rule {
+		return ratelimit.Rule{IP: limit(r.IP), Client: limit(r.Client), User: limit(r.User)}
+	}
+	var proxies []netip.Prefix
+	for _, p := range rl.TrustedProxies {
+		proxies = append(proxies, netip.MustParsePrefix(p)) // checked by Validate
+	}
+	return ratelimit.New(ratelimit.Options{
+		Backend: backend,
+		Rules: map[string]ratelimit.Rule{
+			"login":      rule(rl.Login),
+			"callback":   rule(rl.Callback),
+			"token":      rule(rl.Token),
+			"logout":     rule(rl.Logout),
+			"introspect": rule(rl.Introspect),
+			"revoke":     rule(rl.Revoke),
+			"userinfo":   rule(rl.UserInfo),
+			"admin":      rule(rl.Admin),
+		},
+		Penalty: ratelimit.Penalty{
+			Free:     rl.FailuresFree,
+			Window:   time.Duration(rl.FailureWindow),
+			Delay:    time.Duration(rl.FailureDelay),
+			MaxDelay: time.Duration(rl.FailureMaxDelay),
+		},
+		TrustedProxies: proxies,
+		OnLimited: func(endpoint, dimension string) {
+			m.RateLimited.WithLabelValues(endpoint, dimension).Inc()
+		},
+	})
+}
+
+// newLoginBinder signs the pre-auth cookie with login.cookie_key (32 bytes,
+// base64). The cookie is Secure whenever the callback is served over https.
+func newLoginBinder(c config.Login, ttl time.Duration, redirectURL string) (*loginstate.Binder, error) {
+	key, err := cookieKey(c)
+	if err != nil {
+		return nil, err
+	}
+	secure := strings.HasPrefix(redirectURL, "https://")
+	return loginstate.NewBinder(key, ttl, secure)
+}
+
+// newUI loads the pages from ui.theme_dir and the message catalogs from
+// ui.locales_dir over the built-in ones. Their CSRF
+// tokens are signed with a key derived from login.cookie_key, so they stay
+// valid across restarts and replicas.
+func newUI(cfg *config.Config, redirectURL string) (*ui.UI, error) {
+	key, err := cookieKey(cfg.Login)
+	if err != nil {
+		return nil, err
+	}
+	return ui.New(ui.Options{
+		ThemeDir:      cfg.UI.ThemeDir,
+		ProductName:   cfg.UI.ProductName,
+		CSRFKey:       key,
+		SecureCookies: strings.HasPrefix(redirectURL, "https://"),
+		HSTSMaxAge:    time.Duration(cfg.HTTP.HSTSMaxAge),
+		LocalesDir:    cfg.UI.LocalesDir,
+		DefaultLocale: cfg.UI.DefaultLocale,
+	})
+}
+
+// cookieKey decodes login.cookie_key, in standard or URL-safe base64.
+func cookieKey(c config.Login) ([]byte, error) {
+	encoded := string(c.CookieKey)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if key, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("decoding login.cookie_key: %w", err)
+		}
 	}
-	return base64.RawURLEncoding.EncodeToString(b)[:length]
+	return key, nil
 }
 
-func generateCodeChallenge(verifier string) string {
-	hash := sha256.Sum256([]byte(verifier))
-	return base64.RawURLEncoding.EncodeToString(hash[:])
+// redisOptions maps the Redis topology. redis.mode is standalone (default),
+// sentinel or cluster; redis.addrs lists the server, the sentinels or the
+// cluster seed nodes respectively.
+func redisOptions(c config.Redis) redisstate.Options {
+	return redisstate.Options{
+		Mode:             c.Mode,
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		Username:         c.Username,
+		Password:         string(c.Password),
+		SentinelUsername: c.SentinelUsername,
+		SentinelPassword: string(c.SentinelPassword),
+		DB:               c.DB,
+		TLS: redisstate.TLSOptions{
+			Enabled:    c.TLS.Enabled,
+			CAFile:     c.TLS.CAFile,
+			CertFile:   c.TLS.CertFile,
+			KeyFile:    c.TLS.KeyFile,
+			ServerName: c.TLS.ServerName,
+		},
+	}
+}
+
+// newStore opens the backend named by storage.driver: memory (default),
+// postgres, mysql or mongodb. storage.dsn is the driver's connection string.
+// SQL schemas are migrated and MongoDB indexes created on startup.
+func newStore(ctx context.Context, c config.Storage) (storage.Store, error) {
+	switch c.Driver {
+	case "", "memory":
+		return memory.New(), nil
+	case sqlstore.Postgres, sqlstore.MySQL:
+		db, err := sqlstore.Open(ctx, c.Driver, string(c.DSN))
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Migrate(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	case "mongodb":
+		db, err := mongostore.Open(ctx, string(c.DSN), c.Database)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.EnsureIndexes(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", c.Driver)
+	}
+}
+
+// loadClients registers the clients listed in oauth.clients_file, a JSON
+// array, in the store, creating or updating each one. Secrets are only kept
+// hashed and must have storage.MinSecretLength characters. The default client for /login without a client_id uses the
+// tokens.access_token_* settings. It runs at startup and on every SIGHUP.
+func loadClients(ctx context.Context, conf *config.Config, store storage.Store, srv *server.Server) error {
+	format, err := tokens.ParseFormat(conf.Tokens.AccessTokenFormat)
+	if err != nil {
+		return fmt.Errorf("tokens.access_token_format: %w", err)
+	}
+	srv.SetDefaultClient(&storage.Client{
+		AccessTokenFormat: string(format),
+		AccessTokenTTL:    time.Duration(conf.Tokens.AccessTokenTTL),
+	})
+
+	path := conf.OAuth.ClientsFile
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading oauth.clients_file: %w", err)
+	}
+	var list []client
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parsing oauth.clients_file: %w", err)
+	}
+
+	seen := make(map[string]bool, len(list))
+	for _, c := range list {
+		if c.ID == "" {
+			return errors.New("oauth.clients_file: client without client_id")
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("client %q is defined twice", c.ID)
+		}
+		seen[c.ID] = true
+
+		for _, u := range c.RedirectURIs {
+			if err := storage.CheckRedirectURI(u); err != nil {
+				return fmt.Errorf("client %q: redirect_uris: %w", c.ID, err)
+			}
+		}
+		format, err := tokens.ParseFormat(c.AccessTokenFormat)
+		if err != nil {
+			return fmt.Errorf("client %q: %w", c.ID, err)
+		}
+		ttl := time.Hour
+		if c.AccessTokenTTL != "" {
+			if ttl, err = time.ParseDuration(c.AccessTokenTTL); err != nil {
+				return fmt.Errorf("client %q: parsing access_token_ttl: %w", c.ID, err)
+			}
+		}
+		var encKey string
+		if len(c.ResponseEncryptionKey) > 0 && string(c.ResponseEncryptionKey) != "null" {
+			if _, err := tokens.ParseEncryptionJWK(c.ResponseEncryptionKey); err != nil {
+				return fmt.Errorf("client %q: response_encryption_key: %w", c.ID, err)
+			}
+			encKey = string(c.ResponseEncryptionKey)
+		}
+		record := &storage.Client{
+			ID:                c.ID,
+			Name:              c.Name,
+			RedirectURIs:      c.RedirectURIs,
+			Scopes:            c.Scopes,
+			AccessTokenFormat: string(format),
+			AccessTokenTTL:    ttl,
+			AllowPlainPKCE:    c.AllowPlainPKCE,
+			LegacyFlows:       c.LegacyFlows,
+
+			ResponseEncryptionKey: encKey,
+		}
+		if c.Secret != "" {
+			if err := storage.CheckClientSecret(c.Secret); err != nil {
+				return fmt.Errorf("client %q: %w", c.ID, err)
+			}
+			record.SecretHash = storage.HashSecret(c.Secret)
+		}
+
+		err = store.CreateClient(ctx, record)
+		if errors.Is(err, storage.ErrConflict) {
+			err = store.UpdateClient(ctx, record)
+		}
+		if err != nil {
+			return fmt.Errorf("client %q: %w", c.ID, err)
+		}
+	}
+	return nil
 }
 
 /*
@@ -404,19 +923,104 @@ The /callback endpoint receives the authorization code from the OAuth provider a
 
 A JWT token is generated and returned to the client.
 
+Registered clients use the standard authorization code flow instead: /authorize?response_type=code&client_id=...&redirect_uri=...&state=... checks the client, its exact redirect_uri and the requested scopes, sends the user through the same Google login, and /callback redirects back to the client with a single-use code (valid for login.code_ttl) and the client's state. The client redeems the code at POST /token with grant_type=authorization_code, authenticating with Basic or client_secret_post unless it is public. A code redeemed twice revokes the grant it was issued for. Clients revoke their tokens at POST /revoke (RFC 7009), authenticating the same way; a client can only revoke tokens issued to it.
+
+GET /userinfo (OpenID Connect Core section 5.3) takes one of our access tokens as a Bearer token and answers with the user's current Google profile, sub replaced by our user ID. The profile is read with the upstream token the vault keeps for the session (the upstream_ref of the access token); when it has expired the vault refreshes it, once across replicas, and stores the new token. Code that calls other Google APIs on behalf of a session does the same through vault.Client(ctx, upstream_ref). Once the session ends or vault.ttl passes the upstream tokens are gone and /userinfo answers 401.
+
+Before a registered client gets anything, the user is asked on a consent page to allow the scopes it requested; the answer is remembered, so the page only comes back when a client asks for more. Denying ends the login with access_denied.
+
+Clients registered with legacy_flows may also use the implicit and hybrid flows of OpenID Connect: response_type token, id_token, id_token token, code id_token, code token and code id_token token. Their tokens never travel in the query: the response goes into the fragment (the default) or, with response_mode=form_post, into a form the browser posts to the redirect_uri. Implicit access tokens are issued like those from /token and have no refresh token. The ID tokens carry the client's nonce, which is required, and c_hash and at_hash of the code and access token issued with them. When the code of a response with an ID token is redeemed, the token response carries a fresh ID token too, with the same nonce and the at_hash of the new access token. They are signed with the key of tokens.signing_key_file, whose public half is published at /.well-known/jwks.json; with only an HMAC secret, response types with id_token are refused. New clients should stay with the code flow and PKCE.
+
+Clients that need the authorization response itself protected use JWT-secured responses (JARM): response_mode query.jwt, fragment.jwt or form_post.jwt, or jwt for the JWT variant of the default mode. The response then has a single response parameter, a JWT signed with the key of tokens.signing_key_file typed oauth-authz-resp+jwt that holds iss, aud (the client_id), exp (five minutes) and the parameters the plain mode would have sent, errors included. Clients registered with a response_encryption_key, a public RSA or EC JWK, get it encrypted to that key as a nested JWT (A256GCM). query.jwt is refused for response types with tokens, and without an asymmetric signing key the JWT modes are refused altogether.
+
+Devices without a browser use the device authorization grant (RFC 8628): POST /device_authorization returns a device_code and a short user_code (XXXX-XXXX), the user enters the code at /device and logs in there, and the device polls POST /token with grant_type=urn:ietf:params:oauth:grant-type:device_code until it gets its token, authorization_pending, slow_down, access_denied or expired_token. Codes are valid for login.device_code_ttl; wrong user codes lock the address out like failed logins.
+
+Pages:
+
+The login, consent, error, device and form_post pages are html/template files from the ui package, embedded in the binary. ui.theme_dir can replace any of them and the stylesheet, and ui.product_name is shown in their titles. The texts come from message catalogs in English, German, French and Spanish (ui/locales); the language is taken from the ui_locales parameter of /authorize or /login, then from Accept-Language, falling back to ui.default_locale. Consent pages describe scopes with their scope.<name> messages, and error pages explain the error code in the user's language. Further languages, or different wording, go into ui.locales_dir as <tag>.json files (e.g. pt-BR.json) with the same keys; missing keys fall back to the default language. Every response carries a Content-Security-Policy, X-Frame-Options DENY, nosniff and a no-referrer policy, plus Strict-Transport-Security with http.hsts_max_age. Forms are protected against CSRF with a signed double-submit cookie, keyed from login.cookie_key.
+
+Errors:
+
+Failures are reported with the error codes of RFC 6749 (invalid_request, invalid_client, invalid_grant, access_denied, server_error, temporarily_unavailable, ...) and a description meant for the client; the underlying error is only logged. /token answers them as JSON, /authorize logins as error, error_description and state parameters on the redirect_uri (in the fragment or a form_post page, or signed in a JWT, following response_mode), and /login logins as JSON. As long as the client or its redirect_uri is not verified the error is shown to the user instead of redirected. A user declining at Google comes back to the client as access_denied.
+
 PKCE:
 
 The PKCE (Proof Key for Code Exchange) mechanism is implemented to improve security in public clients like mobile apps and single-page apps.
 
 The code_verifier is stored in Redis for validation during token exchange.
 
+Towards our own clients the server checks PKCE itself (RFC 7636). /authorize takes code_challenge and code_challenge_method. Public clients have to send a challenge. S256 is always accepted; plain (also the default when the method is left out) only from clients registered with allow_plain_pkce. The challenge is stored with the authorization code, and /token requires the matching code_verifier. A code_verifier for a code issued without a challenge is refused as well, so a challenge stripped from the authorization request cannot be passed off as PKCE (downgrade protection, RFC 9700 section 2.1.1).
+
+Secrets:
+
+State values, nonces, codes, opaque tokens, vault references, CSRF secrets and client secrets all come from the cryptoutil package. Its generators take the entropy in bytes (at least 128 bits) and return unpadded base64url, and a failing random source is returned as an error (a server_error for the client) instead of ending the process. cryptoutil.Equal compares secrets in constant time, and cryptoutil.CodeVerifier and S256Challenge implement RFC 7636: verifiers carry 384 bits in 64 characters.
+
+Client secrets are stored as unsalted SHA-256, which is only safe for random secrets. The admin API and oauthctl client create generate them; client_secret entries in oauth.clients_file need at least 32 characters (storage.MinSecretLength) and should come from a generator such as openssl rand -base64 32.
+
 Redis:
 
-Redis is used to store and validate the PKCE code verifier and simulate token revocation.
+Redis is used to store and validate the PKCE code verifier and simulate token revocation. It sits behind the state package; with STATE_DRIVER=memory (the default when REDIS_ADDR is unset) the whole flow runs in-process without Redis. With STATE_DRIVER=mongodb the state lives instead in the oauth_state collection of the MongoDB storage database (see state/mongostate), whose TTL index removes authorization and device codes, login sessions, opaque tokens and revocations once they expire; rate limits are then counted per replica. Every state backend must pass the state/statetest conformance suite (expiry, SetNX and GetDel atomicity under concurrent callers, independent keys sharing a prefix): go test runs it against the memory store, against Redis when REDISSTATE_ADDR names a server and against MongoDB when MONGOSTORE_URI is set.
+
+Storage:
+
+Clients, users, grants and consents are kept in the store selected by STORAGE_DRIVER (memory, postgres, mysql or mongodb, see the storage package). SQL schemas are migrated automatically at startup from storage/sqlstore/migrations; on MongoDB a TTL index removes expired grants, and codes, sessions and tokens get theirs from state.driver=mongodb. Every backend must pass the storage/storagetest conformance suite: go test runs it against the memory store, against PostgreSQL and MySQL when SQLSTORE_POSTGRES_DSN or SQLSTORE_MYSQL_DSN names a database, and against MongoDB when MONGOSTORE_URI is set; without a server the MongoDB store is checked against the driver's mock deployment.
+
+Configuration:
+
+Settings are read by the config package from defaults, an optional YAML or TOML file (-config or CONFIG_FILE, see config.example.yaml), the environment (a .env file is optional) and flags such as -redis.addrs, later sources winning. All problems are reported together at startup. Secrets accept file:/path references. kill -HUP reloads the clients file and the default token settings; other changes are logged and need a restart.
+
+Server:
+
+The handlers live in the server package. main only wires the configured dependencies into server.New; other Go services can do the same with their own stores and mount the returned http.Handler on their mux.
+
+The httpserver package runs it with read/write/idle timeouts, an optional connection limit, HTTP/2 and, with http.tls.cert_file and key_file, TLS whose certificate is reloaded from disk after a renewal. On SIGTERM it stops accepting connections, lets in-flight logins finish within http.shutdown_timeout and then closes Redis and the database.
+
+Health:
+
+/healthz (liveness) only checks that tokens can still be signed. /readyz (readiness) also checks the state store, the database and Google's discovery document, reports each check with its latency as JSON, and answers 503 from the moment SIGTERM arrives; http.drain_delay keeps serving meanwhile so the load balancer can catch up.
+
+Metrics:
+
+/metrics exposes Prometheus metrics: logins started and completed by client and outcome, the latency of the upstream code exchange and userinfo calls, access tokens issued by grant type, client and format, introspections, revocations, and state store errors by operation along with the circuit breaker state. Only the first 100 client IDs get a label of their own; later ones are counted as "other".
+
+Tracing:
+
+Every handler, upstream call (code exchange, ID token keys, userinfo) and state store operation is an OpenTelemetry span, so a failed login shows whether Redis, the exchange or userinfo was at fault; the callback span carries the outcome in oauth.login.result. A traceparent header on the incoming request continues the caller's trace and is passed on to Google. Spans are exported over OTLP/HTTP (tracing.exporter=otlp), or written as JSON to stdout or tracing.file for offline use.
+
+Audit:
+
+Logins (successful or not), consents, issued and revoked tokens, logouts and configuration reloads are written as JSON lines to audit.file and/or stdout, and with audit.storage=true to the MongoDB or in-memory store. Each record contains the hash of the previous one, and the chain in audit.file continues across restarts. Set audit.key: without it the hashes are plain SHA-256, which anyone able to edit the file can recompute; with it they are HMACs only the key holder can produce. Verifying finds modified, removed and reordered records inside the file, but a file may start mid-chain after rotation, so records cut off its start or end only show against a head hash kept elsewhere (-head). Check a file with:
+
+go run ./cmd/auditverify -key "$AUDIT_KEY" audit.log
+
+Rate limiting:
+
+/login and /authorize (sharing the login limits), /callback, /token, /logout, /introspect, /revoke and /userinfo are limited per client IP, client_id and user with GCRA, e.g. RATELIMIT_LOGIN=ip=30/1m,client=600/1m. The buckets live in Redis when the state store does, so the limits hold across replicas, and in memory while Redis is down. Refused requests get 429 with Retry-After. Submitted device codes count against the login limits. Rejected callbacks, wrong device codes and failed client authentication on /token, /introspect and /revoke lock the source out after ratelimit.failures_free failures, for a delay that doubles with each further failure. Behind a load balancer, list it in ratelimit.trusted_proxies so X-Forwarded-For is used.
+
+Admin API:
+
+With admin.enabled=true the admin package serves a JSON API under /admin/v1, described by the OpenAPI document at /admin/v1/openapi.yaml: clients and the scopes they may request, looking up and disabling users, listing and ending sessions (grants), revoking every token of a user or client, and rotating the signing key. Callers sign in through a registered client that is allowed the admin scope and send the access token as a Bearer token; the user must be listed in admin.roles as viewer (read only), operator (also disable users and end sessions) or admin (also change clients and rotate keys). Ending a session revokes its grant, so its access and refresh tokens stop working at once, and removes its upstream tokens from the vault. Every change is written to the audit trail with the acting user, failed authentications lock the source out like failed logins, and RATELIMIT_ADMIN limits the API. Clients from oauth.clients_file are registered again on start and SIGHUP, so change those in the file.
+
+To rotate the signing key, replace tokens.signing_key_file and POST /admin/v1/keys/rotate; the previous keys stay in the JWKS and valid for verification until their tokens have expired. Rotation applies to the replica that receives the call, so call it on each one (or restart them).
+
+oauthctl:
+
+cmd/oauthctl is the command-line companion for operators. It reads the same configuration as the server (-config, CONFIG_FILE, the environment and .env) when a command needs the store, the signing key or the state store:
+
+go run ./cmd/oauthctl client create -redirect-uri https://app.example.com/cb -scope "openid email"
+go run ./cmd/oauthctl keys rotate -file "$JWT_SIGNING_KEY_FILE" -server https://auth.example.com -token "$OAUTHCTL_TOKEN"
+go run ./cmd/oauthctl token mint -sub user-1 -client orders-api -claim admin=true
+go run ./cmd/oauthctl token decode -jwks jwks.json "$TOKEN"
+go run ./cmd/oauthctl device login -server http://localhost:8080 -client-id tv-app
+go run ./cmd/oauthctl state inspect "$STATE"
+
+keys generate writes a new PKCS#8 key and keys jwks prints the public JWK Set of key files. state inspect looks an ID up under every key the server keeps in its Redis or MongoDB state store (login state, consent, authorization and device codes, vault records, opaque tokens and the revocation list) and shows the value and the time left; vault records stay sealed. Run oauthctl without arguments for the full list.
 
 JWT:
 
-A JWT token is generated using the access token and a secret key. The JWT is returned to the client for subsequent requests.
+Access tokens are signed with tokens.signing_key_file, or HS256 with tokens.secret, and encrypted when tokens.jwe_key_file is set; the upstream tokens stay in the vault and the JWT only names them. Tokens carry iss from tokens.issuer and, when tokens.audience lists resource servers, an aud naming them; both are checked whenever the server reads a token back, so a token minted for another issuer or audience is refused.
+
+Access tokens in the jwt format carry typ at+jwt (RFC 9068). /introspect and the revocation list only take JWTs of that type, so ID tokens and JWT-secured authorization responses, which are signed with the same key, are never mistaken for access tokens. Access tokens also have to name their grant_id; tokens without one are reported inactive.
 
 4. Running the Server
 To run the server:
@@ -1,3 +1,6 @@
+//go:build ignore
+
+/*
 Implementing all the points discussed for a production-grade, distributed OAuth 2.0 solution in Golang is a large-scale project. While I can't fully implement the entire system here, I can break it down into key sections and provide code snippets and architecture outlines for each of the critical components.
 
 I'll guide you through:
@@ -25,9 +28,8 @@ First, install the dependencies:
 bash
 Copy code
 go get golang.org/x/oauth2
-go get github.com/golang-jwt/jwt/v4
+go get github.com/go-jose/go-jose/v4
 go get github.com/go-redis/redis/v8
-go get github.com/dgrijalva/jwt-go
 go get github.com/go-kit/kit
 go get github.com/joho/godotenv
 You will need a basic OAuth 2.0 Authorization Server that can authenticate users, issue tokens, and validate them. For scalability and security, use JWTs (JSON Web Tokens) for stateless authentication.
@@ -44,7 +46,8 @@ import (
 	"fmt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
 	"net/http"
 	"log"
 	"time"
@@ -120,13 +123,16 @@ func handleCallback(w http.ResponseWriter, r *http.Request) {
 
 // Step 3: Generate JWT Token
 func generateJWT(secret string, accessToken string) (string, error) {
-	claims := jwt.MapClaims{
+	claims := map[string]interface{}{
 		"access_token": accessToken,
 		"exp":          time.Now().Add(time.Hour * 1).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte(secret)}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).Serialize()
 }
 
 // Step 4: Generate PKCE code verifier and code challenge
@@ -191,7 +197,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		"client_ip": r.RemoteAddr,
 		"endpoint":  "/login",
 	}).Info("User login request initiated")
-	
+
 	// Handle logic...
 }
 For monitoring, use Prometheus or any other monitoring tool to track important metrics like request rates, response times, and error rates.
@@ -235,3 +241,6 @@ Monitoring, Auditing, and Logging for operational insights.
 High Availability with auto-scaling and fault tolerance.
 
 By breaking it into modular components and addressing each aspect (security, performance, scalability), you can build a robust OAuth 2.0 solution that can support a large number of users in a production-grade distributed environment.
+*/
+
+package main
@@ -0,0 +1,301 @@
+// Package admin is the operator API of the authorization server, served
+// under /admin/v1: clients and their scopes, users, sessions (the grants a
+// login creates) and the token signing key. openapi.yaml describes it and is
+// served at /admin/v1/openapi.yaml.
+//
+// Callers present an access token of this server whose grant includes the
+// admin scope. The user behind it needs a role (viewer, operator or admin)
+// in Options.Roles; viewers can read, operators can also disable users and
+// end sessions, admins can change clients and rotate keys.
+package admin
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+// Scope is the scope an access token's grant needs for the admin API.
+const Scope = "admin"
+
+// Introspector checks access tokens; implemented by *tokens.Issuer.
+type Introspector interface {
+	Introspect(ctx context.Context, token string) (tokens.Claims, error)
+}
+
+// Vault holds the upstream tokens of sessions; implemented by *vault.Vault.
+type Vault interface {
+	Delete(ctx context.Context, ref string) error
+}
+
+// KeyRotator replaces the token signing key; implemented by
+// *tokens.RotatingCodec.
+type KeyRotator interface {
+	Rotate() (string, error)
+	KeyID() string
+	JWKS() jose.JSONWebKeySet
+}
+
+// Options are the dependencies of the API. Fields without a default are
+// required.
+type Options struct {
+	Store  storage.Store
+	Tokens Introspector
+	Vault  Vault
+	// Keys rotates the signing key. Without it /keys answers 501.
+	Keys KeyRotator
+	// Roles maps user IDs and email addresses to roles. An email address
+	// only matches users whose provider verified it.
+	Roles map[string]Role
+
+	// Audit records every change. Defaults to audit.Discard().
+	Audit *audit.Logger
+	// RateLimiter locks out callers after failed authentications (scope
+	// admin_auth) and limits the endpoint named admin. Defaults to no
+	// limits.
+	RateLimiter *ratelimit.Limiter
+}
+
+// API serves /admin/v1. Mount it with the prefix stripped:
+//
+//	mux.Handle("/admin/v1/", http.StripPrefix("/admin/v1", api))
+type API struct {
+	store   storage.Store
+	tokens  Introspector
+	vault   Vault
+	keys    KeyRotator
+	roles   map[string]Role
+	audit   *audit.Logger
+	limiter *ratelimit.Limiter
+	mux     *http.ServeMux
+}
+
+// New checks opts and returns the API with its routes registered.
+func New(opts Options) (*API, error) {
+	var errs []error
+	require := func(ok bool, name string) {
+		if !ok {
+			errs = append(errs, errors.New("admin: Options."+name+" is required"))
+		}
+	}
+	require(opts.Store != nil, "Store")
+	require(opts.Tokens != nil, "Tokens")
+	require(opts.Vault != nil, "Vault")
+	for principal, role := range opts.Roles {
+		if !role.valid() {
+			errs = append(errs, fmt.Errorf("admin: unknown role %q for %s", role, principal))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	a := &API{
+		store:   opts.Store,
+		tokens:  opts.Tokens,
+		vault:   opts.Vault,
+		keys:    opts.Keys,
+		roles:   opts.Roles,
+		audit:   opts.Audit,
+		limiter: opts.RateLimiter,
+		mux:     http.NewServeMux(),
+	}
+	if a.audit == nil {
+		a.audit = audit.Discard()
+	}
+	if a.limiter == nil {
+		a.limiter = ratelimit.New(ratelimit.Options{})
+	}
+	a.routes()
+	return a, nil
+}
+
+func (a *API) routes() {
+	a.mux.HandleFunc("GET /openapi.yaml", a.handleOpenAPI)
+
+	a.handle("GET /clients", RoleViewer, a.listClients)
+	a.handle("POST /clients", RoleAdmin, a.createClient)
+	a.handle("GET /clients/{id}", RoleViewer, a.getClient)
+	a.handle("PUT /clients/{id}", RoleAdmin, a.updateClient)
+	a.handle("DELETE /clients/{id}", RoleAdmin, a.deleteClient)
+	a.handle("POST /clients/{id}/secret", RoleAdmin, a.resetClientSecret)
+	a.handle("GET /clients/{id}/scopes", RoleViewer, a.listClientScopes)
+	a.handle("PUT /clients/{id}/scopes/{scope}", RoleAdmin, a.addClientScope)
+	a.handle("DELETE /clients/{id}/scopes/{scope}", RoleAdmin, a.removeClientScope)
+	a.handle("GET /clients/{id}/sessions", RoleViewer, a.listClientSessions)
+	a.handle("POST /clients/{id}/revoke", RoleOperator, a.revokeClient)
+
+	a.handle("GET /users/{id}", RoleViewer, a.getUser)
+	a.handle("PATCH /users/{id}", RoleOperator, a.updateUser)
+	a.handle("GET /users/{id}/sessions", RoleViewer, a.listUserSessions)
+	a.handle("POST /users/{id}/revoke", RoleOperator, a.revokeUser)
+
+	a.handle("GET /sessions/{id}", RoleViewer, a.getSession)
+	a.handle("DELETE /sessions/{id}", RoleOperator, a.deleteSession)
+
+	a.handle("GET /keys", RoleViewer, a.getKeys)
+	a.handle("POST /keys/rotate", RoleAdmin, a.rotateKeys)
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *API) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPI)
+}
+
+// apiError is the error body of every endpoint.
+type apiError struct {
+	status  int
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string { return e.Code + ": " + e.Message }
+
+func newError(status int, code, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(format string, args ...interface{}) *apiError {
+	return newError(http.StatusBadRequest, "invalid_request", format, args...)
+}
+
+// storageError maps storage errors, logging the unexpected ones.
+func storageError(what string, err error) *apiError {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return newError(http.StatusNotFound, "not_found", "%s not found", what)
+	case errors.Is(err, storage.ErrConflict):
+		return newError(http.StatusConflict, "conflict", "%s already exists", what)
+	default:
+		log.Printf("admin: %s: %v", what, err)
+		return newError(http.StatusInternalServerError, "server_error", "The request could not be completed")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var e *apiError
+	if !errors.As(err, &e) {
+		e = storageError("request", err)
+	}
+	writeJSON(w, e.status, e)
+}
+
+// readJSON decodes the request body into v, refusing unknown fields so typos
+// do not go unnoticed.
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("The request body is not valid JSON: %v", err)
+	}
+	return nil
+}
+
+// record adds an admin action to the audit trail, with the acting user in
+// Details["actor"].
+func (a *API) record(r *http.Request, action string, e *audit.Event) {
+	e.Type = audit.EventAdmin
+	e.RemoteIP = a.limiter.ClientIP(r)
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	e.Details["action"] = action
+	if c, ok := callerFrom(r.Context()); ok {
+		e.Details["actor"] = c.UserID
+		e.Details["role"] = string(c.Role)
+	}
+	if err := a.audit.Record(r.Context(), e); err != nil {
+		log.Println(err)
+	}
+}
+
+// session is a grant as the API shows it.
+type session struct {
+	ID        string     `json:"id"`
+	ClientID  string     `json:"client_id"`
+	UserID    string     `json:"user_id"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Active    bool       `json:"active"`
+}
+
+func sessionOf(g *storage.Grant, now time.Time) session {
+	scopes := g.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return session{
+		ID: g.ID, ClientID: g.ClientID, UserID: g.UserID, Scopes: scopes,
+		CreatedAt: g.CreatedAt, ExpiresAt: g.ExpiresAt, RevokedAt: g.RevokedAt,
+		Active: g.Active(now),
+	}
+}
+
+func sessionsOf(grants []*storage.Grant, activeOnly bool) []session {
+	now := time.Now()
+	out := make([]session, 0, len(grants))
+	for _, g := range grants {
+		if !activeOnly || g.Active(now) {
+			out = append(out, sessionOf(g, now))
+		}
+	}
+	return out
+}
+
+// endSession revokes a grant, which makes every access token issued under it
+// inactive, and deletes its upstream tokens.
+func (a *API) endSession(ctx context.Context, g *storage.Grant) error {
+	if err := a.store.RevokeGrant(ctx, g.ID, time.Now()); err != nil {
+		return err
+	}
+	if g.UpstreamRef != "" {
+		if err := a.vault.Delete(ctx, g.UpstreamRef); err != nil {
+			log.Println("admin: deleting upstream token:", err)
+		}
+	}
+	return nil
+}
+
+// endSessions ends the active grants among grants and returns how many.
+func (a *API) endSessions(ctx context.Context, grants []*storage.Grant) (int, error) {
+	now := time.Now()
+	n := 0
+	for _, g := range grants {
+		if !g.Active(now) {
+			continue
+		}
+		if err := a.endSession(ctx, g); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
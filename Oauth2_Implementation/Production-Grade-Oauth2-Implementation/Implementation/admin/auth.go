@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// Role is what a caller may do. Every role includes the ones before it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // read clients, users, sessions and keys
+	RoleOperator Role = "operator" // also disable users and end sessions
+	RoleAdmin    Role = "admin"    // also change clients and rotate keys
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+func (r Role) valid() bool {
+	return roleRank[r] > 0
+}
+
+// includes reports whether r may do what other may.
+func (r Role) includes(other Role) bool {
+	return roleRank[r] >= roleRank[other]
+}
+
+// ParseRoles reads "principal=role" entries, where principal is a user ID
+// or an email address, into the form of Options.Roles.
+func ParseRoles(entries []string) (map[string]Role, error) {
+	roles := make(map[string]Role, len(entries))
+	for _, e := range entries {
+		principal, role, ok := strings.Cut(e, "=")
+		principal = strings.TrimSpace(principal)
+		if !ok || principal == "" {
+			return nil, fmt.Errorf("admin: role entry %q is not principal=role", e)
+		}
+		r := Role(strings.TrimSpace(role))
+		if !r.valid() {
+			return nil, fmt.Errorf("admin: unknown role %q for %s", r, principal)
+		}
+		roles[strings.ToLower(principal)] = r
+	}
+	return roles, nil
+}
+
+// caller is the authenticated user of an admin request.
+type caller struct {
+	UserID string
+	Role   Role
+}
+
+type callerKey struct{}
+
+func callerFrom(ctx context.Context) (caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(caller)
+	return c, ok
+}
+
+// handle registers h for pattern behind authentication, requiring role.
+func (a *API) handle(pattern string, role Role, h func(http.ResponseWriter, *http.Request) error) {
+	a.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		ip := a.limiter.ClientIP(r)
+		if left := a.limiter.Penalized(r.Context(), "admin_auth", ip); left > 0 {
+			ratelimit.TooManyRequests(w, left)
+			return
+		}
+		c, err := a.authenticate(r)
+		if err != nil {
+			var e *apiError
+			if errors.As(err, &e) && e.status == http.StatusUnauthorized {
+				a.limiter.Fail(r.Context(), "admin_auth", ip)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin", error="invalid_token"`)
+			}
+			writeError(w, err)
+			return
+		}
+		a.limiter.Forgive(r.Context(), "admin_auth", ip)
+		if res := a.limiter.Allow(r.Context(), "admin", ratelimit.Keys{IP: ip, User: c.UserID}); !res.Allowed {
+			ratelimit.TooManyRequests(w, res.RetryAfter)
+			return
+		}
+		if !c.Role.includes(role) {
+			writeError(w, newError(http.StatusForbidden, "forbidden", "This needs the %s role", role))
+			return
+		}
+		if err := h(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, c))); err != nil {
+			writeError(w, err)
+		}
+	})
+}
+
+// authenticate checks the bearer token of r: it must be active, belong to a
+// live grant with the admin scope and to an enabled user with a role.
+func (a *API) authenticate(r *http.Request) (caller, error) {
+	unauthorized := newError(http.StatusUnauthorized, "invalid_token", "A valid access token with the %s scope is required", Scope)
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		return caller{}, unauthorized
+	}
+	claims, err := a.tokens.Introspect(r.Context(), raw)
+	if errors.Is(err, tokens.ErrInvalidToken) || errors.Is(err, tokens.ErrExpiredToken) {
+		return caller{}, unauthorized
+	}
+	if err != nil {
+		return caller{}, storageError("token", err)
+	}
+	grantID, _ := claims["grant_id"].(string)
+	if grantID == "" {
+		return caller{}, unauthorized
+	}
+	g, err := a.store.GetGrant(r.Context(), grantID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return caller{}, unauthorized
+	}
+	if err != nil {
+		return caller{}, storageError("grant", err)
+	}
+	if !g.Active(time.Now()) || !slices.Contains(g.Scopes, Scope) {
+		return caller{}, unauthorized
+	}
+	u, err := a.store.GetUser(r.Context(), g.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return caller{}, unauthorized
+	}
+	if err != nil {
+		return caller{}, storageError("user", err)
+	}
+	if u.Disabled {
+		return caller{}, unauthorized
+	}
+	// The callback stores only email addresses the provider verified, so
+	// an unverified address cannot claim a role
+	role, ok := a.roles[strings.ToLower(u.ID)]
+	if !ok && u.Email != "" {
+		role, ok = a.roles[strings.ToLower(u.Email)]
+	}
+	if !ok {
+		return caller{}, newError(http.StatusForbidden, "forbidden", "No admin role is assigned to this user")
+	}
+	return caller{UserID: u.ID, Role: role}, nil
+}
@@ -0,0 +1,179 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// fakeTokens maps access tokens to the grant they belong to.
+type fakeTokens map[string]string
+
+func (f fakeTokens) Introspect(_ context.Context, token string) (tokens.Claims, error) {
+	grantID, ok := f[token]
+	if !ok {
+		return nil, tokens.ErrInvalidToken
+	}
+	return tokens.Claims{"grant_id": grantID}, nil
+}
+
+type fakeVault struct{}
+
+func (fakeVault) Delete(context.Context, string) error { return nil }
+
+type testAPI struct {
+	*API
+	store  *memory.Store
+	tokens fakeTokens
+}
+
+func newTestAPI(t *testing.T, roles map[string]Role, limiter *ratelimit.Limiter) *testAPI {
+	t.Helper()
+	ta := &testAPI{store: memory.New(), tokens: fakeTokens{}}
+	api, err := New(Options{Store: ta.store, Tokens: ta.tokens, Vault: fakeVault{}, Roles: roles, RateLimiter: limiter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ta.API = api
+	return ta
+}
+
+// login creates u and returns an access token for a new grant of scopes.
+func (ta *testAPI) login(t *testing.T, u *storage.User, scopes ...string) string {
+	t.Helper()
+	if err := ta.store.UpsertUser(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return ta.grant(t, u.ID, scopes...)
+}
+
+// grant returns an access token for a new grant of scopes to userID.
+func (ta *testAPI) grant(t *testing.T, userID string, scopes ...string) string {
+	t.Helper()
+	g := &storage.Grant{ClientID: "console", UserID: userID, Scopes: scopes, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := ta.store.CreateGrant(context.Background(), g); err != nil {
+		t.Fatal(err)
+	}
+	token := "token-" + g.ID
+	ta.tokens[token] = g.ID
+	return token
+}
+
+func (ta *testAPI) do(method, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ta.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoles(t *testing.T) {
+	ta := newTestAPI(t, map[string]Role{
+		"viewer-1":             RoleViewer,
+		"operator@example.com": RoleOperator,
+		"admin-1":              RoleAdmin,
+		"disabled-1":           RoleAdmin,
+	}, nil)
+	viewer := ta.login(t, &storage.User{ID: "viewer-1", Provider: "google", Subject: "v"}, Scope)
+	operator := ta.login(t, &storage.User{ID: "operator-1", Provider: "google", Subject: "o", Email: "Operator@example.com"}, Scope)
+	admin := ta.login(t, &storage.User{ID: "admin-1", Provider: "google", Subject: "a"}, Scope)
+	nobody := ta.login(t, &storage.User{ID: "nobody-1", Provider: "google", Subject: "n", Email: "nobody@example.com"}, Scope)
+	unscoped := ta.grant(t, "admin-1", "openid")
+	disabled := ta.login(t, &storage.User{ID: "disabled-1", Provider: "google", Subject: "d"}, Scope)
+	u, _ := ta.store.GetUser(context.Background(), "disabled-1")
+	u.Disabled = true
+	if err := ta.store.UpdateUser(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+
+	// One endpoint per role; past authorization each answers something
+	// other than 401 or 403 without Keys or any stored data.
+	endpoints := []struct {
+		method, path string
+		role         Role
+	}{
+		{"GET", "/keys", RoleViewer},
+		{"DELETE", "/sessions/missing", RoleOperator},
+		{"POST", "/keys/rotate", RoleAdmin},
+	}
+	for _, tt := range []struct {
+		name  string
+		token string
+		role  Role // empty: refused everywhere with want
+		want  int
+	}{
+		{"viewer", viewer, RoleViewer, 0},
+		{"operator by email", operator, RoleOperator, 0},
+		{"admin", admin, RoleAdmin, 0},
+		{"no role", nobody, "", http.StatusForbidden},
+		{"no admin scope", unscoped, "", http.StatusUnauthorized},
+		{"disabled", disabled, "", http.StatusUnauthorized},
+		{"unknown token", "forged", "", http.StatusUnauthorized},
+		{"no token", "", "", http.StatusUnauthorized},
+	} {
+		for _, e := range endpoints {
+			got := ta.do(e.method, e.path, tt.token).Code
+			switch {
+			case tt.role == "":
+				if got != tt.want {
+					t.Errorf("%s: %s %s answered %d, want %d", tt.name, e.method, e.path, got, tt.want)
+				}
+			case tt.role.includes(e.role):
+				if got == http.StatusUnauthorized || got == http.StatusForbidden {
+					t.Errorf("%s: %s %s refused with %d", tt.name, e.method, e.path, got)
+				}
+			default:
+				if got != http.StatusForbidden {
+					t.Errorf("%s: %s %s answered %d, want 403", tt.name, e.method, e.path, got)
+				}
+			}
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	backend := ratelimit.NewMemory()
+	defer backend.Close()
+	limiter := ratelimit.New(ratelimit.Options{
+		Backend: backend,
+		Penalty: ratelimit.Penalty{Free: 2, Window: time.Minute, Delay: time.Minute},
+	})
+	ta := newTestAPI(t, map[string]Role{"admin-1": RoleAdmin}, limiter)
+	admin := ta.login(t, &storage.User{ID: "admin-1", Provider: "google", Subject: "a"}, Scope)
+
+	for i, tt := range []struct {
+		token string
+		want  int
+	}{
+		{"forged", http.StatusUnauthorized},
+		{"forged", http.StatusUnauthorized},
+		// A success forgives the failures before it
+		{admin, http.StatusNotImplemented},
+		{"forged", http.StatusUnauthorized},
+		{"forged", http.StatusUnauthorized},
+		{"forged", http.StatusUnauthorized}, // third failure: locked out
+		{"forged", http.StatusTooManyRequests},
+		// The lockout holds even for a valid token
+		{admin, http.StatusTooManyRequests},
+	} {
+		w := ta.do("GET", "/keys", tt.token)
+		if w.Code != tt.want {
+			t.Fatalf("request %d: got %d, want %d", i+1, w.Code, tt.want)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("request %d: 401 without WWW-Authenticate", i+1)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: 429 without Retry-After", i+1)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// clientView is a client as the API shows and accepts it. The secret only
+// appears in the response that created or reset it.
+type clientView struct {
+	ID                    string          `json:"client_id"`
+	Secret                string          `json:"client_secret,omitempty"`
+	Name                  string          `json:"name"`
+	Public                bool            `json:"public"`
+	RedirectURIs          []string        `json:"redirect_uris"`
+	Scopes                []string        `json:"scopes"`
+	AccessTokenFormat     string          `json:"access_token_format"`
+	AccessTokenTTL        string          `json:"access_token_ttl"`
+	AllowPlainPKCE        bool            `json:"allow_plain_pkce"`
+	LegacyFlows           bool            `json:"legacy_flows"`
+	ResponseEncryptionKey json.RawMessage `json:"response_encryption_key,omitempty"`
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+func viewClient(c *storage.Client) clientView {
+	return clientView{
+		ID:                    c.ID,
+		Name:                  c.Name,
+		Public:                c.Public(),
+		RedirectURIs:          nonNil(c.RedirectURIs),
+		Scopes:                nonNil(c.Scopes),
+		AccessTokenFormat:     c.AccessTokenFormat,
+		AccessTokenTTL:        c.AccessTokenTTL.String(),
+		AllowPlainPKCE:        c.AllowPlainPKCE,
+		LegacyFlows:           c.LegacyFlows,
+		ResponseEncryptionKey: json.RawMessage(c.ResponseEncryptionKey),
+		CreatedAt:             c.CreatedAt,
+		UpdatedAt:             c.UpdatedAt,
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// clientInput is the body of POST /clients and PUT /clients/{id}.
+type clientInput struct {
+	ID                    string          `json:"client_id"`
+	Name                  string          `json:"name"`
+	Public                bool            `json:"public"`
+	RedirectURIs          []string        `json:"redirect_uris"`
+	Scopes                []string        `json:"scopes"`
+	AccessTokenFormat     string          `json:"access_token_format"`
+	AccessTokenTTL        string          `json:"access_token_ttl"`
+	AllowPlainPKCE        bool            `json:"allow_plain_pkce"`
+	LegacyFlows           bool            `json:"legacy_flows"`
+	ResponseEncryptionKey json.RawMessage `json:"response_encryption_key"`
+}
+
+// apply checks in and copies it onto c.
+func (in *clientInput) apply(c *storage.Client) error {
+	if len(in.RedirectURIs) == 0 {
+		return badRequest("redirect_uris must not be empty")
+	}
+	for _, u := range in.RedirectURIs {
+		if err := storage.CheckRedirectURI(u); err != nil {
+			return badRequest("redirect_uris: %v", err)
+		}
+	}
+	for _, s := range in.Scopes {
+		if !validScope(s) {
+			return badRequest("scopes: %q is not a valid scope", s)
+		}
+	}
+	format, err := tokens.ParseFormat(in.AccessTokenFormat)
+	if err != nil {
+		return badRequest("access_token_format: %v", err)
+	}
+	ttl := time.Hour
+	if in.AccessTokenTTL != "" {
+		if ttl, err = time.ParseDuration(in.AccessTokenTTL); err != nil || ttl <= 0 {
+			return badRequest("access_token_ttl: %q is not a positive duration", in.AccessTokenTTL)
+		}
+	}
+	var encKey string
+	if len(in.ResponseEncryptionKey) > 0 && string(in.ResponseEncryptionKey) != "null" {
+		if _, err := tokens.ParseEncryptionJWK(in.ResponseEncryptionKey); err != nil {
+			return badRequest("response_encryption_key: %v", err)
+		}
+		encKey = string(in.ResponseEncryptionKey)
+	}
+	c.Name = in.Name
+	c.RedirectURIs = in.RedirectURIs
+	c.Scopes = dedupe(in.Scopes)
+	c.AccessTokenFormat = string(format)
+	c.AccessTokenTTL = ttl
+	c.AllowPlainPKCE = in.AllowPlainPKCE
+	c.LegacyFlows = in.LegacyFlows
+	c.ResponseEncryptionKey = encKey
+	return nil
+}
+
+// validScope reports whether s is a scope-token of RFC 6749 section 3.3.
+func validScope(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x21 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func dedupe(s []string) []string {
+	out := make([]string, 0, len(s))
+	for _, v := range s {
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// newSecret returns a client secret with 256 bits of entropy, the strength
+// storage.HashSecret assumes.
+func newSecret() (string, error) {
+	return cryptoutil.Token(32)
+}
+
+func (a *API) listClients(w http.ResponseWriter, r *http.Request) error {
+	clients, err := a.store.ListClients(r.Context())
+	if err != nil {
+		return storageError("clients", err)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	out := make([]clientView, len(clients))
+	for i, c := range clients {
+		out[i] = viewClient(c)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"clients": out})
+	return nil
+}
+
+func (a *API) createClient(w http.ResponseWriter, r *http.Request) error {
+	var in clientInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if in.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		in.ID = newID
+	}
+	if !validScope(in.ID) {
+		return badRequest("client_id: %q contains invalid characters", in.ID)
+	}
+	c := &storage.Client{ID: in.ID}
+	if err := in.apply(c); err != nil {
+		return err
+	}
+	var secret string
+	if !in.Public {
+		var err error
+		if secret, err = newSecret(); err != nil {
+			return err
+		}
+		c.SecretHash = storage.HashSecret(secret)
+	}
+	if err := a.store.CreateClient(r.Context(), c); err != nil {
+		return storageError("client "+c.ID, err)
+	}
+	a.record(r, "client.created", &audit.Event{Outcome: audit.OutcomeSuccess, ClientID: c.ID, Scopes: c.Scopes})
+	view := viewClient(c)
+	view.Secret = secret
+	w.Header().Set("Location", "/admin/v1/clients/"+url.PathEscape(c.ID))
+	writeJSON(w, http.StatusCreated, view)
+	return nil
+}
+
+func (a *API) getClient(w http.ResponseWriter, r *http.Request) error {
+	c, err := a.store.GetClient(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("client", err)
+	}
+	writeJSON(w, http.StatusOK, viewClient(c))
+	return nil
+}
+
+// updateClient replaces the settings of a client. Its secret and whether it
+// is public stay as they are; POST /clients/{id}/secret changes the secret.
+func (a *API) updateClient(w http.ResponseWriter, r *http.Request) error {
+	var in clientInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	c, err := a.store.GetClient(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("client", err)
+	}
+	if in.ID != "" && in.ID != c.ID {
+		return badRequest("client_id cannot be changed")
+	}
+	if in.Public != c.Public() {
+		return badRequest("public cannot be changed; create a new client instead")
+	}
+	if err := in.apply(c); err != nil {
+		return err
+	}
+	if err := a.store.UpdateClient(r.Context(), c); err != nil {
+		return storageError("client", err)
+	}
+	a.record(r, "client.updated", &audit.Event{Outcome: audit.OutcomeSuccess, ClientID: c.ID, Scopes: c.Scopes})
+	writeJSON(w, http.StatusOK, viewClient(c))
+	return nil
+}
+
+// deleteClient removes a client and ends its sessions, so tokens it already
+// holds stop working too.
+func (a *API) deleteClient(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if _, err := a.store.GetClient(r.Context(), id); err != nil {
+		return storageError("client", err)
+	}
+	grants, err := a.store.ListGrantsByClient(r.Context(), id)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	n, err := a.endSessions(r.Context(), grants)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	if err := a.store.DeleteClient(r.Context(), id); err != nil {
+		return storageError("client", err)
+	}
+	a.record(r, "client.deleted", &audit.Event{
+		Outcome: audit.OutcomeSuccess, ClientID: id,
+		Details: map[string]string{"sessions_revoked": strconv.Itoa(n)},
+	})
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (a *API) resetClientSecret(w http.ResponseWriter, r *http.Request) error {
+	c, err := a.store.GetClient(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("client", err)
+	}
+	if c.Public() {
+		return newError(http.StatusConflict, "public_client", "Public clients have no secret")
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	c.SecretHash = storage.HashSecret(secret)
+	if err := a.store.UpdateClient(r.Context(), c); err != nil {
+		return storageError("client", err)
+	}
+	a.record(r, "client.secret_reset", &audit.Event{Outcome: audit.OutcomeSuccess, ClientID: c.ID})
+	writeJSON(w, http.StatusOK, map[string]string{"client_id": c.ID, "client_secret": secret})
+	return nil
+}
+
+func (a *API) listClientScopes(w http.ResponseWriter, r *http.Request) error {
+	c, err := a.store.GetClient(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("client", err)
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"scopes": nonNil(c.Scopes)})
+	return nil
+}
+
+// addClientScope allows the client to request scope. Adding a scope the
+// client already has is not an error.
+func (a *API) addClientScope(w http.ResponseWriter, r *http.Request) error {
+	return a.changeClientScope(w, r, true)
+}
+
+// removeClientScope takes scope away from the client. Sessions that were
+// granted it keep it until they end.
+func (a *API) removeClientScope(w http.ResponseWriter, r *http.Request) error {
+	return a.changeClientScope(w, r, false)
+}
+
+func (a *API) changeClientScope(w http.ResponseWriter, r *http.Request, add bool) error {
+	scope := r.PathValue("scope")
+	if !validScope(scope) {
+		return badRequest("%q is not a valid scope", scope)
+	}
+	c, err := a.store.GetClient(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("client", err)
+	}
+	has := slices.Contains(c.Scopes, scope)
+	if has != add {
+		if add {
+			c.Scopes = append(c.Scopes, scope)
+		} else {
+			c.Scopes = slices.DeleteFunc(c.Scopes, func(s string) bool { return s == scope })
+		}
+		if err := a.store.UpdateClient(r.Context(), c); err != nil {
+			return storageError("client", err)
+		}
+		action := "client.scope_removed"
+		if add {
+			action = "client.scope_added"
+		}
+		a.record(r, action, &audit.Event{Outcome: audit.OutcomeSuccess, ClientID: c.ID, Scopes: []string{scope}})
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"scopes": nonNil(c.Scopes)})
+	return nil
+}
+
+func (a *API) listClientSessions(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if _, err := a.store.GetClient(r.Context(), id); err != nil {
+		return storageError("client", err)
+	}
+	grants, err := a.store.ListGrantsByClient(r.Context(), id)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessionsOf(grants, activeOnly(r))})
+	return nil
+}
+
+// revokeClient ends every session of the client, which revokes all tokens
+// issued to it. The client itself stays registered.
+func (a *API) revokeClient(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if _, err := a.store.GetClient(r.Context(), id); err != nil {
+		return storageError("client", err)
+	}
+	grants, err := a.store.ListGrantsByClient(r.Context(), id)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	n, err := a.endSessions(r.Context(), grants)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	a.record(r, "client.tokens_revoked", &audit.Event{
+		Outcome: audit.OutcomeSuccess, ClientID: id,
+		Details: map[string]string{"sessions_revoked": strconv.Itoa(n)},
+	})
+	writeJSON(w, http.StatusOK, map[string]int{"sessions_revoked": n})
+	return nil
+}
+
+// activeOnly reports whether the listing should leave out ended sessions,
+// which it does unless ?all=true is given.
+func activeOnly(r *http.Request) bool {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	return !all
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+var errNoKeys = newError(http.StatusNotImplemented, "not_supported", "Signing keys are not managed by this server")
+
+// getKeys shows the current key ID and the public keys tokens are verified
+// with, which after a rotation include the previous ones.
+func (a *API) getKeys(w http.ResponseWriter, r *http.Request) error {
+	if a.keys == nil {
+		return errNoKeys
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"current_kid": a.keys.KeyID(),
+		"jwks":        a.keys.JWKS(),
+	})
+	return nil
+}
+
+// rotateKeys makes the server sign with the key now in its key source.
+// Operators put the new key in place first, then call this.
+func (a *API) rotateKeys(w http.ResponseWriter, r *http.Request) error {
+	if a.keys == nil {
+		return errNoKeys
+	}
+	prev := a.keys.KeyID()
+	kid, err := a.keys.Rotate()
+	if errors.Is(err, tokens.ErrKeyUnchanged) {
+		return newError(http.StatusConflict, "key_unchanged", "The key source still holds the current key %s", prev)
+	}
+	if err != nil {
+		log.Println("admin: rotating signing key:", err)
+		a.record(r, "keys.rotated", &audit.Event{Outcome: audit.OutcomeFailure, Details: map[string]string{"error": err.Error()}})
+		return newError(http.StatusInternalServerError, "server_error", "The signing key could not be loaded")
+	}
+	a.record(r, "keys.rotated", &audit.Event{
+		Outcome: audit.OutcomeSuccess,
+		Details: map[string]string{"previous_kid": prev, "kid": kid},
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"previous_kid": prev, "current_kid": kid})
+	return nil
+}
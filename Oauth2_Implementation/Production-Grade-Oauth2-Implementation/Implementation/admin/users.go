@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// userView is a user as the API shows it.
+type userView struct {
+	ID          string    `json:"id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func viewUser(u *storage.User) userView {
+	return userView{
+		ID: u.ID, Provider: u.Provider, Subject: u.Subject, Email: u.Email, Name: u.Name,
+		Disabled: u.Disabled, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt, LastLoginAt: u.LastLoginAt,
+	}
+}
+
+func (a *API) getUser(w http.ResponseWriter, r *http.Request) error {
+	u, err := a.store.GetUser(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("user", err)
+	}
+	writeJSON(w, http.StatusOK, viewUser(u))
+	return nil
+}
+
+// updateUser enables or disables a user. Disabling also ends the user's
+// sessions; a disabled user cannot log in again.
+func (a *API) updateUser(w http.ResponseWriter, r *http.Request) error {
+	var in struct {
+		Disabled *bool `json:"disabled"`
+	}
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if in.Disabled == nil {
+		return badRequest("disabled is required")
+	}
+	u, err := a.store.GetUser(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("user", err)
+	}
+	if c, _ := callerFrom(r.Context()); *in.Disabled && c.UserID == u.ID {
+		return newError(http.StatusConflict, "self_disable", "You cannot disable yourself")
+	}
+	if u.Disabled != *in.Disabled {
+		u.Disabled = *in.Disabled
+		if err := a.store.UpdateUser(r.Context(), u); err != nil {
+			return storageError("user", err)
+		}
+		e := &audit.Event{Outcome: audit.OutcomeSuccess, UserID: u.ID}
+		if u.Disabled {
+			grants, err := a.store.ListGrantsByUser(r.Context(), u.ID)
+			if err != nil {
+				return storageError("sessions", err)
+			}
+			n, err := a.endSessions(r.Context(), grants)
+			if err != nil {
+				return storageError("sessions", err)
+			}
+			e.Details = map[string]string{"sessions_revoked": strconv.Itoa(n)}
+			a.record(r, "user.disabled", e)
+		} else {
+			a.record(r, "user.enabled", e)
+		}
+	}
+	writeJSON(w, http.StatusOK, viewUser(u))
+	return nil
+}
+
+func (a *API) listUserSessions(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if _, err := a.store.GetUser(r.Context(), id); err != nil {
+		return storageError("user", err)
+	}
+	grants, err := a.store.ListGrantsByUser(r.Context(), id)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessionsOf(grants, activeOnly(r))})
+	return nil
+}
+
+// revokeUser ends every session of the user, which revokes all tokens issued
+// for them. The user can log in again.
+func (a *API) revokeUser(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if _, err := a.store.GetUser(r.Context(), id); err != nil {
+		return storageError("user", err)
+	}
+	grants, err := a.store.ListGrantsByUser(r.Context(), id)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	n, err := a.endSessions(r.Context(), grants)
+	if err != nil {
+		return storageError("sessions", err)
+	}
+	a.record(r, "user.tokens_revoked", &audit.Event{
+		Outcome: audit.OutcomeSuccess, UserID: id,
+		Details: map[string]string{"sessions_revoked": strconv.Itoa(n)},
+	})
+	writeJSON(w, http.StatusOK, map[string]int{"sessions_revoked": n})
+	return nil
+}
+
+func (a *API) getSession(w http.ResponseWriter, r *http.Request) error {
+	g, err := a.store.GetGrant(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("session", err)
+	}
+	writeJSON(w, http.StatusOK, sessionOf(g, time.Now()))
+	return nil
+}
+
+// deleteSession ends one session. Ending a session that already ended is not
+// an error.
+func (a *API) deleteSession(w http.ResponseWriter, r *http.Request) error {
+	g, err := a.store.GetGrant(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return storageError("session", err)
+	}
+	if g.Active(time.Now()) {
+		if err := a.endSession(r.Context(), g); err != nil {
+			return storageError("session", err)
+		}
+		a.record(r, "session.revoked", &audit.Event{
+			Outcome: audit.OutcomeSuccess, UserID: g.UserID, ClientID: g.ClientID,
+			Details: map[string]string{"grant_id": g.ID},
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package audit writes the security audit trail: who logged in, which client
+// got which scopes, which tokens were issued and revoked, and what operators
+// changed. Events are JSON lines, and every record carries the hash of the
+// previous one, so editing, removing or reordering records breaks the chain
+// and is found by Verify.
+//
+// Without a key the hashes are plain SHA-256 and only catch accidents:
+// anyone who can write the file can recompute every hash after an edit. With
+// a key they are HMAC-SHA256, so someone who can write the file but does not
+// know the key cannot rebuild a valid chain after tampering.
+//
+// The chain cannot show what came before its first record in a file, since
+// Verify accepts files starting mid-chain (after rotation). Records cut off
+// the start or the end of a file are only found by comparing with a hash
+// kept elsewhere, such as Summary.Head of the previous check.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	EventLogin          = "login"           // a user completed (or failed) the login
+	EventLogout         = "logout"          // a user revoked their token through /logout
+	EventConsentGranted = "consent.granted" // a user granted a client scopes
+	EventConsentDenied  = "consent.denied"  // a user refused a client on the consent page
+	EventTokenIssued    = "token.issued"    // an access token was issued
+	EventTokenRefreshed = "token.refreshed" // a refresh token was redeemed
+	EventTokenRevoked   = "token.revoked"   // a token was revoked through /revoke
+	EventAdmin          = "admin"           // an operator changed clients or settings; see Details["action"]
+)
+
+// Outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is one audit record. Seq, Time, PrevHash and Hash are filled in by
+// Logger.Record.
+type Event struct {
+	Seq      uint64            `json:"seq"`
+	Time     time.Time         `json:"time"`
+	Type     string            `json:"type"`
+	Outcome  string            `json:"outcome"`
+	UserID   string            `json:"user_id,omitempty"`
+	ClientID string            `json:"client_id,omitempty"`
+	RemoteIP string            `json:"remote_ip,omitempty"`
+	Scopes   []string          `json:"scopes,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	PrevHash string            `json:"prev_hash"`
+	Hash     string            `json:"hash"`
+}
+
+// digest hashes every field but Hash. encoding/json writes struct fields in
+// declaration order and map keys sorted, so the encoding is stable.
+func (e Event) digest(key []byte) (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Sink stores audit records. Write is called with the records in chain
+// order and never concurrently.
+type Sink interface {
+	Write(ctx context.Context, e *Event) error
+	Close() error
+}
+
+// Options configure a Logger.
+type Options struct {
+	// Sinks receive every record. Without sinks nothing is kept.
+	Sinks []Sink
+	// Key turns the hashes into HMACs. Verify needs the same key.
+	Key []byte
+	// Last is the newest record already written, to continue its chain
+	// after a restart (see LastInFile). Nil starts a new chain.
+	Last *Event
+}
+
+// Logger chains events and hands them to the sinks.
+type Logger struct {
+	sinks []Sink
+	key   []byte
+
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+}
+
+// New returns a Logger continuing the chain after opts.Last.
+func New(opts Options) *Logger {
+	l := &Logger{sinks: opts.Sinks, key: opts.Key}
+	if opts.Last != nil {
+		l.seq, l.prev = opts.Last.Seq, opts.Last.Hash
+	}
+	return l
+}
+
+// Discard returns a Logger without sinks.
+func Discard() *Logger {
+	return New(Options{})
+}
+
+// Record completes e and writes it to every sink. Records are chained in
+// the order Record is called. An error means at least one sink missed the
+// record; the others still have it.
+func (l *Logger) Record(ctx context.Context, e *Event) error {
+	if len(l.sinks) == 0 {
+		return nil
+	}
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UTC()
+	e.PrevHash = l.prev
+	hash, err := e.digest(l.key)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	e.Hash = hash
+	l.seq, l.prev = e.Seq, e.Hash
+
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Write(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("audit: record %d: %w", e.Seq, err)
+	}
+	return nil
+}
+
+// Close closes the sinks.
+func (l *Logger) Close() error {
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
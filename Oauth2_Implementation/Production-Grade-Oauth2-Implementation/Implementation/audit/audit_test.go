@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// chain records n events and returns them as JSON lines.
+func chain(t *testing.T, key []byte, n int) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	l := New(Options{Sinks: []Sink{NewWriterSink(&buf)}, Key: key})
+	for i := 0; i < n; i++ {
+		e := &Event{Type: EventLogin, UserID: "u" + string(rune('a'+i))}
+		if err := l.Record(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func verify(lines []string, key []byte) (Summary, error) {
+	return Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), key)
+}
+
+func TestVerify(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	lines := chain(t, key, 4)
+
+	sum, err := verify(lines, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Records != 4 || sum.Chains != 1 {
+		t.Errorf("got %+v", sum)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		lines []string
+		key   []byte
+		line  int // of the ChainError
+	}{
+		{"edited", []string{lines[0], strings.Replace(lines[1], `"ub"`, `"ux"`, 1), lines[2], lines[3]}, key, 2},
+		{"outcome changed", []string{lines[0], lines[1], strings.Replace(lines[2], `"success"`, `"failure"`, 1), lines[3]}, key, 3},
+		{"deleted", []string{lines[0], lines[2], lines[3]}, key, 2},
+		{"reordered", []string{lines[0], lines[2], lines[1], lines[3]}, key, 2},
+		{"duplicated", []string{lines[0], lines[1], lines[1], lines[2]}, key, 3},
+		{"wrong key", lines, bytes.Repeat([]byte{8}, 32), 1},
+		{"no key", lines, nil, 1},
+		{"not JSON", []string{lines[0], "{", lines[1]}, key, 2},
+	} {
+		_, err := verify(tt.lines, tt.key)
+		var ce *ChainError
+		if !errors.As(err, &ce) {
+			t.Errorf("%s: got %v, want a ChainError", tt.name, err)
+			continue
+		}
+		if ce.Line != tt.line {
+			t.Errorf("%s: reported line %d, want %d: %v", tt.name, ce.Line, tt.line, err)
+		}
+	}
+}
+
+// TestVerifyRebuiltChain shows what the key is for: without it whoever
+// edits a record can recompute every hash after it.
+func TestVerifyRebuiltChain(t *testing.T) {
+	for _, key := range [][]byte{nil, bytes.Repeat([]byte{7}, 32)} {
+		var buf bytes.Buffer
+		l := New(Options{Sinks: []Sink{NewWriterSink(&buf)}, Key: key})
+		ctx := context.Background()
+		for _, user := range []string{"alice", "mallory", "bob"} {
+			if err := l.Record(ctx, &Event{Type: EventLogin, UserID: user}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The forger drops mallory's record and rehashes the rest
+		// without the key.
+		var out bytes.Buffer
+		forged := New(Options{Sinks: []Sink{NewWriterSink(&out)}})
+		for _, user := range []string{"alice", "bob"} {
+			if err := forged.Record(ctx, &Event{Type: EventLogin, UserID: user}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := Verify(&out, key)
+		if key == nil && err != nil {
+			t.Errorf("without a key the rebuilt chain should pass: %v", err)
+		}
+		if key != nil && err == nil {
+			t.Error("with a key the rebuilt chain passed")
+		}
+	}
+}
+
+func TestVerifyTruncation(t *testing.T) {
+	lines := chain(t, nil, 4)
+	full, err := verify(lines, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file starting mid-chain is accepted, as after rotation, so
+	// records cut off the start are not found by Verify alone.
+	sum, err := verify(lines[2:], nil)
+	if err != nil {
+		t.Fatalf("mid-chain start refused: %v", err)
+	}
+	if sum.Records != 2 || sum.Head != full.Head {
+		t.Errorf("got %+v", sum)
+	}
+
+	// Records cut off the end only show in the head hash.
+	sum, err = verify(lines[:3], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Head == full.Head {
+		t.Error("head unchanged after truncation")
+	}
+}
+
+func TestLoggerContinuesChain(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(Options{Sinks: []Sink{NewWriterSink(&buf)}})
+	first := &Event{Type: EventLogin}
+	if err := l.Record(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	// A restart continues after the last record.
+	l = New(Options{Sinks: []Sink{NewWriterSink(&buf)}, Last: first})
+	if err := l.Record(context.Background(), &Event{Type: EventLogout}); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Verify(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Records != 2 || sum.Chains != 1 {
+		t.Errorf("got %+v", sum)
+	}
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+var (
+	_ Sink = (*WriterSink)(nil)
+	_ Sink = (*FileSink)(nil)
+	_ Sink = (*StoreSink)(nil)
+)
+
+// WriterSink writes JSON lines to w, e.g. os.Stdout for a log collector.
+// Close does not close w.
+type WriterSink struct {
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(_ context.Context, e *Event) error {
+	return json.NewEncoder(s.w).Encode(e)
+}
+
+func (s *WriterSink) Close() error { return nil }
+
+// FileSink appends JSON lines to a file and syncs after every record, so an
+// acknowledged record survives a crash.
+type FileSink struct {
+	f *os.File
+}
+
+// NewFileSink opens path for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// LastInFile returns the last record of a JSON lines file, or nil when the
+// file does not exist or is empty.
+func LastInFile(path string) (*Event, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	defer f.Close()
+
+	var last []byte
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxLine)
+	for sc.Scan() {
+		if len(sc.Bytes()) > 0 {
+			last = append(last[:0], sc.Bytes()...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("audit: reading %s: %w", path, err)
+	}
+	if last == nil {
+		return nil, nil
+	}
+	var e Event
+	if err := json.Unmarshal(last, &e); err != nil {
+		return nil, fmt.Errorf("audit: last record of %s: %w", path, err)
+	}
+	return &e, nil
+}
+
+// StoreSink appends the records to a storage backend's audit trail. The
+// chain fields and scopes go into Details, next to the event's own.
+type StoreSink struct {
+	store storage.AuditStore
+}
+
+func NewStoreSink(store storage.AuditStore) *StoreSink {
+	return &StoreSink{store: store}
+}
+
+func (s *StoreSink) Write(ctx context.Context, e *Event) error {
+	details := make(map[string]string, len(e.Details)+4)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details["seq"] = strconv.FormatUint(e.Seq, 10)
+	details["outcome"] = e.Outcome
+	details["prev_hash"] = e.PrevHash
+	details["hash"] = e.Hash
+	if len(e.Scopes) > 0 {
+		b, _ := json.Marshal(e.Scopes)
+		details["scopes"] = string(b)
+	}
+	return s.store.AppendAuditEvent(ctx, &storage.AuditEvent{
+		Time:     e.Time,
+		Type:     e.Type,
+		UserID:   e.UserID,
+		ClientID: e.ClientID,
+		RemoteIP: e.RemoteIP,
+		Details:  details,
+	})
+}
+
+func (s *StoreSink) Close() error { return nil }
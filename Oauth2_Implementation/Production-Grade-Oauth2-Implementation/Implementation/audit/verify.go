@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxLine bounds a single record when reading a file.
+const maxLine = 1 << 20
+
+// Summary describes a verified audit file.
+type Summary struct {
+	Records int
+	// Chains counts the chains in the file. Every chain but the first
+	// starts at sequence 1, i.e. the logger was started without the
+	// previous record.
+	Chains int
+	// Head is the hash of the last record. Keeping it elsewhere also
+	// detects records cut off the end.
+	Head string
+}
+
+// ChainError reports the first record that does not belong in the chain.
+type ChainError struct {
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit: line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// Verify reads JSON lines from r and checks every hash and link. key must
+// be the Logger's key, nil for plain SHA-256. The first record may continue
+// a chain from an earlier file, so removing records from the start of the
+// file goes unnoticed; so does removing them from the end unless Head is
+// compared with an earlier value.
+func Verify(r io.Reader, key []byte) (Summary, error) {
+	var (
+		sum  Summary
+		prev *Event
+		line int
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLine)
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return sum, &ChainError{Line: line, Reason: "not a record: " + err.Error()}
+		}
+		fail := func(format string, args ...interface{}) (Summary, error) {
+			return sum, &ChainError{Line: line, Seq: e.Seq, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		want, err := e.digest(key)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if e.Hash != want {
+			return fail("hash mismatch, the record was modified or the key is wrong")
+		}
+		switch {
+		case e.Seq == 1 && e.PrevHash == "":
+			sum.Chains++
+		case prev == nil:
+			// The file starts inside a chain, e.g. after rotation; only
+			// the links from here on can be checked.
+			sum.Chains++
+		case e.Seq != prev.Seq+1:
+			return fail("expected seq %d, records are missing or reordered", prev.Seq+1)
+		case e.PrevHash != prev.Hash:
+			return fail("prev_hash does not match the hash of seq %d", prev.Seq)
+		}
+		sum.Records++
+		sum.Head = e.Hash
+		prev = &e
+	}
+	if err := sc.Err(); err != nil {
+		return sum, fmt.Errorf("audit: line %d: %w", line+1, err)
+	}
+	return sum, nil
+}
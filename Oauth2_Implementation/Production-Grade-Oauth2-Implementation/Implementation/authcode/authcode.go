@@ -0,0 +1,124 @@
+// Package authcode keeps the authorization codes we issue to our own clients
+// between the redirect from /callback and their /token request. A code can be
+// redeemed exactly once; redeeming it again reports the grant it was issued
+// for, so that grant can be revoked (RFC 6749 section 4.1.2).
+package authcode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var (
+	ErrInvalid  = errors.New("authcode: code expired or unknown")
+	ErrReplayed = errors.New("authcode: code already redeemed")
+)
+
+// Key prefixes in the state store: codes waiting to be redeemed, and the
+// grant IDs of redeemed ones, kept to revoke the grant on a replay. Neither
+// is a prefix of the other.
+const (
+	KeyPrefix  = "authcode:code:"
+	UsedPrefix = "authcode:used:"
+)
+
+// Code is what an authorization code stands for.
+type Code struct {
+	ClientID string `json:"client_id"`
+	// RedirectURI is the redirect_uri of the authorization request, empty
+	// if the client left it out and the registered one was used.
+	RedirectURI string                 `json:"redirect_uri,omitempty"`
+	UserID      string                 `json:"user_id"`
+	GrantID     string                 `json:"grant_id"`
+	Scopes      []string               `json:"scopes,omitempty"`
+	UpstreamRef string                 `json:"upstream_ref"`
+	User        map[string]interface{} `json:"user,omitempty"`
+
+	// CodeChallenge and CodeChallengeMethod bind the code to the PKCE
+	// challenge of the authorization request; empty if it had none.
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+
+	// IDToken is set for codes of a hybrid response that carried an ID
+	// token; the token response then has one as well, with the client's
+	// Nonce (OpenID Connect Core section 3.3.3.8).
+	IDToken bool   `json:"id_token,omitempty"`
+	Nonce   string `json:"nonce,omitempty"`
+}
+
+// Store keeps codes in the state store for ttl.
+type Store struct {
+	kv  state.Store
+	ttl time.Duration
+}
+
+func NewStore(kv state.Store, ttl time.Duration) *Store {
+	return &Store{kv: kv, ttl: ttl}
+}
+
+// Issue stores c under a new random code and returns the code.
+func (s *Store) Issue(ctx context.Context, c Code) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	code, err := cryptoutil.Token(32)
+	if err != nil {
+		return "", fmt.Errorf("authcode: %w", err)
+	}
+	if err := s.kv.Set(ctx, KeyPrefix+code, b, s.ttl); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Redeem returns the Code behind code and deletes it. It fails with
+// ErrInvalid for an unknown or expired code, and with ErrReplayed for a code
+// that was already redeemed; the returned Code then only has GrantID set.
+//
+// The "used" marker is written before the code is deleted, so a failure in
+// between leaves the code redeemable rather than a replay unrecognized. It
+// outlives the code by its TTL, long enough for a replay by whoever
+// intercepted the code to be recognized. GETDEL picks the single winner
+// among concurrent redemptions; the others are replays.
+func (s *Store) Redeem(ctx context.Context, code string) (Code, error) {
+	var c Code
+	b, err := s.kv.Get(ctx, KeyPrefix+code)
+	if err == state.ErrNotFound {
+		return s.replayed(ctx, code)
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("authcode: decoding code: %w", err)
+	}
+	if err := s.kv.Set(ctx, UsedPrefix+code, []byte(c.GrantID), 2*s.ttl); err != nil {
+		return Code{}, err
+	}
+	if _, err := s.kv.GetDel(ctx, KeyPrefix+code); err == state.ErrNotFound {
+		return s.replayed(ctx, code)
+	} else if err != nil {
+		return Code{}, err
+	}
+	return c, nil
+}
+
+// replayed reports a code that is gone: ErrReplayed with its grant if it
+// was redeemed, ErrInvalid otherwise.
+func (s *Store) replayed(ctx context.Context, code string) (Code, error) {
+	grantID, err := s.kv.Get(ctx, UsedPrefix+code)
+	if err == state.ErrNotFound {
+		return Code{}, ErrInvalid
+	}
+	if err != nil {
+		return Code{}, err
+	}
+	return Code{GrantID: string(grantID)}, ErrReplayed
+}
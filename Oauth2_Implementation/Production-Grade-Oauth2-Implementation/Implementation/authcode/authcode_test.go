@@ -0,0 +1,103 @@
+package authcode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+func TestRedeem(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(memory.New(), time.Minute)
+	code, err := s.Issue(ctx, Code{ClientID: "web", GrantID: "g1", CodeChallenge: "ch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Redeem(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ClientID != "web" || c.GrantID != "g1" || c.CodeChallenge != "ch" {
+		t.Errorf("got %+v", c)
+	}
+
+	c, err = s.Redeem(ctx, code)
+	if !errors.Is(err, ErrReplayed) || c.GrantID != "g1" {
+		t.Errorf("replay: got %+v, %v; want ErrReplayed with grant g1", c, err)
+	}
+	if _, err := s.Redeem(ctx, "unknown"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown code: got %v, want ErrInvalid", err)
+	}
+}
+
+func TestRedeemOnce(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(memory.New(), time.Minute)
+	code, err := s.Issue(ctx, Code{GrantID: "g1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg              sync.WaitGroup
+		mu              sync.Mutex
+		wins, replayeds int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.Redeem(ctx, code)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				wins++
+			case errors.Is(err, ErrReplayed) && c.GrantID == "g1":
+				replayeds++
+			default:
+				t.Errorf("got %+v, %v", c, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins != 1 || replayeds != 19 {
+		t.Errorf("%d redemptions and %d replays", wins, replayeds)
+	}
+}
+
+// failingGetDel loses the connection when the code is deleted.
+type failingGetDel struct {
+	state.Store
+}
+
+func (failingGetDel) GetDel(context.Context, string) ([]byte, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestRedeemMarksBeforeDeleting(t *testing.T) {
+	ctx := context.Background()
+	kv := memory.New()
+	code, err := NewStore(kv, time.Minute).Issue(ctx, Code{GrantID: "g1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(failingGetDel{kv}, time.Minute).Redeem(ctx, code); err == nil {
+		t.Fatal("redeemed without deleting the code")
+	}
+	if grantID, err := kv.Get(ctx, UsedPrefix+code); err != nil || string(grantID) != "g1" {
+		t.Errorf("used marker: %q, %v", grantID, err)
+	}
+}
+
+func TestPrefixesDisjoint(t *testing.T) {
+	if strings.HasPrefix(UsedPrefix, KeyPrefix) || strings.HasPrefix(KeyPrefix, UsedPrefix) {
+		t.Errorf("%q and %q overlap", KeyPrefix, UsedPrefix)
+	}
+}
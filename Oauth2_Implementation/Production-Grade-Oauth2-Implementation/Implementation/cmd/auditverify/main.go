@@ -0,0 +1,93 @@
+// Command auditverify checks the hash chain of audit log files written by
+// the authorization server:
+//
+//	auditverify [-key BASE64 | -key-file PATH] [-head HASH] FILE...
+//
+// It prints the number of records and the hash of the last one, and exits
+// with status 1 at the first record that was modified, removed or reordered.
+// With -head the last hash must also match a value kept elsewhere, which
+// catches records cut off the end of the file.
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+)
+
+func main() {
+	keyFlag := flag.String("key", "", "audit.key of the server, base64")
+	keyFile := flag.String("key-file", "", "file containing audit.key")
+	head := flag.String("head", "", "expected hash of the last record")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: auditverify [-key BASE64 | -key-file PATH] [-head HASH] FILE...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	key, err := loadKey(*keyFlag, *keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "auditverify:", err)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		if err := verify(path, key, *head); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func verify(path string, key []byte, head string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum, err := audit.Verify(f, key)
+	if err != nil {
+		return err
+	}
+	if head != "" && sum.Head != head {
+		return fmt.Errorf("last record has hash %s, want %s; records were removed from the end", sum.Head, head)
+	}
+	fmt.Printf("%s: ok, %d records in %d chain(s), head %s\n", path, sum.Records, sum.Chains, sum.Head)
+	return nil
+}
+
+func loadKey(encoded, path string) ([]byte, error) {
+	if path != "" {
+		if encoded != "" {
+			return nil, fmt.Errorf("-key and -key-file are exclusive")
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		encoded = strings.TrimSpace(string(b))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if key, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("decoding key: %w", err)
+		}
+	}
+	return key, nil
+}
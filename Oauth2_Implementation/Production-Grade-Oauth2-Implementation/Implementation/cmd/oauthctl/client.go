@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/mongostore"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/sqlstore"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+func clientCreate(ctx context.Context, e *env, args []string) error {
+	fs := flags("client create", "-redirect-uri URI [-id ID] [-name NAME] [-public] [-scope S]... [-format jwt|opaque] [-ttl D] [-allow-plain-pkce] [-legacy-flows] [-response-encryption-key FILE]")
+	id := fs.String("id", "", "client_id; random if empty")
+	name := fs.String("name", "", "display name")
+	public := fs.Bool("public", false, "no secret; the client must use PKCE")
+	var redirects, scopes list
+	fs.Var(&redirects, "redirect-uri", "allowed redirect URI (repeatable)")
+	fs.Var(&scopes, "scope", "allowed scope (repeatable, or space separated)")
+	format := fs.String("format", "jwt", "access token format: jwt or opaque")
+	ttl := fs.Duration("ttl", time.Hour, "access token lifetime")
+	allowPlain := fs.Bool("allow-plain-pkce", false, "accept code_challenge_method=plain, not only S256")
+	legacy := fs.Bool("legacy-flows", false, "allow the implicit and hybrid flows (response types with token or id_token)")
+	encKeyFile := fs.String("response-encryption-key", "", "public JWK file to encrypt JWT-secured authorization responses to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(redirects) == 0 || fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+	for _, u := range redirects {
+		if err := storage.CheckRedirectURI(u); err != nil {
+			return fmt.Errorf("-redirect-uri: %w", err)
+		}
+	}
+	f, err := tokens.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		return fmt.Errorf("-ttl must be positive")
+	}
+	var encKey []byte
+	if *encKeyFile != "" {
+		if encKey, err = os.ReadFile(*encKeyFile); err != nil {
+			return err
+		}
+		if _, err := tokens.ParseEncryptionJWK(encKey); err != nil {
+			return fmt.Errorf("-response-encryption-key: %w", err)
+		}
+	}
+
+	store, err := e.openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	c := &storage.Client{
+		ID:                *id,
+		Name:              *name,
+		RedirectURIs:      redirects,
+		Scopes:            strings.Fields(strings.Join(scopes, " ")),
+		AccessTokenFormat: string(f),
+		AccessTokenTTL:    *ttl,
+		AllowPlainPKCE:    *allowPlain,
+		LegacyFlows:       *legacy,
+
+		ResponseEncryptionKey: strings.TrimSpace(string(encKey)),
+	}
+	if c.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		c.ID = newID
+	}
+	var secret string
+	if !*public {
+		var err error
+		if secret, err = cryptoutil.Token(32); err != nil {
+			return err
+		}
+		c.SecretHash = storage.HashSecret(secret)
+	}
+	if err := store.CreateClient(ctx, c); err != nil {
+		return fmt.Errorf("client %q: %w", c.ID, err)
+	}
+
+	fmt.Fprintln(e.out, "client_id:    ", c.ID)
+	if secret != "" {
+		fmt.Fprintln(e.out, "client_secret:", secret)
+		fmt.Fprintln(os.Stderr, "The secret is only stored hashed; keep it now.")
+	}
+	return nil
+}
+
+func clientList(ctx context.Context, e *env, args []string) error {
+	fs := flags("client list", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	store, err := e.openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	clients, err := store.ListClients(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	tw := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLIENT_ID\tTYPE\tFORMAT\tTTL\tSCOPES\tREDIRECT_URIS")
+	for _, c := range clients {
+		kind := "confidential"
+		if c.Public() {
+			kind = "public"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ID, kind, c.AccessTokenFormat, c.AccessTokenTTL,
+			strings.Join(c.Scopes, " "), strings.Join(c.RedirectURIs, " "))
+	}
+	return tw.Flush()
+}
+
+// openStore opens storage.driver like the server does, migrating SQL schemas
+// and creating MongoDB indexes. The memory driver is refused, since its
+// clients would vanish with this process.
+func (e *env) openStore(ctx context.Context) (storage.Store, error) {
+	if e.store != nil {
+		return e.store, nil
+	}
+	cfg, err := e.config()
+	if err != nil {
+		return nil, err
+	}
+	c := cfg.Storage
+	switch c.Driver {
+	case "", "memory":
+		return nil, fmt.Errorf("storage.driver is memory; the server's clients are not reachable from here")
+	case sqlstore.Postgres, sqlstore.MySQL:
+		db, err := sqlstore.Open(ctx, c.Driver, string(c.DSN))
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Migrate(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	case "mongodb":
+		db, err := mongostore.Open(ctx, string(c.DSN), c.Database)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.EnsureIndexes(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", c.Driver)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func TestClientCommands(t *testing.T) {
+	te := newTestEnv(t)
+	ctx := context.Background()
+
+	out := te.mustRun(t, "client", "create", "-id", "web", "-name", "Web", "-redirect-uri", "https://app.example/cb",
+		"-scope", "openid email", "-scope", "orders", "-format", "opaque", "-ttl", "10m")
+	m := regexp.MustCompile(`client_secret: (\S+)`).FindStringSubmatch(out)
+	if m == nil || !strings.Contains(out, "client_id:     web") {
+		t.Fatalf("output %q", out)
+	}
+	c, err := te.store.GetClient(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.CheckSecret(m[1]) || storage.CheckClientSecret(m[1]) != nil {
+		t.Error("printed secret does not authenticate the client")
+	}
+	if strings.Join(c.Scopes, " ") != "openid email orders" || c.AccessTokenFormat != "opaque" || c.AccessTokenTTL.Minutes() != 10 {
+		t.Errorf("stored %+v", c)
+	}
+
+	out = te.mustRun(t, "client", "create", "-public", "-redirect-uri", "http://127.0.0.1:8000/cb")
+	id := strings.TrimSpace(strings.TrimPrefix(out, "client_id:"))
+	if c, err := te.store.GetClient(ctx, id); err != nil || !c.Public() {
+		t.Errorf("public client %q: %+v, %v", id, c, err)
+	}
+	if strings.Contains(out, "client_secret") {
+		t.Errorf("public client got a secret: %q", out)
+	}
+
+	for _, args := range [][]string{
+		{"-id", "web", "-redirect-uri", "https://app.example/cb"},        // taken
+		{"-redirect-uri", "http://app.example/cb"},                       // not https
+		{"-redirect-uri", "https://app.example/cb", "-format", "paseto"}, // unknown format
+		{"-redirect-uri", "https://app.example/cb", "-ttl", "0s"},
+	} {
+		if _, err := te.run(t, "client", "create", args...); err == nil {
+			t.Errorf("client create %q: no error", args)
+		}
+	}
+
+	out = te.mustRun(t, "client", "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "CLIENT_ID") {
+		t.Fatalf("list %q", out)
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if fields[0] == "web" && fields[1] != "confidential" || fields[0] == id && fields[1] != "public" {
+			t.Errorf("list line %q", line)
+		}
+	}
+	if lines[1] > lines[2] {
+		t.Errorf("list not sorted: %q", out)
+	}
+}
+
+func TestClientCommandsRefuseMemoryStorage(t *testing.T) {
+	te := newTestEnv(t)
+	te.env.store = nil
+	if _, err := te.run(t, "client", "list"); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("client list against the memory driver: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// deviceLogin runs the device authorization grant (RFC 8628) against the
+// server as the given client: it shows the user code, polls /token until the
+// user has decided and prints the token response.
+func deviceLogin(ctx context.Context, e *env, args []string) error {
+	fs := flags("device login", "-server URL -client-id ID [-client-secret S] [-scope S]")
+	server := fs.String("server", "", "base URL of the server, e.g. https://auth.example.com")
+	clientID := fs.String("client-id", "", "client_id")
+	clientSecret := fs.String("client-secret", os.Getenv("OAUTHCTL_CLIENT_SECRET"), "client secret of confidential clients (default $OAUTHCTL_CLIENT_SECRET)")
+	scope := fs.String("scope", "", "space separated scopes; the client's scopes if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *server == "" || *clientID == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+	base := strings.TrimRight(*server, "/")
+	post := func(path string, form url.Values) (int, map[string]interface{}, error) {
+		if *clientSecret == "" {
+			form.Set("client_id", *clientID)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if *clientSecret != "" {
+			req.SetBasicAuth(*clientID, *clientSecret)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		if err != nil {
+			return 0, nil, err
+		}
+		var out map[string]interface{}
+		if err := json.Unmarshal(body, &out); err != nil {
+			return 0, nil, fmt.Errorf("%s answered %s: %s", path, res.Status, strings.TrimSpace(string(body)))
+		}
+		return res.StatusCode, out, nil
+	}
+
+	form := url.Values{}
+	if *scope != "" {
+		form.Set("scope", *scope)
+	}
+	status, auth, err := post("/device_authorization", form)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("device authorization failed: %v: %v", auth["error"], auth["error_description"])
+	}
+	deviceCode, _ := auth["device_code"].(string)
+	interval := time.Duration(number(auth["interval"], 5)) * time.Second
+	deadline := time.Now().Add(time.Duration(number(auth["expires_in"], 600)) * time.Second)
+
+	fmt.Fprintf(os.Stderr, "Open %v\nand enter the code %v\n", auth["verification_uri"], auth["user_code"])
+	if complete, ok := auth["verification_uri_complete"].(string); ok {
+		fmt.Fprintf(os.Stderr, "(or open %s)\n", complete)
+	}
+	fmt.Fprintln(os.Stderr, "Waiting for the login...")
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		status, tok, err := post("/token", url.Values{"grant_type": {deviceGrantType}, "device_code": {deviceCode}})
+		if err != nil {
+			return err
+		}
+		if status == http.StatusOK {
+			enc := json.NewEncoder(e.out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(tok)
+		}
+		switch tok["error"] {
+		case "authorization_pending":
+		case "slow_down":
+			// RFC 8628 section 3.5: add 5 seconds to the interval
+			interval += 5 * time.Second
+		default:
+			return fmt.Errorf("%v: %v", tok["error"], tok["error_description"])
+		}
+	}
+	return fmt.Errorf("the device code expired before the login finished")
+}
+
+// number reads a JSON number, or def if v is not one.
+func number(v interface{}, def float64) float64 {
+	if f, ok := v.(float64); ok && f > 0 {
+		return f
+	}
+	return def
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeviceLogin(t *testing.T) {
+	var polls int
+	answer := `{"access_token":"at","token_type":"Bearer","expires_in":3600}`
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id, secret, basic := r.BasicAuth()
+		if !basic || id != "tv" || secret != "s3cret" || r.FormValue("client_id") != "" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/device_authorization":
+			if r.FormValue("scope") != "openid profile" {
+				http.Error(w, `{"error":"invalid_scope"}`, http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, `{"device_code":"dc","user_code":"BCDF-GHJK","verification_uri":"https://auth.example/device","interval":1,"expires_in":60}`)
+		case "/token":
+			if r.FormValue("grant_type") != deviceGrantType || r.FormValue("device_code") != "dc" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			polls++
+			w.WriteHeader(status)
+			io.WriteString(w, answer)
+		}
+	}))
+	defer srv.Close()
+
+	te := newTestEnv(t)
+	args := []string{"-server", srv.URL + "/", "-client-id", "tv", "-client-secret", "s3cret", "-scope", "openid profile"}
+	out := te.mustRun(t, "device", "login", args...)
+	var tok map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &tok); err != nil || tok["access_token"] != "at" || polls != 1 {
+		t.Errorf("after %d polls: %q, %v", polls, out, err)
+	}
+
+	// The user said no
+	status, answer = http.StatusBadRequest, `{"error":"access_denied","error_description":"The user denied the request"}`
+	if _, err := te.run(t, "device", "login", args...); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("denied: %v", err)
+	}
+
+	// A client the server does not accept never gets to poll
+	polls = 0
+	args[5] = "guess"
+	if _, err := te.run(t, "device", "login", args...); err == nil || !strings.Contains(err.Error(), "invalid_client") || polls != 0 {
+		t.Errorf("wrong secret: %v after %d polls", err, polls)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+func keysGenerate(ctx context.Context, e *env, args []string) error {
+	fs := flags("keys generate", "[-type ec|rsa|ed25519] -out FILE")
+	kind := fs.String("type", "ec", "key type: ec (P-256, ES256), rsa (3072 bit, RS256) or ed25519 (EdDSA)")
+	out := fs.String("out", "", "where to write the PEM encoded private key")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if !*force {
+		if _, err := os.Stat(*out); err == nil {
+			return fmt.Errorf("%s exists; use -force or keys rotate", *out)
+		}
+	}
+	key, err := generateKey(*kind)
+	if err != nil {
+		return err
+	}
+	jwk, err := writeKey(*out, key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "wrote %s: %s key %s\n", *out, jwk.Algorithm, jwk.KeyID)
+	return nil
+}
+
+// keysRotate writes a new key over the server's tokens.signing_key_file
+// and, given -server and -token, asks the server to switch to it through
+// the admin API. The previous key is kept next to it with a .prev suffix.
+func keysRotate(ctx context.Context, e *env, args []string) error {
+	fs := flags("keys rotate", "-file FILE [-type ec|rsa|ed25519] [-server URL -token TOKEN]")
+	file := fs.String("file", "", "the server's tokens.signing_key_file")
+	kind := fs.String("type", "", "key type of the new key; defaults to that of the current key")
+	server := fs.String("server", "", "base URL of the server, e.g. https://auth.example.com")
+	token := fs.String("token", os.Getenv("OAUTHCTL_TOKEN"), "admin access token (default $OAUTHCTL_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" || fs.NArg() > 0 || (*server != "") != (*token != "") {
+		fs.Usage()
+		return errUsage
+	}
+
+	current, err := tokens.LoadPrivateKey(*file)
+	if err != nil {
+		return err
+	}
+	if *kind == "" {
+		*kind = keyType(current)
+	}
+	key, err := generateKey(*kind)
+	if err != nil {
+		return err
+	}
+	prev, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*file+".prev", prev, 0o600); err != nil {
+		return err
+	}
+	jwk, err := writeKey(*file, key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "wrote %s: %s key %s (previous key in %s.prev)\n", *file, jwk.Algorithm, jwk.KeyID, *file)
+
+	if *server == "" {
+		fmt.Fprintln(os.Stderr, "Now call POST /admin/v1/keys/rotate on every replica, or restart them.")
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(*server, "/")+"/admin/v1/keys/rotate", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server answered %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Fprintf(e.out, "server: %s\n", strings.TrimSpace(string(body)))
+	return nil
+}
+
+func keysJWKS(ctx context.Context, e *env, args []string) error {
+	fs := flags("keys jwks", "FILE...")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	var set jose.JSONWebKeySet
+	for _, path := range fs.Args() {
+		key, err := tokens.LoadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		jwk, err := tokens.SigningKey(key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		set.Keys = append(set.Keys, jwk.Public())
+	}
+	enc := json.NewEncoder(e.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(set)
+}
+
+func generateKey(kind string) (crypto.Signer, error) {
+	switch kind {
+	case "ec":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unknown key type %q, want ec, rsa or ed25519", kind)
+	}
+}
+
+func keyType(key crypto.Signer) string {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return "rsa"
+	case ed25519.PrivateKey:
+		return "ed25519"
+	default:
+		return "ec"
+	}
+}
+
+// writeKey stores key as PKCS#8 PEM, readable by the owner only. The file is
+// replaced in one rename, so a server reading it never sees half a key.
+func writeKey(path string, key crypto.Signer) (jose.JSONWebKey, error) {
+	jwk, err := tokens.SigningKey(key)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".oauthctl-key-*")
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return jose.JSONWebKey{}, err
+	}
+	if err := pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		tmp.Close()
+		return jose.JSONWebKey{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	return jwk, os.Rename(tmp.Name(), path)
+}
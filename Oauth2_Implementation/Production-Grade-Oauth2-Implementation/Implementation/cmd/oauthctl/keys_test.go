@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+func TestKeysGenerate(t *testing.T) {
+	te := newTestEnv(t)
+	dir := t.TempDir()
+	for _, kind := range []string{"ec", "ed25519"} {
+		file := filepath.Join(dir, kind+".pem")
+		out := te.mustRun(t, "keys", "generate", "-type", kind, "-out", file)
+		key, err := tokens.LoadPrivateKey(file)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if keyType(key) != kind || !strings.HasPrefix(out, "wrote "+file) {
+			t.Errorf("%s: %T, output %q", kind, key, out)
+		}
+		if fi, err := os.Stat(file); err != nil || fi.Mode().Perm() != 0o600 {
+			t.Errorf("%s: mode %v, %v", kind, fi.Mode(), err)
+		}
+	}
+
+	file := filepath.Join(dir, "ec.pem")
+	if _, err := te.run(t, "keys", "generate", "-out", file); err == nil {
+		t.Error("existing key overwritten without -force")
+	}
+	te.mustRun(t, "keys", "generate", "-force", "-type", "ed25519", "-out", file)
+	if key, _ := tokens.LoadPrivateKey(file); keyType(key) != "ed25519" {
+		t.Error("-force did not replace the key")
+	}
+	if _, err := te.run(t, "keys", "generate", "-type", "dsa", "-out", filepath.Join(dir, "dsa.pem")); err == nil {
+		t.Error("unknown key type accepted")
+	}
+}
+
+func TestKeysJWKS(t *testing.T) {
+	te := newTestEnv(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.pem"), filepath.Join(dir, "b.pem")
+	te.mustRun(t, "keys", "generate", "-out", a)
+	te.mustRun(t, "keys", "generate", "-type", "ed25519", "-out", b)
+
+	out := te.mustRun(t, "keys", "jwks", a, b)
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal([]byte(out), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 || set.Keys[0].Algorithm != "ES256" || set.Keys[1].Algorithm != "EdDSA" {
+		t.Fatalf("keys %+v", set.Keys)
+	}
+	for _, k := range set.Keys {
+		if !k.IsPublic() || k.KeyID == "" {
+			t.Errorf("key %s: public %v", k.KeyID, k.IsPublic())
+		}
+	}
+	if strings.Contains(out, `"d"`) {
+		t.Error("private key material in the JWK Set")
+	}
+	if _, err := te.run(t, "keys", "jwks", filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestKeysRotate(t *testing.T) {
+	te := newTestEnv(t)
+	file := filepath.Join(t.TempDir(), "signing.pem")
+	te.mustRun(t, "keys", "generate", "-type", "ed25519", "-out", file)
+	before, _ := os.ReadFile(file)
+
+	var calls int
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Method != http.MethodPost || r.URL.Path != "/admin/v1/keys/rotate" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			http.Error(w, `{"error":"invalid_token"}`, http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"kid":"new"}`)
+	}))
+	defer admin.Close()
+
+	out := te.mustRun(t, "keys", "rotate", "-file", file, "-server", admin.URL+"/", "-token", "admin-token")
+	after, _ := os.ReadFile(file)
+	prev, _ := os.ReadFile(file + ".prev")
+	if bytes.Equal(before, after) || !bytes.Equal(before, prev) {
+		t.Error("the key was not replaced, or the previous one not kept")
+	}
+	// The new key has the type of the old one
+	key, err := tokens.LoadPrivateKey(file)
+	if _, ok := key.(ed25519.PrivateKey); !ok || err != nil {
+		t.Errorf("new key %T, %v", key, err)
+	}
+	if calls != 1 || !strings.Contains(out, `server: {"kid":"new"}`) {
+		t.Errorf("%d calls, output %q", calls, out)
+	}
+
+	if _, err := te.run(t, "keys", "rotate", "-file", file, "-server", admin.URL, "-token", "wrong"); err == nil ||
+		!strings.Contains(err.Error(), "401") {
+		t.Errorf("rejected rotation: %v", err)
+	}
+	// Without -server only the file changes
+	calls = 0
+	te.mustRun(t, "keys", "rotate", "-file", file, "-type", "ec")
+	if key, _ := tokens.LoadPrivateKey(file); keyType(key) != "ec" || calls != 0 {
+		t.Errorf("key %T after -type ec, %d calls", key, calls)
+	}
+}
@@ -0,0 +1,154 @@
+// Command oauthctl is the operator's tool for the authorization server. It
+// reads the server's configuration (-config, CONFIG_FILE, the environment
+// and .env, as the server does) where a command needs the store, the
+// signing key or the state store:
+//
+//	oauthctl [-config FILE] client create -redirect-uri URI [-id ID] [-public] ...
+//	oauthctl [-config FILE] client list
+//	oauthctl keys generate [-type ec|rsa|ed25519] -out FILE
+//	oauthctl keys rotate -file FILE [-server URL -token TOKEN]
+//	oauthctl keys jwks FILE...
+//	oauthctl [-config FILE] token mint [-sub ID] [-client ID] [-claim k=v]... [-format jwt|opaque]
+//	oauthctl token decode [-jwks URL|FILE] [-secret-file FILE] [-jwe-key FILE] TOKEN
+//	oauthctl device login -server URL -client-id ID [-client-secret S] [-scope S]
+//	oauthctl [-config FILE] state inspect ID
+//
+// Errors exit with status 1, usage errors with status 2.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/config"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// command is one "oauthctl <group> <name>" action.
+type command struct {
+	group, name string
+	summary     string
+	run         func(ctx context.Context, env *env, args []string) error
+}
+
+var commands = []command{
+	{"client", "create", "register a client in the store", clientCreate},
+	{"client", "list", "list the registered clients", clientList},
+	{"keys", "generate", "write a new signing key", keysGenerate},
+	{"keys", "rotate", "replace the signing key file and tell the server", keysRotate},
+	{"keys", "jwks", "print the public JWK Set of key files", keysJWKS},
+	{"token", "mint", "issue a test access token with custom claims", tokenMint},
+	{"token", "decode", "show and verify a JWT", tokenDecode},
+	{"device", "login", "log in with the device flow as a client", deviceLogin},
+	{"state", "inspect", "show what the state store holds for a state, code or session ID", stateInspect},
+}
+
+// errUsage makes main print the command's usage and exit with status 2.
+var errUsage = errors.New("usage")
+
+// env is what the commands share: the configuration, loaded on first use,
+// and where results go.
+type env struct {
+	configArgs []string
+	cfg        *config.Config
+	out        io.Writer
+
+	// store and kv replace the backends the configuration names; tests
+	// run the commands against memory stores with them.
+	store storage.Store
+	kv    state.Store
+}
+
+// config loads the server configuration. Commands that do not need it never
+// call this, so they work without one.
+func (e *env) config() (*config.Config, error) {
+	if e.cfg != nil {
+		return e.cfg, nil
+	}
+	cfg, err := (&config.Loader{Args: e.configArgs, DotEnv: ".env"}).Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading the server configuration:\n%w", err)
+	}
+	e.cfg = cfg
+	return cfg, nil
+}
+
+func main() {
+	global := flag.NewFlagSet("oauthctl", flag.ContinueOnError)
+	configFile := global.String("config", "", "server configuration file (YAML or TOML)")
+	global.Usage = usage
+	if err := global.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	args := global.Args()
+	if len(args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].group == args[0] && commands[i].name == args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "oauthctl: unknown command %q\n\n", strings.Join(args[:2], " "))
+		usage()
+		os.Exit(2)
+	}
+
+	e := &env{out: os.Stdout}
+	if *configFile != "" {
+		e.configArgs = []string{"-config", *configFile}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := cmd.run(ctx, e, args[2:])
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "oauthctl %s %s: %v\n", cmd.group, cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	out := os.Stderr
+	fmt.Fprintln(out, "usage: oauthctl [-config FILE] <command> [flags] [args]")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-16s %s\n", c.group+" "+c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nRun oauthctl <command> -h for the flags of a command.")
+}
+
+// flags returns the flag set of a command, printing usage as
+// "oauthctl group name synopsis".
+func flags(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: oauthctl %s %s\n", name, synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// list collects a flag that may be given several times.
+type list []string
+
+func (l *list) String() string { return strings.Join(*l, ",") }
+
+func (l *list) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/config"
+	statememory "oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+	storagememory "oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/memory"
+)
+
+// testEnv is an env whose commands use memory stores and an HMAC signing
+// key, and whose output is kept for the test.
+type testEnv struct {
+	*env
+	store *storagememory.Store
+	kv    *statememory.Store
+	out   bytes.Buffer
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	cfg := config.Defaults()
+	cfg.Tokens.Secret = "0123456789abcdef0123456789abcdef"
+	cfg.Tokens.Issuer = "https://auth.example"
+	te := &testEnv{store: storagememory.New(), kv: statememory.New()}
+	t.Cleanup(func() { te.kv.Close() })
+	te.env = &env{cfg: cfg, out: &te.out, store: te.store, kv: te.kv}
+	return te
+}
+
+// run runs "oauthctl group name args..." and returns what it printed.
+func (te *testEnv) run(t *testing.T, group, name string, args ...string) (string, error) {
+	t.Helper()
+	te.out.Reset()
+	for _, c := range commands {
+		if c.group == group && c.name == name {
+			err := c.run(context.Background(), te.env, args)
+			return te.out.String(), err
+		}
+	}
+	t.Fatalf("no command %s %s", group, name)
+	return "", nil
+}
+
+// mustRun is run for commands that have to succeed.
+func (te *testEnv) mustRun(t *testing.T, group, name string, args ...string) string {
+	t.Helper()
+	out, err := te.run(t, group, name, args...)
+	if err != nil {
+		t.Fatalf("%s %s %q: %v", group, name, args, err)
+	}
+	return out
+}
+
+func TestUsageErrors(t *testing.T) {
+	te := newTestEnv(t)
+	for _, tt := range []struct {
+		group, name string
+		args        []string
+	}{
+		{"client", "create", nil},
+		{"client", "create", []string{"-redirect-uri", "https://app.example/cb", "extra"}},
+		{"keys", "generate", nil},
+		{"keys", "rotate", []string{"-file", "key.pem", "-server", "https://auth.example"}},
+		{"keys", "jwks", nil},
+		{"token", "mint", []string{"extra"}},
+		{"token", "decode", nil},
+		{"device", "login", []string{"-server", "https://auth.example"}},
+		{"state", "inspect", nil},
+	} {
+		if _, err := te.run(t, tt.group, tt.name, tt.args...); !errors.Is(err, errUsage) {
+			t.Errorf("%s %s %q: %v, want a usage error", tt.group, tt.name, tt.args, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/config"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/mongostate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/redisstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/vault"
+)
+
+// stateKeys are the keys the server may keep for an ID, with what they
+// hold.
+var stateKeys = []struct {
+	key  func(id string) string
+	what string
+}{
+	{prefixed(loginstate.KeyPrefix), "pending login (state parameter)"},
+	{prefixed(loginstate.UsedPrefix), "marker: this state was already used"},
+	{prefixed(loginstate.ConsentPrefix), "login waiting for consent"},
+	{prefixed(authcode.KeyPrefix), "authorization code"},
+	{prefixed(authcode.UsedPrefix), "redeemed authorization code, value is its grant ID"},
+	{prefixed(devicecode.KeyPrefix), "device authorization (device_code)"},
+	{prefixed(devicecode.PollKeyPrefix), "marker: the device polled within the interval"},
+	{func(id string) string { return devicecode.UserKeyPrefix + devicecode.NormalizeUserCode(id) }, "user code, value is its device_code"},
+	{prefixed(vault.KeyPrefix), "sealed upstream tokens (upstream_ref of a session)"},
+	{prefixed(vault.LockPrefix), "upstream refresh in progress"},
+	{tokens.ReferenceKey, "opaque access token"},
+	{prefixed(tokens.RevokedPrefix), "revoked JWT (jti)"},
+}
+
+func prefixed(prefix string) func(string) string {
+	return func(id string) string { return prefix + id }
+}
+
+// stateInspect looks an ID up under every key the server uses and prints
+// what it finds with its remaining lifetime. Sealed vault records stay
+// sealed; only the key ID is shown.
+func stateInspect(ctx context.Context, e *env, args []string) error {
+	fs := flags("state inspect", "ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	id := fs.Arg(0)
+	kv, err := e.openState(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+	inspector, _ := kv.(state.Inspector)
+
+	found := 0
+	for _, k := range stateKeys {
+		key := k.key(id)
+		value, err := kv.Get(ctx, key)
+		if errors.Is(err, state.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		lifetime := "expiry unknown"
+		if inspector != nil {
+			switch ttl, err := inspector.TTL(ctx, key); {
+			case errors.Is(err, state.ErrNotFound):
+				// Expired between the two reads
+				continue
+			case err != nil:
+				return fmt.Errorf("%s: %w", key, err)
+			case ttl == 0:
+				lifetime = "never expires"
+			default:
+				lifetime = "expires in " + ttl.Round(time.Second).String()
+			}
+		}
+		found++
+		fmt.Fprintf(e.out, "%s\n  %s, %s\n  %s\n", key, k.what, lifetime, show(key, value))
+	}
+	if found == 0 {
+		return fmt.Errorf("nothing stored for %q; it expired, was used up or never existed", id)
+	}
+	return nil
+}
+
+// show formats a value for the terminal: JSON indented, vault envelopes
+// without their ciphertext.
+func show(key string, value []byte) string {
+	var v map[string]interface{}
+	if json.Unmarshal(value, &v) != nil {
+		return fmt.Sprintf("%q", value)
+	}
+	if strings.HasPrefix(key, vault.KeyPrefix) {
+		for k := range v {
+			if k != "kid" {
+				v[k] = "(sealed)"
+			}
+		}
+	}
+	b, _ := json.MarshalIndent(v, "  ", "  ")
+	return string(b)
+}
+
+// redisClient connects to the Redis of the state store.
+func redisClient(cfg *config.Config) (redis.UniversalClient, error) {
+	switch cfg.StateDriver() {
+	case "redis":
+	case "memory":
+		return nil, errors.New("state.driver is memory; the server's state only exists inside its process")
+	default:
+		return nil, fmt.Errorf("state.driver is %s, not redis", cfg.StateDriver())
+	}
+	c := cfg.Redis
+	return redisstate.NewClient(redisstate.Options{
+		Mode:             c.Mode,
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		Username:         c.Username,
+		Password:         string(c.Password),
+		SentinelUsername: c.SentinelUsername,
+		SentinelPassword: string(c.SentinelPassword),
+		DB:               c.DB,
+		TLS: redisstate.TLSOptions{
+			Enabled:    c.TLS.Enabled,
+			CAFile:     c.TLS.CAFile,
+			CertFile:   c.TLS.CertFile,
+			KeyFile:    c.TLS.KeyFile,
+			ServerName: c.TLS.ServerName,
+		},
+	})
+}
+
+// openState returns the server's state store, or a throwaway one when the
+// command does not need the server's (JWTs are not stored).
+func (e *env) openState(ctx context.Context, needed bool) (state.Store, error) {
+	if !needed {
+		return memory.New(), nil
+	}
+	if e.kv != nil {
+		return e.kv, nil
+	}
+	cfg, err := e.config()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.StateDriver() == "mongodb" {
+		return mongostate.Open(ctx, string(cfg.Storage.DSN), cfg.Storage.Database)
+	}
+	rdb, err := redisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return redisstate.New(rdb), nil
+}
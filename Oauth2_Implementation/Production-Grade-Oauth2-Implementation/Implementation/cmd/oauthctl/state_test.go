@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/vault"
+)
+
+func TestStateInspect(t *testing.T) {
+	te := newTestEnv(t)
+	ctx := context.Background()
+	for key, value := range map[string]string{
+		loginstate.KeyPrefix + "s1":           `{"client_id":"spa","nonce":"n"}`,
+		authcode.UsedPrefix + "s1":            "grant-1",
+		vault.KeyPrefix + "ref1":              `{"kid":"k1","nonce":"bm9uY2U","ct":"Y2lwaGVydGV4dA"}`,
+		vault.LockPrefix + "ref1":             "\x01",
+		devicecode.UserKeyPrefix + "BCDFGHJK": "device-1",
+	} {
+		if err := te.kv.Set(ctx, key, []byte(value), 10*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	te.kv.Set(ctx, devicecode.KeyPrefix+"device-1", []byte(`{"status":"pending"}`), 0)
+
+	for _, tt := range []struct {
+		id      string
+		want    []string
+		notWant []string
+	}{
+		{"s1", []string{
+			loginstate.KeyPrefix + "s1\n  pending login (state parameter), expires in 10m0s",
+			`"client_id": "spa"`,
+			authcode.UsedPrefix + "s1\n  redeemed authorization code",
+			`"grant-1"`,
+		}, nil},
+		// Sealed records show their key ID only
+		{"ref1", []string{
+			vault.KeyPrefix + "ref1\n  sealed upstream tokens",
+			`"kid": "k1"`,
+			`"ct": "(sealed)"`,
+			vault.LockPrefix + "ref1\n  upstream refresh in progress",
+		}, []string{"Y2lwaGVydGV4dA"}},
+		// User codes are found as users type them
+		{"bcdf-ghjk", []string{devicecode.UserKeyPrefix + "BCDFGHJK\n  user code"}, nil},
+		{"device-1", []string{devicecode.KeyPrefix + "device-1\n  device authorization (device_code), never expires"}, nil},
+	} {
+		out, err := te.run(t, "state", "inspect", tt.id)
+		if err != nil {
+			t.Errorf("%s: %v", tt.id, err)
+			continue
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(out, s) {
+				t.Errorf("%s: no %q in\n%s", tt.id, s, out)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(out, s) {
+				t.Errorf("%s: %q shown in\n%s", tt.id, s, out)
+			}
+		}
+	}
+
+	// An opaque token is looked up by its hash
+	token := strings.TrimSpace(te.mustRun(t, "token", "mint", "-sub", "u1", "-format", "opaque"))
+	if out := te.mustRun(t, "state", "inspect", token); !strings.Contains(out, "opaque access token") || !strings.Contains(out, `"sub": "u1"`) {
+		t.Errorf("opaque token: %q", out)
+	}
+
+	if _, err := te.run(t, "state", "inspect", "unknown"); err == nil || !strings.Contains(err.Error(), "nothing stored") {
+		t.Errorf("unknown ID: %v", err)
+	}
+}
+
+func TestStateInspectRefusesMemoryState(t *testing.T) {
+	te := newTestEnv(t)
+	te.env.kv = nil
+	if _, err := te.run(t, "state", "inspect", "s1"); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("state inspect against the memory driver: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/config"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// tokenMint issues a token exactly as the server would, with the configured
+// signing key (and encryption key), so it passes /introspect and any
+// resource server trusting the server. It is meant for tests: /introspect
+// only reports it active if -claim grant_id=... names an active grant.
+func tokenMint(ctx context.Context, e *env, args []string) error {
+	fs := flags("token mint", "[-sub ID] [-client ID] [-scope S] [-claim k=v]... [-ttl D] [-format jwt|opaque]")
+	sub := fs.String("sub", "", "subject (user ID)")
+	client := fs.String("client", "", "client_id claim")
+	scope := fs.String("scope", "", "space separated scope claim")
+	ttl := fs.Duration("ttl", 0, "lifetime; defaults to tokens.access_token_ttl")
+	format := fs.String("format", "jwt", "jwt, or opaque (stored in the state store)")
+	var claims list
+	fs.Var(&claims, "claim", "extra claim as name=value (repeatable); JSON values such as true, 3 or [\"a\"] keep their type")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+	f, err := tokens.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	c := tokens.Claims{}
+	for _, kv := range claims {
+		name, raw, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("-claim %q is not name=value", kv)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			v = raw
+		}
+		c[name] = v
+	}
+	for name, v := range map[string]string{"sub": *sub, "client_id": *client, "scope": *scope} {
+		if v != "" {
+			c[name] = v
+		}
+	}
+
+	cfg, err := e.config()
+	if err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		*ttl = time.Duration(cfg.Tokens.AccessTokenTTL)
+	}
+	codec, err := tokenCodec(cfg.Tokens)
+	if err != nil {
+		return err
+	}
+	kv, err := e.openState(ctx, f == tokens.FormatOpaque)
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+
+	token, err := tokens.NewIssuer(codec, kv).Issue(ctx, f, c, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.out, token)
+	return nil
+}
+
+// tokenCodec builds the server's codec from the tokens settings.
+func tokenCodec(c config.Tokens) (tokens.Codec, error) {
+	var key jose.JSONWebKey
+	var err error
+	if c.SigningKeyFile == "" {
+		key, err = tokens.HMACKey([]byte(c.Secret))
+	} else {
+		signer, loadErr := tokens.LoadPrivateKey(c.SigningKeyFile)
+		if loadErr != nil {
+			return nil, fmt.Errorf("loading tokens.signing_key_file: %w", loadErr)
+		}
+		key, err = tokens.SigningKey(signer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signed, err := tokens.NewSignedCodec(key, tokens.Expectations{Issuer: c.Issuer, Audience: c.Audience, Type: tokens.TypeAccessToken})
+	if err != nil {
+		return nil, err
+	}
+	if c.JWEKeyFile == "" {
+		return signed, nil
+	}
+	encKey, err := loadEncryptionKey(c.JWEKeyFile, c.JWEAlg)
+	if err != nil {
+		return nil, err
+	}
+	return tokens.NewEncryptedCodec(signed, encKey)
+}
+
+func loadEncryptionKey(path, alg string) (jose.JSONWebKey, error) {
+	key, err := tokens.LoadPrivateKey(path)
+	if err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("loading %s: %w", path, err)
+	}
+	return tokens.EncryptionKey(key, alg)
+}
+
+var (
+	signatureAlgs = []jose.SignatureAlgorithm{
+		jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512,
+		jose.ES256, jose.ES384, jose.ES512, jose.EdDSA, jose.HS256, jose.HS384, jose.HS512,
+	}
+	keyAlgs = []jose.KeyAlgorithm{
+		jose.RSA_OAEP, jose.RSA_OAEP_256, jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW,
+	}
+	contentEncs = []jose.ContentEncryption{jose.A128GCM, jose.A192GCM, jose.A256GCM, jose.A128CBC_HS256, jose.A256CBC_HS512}
+)
+
+// tokenDecode prints the header and claims of a JWT and, given keys,
+// verifies its signature and time claims. Encrypted tokens need -jwe-key.
+func tokenDecode(ctx context.Context, e *env, args []string) error {
+	fs := flags("token decode", "[-jwks URL|FILE] [-secret-file FILE] [-jwe-key FILE] TOKEN|-")
+	jwksSource := fs.String("jwks", "", "JWK Set to verify with, as URL or file")
+	secretFile := fs.String("secret-file", "", "file with the tokens.secret HMAC key to verify with")
+	jweKey := fs.String("jwe-key", "", "tokens.jwe_key_file, to decrypt encrypted tokens")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	raw := fs.Arg(0)
+	if raw == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		raw = line
+	}
+	raw = strings.TrimSpace(raw)
+
+	if strings.Count(raw, ".") == 4 {
+		if *jweKey == "" {
+			return errors.New("the token is encrypted (JWE); pass the server's tokens.jwe_key_file with -jwe-key")
+		}
+		enc, err := jose.ParseEncrypted(raw, keyAlgs, contentEncs)
+		if err != nil {
+			return fmt.Errorf("parsing JWE: %w", err)
+		}
+		key, err := tokens.LoadPrivateKey(*jweKey)
+		if err != nil {
+			return err
+		}
+		inner, err := enc.Decrypt(key)
+		if err != nil {
+			return fmt.Errorf("decrypting: %w", err)
+		}
+		fmt.Fprintf(e.out, "encryption: %s, %s (decrypted)\n", enc.Header.Algorithm, enc.Header.ExtraHeaders[jose.HeaderKey("enc")])
+		raw = string(inner)
+	}
+
+	sig, err := jose.ParseSigned(raw, signatureAlgs)
+	if err != nil {
+		return fmt.Errorf("parsing JWS: %w", err)
+	}
+	if len(sig.Signatures) != 1 {
+		return errors.New("the token has more than one signature")
+	}
+	header := sig.Signatures[0].Header
+	payload := sig.UnsafePayloadWithoutVerification()
+	printJSON(e.out, "header", map[string]interface{}{"alg": header.Algorithm, "kid": header.KeyID, "typ": header.ExtraHeaders[jose.HeaderType]})
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("claims are not a JSON object: %w", err)
+	}
+	printJSON(e.out, "claims", claims)
+	for _, name := range []string{"iat", "nbf", "exp"} {
+		if v, ok := claims[name].(float64); ok {
+			fmt.Fprintf(e.out, "%s: %s\n", name, time.Unix(int64(v), 0).Local().Format(time.RFC3339))
+		}
+	}
+
+	var verifyKey interface{}
+	switch {
+	case *jwksSource != "" && *secretFile != "":
+		return errors.New("-jwks and -secret-file are exclusive")
+	case *jwksSource != "":
+		set, err := loadJWKS(ctx, *jwksSource)
+		if err != nil {
+			return err
+		}
+		keys := set.Key(header.KeyID)
+		if len(keys) == 0 {
+			return fmt.Errorf("signature: NOT VERIFIED, no key %q in %s", header.KeyID, *jwksSource)
+		}
+		verifyKey = keys[0].Public()
+	case *secretFile != "":
+		b, err := os.ReadFile(*secretFile)
+		if err != nil {
+			return err
+		}
+		verifyKey = []byte(strings.TrimSpace(string(b)))
+	default:
+		fmt.Fprintln(e.out, "signature: not verified (no -jwks or -secret-file)")
+		return nil
+	}
+	if _, err := sig.Verify(verifyKey); err != nil {
+		return fmt.Errorf("signature: INVALID: %w", err)
+	}
+	var registered jwt.Claims
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return fmt.Errorf("registered claims: %w", err)
+	}
+	if err := registered.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, time.Minute); err != nil {
+		return fmt.Errorf("signature valid, but %w", err)
+	}
+	fmt.Fprintln(e.out, "signature: valid")
+	return nil
+}
+
+// loadJWKS reads a JWK Set from an http(s) URL or a file.
+func loadJWKS(ctx context.Context, source string) (*jose.JSONWebKeySet, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s: %s", source, res.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(res.Body, 1<<20)); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s is not a JWK Set: %w", source, err)
+	}
+	return &set, nil
+}
+
+func printJSON(w io.Writer, label string, v interface{}) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintf(w, "%s: %s\n", label, b)
+}
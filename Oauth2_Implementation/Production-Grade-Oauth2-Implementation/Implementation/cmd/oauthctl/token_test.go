@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+func TestTokenMint(t *testing.T) {
+	te := newTestEnv(t)
+	ctx := context.Background()
+
+	token := strings.TrimSpace(te.mustRun(t, "token", "mint", "-sub", "u1", "-client", "spa", "-scope", "openid email",
+		"-claim", "admin=true", "-claim", "level=3", "-claim", `roles=["a","b"]`, "-claim", "note=plain text", "-ttl", "5m"))
+	codec, err := tokenCodec(te.cfg.Tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := codec.Decode(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]interface{}{
+		"sub": "u1", "client_id": "spa", "scope": "openid email", "iss": "https://auth.example",
+		"admin": true, "level": 3.0, "note": "plain text",
+	} {
+		if claims[name] != want {
+			t.Errorf("%s = %#v, want %#v", name, claims[name], want)
+		}
+	}
+	if roles, _ := claims["roles"].([]interface{}); len(roles) != 2 {
+		t.Errorf("roles = %#v", claims["roles"])
+	}
+	if exp, iat := claims["exp"].(float64), claims["iat"].(float64); exp-iat != 300 {
+		t.Errorf("lifetime %vs, want 300", exp-iat)
+	}
+
+	// Opaque tokens go into the state store, where the server finds them
+	opaque := strings.TrimSpace(te.mustRun(t, "token", "mint", "-sub", "u1", "-format", "opaque"))
+	if ok, err := te.kv.Exists(ctx, tokens.ReferenceKey(opaque)); !ok || err != nil {
+		t.Errorf("opaque token not stored: %v, %v", ok, err)
+	}
+	got, err := tokens.NewIssuer(codec, te.kv).Introspect(ctx, opaque)
+	if err != nil || got["sub"] != "u1" {
+		t.Errorf("introspecting the opaque token: %v, %v", got, err)
+	}
+
+	for _, args := range [][]string{
+		{"-claim", "novalue"},
+		{"-claim", "=x"},
+		{"-format", "paseto"},
+	} {
+		if _, err := te.run(t, "token", "mint", args...); err == nil {
+			t.Errorf("token mint %q: no error", args)
+		}
+	}
+}
+
+func TestTokenDecode(t *testing.T) {
+	te := newTestEnv(t)
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	os.WriteFile(secretFile, []byte(string(te.cfg.Tokens.Secret)+"\n"), 0o600)
+	wrongFile := filepath.Join(dir, "wrong")
+	os.WriteFile(wrongFile, []byte("fedcba9876543210fedcba9876543210"), 0o600)
+
+	hmac := strings.TrimSpace(te.mustRun(t, "token", "mint", "-sub", "u1"))
+	out := te.mustRun(t, "token", "decode", hmac)
+	if !strings.Contains(out, `"alg": "HS256"`) || !strings.Contains(out, `"sub": "u1"`) || !strings.Contains(out, "signature: not verified") {
+		t.Errorf("decode without a key: %q", out)
+	}
+	if out := te.mustRun(t, "token", "decode", "-secret-file", secretFile, hmac); !strings.HasSuffix(out, "signature: valid\n") {
+		t.Errorf("decode with the secret: %q", out)
+	}
+	if _, err := te.run(t, "token", "decode", "-secret-file", wrongFile, hmac); err == nil || !strings.Contains(err.Error(), "INVALID") {
+		t.Errorf("decode with a wrong secret: %v", err)
+	}
+	codec, err := tokenCodec(te.cfg.Tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := codec.Encode(tokens.Claims{"sub": "u1", "exp": time.Now().Add(-time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := te.run(t, "token", "decode", "-secret-file", secretFile, expired); err == nil || !strings.Contains(err.Error(), "signature valid, but") {
+		t.Errorf("decode of an expired token: %v", err)
+	}
+
+	// Asymmetric keys are checked against the published JWK Set, and
+	// encrypted tokens need the decryption key
+	signing, enc, jwks := filepath.Join(dir, "signing.pem"), filepath.Join(dir, "enc.pem"), filepath.Join(dir, "jwks.json")
+	te.mustRun(t, "keys", "generate", "-out", signing)
+	te.mustRun(t, "keys", "generate", "-out", enc)
+	os.WriteFile(jwks, []byte(te.mustRun(t, "keys", "jwks", signing)), 0o600)
+	te.cfg.Tokens.SigningKeyFile = signing
+	te.cfg.Tokens.JWEKeyFile = enc
+
+	jwe := strings.TrimSpace(te.mustRun(t, "token", "mint", "-sub", "u2"))
+	if strings.Count(jwe, ".") != 4 {
+		t.Fatalf("minted %q, want a JWE", jwe)
+	}
+	if _, err := te.run(t, "token", "decode", "-jwks", jwks, jwe); err == nil || !strings.Contains(err.Error(), "-jwe-key") {
+		t.Errorf("decode of a JWE without -jwe-key: %v", err)
+	}
+	out = te.mustRun(t, "token", "decode", "-jwks", jwks, "-jwe-key", enc, jwe)
+	if !strings.Contains(out, "encryption: ECDH-ES") || !strings.Contains(out, `"alg": "ES256"`) || !strings.HasSuffix(out, "signature: valid\n") {
+		t.Errorf("decode of a JWE: %q", out)
+	}
+	if _, err := te.run(t, "token", "decode", "-jwks", jwks, "-secret-file", secretFile, hmac); err == nil {
+		t.Error("-jwks and -secret-file accepted together")
+	}
+	if _, err := te.run(t, "token", "decode", "-jwks", jwks, hmac); err == nil || !strings.Contains(err.Error(), "NOT VERIFIED") {
+		t.Errorf("decode with a JWK Set lacking the key: %v", err)
+	}
+}
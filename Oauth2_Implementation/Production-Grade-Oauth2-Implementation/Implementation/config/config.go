@@ -0,0 +1,483 @@
+// Package config is the typed configuration of the authorization server.
+//
+// Values are layered, later layers winning:
+//
+//  1. built-in defaults (Defaults)
+//  2. a YAML or TOML file (-config flag or CONFIG_FILE)
+//  3. environment variables, including those from an optional .env file
+//  4. command-line flags, named after the file keys (-redis.addrs=...)
+//
+// Every field documents its file key and environment variable in its struct
+// tags. Secret fields accept "file:/path" to read the value from a file, as
+// mounted by Docker and Kubernetes secrets.
+//
+// Fields tagged reload:"true" may change on SIGHUP; any other difference
+// needs a restart and is reported by Diff.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	HTTP    HTTP    `yaml:"http" toml:"http"`
+	OAuth   OAuth   `yaml:"oauth" toml:"oauth"`
+	Tokens  Tokens  `yaml:"tokens" toml:"tokens"`
+	Vault   Vault   `yaml:"vault" toml:"vault"`
+	Login   Login   `yaml:"login" toml:"login"`
+	State   State   `yaml:"state" toml:"state"`
+	Redis   Redis   `yaml:"redis" toml:"redis"`
+	Storage Storage `yaml:"storage" toml:"storage"`
+	Tracing Tracing `yaml:"tracing" toml:"tracing"`
+	Audit   Audit   `yaml:"audit" toml:"audit"`
+	UI      UI      `yaml:"ui" toml:"ui"`
+	Admin   Admin   `yaml:"admin" toml:"admin"`
+
+	RateLimit RateLimit `yaml:"ratelimit" toml:"ratelimit"`
+}
+
+// HTTP is the listener. Setting both TLS files serves https.
+type HTTP struct {
+	Addr              string   `yaml:"addr" toml:"addr" env:"HTTP_ADDR"`
+	TLS               HTTPTLS  `yaml:"tls" toml:"tls"`
+	HTTP2             bool     `yaml:"http2" toml:"http2" env:"HTTP_HTTP2"`
+	H2C               bool     `yaml:"h2c" toml:"h2c" env:"HTTP_H2C"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int      `yaml:"max_header_bytes" toml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+	MaxConnections    int      `yaml:"max_connections" toml:"max_connections" env:"HTTP_MAX_CONNECTIONS"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+	// DrainDelay keeps serving after SIGTERM with /readyz failing, until
+	// the load balancer has taken the instance out.
+	DrainDelay Duration `yaml:"drain_delay" toml:"drain_delay" env:"HTTP_DRAIN_DELAY"`
+	// HSTSMaxAge sends Strict-Transport-Security with this max-age; zero
+	// leaves it off. Only set it once every host name serves https.
+	HSTSMaxAge Duration `yaml:"hsts_max_age" toml:"hsts_max_age" env:"HTTP_HSTS_MAX_AGE"`
+}
+
+type HTTPTLS struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file" env:"HTTP_TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" toml:"key_file" env:"HTTP_TLS_KEY_FILE"`
+	// ReloadInterval is how often the files are checked for a renewal.
+	ReloadInterval Duration `yaml:"reload_interval" toml:"reload_interval" env:"HTTP_TLS_RELOAD_INTERVAL"`
+}
+
+// OAuth is the upstream provider (Google) and our client registry.
+type OAuth struct {
+	ClientID     string   `yaml:"client_id" toml:"client_id" env:"OAUTH_CLIENT_ID"`
+	ClientSecret Secret   `yaml:"client_secret" toml:"client_secret" env:"OAUTH_CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" env:"OAUTH_REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" env:"OAUTH_SCOPES" sep:" "`
+	ClientsFile  string   `yaml:"clients_file" toml:"clients_file" env:"OAUTH_CLIENTS_FILE" reload:"true"`
+}
+
+// Tokens controls the access tokens we issue.
+type Tokens struct {
+	Secret         Secret `yaml:"secret" toml:"secret" env:"JWT_SECRET"`
+	SigningKeyFile string `yaml:"signing_key_file" toml:"signing_key_file" env:"JWT_SIGNING_KEY_FILE"`
+	Issuer         string `yaml:"issuer" toml:"issuer" env:"JWT_ISSUER"`
+	JWEKeyFile     string `yaml:"jwe_key_file" toml:"jwe_key_file" env:"JWE_KEY_FILE"`
+	JWEAlg         string `yaml:"jwe_alg" toml:"jwe_alg" env:"JWE_ALG"`
+
+	// Audience is the aud of access tokens, the resource servers they are
+	// for. Empty leaves aud out.
+	Audience []string `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE"`
+
+	// Defaults for callers of /login without a client_id.
+	AccessTokenFormat string   `yaml:"access_token_format" toml:"access_token_format" env:"ACCESS_TOKEN_FORMAT" reload:"true"`
+	AccessTokenTTL    Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" reload:"true"`
+}
+
+// Vault seals upstream tokens at rest.
+type Vault struct {
+	KEK          Secret   `yaml:"kek" toml:"kek" env:"VAULT_KEK"`
+	KEKID        string   `yaml:"kek_id" toml:"kek_id" env:"VAULT_KEK_ID"`
+	PreviousKEKs Secret   `yaml:"previous_keks" toml:"previous_keks" env:"VAULT_PREVIOUS_KEKS"`
+	TTL          Duration `yaml:"ttl" toml:"ttl" env:"VAULT_TTL"`
+}
+
+// Login covers the browser leg between /login or /authorize and /callback,
+// how long the authorization code handed to the client stays valid and how
+// long users have to enter a device's code. CookieKey also signs the CSRF
+// tokens of the pages.
+type Login struct {
+	CookieKey     Secret   `yaml:"cookie_key" toml:"cookie_key" env:"LOGIN_COOKIE_KEY"`
+	StateTTL      Duration `yaml:"state_ttl" toml:"state_ttl" env:"LOGIN_STATE_TTL"`
+	CodeTTL       Duration `yaml:"code_ttl" toml:"code_ttl" env:"LOGIN_CODE_TTL"`
+	DeviceCodeTTL Duration `yaml:"device_code_ttl" toml:"device_code_ttl" env:"LOGIN_DEVICE_CODE_TTL"`
+}
+
+// State selects the ephemeral state store.
+type State struct {
+	Driver string `yaml:"driver" toml:"driver" env:"STATE_DRIVER"`
+}
+
+type Redis struct {
+	Mode             string   `yaml:"mode" toml:"mode" env:"REDIS_MODE"`
+	Addrs            []string `yaml:"addrs" toml:"addrs" env:"REDIS_ADDR"`
+	MasterName       string   `yaml:"master_name" toml:"master_name" env:"REDIS_MASTER_NAME"`
+	Username         string   `yaml:"username" toml:"username" env:"REDIS_USERNAME"`
+	Password         Secret   `yaml:"password" toml:"password" env:"REDIS_PASSWORD"`
+	SentinelUsername string   `yaml:"sentinel_username" toml:"sentinel_username" env:"REDIS_SENTINEL_USERNAME"`
+	SentinelPassword Secret   `yaml:"sentinel_password" toml:"sentinel_password" env:"REDIS_SENTINEL_PASSWORD"`
+	DB               int      `yaml:"db" toml:"db" env:"REDIS_DB"`
+	TLS              RedisTLS `yaml:"tls" toml:"tls"`
+}
+
+type RedisTLS struct {
+	Enabled    bool   `yaml:"enabled" toml:"enabled" env:"REDIS_TLS"`
+	CAFile     string `yaml:"ca_file" toml:"ca_file" env:"REDIS_TLS_CA_FILE"`
+	CertFile   string `yaml:"cert_file" toml:"cert_file" env:"REDIS_TLS_CERT_FILE"`
+	KeyFile    string `yaml:"key_file" toml:"key_file" env:"REDIS_TLS_KEY_FILE"`
+	ServerName string `yaml:"server_name" toml:"server_name" env:"REDIS_TLS_SERVER_NAME"`
+}
+
+// Storage selects the durable store for clients, users, grants and consents.
+type Storage struct {
+	Driver   string `yaml:"driver" toml:"driver" env:"STORAGE_DRIVER"`
+	DSN      Secret `yaml:"dsn" toml:"dsn" env:"STORAGE_DSN"`
+	Database string `yaml:"database" toml:"database" env:"STORAGE_DATABASE"`
+}
+
+// Tracing exports OpenTelemetry spans. Exporter is none, otlp, stdout or
+// file; the otlp exporter also honours the standard OTEL_EXPORTER_OTLP_*
+// variables when Endpoint is empty.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" toml:"insecure" env:"TRACING_INSECURE"`
+	File        string  `yaml:"file" toml:"file" env:"TRACING_FILE"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Audit selects where the audit trail goes. Every record is hash-chained to
+// the previous one; with Key (32 bytes, base64) the hashes are HMACs.
+type Audit struct {
+	File    string `yaml:"file" toml:"file" env:"AUDIT_FILE"`
+	Stdout  bool   `yaml:"stdout" toml:"stdout" env:"AUDIT_STDOUT"`
+	Storage bool   `yaml:"storage" toml:"storage" env:"AUDIT_STORAGE"`
+	Key     Secret `yaml:"key" toml:"key" env:"AUDIT_KEY"`
+}
+
+// UI is the look and language of the pages users see. ThemeDir may hold
+// layout.html, login.html, consent.html, error.html, device.html and
+// style.css to replace the built-in ones, LocalesDir <tag>.json message
+// catalogs that add languages or reword the built-in ones. DefaultLocale is
+// shown when none of the languages a user asks for is available.
+type UI struct {
+	ThemeDir      string `yaml:"theme_dir" toml:"theme_dir" env:"UI_THEME_DIR"`
+	ProductName   string `yaml:"product_name" toml:"product_name" env:"UI_PRODUCT_NAME"`
+	LocalesDir    string `yaml:"locales_dir" toml:"locales_dir" env:"UI_LOCALES_DIR"`
+	DefaultLocale string `yaml:"default_locale" toml:"default_locale" env:"UI_DEFAULT_LOCALE"`
+}
+
+// Admin is the operator API under /admin/v1. Roles are "principal=role"
+// entries, where principal is a user ID or verified email address and role is
+// viewer, operator or admin; only users listed there can use the API.
+type Admin struct {
+	Enabled bool     `yaml:"enabled" toml:"enabled" env:"ADMIN_ENABLED"`
+	Roles   []string `yaml:"roles" toml:"roles" env:"ADMIN_ROLES"`
+}
+
+// RateLimit limits the auth endpoints. Driver is redis or memory; empty
+// follows the state store. X-Forwarded-For is only believed from
+// TrustedProxies (CIDRs). After FailuresFree failed authentications within
+// FailureWindow the source is locked out for FailureDelay, doubling with
+// every further failure up to FailureMaxDelay.
+type RateLimit struct {
+	Enabled        bool     `yaml:"enabled" toml:"enabled" env:"RATELIMIT_ENABLED"`
+	Driver         string   `yaml:"driver" toml:"driver" env:"RATELIMIT_DRIVER"`
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"RATELIMIT_TRUSTED_PROXIES"`
+
+	Login      RateRule `yaml:"login" toml:"login" env:"RATELIMIT_LOGIN"`
+	Callback   RateRule `yaml:"callback" toml:"callback" env:"RATELIMIT_CALLBACK"`
+	Token      RateRule `yaml:"token" toml:"token" env:"RATELIMIT_TOKEN"`
+	Logout     RateRule `yaml:"logout" toml:"logout" env:"RATELIMIT_LOGOUT"`
+	Introspect RateRule `yaml:"introspect" toml:"introspect" env:"RATELIMIT_INTROSPECT"`
+	Revoke     RateRule `yaml:"revoke" toml:"revoke" env:"RATELIMIT_REVOKE"`
+	UserInfo   RateRule `yaml:"userinfo" toml:"userinfo" env:"RATELIMIT_USERINFO"`
+	Admin      RateRule `yaml:"admin" toml:"admin" env:"RATELIMIT_ADMIN"`
+
+	FailuresFree    int      `yaml:"failures_free" toml:"failures_free" env:"RATELIMIT_FAILURES_FREE"`
+	FailureWindow   Duration `yaml:"failure_window" toml:"failure_window" env:"RATELIMIT_FAILURE_WINDOW"`
+	FailureDelay    Duration `yaml:"failure_delay" toml:"failure_delay" env:"RATELIMIT_FAILURE_DELAY"`
+	FailureMaxDelay Duration `yaml:"failure_max_delay" toml:"failure_max_delay" env:"RATELIMIT_FAILURE_MAX_DELAY"`
+}
+
+// Defaults returns the configuration used for anything not set elsewhere.
+func Defaults() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Addr:              ":8080",
+			TLS:               HTTPTLS{ReloadInterval: Duration(time.Minute)},
+			HTTP2:             true,
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(15 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		OAuth: OAuth{
+			RedirectURL: "http://localhost:8080/callback",
+			Scopes:      []string{"profile", "email"},
+		},
+		Tokens: Tokens{
+			AccessTokenFormat: "jwt",
+			AccessTokenTTL:    Duration(time.Hour),
+		},
+		Vault: Vault{KEKID: "1", TTL: Duration(30 * 24 * time.Hour)},
+		Login: Login{
+			StateTTL:      Duration(5 * time.Minute),
+			CodeTTL:       Duration(time.Minute),
+			DeviceCodeTTL: Duration(10 * time.Minute),
+		},
+		Redis: Redis{Mode: "standalone"},
+		UI:    UI{DefaultLocale: "en"},
+		Storage: Storage{
+			Driver:   "memory",
+			Database: "oauth",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "oauth2-server",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimit{
+			Enabled:         true,
+			Login:           RateRule{IP: Rate{30, time.Minute}, Client: Rate{600, time.Minute}},
+			Callback:        RateRule{IP: Rate{30, time.Minute}, User: Rate{20, time.Minute}},
+			Token:           RateRule{IP: Rate{60, time.Minute}, Client: Rate{600, time.Minute}},
+			Logout:          RateRule{IP: Rate{60, time.Minute}},
+			Introspect:      RateRule{Client: Rate{6000, time.Minute}},
+			Revoke:          RateRule{IP: Rate{60, time.Minute}},
+			UserInfo:        RateRule{IP: Rate{120, time.Minute}, User: Rate{60, time.Minute}},
+			Admin:           RateRule{IP: Rate{120, time.Minute}, User: Rate{120, time.Minute}},
+			FailuresFree:    5,
+			FailureWindow:   Duration(15 * time.Minute),
+			FailureDelay:    Duration(time.Second),
+			FailureMaxDelay: Duration(5 * time.Minute),
+		},
+	}
+}
+
+// Validate checks the whole configuration and reports every problem at once.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.HTTP.Addr == "" {
+		fail("http.addr", "required")
+	}
+	if (c.HTTP.TLS.CertFile == "") != (c.HTTP.TLS.KeyFile == "") {
+		fail("http.tls", "cert_file and key_file must be set together")
+	}
+	for _, t := range []struct {
+		key string
+		d   Duration
+	}{
+		{"http.read_header_timeout", c.HTTP.ReadHeaderTimeout},
+		{"http.read_timeout", c.HTTP.ReadTimeout},
+		{"http.write_timeout", c.HTTP.WriteTimeout},
+		{"http.idle_timeout", c.HTTP.IdleTimeout},
+		{"http.drain_delay", c.HTTP.DrainDelay},
+		{"http.hsts_max_age", c.HTTP.HSTSMaxAge},
+	} {
+		if t.d < 0 {
+			fail(t.key, "must not be negative")
+		}
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		fail("http.shutdown_timeout", "must be positive")
+	}
+	if c.HTTP.MaxHeaderBytes < 0 {
+		fail("http.max_header_bytes", "must not be negative")
+	}
+	if c.HTTP.MaxConnections < 0 {
+		fail("http.max_connections", "must not be negative, 0 is unlimited")
+	}
+
+	if c.OAuth.ClientID == "" {
+		fail("oauth.client_id", "required")
+	}
+	if c.OAuth.ClientSecret == "" {
+		fail("oauth.client_secret", "required")
+	}
+	if !strings.HasPrefix(c.OAuth.RedirectURL, "http://") && !strings.HasPrefix(c.OAuth.RedirectURL, "https://") {
+		fail("oauth.redirect_url", "must be an http or https URL, got %q", c.OAuth.RedirectURL)
+	}
+	if len(c.OAuth.Scopes) == 0 {
+		fail("oauth.scopes", "at least one scope is required")
+	}
+
+	if c.Tokens.SigningKeyFile == "" && len(c.Tokens.Secret) < 32 {
+		fail("tokens.secret", "at least 32 bytes are required unless tokens.signing_key_file is set")
+	}
+	switch strings.ToLower(c.Tokens.AccessTokenFormat) {
+	case "", "jwt", "opaque":
+	default:
+		fail("tokens.access_token_format", "must be jwt or opaque, got %q", c.Tokens.AccessTokenFormat)
+	}
+	if c.Tokens.AccessTokenTTL <= 0 {
+		fail("tokens.access_token_ttl", "must be positive")
+	}
+
+	if c.Vault.KEK == "" {
+		fail("vault.kek", "required")
+	}
+	if c.Vault.KEKID == "" {
+		fail("vault.kek_id", "required")
+	}
+	if c.Vault.TTL <= 0 {
+		fail("vault.ttl", "must be positive")
+	}
+
+	if c.Login.CookieKey == "" {
+		fail("login.cookie_key", "required")
+	}
+	if c.Login.StateTTL <= 0 {
+		fail("login.state_ttl", "must be positive")
+	}
+	// RFC 6749 section 4.1.2 recommends at most ten minutes
+	if c.Login.CodeTTL <= 0 || c.Login.CodeTTL > Duration(10*time.Minute) {
+		fail("login.code_ttl", "must be positive and at most 10m, got %s", c.Login.CodeTTL)
+	}
+	if c.Login.DeviceCodeTTL <= 0 {
+		fail("login.device_code_ttl", "must be positive")
+	}
+
+	switch c.StateDriver() {
+	case "memory":
+	case "redis":
+		if len(c.Redis.Addrs) == 0 {
+			fail("redis.addrs", "required when state.driver is redis")
+		}
+		switch c.Redis.Mode {
+		case "", "standalone":
+			if len(c.Redis.Addrs) > 1 {
+				fail("redis.addrs", "standalone mode takes exactly one address")
+			}
+		case "sentinel":
+			if c.Redis.MasterName == "" {
+				fail("redis.master_name", "required in sentinel mode")
+			}
+		case "cluster":
+			if c.Redis.DB != 0 {
+				fail("redis.db", "Redis Cluster only has database 0")
+			}
+		default:
+			fail("redis.mode", "must be standalone, sentinel or cluster, got %q", c.Redis.Mode)
+		}
+	case "mongodb":
+		if c.Storage.Driver != "mongodb" {
+			fail("state.driver", "mongodb keeps the state in the storage database and needs storage.driver mongodb")
+		}
+	default:
+		fail("state.driver", "must be memory, redis or mongodb, got %q", c.State.Driver)
+	}
+
+	switch c.Storage.Driver {
+	case "memory":
+	case "postgres", "mysql", "mongodb":
+		if c.Storage.DSN == "" {
+			fail("storage.dsn", "required for the %s driver", c.Storage.Driver)
+		}
+	default:
+		fail("storage.driver", "must be memory, postgres, mysql or mongodb, got %q", c.Storage.Driver)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			fail("tracing.file", "required for the file exporter")
+		}
+	default:
+		fail("tracing.exporter", "must be none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	switch c.RateLimit.Driver {
+	case "", "memory", "redis":
+	default:
+		fail("ratelimit.driver", "must be memory or redis, got %q", c.RateLimit.Driver)
+	}
+	if c.RateLimit.Driver == "redis" && c.StateDriver() != "redis" {
+		fail("ratelimit.driver", "redis shares the state store's connection and needs state.driver redis")
+	}
+	for _, p := range c.RateLimit.TrustedProxies {
+		if _, err := netip.ParsePrefix(p); err != nil {
+			fail("ratelimit.trusted_proxies", "%q is not a CIDR prefix", p)
+		}
+	}
+	if c.RateLimit.FailuresFree < 0 {
+		fail("ratelimit.failures_free", "must not be negative")
+	}
+	if c.RateLimit.FailureDelay < 0 || c.RateLimit.FailureMaxDelay < c.RateLimit.FailureDelay {
+		fail("ratelimit.failure_delay", "must not be negative or above ratelimit.failure_max_delay")
+	}
+	if c.RateLimit.FailureDelay > 0 && c.RateLimit.FailureWindow <= 0 {
+		fail("ratelimit.failure_window", "must be positive")
+	}
+
+	for _, e := range c.Admin.Roles {
+		principal, role, ok := strings.Cut(e, "=")
+		if !ok || strings.TrimSpace(principal) == "" {
+			fail("admin.roles", "%q is not principal=role", e)
+			continue
+		}
+		switch strings.TrimSpace(role) {
+		case "viewer", "operator", "admin":
+		default:
+			fail("admin.roles", "role of %s must be viewer, operator or admin, got %q", principal, role)
+		}
+	}
+	if c.Admin.Enabled && len(c.Admin.Roles) == 0 {
+		fail("admin.roles", "required when the admin API is enabled")
+	}
+
+	if c.Audit.Storage {
+		switch c.Storage.Driver {
+		case "postgres", "mysql":
+			fail("audit.storage", "the %s driver cannot keep the audit trail, only memory and mongodb can", c.Storage.Driver)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// StateDriver resolves an empty state.driver: Redis when an address is
+// configured, the in-process store otherwise.
+func (c *Config) StateDriver() string {
+	if c.State.Driver != "" {
+		return c.State.Driver
+	}
+	if len(c.Redis.Addrs) > 0 {
+		return "redis"
+	}
+	return "memory"
+}
+
+// RateLimitDriver resolves an empty ratelimit.driver to redis when the
+// state is in Redis, so the limits are shared between replicas whenever
+// Redis is there, and to memory otherwise.
+func (c *Config) RateLimitDriver() string {
+	if c.RateLimit.Driver != "" {
+		return c.RateLimit.Driver
+	}
+	if c.StateDriver() == "redis" {
+		return "redis"
+	}
+	return "memory"
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// required are the settings without a usable default.
+var required = map[string]string{
+	"OAUTH_CLIENT_ID":     "google-client",
+	"OAUTH_CLIENT_SECRET": "google-secret",
+	"JWT_SECRET":          strings.Repeat("s", 32),
+	"VAULT_KEK":           "kek",
+	"LOGIN_COOKIE_KEY":    "cookie-key",
+}
+
+// env returns a LookupEnv over required and vars, vars winning.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+		v, ok := required[name]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+http:
+  addr: ":1"
+  read_timeout: 1s
+  write_timeout: 1s
+tokens:
+  access_token_ttl: 1m
+`)
+	dotenv := writeFile(t, ".env", "HTTP_READ_TIMEOUT=2s\nHTTP_WRITE_TIMEOUT=2s\nHTTP_IDLE_TIMEOUT=2s\n")
+
+	cfg, err := (&Loader{
+		Args:      []string{"-config", file, "-http.write_timeout=4s"},
+		LookupEnv: env(map[string]string{"HTTP_READ_TIMEOUT": "3s", "HTTP_WRITE_TIMEOUT": "3s", "HTTP_IDLE_TIMEOUT": ""}),
+		DotEnv:    dotenv,
+	}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		key       string
+		got, want time.Duration
+	}{
+		{"default", time.Duration(cfg.HTTP.ShutdownTimeout), 30 * time.Second},
+		{"file over default", time.Duration(cfg.Tokens.AccessTokenTTL), time.Minute},
+		{"dotenv under an empty variable", time.Duration(cfg.HTTP.IdleTimeout), 2 * time.Second},
+		{"environment over dotenv and file", time.Duration(cfg.HTTP.ReadTimeout), 3 * time.Second},
+		{"flag over everything", time.Duration(cfg.HTTP.WriteTimeout), 4 * time.Second},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.key, tt.got, tt.want)
+		}
+	}
+	if cfg.HTTP.Addr != ":1" {
+		t.Errorf("http.addr from the file: got %q", cfg.HTTP.Addr)
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	for _, tt := range []struct {
+		name, content string
+		wantErr       string
+	}{
+		{"config.yaml", "redis:\n  addrs: [a:6379]\n", ""},
+		{"config.toml", "[redis]\naddrs = [\"a:6379\"]\n", ""},
+		{"config.yaml", "redis:\n  adrs: [a:6379]\n", "adrs"},
+		{"config.toml", "[redis]\nadrs = [\"a:6379\"]\n", "redis.adrs"},
+		{"config.json", "{}", "unsupported extension"},
+	} {
+		_, err := (&Loader{Args: []string{"-config", writeFile(t, tt.name, tt.content)}, LookupEnv: env(nil)}).Load()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s %q: %v", tt.name, tt.content, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s %q: got %v, want an error about %s", tt.name, tt.content, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	kek := writeFile(t, "kek", "from-file\n")
+	cfg, err := (&Loader{LookupEnv: env(map[string]string{"VAULT_KEK": "file:" + kek})}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Vault.KEK != "from-file" {
+		t.Errorf("got %q", string(cfg.Vault.KEK))
+	}
+	if s := cfg.Vault.KEK.String(); s != "[redacted]" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	_, err := (&Loader{
+		Args:      []string{"-http.read_timeout=soon", "-redis.db=one"},
+		LookupEnv: env(map[string]string{"HTTP_HTTP2": "maybe"}),
+	}).Load()
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, want := range []string{`-http.read_timeout: invalid duration "soon"`, `-redis.db: invalid integer "one"`, `HTTP_HTTP2: invalid boolean "maybe"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q missing from %v", want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := Defaults()
+		cfg.OAuth.ClientID = "google-client"
+		cfg.OAuth.ClientSecret = "google-secret"
+		cfg.Tokens.Secret = Secret(strings.Repeat("s", 32))
+		cfg.Vault.KEK = "kek"
+		cfg.Login.CookieKey = "cookie-key"
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("valid configuration refused: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{"vault keys missing", func(c *Config) { c.Vault.KEK, c.Vault.KEKID = "", "" }, []string{"vault.kek: required", "vault.kek_id: required"}},
+		{"upstream client missing", func(c *Config) { c.OAuth.ClientID, c.OAuth.ClientSecret = "", "" }, []string{"oauth.client_id: required", "oauth.client_secret: required"}},
+		{"short token secret", func(c *Config) { c.Tokens.Secret = "short" }, []string{"tokens.secret"}},
+		{"signing key instead of secret", func(c *Config) { c.Tokens.Secret, c.Tokens.SigningKeyFile = "", "key.pem" }, nil},
+		{"code TTL above ten minutes", func(c *Config) { c.Login.CodeTTL = Duration(11 * time.Minute) }, []string{"login.code_ttl"}},
+		{"redis without address", func(c *Config) { c.State.Driver = "redis" }, []string{"redis.addrs: required"}},
+		{"mongodb state without mongodb storage", func(c *Config) { c.State.Driver = "mongodb" }, []string{"state.driver"}},
+		{"database without DSN", func(c *Config) { c.Storage.Driver = "postgres" }, []string{"storage.dsn"}},
+		{"bad admin role", func(c *Config) { c.Admin.Roles = []string{"alice=root"} }, []string{"admin.roles"}},
+		{"bad proxy", func(c *Config) { c.RateLimit.TrustedProxies = []string{"10.0.0.1"} }, []string{"ratelimit.trusted_proxies"}},
+	} {
+		cfg := valid()
+		tt.change(cfg)
+		err := cfg.Validate()
+		if len(tt.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: accepted", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: %q missing from %v", tt.name, want, err)
+			}
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want time.Duration
+		ok   bool
+	}{
+		{"90s", 90 * time.Second, true},
+		{"15m", 15 * time.Minute, true},
+		{"720h", 720 * time.Hour, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"-1s", -time.Second, true},
+		{"0", 0, true},
+		{"10", 0, false},
+		{"1d", 0, false},
+		{"", 0, false},
+	} {
+		var d Duration
+		err := d.UnmarshalText([]byte(tt.text))
+		if tt.ok != (err == nil) || (tt.ok && time.Duration(d) != tt.want) {
+			t.Errorf("%q: got %s, %v", tt.text, d, err)
+		}
+	}
+	if b, _ := Duration(90 * time.Second).MarshalText(); string(b) != "1m30s" {
+		t.Errorf("MarshalText: %s", b)
+	}
+}
+
+func TestRateRule(t *testing.T) {
+	var r RateRule
+	if err := r.UnmarshalText([]byte("ip=20/1m, user=5/s")); err != nil {
+		t.Fatal(err)
+	}
+	if r.IP != (Rate{20, time.Minute}) || r.User != (Rate{5, time.Second}) || r.Client != (Rate{}) {
+		t.Errorf("got %+v", r)
+	}
+	if r.String() != "ip=20/1m,user=5/1s" {
+		t.Errorf("String() = %q", r.String())
+	}
+	for _, bad := range []string{"host=1/m", "ip=20", "ip=x/1m", "ip=1/0s"} {
+		if err := r.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("tokens:\n  access_token_ttl: 1h\nhttp:\n  addr: \":1\"\n")
+	l := &Loader{Args: []string{"-config", path}, LookupEnv: env(nil)}
+	current, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reloadable change is applied; the listen address needs a restart
+	// and keeps its running value.
+	write("tokens:\n  access_token_ttl: 5m\nhttp:\n  addr: \":2\"\n")
+	var applied *Config
+	next := l.reload(current, func(c *Config) error { applied = c; return nil })
+	if applied == nil || next != applied {
+		t.Fatal("reload did not apply the new configuration")
+	}
+	if next.Tokens.AccessTokenTTL != Duration(5*time.Minute) || next.HTTP.Addr != ":1" {
+		t.Errorf("got access_token_ttl %s and http.addr %q", next.Tokens.AccessTokenTTL, next.HTTP.Addr)
+	}
+	if current.Tokens.AccessTokenTTL != Duration(time.Hour) {
+		t.Error("reload modified the running configuration")
+	}
+
+	// A configuration that does not load, or that apply refuses, keeps
+	// the running one.
+	write("tokens:\n  access_token_ttl: soon\n")
+	if got := l.reload(next, func(*Config) error { t.Error("applied an invalid configuration"); return nil }); got != next {
+		t.Error("invalid configuration replaced the running one")
+	}
+	write("tokens:\n  access_token_ttl: 10m\nhttp:\n  addr: \":1\"\n")
+	if got := l.reload(next, func(*Config) error { return errors.New("refused") }); got != next {
+		t.Error("refused configuration replaced the running one")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, b := Defaults(), Defaults()
+	b.OAuth.ClientsFile = "clients.json"
+	b.Tokens.AccessTokenFormat = "opaque"
+	b.Redis.Addrs = []string{"a:6379"}
+	reloadable, structural := Diff(a, b)
+	if strings.Join(reloadable, " ") != "oauth.clients_file tokens.access_token_format" || strings.Join(structural, " ") != "redis.addrs" {
+		t.Errorf("got %v and %v", reloadable, structural)
+	}
+	if m := Merge(a, b); m.OAuth.ClientsFile != "clients.json" || len(m.Redis.Addrs) != 0 {
+		t.Errorf("Merge: %+v", m)
+	}
+}
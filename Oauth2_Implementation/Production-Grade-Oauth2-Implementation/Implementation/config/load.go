@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader reads a Config from its sources. A server typically uses
+//
+//	&config.Loader{Args: os.Args[1:], DotEnv: ".env"}
+type Loader struct {
+	// Args are the command-line arguments without the program name.
+	Args []string
+	// LookupEnv reads an environment variable. Defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+	// DotEnv is an optional dotenv file. Its variables apply when the
+	// process environment does not set them; a missing file is ignored.
+	DotEnv string
+	// Output receives flag errors and -help. Defaults to os.Stderr.
+	Output io.Writer
+}
+
+// Load layers defaults, the config file, the environment and flags, resolves
+// secret file references and validates the result. Every problem found is
+// reported in the returned error. -help returns flag.ErrHelp.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Defaults()
+
+	flags, path, err := l.parseFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := l.environment()
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = env("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := decodeFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	v := reflect.ValueOf(cfg).Elem()
+	walk(v.Type(), "", nil, func(key string, f reflect.StructField, index []int) {
+		name := f.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		if raw := env(name); raw != "" {
+			if err := set(v.FieldByIndex(index), f, raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	})
+	for _, fl := range flags {
+		if err := set(v.FieldByIndex(fl.index), fl.field, fl.raw); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", fl.key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if err := resolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// flagValue is a flag given on the command line, applied after the
+// environment.
+type flagValue struct {
+	key   string
+	field reflect.StructField
+	index []int
+	raw   string
+}
+
+// parseFlags defines one flag per configuration key, named after its file
+// key (-oauth.client_id), plus -config for the file itself.
+func (l *Loader) parseFlags() ([]flagValue, string, error) {
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	if l.Output != nil {
+		flags.SetOutput(l.Output)
+	}
+	path := flags.String("config", "", "YAML or TOML configuration file (env CONFIG_FILE)")
+
+	var values []flagValue
+	walk(reflect.TypeOf(Config{}), "", nil, func(key string, f reflect.StructField, index []int) {
+		usage := "see " + key + " in the configuration file"
+		if env := f.Tag.Get("env"); env != "" {
+			usage += " (env " + env + ")"
+		}
+		record := func(raw string) error {
+			values = append(values, flagValue{key: key, field: f, index: index, raw: raw})
+			return nil
+		}
+		if f.Type.Kind() == reflect.Bool {
+			flags.BoolFunc(key, usage, record)
+		} else {
+			flags.Func(key, usage, record)
+		}
+	})
+	if err := flags.Parse(l.Args); err != nil {
+		return nil, "", err
+	}
+	if flags.NArg() > 0 {
+		return nil, "", fmt.Errorf("config: unexpected argument %q", flags.Arg(0))
+	}
+	return values, *path, nil
+}
+
+// environment returns a lookup over the process environment and, below it,
+// the dotenv file. Empty variables count as unset so that a template .env
+// with blank entries does not override the config file.
+func (l *Loader) environment() (func(string) string, error) {
+	lookup := l.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	dotenv := map[string]string{}
+	if l.DotEnv != "" {
+		var err error
+		dotenv, err = godotenv.Read(l.DotEnv)
+		if errors.Is(err, fs.ErrNotExist) {
+			dotenv = map[string]string{}
+		} else if err != nil {
+			return nil, fmt.Errorf("config: reading %s: %w", l.DotEnv, err)
+		}
+	}
+	return func(name string) string {
+		if v, ok := lookup(name); ok && v != "" {
+			return v
+		}
+		return dotenv[name]
+	}, nil
+}
+
+// decodeFile decodes a .yaml, .yml or .toml file over cfg. Unknown keys are
+// errors, so that a typo does not silently fall back to a default.
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && err != io.EOF {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return fmt.Errorf("config: %s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("config: %s: unsupported extension %q, use .yaml, .yml or .toml", path, ext)
+	}
+	return nil
+}
+
+// resolveSecrets replaces "file:" references with the file contents, less a
+// trailing newline.
+func resolveSecrets(cfg *Config) error {
+	var errs []error
+	v := reflect.ValueOf(cfg).Elem()
+	walk(v.Type(), "", nil, func(key string, f reflect.StructField, index []int) {
+		if f.Type != reflect.TypeOf(Secret("")) {
+			return
+		}
+		field := v.FieldByIndex(index)
+		path, ok := strings.CutPrefix(field.String(), secretFilePrefix)
+		if !ok {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		field.SetString(strings.TrimRight(string(data), "\r\n"))
+	})
+	return errors.Join(errs...)
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// walk calls fn for every leaf field of t with its dotted file key and its
+// index for reflect.Value.FieldByIndex.
+func walk(t reflect.Type, prefix string, index []int, fn func(key string, f reflect.StructField, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := prefix + f.Tag.Get("yaml")
+		idx := append(append([]int(nil), index...), i)
+		if f.Type.Kind() == reflect.Struct && !reflect.PointerTo(f.Type).Implements(textUnmarshaler) {
+			walk(f.Type, key+".", idx, fn)
+			continue
+		}
+		fn(key, f, idx)
+	}
+}
+
+// set parses raw into a leaf field. Lists are split on the field's sep tag,
+// a comma by default.
+func set(v reflect.Value, f reflect.StructField, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		sep := f.Tag.Get("sep")
+		if sep == "" {
+			sep = ","
+		}
+		var list []string
+		for _, item := range strings.Split(raw, sep) {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
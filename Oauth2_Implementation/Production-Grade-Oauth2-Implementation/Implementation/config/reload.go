@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+)
+
+// Diff compares two configurations and returns the keys that differ, split
+// into those tagged reload:"true" and those that need a restart.
+func Diff(old, new *Config) (reloadable, structural []string) {
+	a, b := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	walk(a.Type(), "", nil, func(key string, f reflect.StructField, index []int) {
+		if reflect.DeepEqual(a.FieldByIndex(index).Interface(), b.FieldByIndex(index).Interface()) {
+			return
+		}
+		if f.Tag.Get("reload") == "true" {
+			reloadable = append(reloadable, key)
+		} else {
+			structural = append(structural, key)
+		}
+	})
+	return reloadable, structural
+}
+
+// Merge returns a copy of current with the reloadable settings of next.
+func Merge(current, next *Config) *Config {
+	merged := *current
+	m, n := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next).Elem()
+	walk(m.Type(), "", nil, func(key string, f reflect.StructField, index []int) {
+		if f.Tag.Get("reload") == "true" {
+			m.FieldByIndex(index).Set(n.FieldByIndex(index))
+		}
+	})
+	return &merged
+}
+
+// Watch reloads the configuration on every SIGHUP until ctx is done. A
+// configuration that fails to load or validate is logged and ignored.
+// Otherwise the reloadable settings are merged into current and passed to
+// apply; changes to other settings are logged as needing a restart.
+func (l *Loader) Watch(ctx context.Context, current *Config, apply func(*Config) error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			current = l.reload(current, apply)
+		}
+	}
+}
+
+// reload loads the configuration once for Watch and returns the one now
+// running: current with the reloadable settings merged in if they changed
+// and apply took them, current itself otherwise.
+func (l *Loader) reload(current *Config, apply func(*Config) error) *Config {
+	next, err := l.Load()
+	if err != nil {
+		log.Printf("config: reload failed, keeping the running configuration: %v", err)
+		return current
+	}
+	reloadable, structural := Diff(current, next)
+	if len(structural) > 0 {
+		log.Printf("config: changes to %v need a restart and were not applied", structural)
+	}
+	if len(reloadable) == 0 {
+		log.Println("config: reloaded, nothing to apply")
+		return current
+	}
+	merged := Merge(current, next)
+	if err := apply(merged); err != nil {
+		log.Printf("config: applying %v failed: %v", reloadable, err)
+		return current
+	}
+	log.Printf("config: reloaded %v", reloadable)
+	return merged
+}
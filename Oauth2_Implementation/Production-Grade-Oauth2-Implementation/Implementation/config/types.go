@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as "90s", "15m" or "720h" in files,
+// environment variables and flags.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Secret is a value that must not end up in logs. "file:/run/secrets/kek"
+// is replaced by the contents of that file when the configuration is loaded.
+type Secret string
+
+// secretFilePrefix marks a Secret that references a file.
+const secretFilePrefix = "file:"
+
+// String redacts the value so that printing a Config is safe.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// Rate is a request rate written "20/1m", "5/s" or "1000/1h". "0" or "off"
+// is unlimited.
+type Rate struct {
+	N   int
+	Per time.Duration
+}
+
+func (r Rate) String() string {
+	if r.N <= 0 {
+		return "off"
+	}
+	// 1m rather than 1m0s
+	per := r.Per.String()
+	if strings.HasSuffix(per, "m0s") {
+		per = strings.TrimSuffix(per, "0s")
+	}
+	if strings.HasSuffix(per, "h0m") {
+		per = strings.TrimSuffix(per, "0m")
+	}
+	return strconv.Itoa(r.N) + "/" + per
+}
+
+func (r Rate) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+func (r *Rate) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" || s == "0" || s == "off" {
+		*r = Rate{}
+		return nil
+	}
+	n, per, ok := strings.Cut(s, "/")
+	count, err := strconv.Atoi(n)
+	if !ok || err != nil || count < 0 {
+		return fmt.Errorf("invalid rate %q, want e.g. 20/1m", text)
+	}
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid rate %q, want e.g. 20/1m", text)
+	}
+	*r = Rate{N: count, Per: d}
+	return nil
+}
+
+// RateRule limits one endpoint per client IP, per client_id and per user,
+// written "ip=20/1m,client=600/1m,user=10/1m". Missing dimensions are
+// unlimited.
+type RateRule struct {
+	IP     Rate
+	Client Rate
+	User   Rate
+}
+
+func (r RateRule) String() string {
+	var parts []string
+	for _, d := range []struct {
+		name string
+		rate Rate
+	}{{"ip", r.IP}, {"client", r.Client}, {"user", r.User}} {
+		if d.rate.N > 0 {
+			parts = append(parts, d.name+"="+d.rate.String())
+		}
+	}
+	if len(parts) == 0 {
+		return "off"
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r RateRule) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+func (r *RateRule) UnmarshalText(text []byte) error {
+	var rule RateRule
+	for _, part := range strings.Split(string(text), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "off" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		var target *Rate
+		switch strings.TrimSpace(name) {
+		case "ip":
+			target = &rule.IP
+		case "client":
+			target = &rule.Client
+		case "user":
+			target = &rule.User
+		default:
+			return fmt.Errorf("invalid rate rule %q, dimensions are ip, client and user", part)
+		}
+		if err := target.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+	}
+	*r = rule
+	return nil
+}
@@ -0,0 +1,70 @@
+// Package cryptoutil generates the secrets of the server (state values,
+// codes, client secrets, opaque tokens) and compares them. Generators take
+// the entropy in bytes, not the length of the result, and report a failing
+// random source as an error for the caller to answer, instead of ending the
+// process.
+package cryptoutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// MinTokenBytes is the least entropy Token and HexToken accept: 128 bits, the
+// minimum RFC 6749 section 10.10 asks for credentials an attacker could
+// guess.
+const MinTokenBytes = 16
+
+// Bytes returns n bytes from crypto/rand.
+func Bytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("cryptoutil: reading random bytes: %w", err)
+	}
+	return b, nil
+}
+
+// Token returns n random bytes as unpadded base64url, 8n bits of entropy in
+// ceil(4n/3) URL-safe characters.
+func Token(n int) (string, error) {
+	if n < MinTokenBytes {
+		return "", fmt.Errorf("cryptoutil: %d bytes are too few for a token, need at least %d", n, MinTokenBytes)
+	}
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HexToken returns n random bytes hex encoded, 8n bits in 2n characters.
+func HexToken(n int) (string, error) {
+	if n < MinTokenBytes {
+		return "", fmt.Errorf("cryptoutil: %d bytes are too few for a token, need at least %d", n, MinTokenBytes)
+	}
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Equal compares a secret presented by a caller with the expected one in
+// constant time. Both are hashed first, so neither their contents nor the
+// length of the expected value leak through timing.
+func Equal(presented, expected string) bool {
+	a := sha256.Sum256([]byte(presented))
+	b := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// EqualBytes is Equal for byte slices.
+func EqualBytes(presented, expected []byte) bool {
+	a := sha256.Sum256(presented)
+	b := sha256.Sum256(expected)
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
@@ -0,0 +1,113 @@
+package cryptoutil
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		gen    func(int) (string, error)
+		n      int
+		length int
+		decode func(string) ([]byte, error)
+	}{
+		{"Token 16", Token, 16, 22, base64.RawURLEncoding.DecodeString},
+		{"Token 32", Token, 32, 43, base64.RawURLEncoding.DecodeString},
+		{"Token 33", Token, 33, 44, base64.RawURLEncoding.DecodeString},
+		{"HexToken 16", HexToken, 16, 32, hex.DecodeString},
+		{"HexToken 32", HexToken, 32, 64, hex.DecodeString},
+	} {
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			tok, err := tt.gen(tt.n)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if len(tok) != tt.length {
+				t.Fatalf("%s: %q has %d characters, want %d", tt.name, tok, len(tok), tt.length)
+			}
+			// Decoding proves the alphabet and that no entropy was cut off.
+			b, err := tt.decode(tok)
+			if err != nil || len(b) != tt.n {
+				t.Fatalf("%s: %q decodes to %d bytes (%v), want %d", tt.name, tok, len(b), err, tt.n)
+			}
+			if seen[tok] {
+				t.Fatalf("%s: %q generated twice", tt.name, tok)
+			}
+			seen[tok] = true
+		}
+	}
+}
+
+func TestTokenTooShort(t *testing.T) {
+	for _, gen := range []func(int) (string, error){Token, HexToken} {
+		for _, n := range []int{-1, 0, 8, MinTokenBytes - 1} {
+			if tok, err := gen(n); err == nil {
+				t.Errorf("%d bytes: got %q, want an error", n, tok)
+			}
+		}
+	}
+}
+
+func TestCodeVerifier(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		v, err := CodeVerifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != 64 || !ValidCodeVerifier(v) {
+			t.Fatalf("%q is not a 64 character code verifier", v)
+		}
+		if !VerifyCodeChallenge(MethodS256, S256Challenge(v), v) {
+			t.Fatalf("%q does not answer its own challenge", v)
+		}
+	}
+}
+
+func TestValidCodeVerifier(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		v    string
+		ok   bool
+	}{
+		{"shortest", strings.Repeat("a", MinVerifierLength), true},
+		{"longest", strings.Repeat("a", MaxVerifierLength), true},
+		{"every allowed character", "ABCXYZabcxyz0189-._~" + strings.Repeat("a", 23), true},
+		{"too short", strings.Repeat("a", MinVerifierLength-1), false},
+		{"too long", strings.Repeat("a", MaxVerifierLength+1), false},
+		{"empty", "", false},
+		{"plus", strings.Repeat("a", 42) + "+", false},
+		{"slash", strings.Repeat("a", 42) + "/", false},
+		{"padding", strings.Repeat("a", 42) + "=", false},
+		{"space", strings.Repeat("a", 42) + " ", false},
+		{"non-ASCII", strings.Repeat("a", 42) + "é", false},
+	} {
+		if got := ValidCodeVerifier(tt.v); got != tt.ok {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.ok)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"secret", "secret", true},
+		{"", "", true},
+		{"secret", "Secret", false},
+		{"secret", "secret ", false},
+		{"secret", "", false},
+	} {
+		if got := Equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equal(%q, %q) = %v", tt.a, tt.b, got)
+		}
+		if got := EqualBytes([]byte(tt.a), []byte(tt.b)); got != tt.want {
+			t.Errorf("EqualBytes(%q, %q) = %v", tt.a, tt.b, got)
+		}
+	}
+}
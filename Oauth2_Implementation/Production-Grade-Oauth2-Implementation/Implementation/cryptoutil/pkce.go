@@ -0,0 +1,82 @@
+package cryptoutil
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Code verifier lengths allowed by RFC 7636 section 4.1.
+const (
+	MinVerifierLength = 43
+	MaxVerifierLength = 128
+)
+
+// Code challenge methods of RFC 7636 section 4.2.
+const (
+	MethodPlain = "plain"
+	MethodS256  = "S256"
+)
+
+// verifierBytes gives verifiers 384 bits of entropy in 64 characters, well
+// above the 256 bits RFC 7636 section 7.1 recommends.
+const verifierBytes = 48
+
+// CodeVerifier returns a new PKCE code verifier. Base64url is a subset of
+// the unreserved characters RFC 7636 allows, so no character is lost to
+// encoding.
+func CodeVerifier() (string, error) {
+	return Token(verifierBytes)
+}
+
+// ValidCodeVerifier reports whether v has the length and characters RFC 7636
+// section 4.1 requires: 43 to 128 of A-Z, a-z, 0-9, "-", ".", "_" and "~".
+func ValidCodeVerifier(v string) bool {
+	if len(v) < MinVerifierLength || len(v) > MaxVerifierLength {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// S256Challenge derives the S256 code challenge of verifier (RFC 7636
+// section 4.2).
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidCodeChallenge reports whether challenge is well formed for method:
+// a code verifier itself for plain, the base64url SHA-256 of one for S256.
+func ValidCodeChallenge(method, challenge string) bool {
+	switch method {
+	case MethodPlain:
+		return ValidCodeVerifier(challenge)
+	case MethodS256:
+		b, err := base64.RawURLEncoding.DecodeString(challenge)
+		return err == nil && len(b) == sha256.Size
+	}
+	return false
+}
+
+// VerifyCodeChallenge reports whether verifier answers challenge under
+// method (RFC 7636 section 4.6). The comparison takes constant time.
+func VerifyCodeChallenge(method, challenge, verifier string) bool {
+	if !ValidCodeVerifier(verifier) {
+		return false
+	}
+	switch method {
+	case MethodPlain:
+		return Equal(verifier, challenge)
+	case MethodS256:
+		return Equal(S256Challenge(verifier), challenge)
+	}
+	return false
+}
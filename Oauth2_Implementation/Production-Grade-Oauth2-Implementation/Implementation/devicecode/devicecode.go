@@ -0,0 +1,273 @@
+// Package devicecode keeps pending device authorizations (RFC 8628): the
+// device polls with its device_code while the user enters the user_code in a
+// browser and logs in. Once approved, the device_code can be redeemed once.
+package devicecode
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var (
+	ErrExpired  = errors.New("devicecode: code expired or unknown")
+	ErrPending  = errors.New("devicecode: authorization pending")
+	ErrSlowDown = errors.New("devicecode: polling too fast")
+	ErrDenied   = errors.New("devicecode: authorization denied")
+)
+
+// Interval is how long devices have to wait between polls.
+const Interval = 5 * time.Second
+
+// Key prefixes in the state store: authorizations by device code, device
+// codes by user code, and the time of the last poll.
+//
+// The authorization is only written by Start and by whoever wins the user
+// code in Approve or Deny; polls keep their time under PollKeyPrefix, so
+// they cannot write back a stale pending record over an approval. No prefix
+// is the start of another, so each names only its own keys.
+const (
+	KeyPrefix     = "devicecode:device:"
+	UserKeyPrefix = "devicecode:user:"
+	PollKeyPrefix = "devicecode:poll:"
+)
+
+// userCodeAlphabet has no vowels, so codes do not spell words, and no
+// characters that are easily confused (RFC 8628 section 6.1).
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// Status of an authorization.
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusDenied   Status = "denied"
+)
+
+// Authorization is what a device code stands for. The user fields are set
+// on approval.
+type Authorization struct {
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	UserCode  string    `json:"user_code"`
+	Status    Status    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	UserID      string                 `json:"user_id,omitempty"`
+	GrantID     string                 `json:"grant_id,omitempty"`
+	UpstreamRef string                 `json:"upstream_ref,omitempty"`
+	User        map[string]interface{} `json:"user,omitempty"`
+}
+
+// Store keeps authorizations in the state store for ttl.
+type Store struct {
+	kv  state.Store
+	ttl time.Duration
+}
+
+func NewStore(kv state.Store, ttl time.Duration) *Store {
+	return &Store{kv: kv, ttl: ttl}
+}
+
+// TTL is how long the user has to approve a device.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Start stores a pending authorization for a and returns its device code
+// and user code. The user code is formatted as XXXX-XXXX.
+func (s *Store) Start(ctx context.Context, a Authorization) (deviceCode, userCode string, err error) {
+	if deviceCode, err = cryptoutil.Token(32); err != nil {
+		return "", "", fmt.Errorf("devicecode: %w", err)
+	}
+	a.Status = StatusPending
+	a.ExpiresAt = time.Now().Add(s.ttl)
+
+	// User codes are short; retry the rare collision with a pending one
+	for range 3 {
+		if a.UserCode, err = newUserCode(); err != nil {
+			return "", "", err
+		}
+		ok, err := s.kv.SetNX(ctx, UserKeyPrefix+a.UserCode, []byte(deviceCode), s.ttl)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			if err := s.put(ctx, deviceCode, a); err != nil {
+				return "", "", err
+			}
+			return deviceCode, FormatUserCode(a.UserCode), nil
+		}
+	}
+	return "", "", errors.New("devicecode: no free user code")
+}
+
+// Lookup finds the pending authorization for a user code as typed by the
+// user. The code stays valid until Approve or Deny.
+func (s *Store) Lookup(ctx context.Context, userCode string) (string, Authorization, error) {
+	var a Authorization
+	b, err := s.kv.Get(ctx, UserKeyPrefix+NormalizeUserCode(userCode))
+	if err == state.ErrNotFound {
+		return "", a, ErrExpired
+	}
+	if err != nil {
+		return "", a, err
+	}
+	deviceCode := string(b)
+	if a, err = s.get(ctx, deviceCode); err != nil {
+		return "", a, err
+	}
+	if a.Status != StatusPending {
+		return "", a, ErrExpired
+	}
+	return deviceCode, a, nil
+}
+
+// Approve records the user's approval; the device gets its token on the
+// next poll.
+func (s *Store) Approve(ctx context.Context, deviceCode string, approved Authorization) error {
+	return s.finish(ctx, deviceCode, func(a *Authorization) {
+		a.Status = StatusApproved
+		a.UserID, a.GrantID, a.UpstreamRef, a.User = approved.UserID, approved.GrantID, approved.UpstreamRef, approved.User
+		a.Scopes = approved.Scopes
+	})
+}
+
+// Deny records that the user refused.
+func (s *Store) Deny(ctx context.Context, deviceCode string) error {
+	return s.finish(ctx, deviceCode, func(a *Authorization) { a.Status = StatusDenied })
+}
+
+// finish applies the user's decision. Taking the user code with GETDEL
+// decides between concurrent Approve and Deny calls: only the one that gets
+// it writes the authorization.
+func (s *Store) finish(ctx context.Context, deviceCode string, update func(*Authorization)) error {
+	a, err := s.get(ctx, deviceCode)
+	if err != nil {
+		return err
+	}
+	if a.Status != StatusPending {
+		return ErrExpired
+	}
+	if _, err := s.kv.GetDel(ctx, UserKeyPrefix+a.UserCode); err == state.ErrNotFound {
+		return ErrExpired
+	} else if err != nil {
+		return err
+	}
+	update(&a)
+	return s.put(ctx, deviceCode, a)
+}
+
+// Poll answers a device polling with deviceCode. It fails with ErrPending
+// until the user decided, ErrSlowDown when polled faster than Interval,
+// ErrDenied once if the user refused and ErrExpired afterwards. An approved
+// authorization is returned and deleted, so it yields one token.
+func (s *Store) Poll(ctx context.Context, deviceCode string) (Authorization, error) {
+	a, err := s.get(ctx, deviceCode)
+	if err != nil {
+		return a, err
+	}
+	switch a.Status {
+	case StatusApproved, StatusDenied:
+		// GETDEL decides between concurrent polls
+		if _, err := s.kv.GetDel(ctx, KeyPrefix+deviceCode); err == state.ErrNotFound {
+			return a, ErrExpired
+		} else if err != nil {
+			return a, err
+		}
+		if a.Status == StatusDenied {
+			return a, ErrDenied
+		}
+		return a, nil
+	}
+	// The poll key lives for Interval after every poll; a poll that finds
+	// it is too fast and starts the wait over
+	ok, err := s.kv.SetNX(ctx, PollKeyPrefix+deviceCode, []byte{1}, Interval)
+	if err != nil {
+		return a, err
+	}
+	if !ok {
+		if err := s.kv.Set(ctx, PollKeyPrefix+deviceCode, []byte{1}, Interval); err != nil {
+			return a, err
+		}
+		return a, ErrSlowDown
+	}
+	return a, ErrPending
+}
+
+func (s *Store) get(ctx context.Context, deviceCode string) (Authorization, error) {
+	var a Authorization
+	b, err := s.kv.Get(ctx, KeyPrefix+deviceCode)
+	if err == state.ErrNotFound {
+		return a, ErrExpired
+	}
+	if err != nil {
+		return a, err
+	}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return a, fmt.Errorf("devicecode: decoding authorization: %w", err)
+	}
+	return a, nil
+}
+
+// put stores a for the rest of its lifetime.
+func (s *Store) put(ctx context.Context, deviceCode string, a Authorization) error {
+	ttl := time.Until(a.ExpiresAt)
+	if ttl <= 0 {
+		return ErrExpired
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(ctx, KeyPrefix+deviceCode, b, ttl)
+}
+
+// newUserCode returns eight characters from userCodeAlphabet, about 34 bits;
+// guessing is left to the rate limits.
+func newUserCode() (string, error) {
+	code := make([]byte, 0, 8)
+	buf := make([]byte, 16)
+	for len(code) < cap(code) {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("devicecode: %w", err)
+		}
+		for _, b := range buf {
+			// Bytes from 240 up would favour the first characters
+			if int(b) < 256-256%len(userCodeAlphabet) && len(code) < cap(code) {
+				code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// FormatUserCode groups a user code for display as XXXX-XXXX.
+func FormatUserCode(code string) string {
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// NormalizeUserCode undoes what users do to codes when typing them:
+// lower case, dashes and spaces.
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,135 @@
+package devicecode
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	kv := memory.New()
+	t.Cleanup(func() { kv.Close() })
+	return NewStore(kv, time.Minute)
+}
+
+func TestPollDoesNotUndoApproval(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	deviceCode, userCode, err := s.Start(ctx, Authorization{ClientID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Poll(ctx, deviceCode); !errors.Is(err, ErrPending) {
+		t.Fatalf("first Poll = %v, want ErrPending", err)
+	}
+	if _, err := s.Poll(ctx, deviceCode); !errors.Is(err, ErrSlowDown) {
+		t.Fatalf("second Poll = %v, want ErrSlowDown", err)
+	}
+
+	// Polls racing the approval must not write the pending record back:
+	// exactly one poll, during or after the race, gets the approval
+	var wg sync.WaitGroup
+	approvals := make(chan Authorization, 21)
+	poll := func() {
+		if a, err := s.Poll(ctx, deviceCode); err == nil {
+			approvals <- a
+		}
+	}
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			poll()
+		}()
+	}
+	looked, _, err := s.Lookup(ctx, userCode)
+	if err != nil || looked != deviceCode {
+		t.Fatalf("Lookup = %q, %v", looked, err)
+	}
+	if err := s.Approve(ctx, deviceCode, Authorization{UserID: "u1", GrantID: "g1"}); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	poll()
+	close(approvals)
+
+	var got []Authorization
+	for a := range approvals {
+		got = append(got, a)
+	}
+	if len(got) != 1 || got[0].Status != StatusApproved || got[0].GrantID != "g1" {
+		t.Fatalf("approvals handed out: %+v, want one for g1", got)
+	}
+	if _, _, err := s.Lookup(ctx, userCode); !errors.Is(err, ErrExpired) {
+		t.Errorf("Lookup after Approve = %v, want ErrExpired", err)
+	}
+}
+
+func TestFinishOnce(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	deviceCode, _, err := s.Start(ctx, Authorization{ClientID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				results <- s.Approve(ctx, deviceCode, Authorization{UserID: "u1"})
+			} else {
+				results <- s.Deny(ctx, deviceCode)
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+	won := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrExpired):
+			t.Errorf("finish: %v", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d calls finished the authorization, want 1", won)
+	}
+}
+
+func TestPollRedeemsOnce(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	for _, tc := range []struct {
+		name   string
+		finish func(deviceCode string) error
+		want   error
+	}{
+		{"approved", func(c string) error { return s.Approve(ctx, c, Authorization{UserID: "u1"}) }, nil},
+		{"denied", func(c string) error { return s.Deny(ctx, c) }, ErrDenied},
+	} {
+		deviceCode, _, err := s.Start(ctx, Authorization{ClientID: "tv"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tc.finish(deviceCode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Poll(ctx, deviceCode); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Poll = %v, want %v", tc.name, err, tc.want)
+		}
+		if _, err := s.Poll(ctx, deviceCode); !errors.Is(err, ErrExpired) {
+			t.Errorf("%s: second Poll = %v, want ErrExpired", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// probeKey is never written; looking it up is a round trip to the backend.
+const probeKey = "health:probe"
+
+// StateStore checks that the state store answers. Behind a circuit breaker
+// an open breaker fails the check without touching the backend.
+func StateStore(kv state.Store) Func {
+	return func(ctx context.Context) error {
+		_, err := kv.Exists(ctx, probeKey)
+		return err
+	}
+}
+
+// Storage checks that the durable store answers a lookup.
+func Storage(s storage.Store) Func {
+	return func(ctx context.Context) error {
+		_, err := s.GetClient(ctx, probeKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+}
+
+// SigningKey checks that codec can still produce tokens it accepts, which
+// fails when a key file or key service becomes unusable.
+func SigningKey(codec tokens.Codec) Func {
+	return func(ctx context.Context) error {
+		raw, err := codec.Encode(tokens.Claims{
+			"sub": probeKey,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			return fmt.Errorf("encoding: %w", err)
+		}
+		if _, err := codec.Decode(raw); err != nil {
+			return fmt.Errorf("decoding: %w", err)
+		}
+		return nil
+	}
+}
+
+// Discovery checks that the OpenID provider at issuer publishes its
+// discovery document. A nil client means http.DefaultClient.
+func Discovery(client *http.Client, issuer string) Func {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s", url, resp.Status)
+		}
+		var doc struct {
+			Issuer string `json:"issuer"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+			return fmt.Errorf("%s: %w", url, err)
+		}
+		if doc.Issuer != issuer {
+			return fmt.Errorf("%s: issuer is %q, want %q", url, doc.Issuer, issuer)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	statememory "oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+	storagememory "oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+type downStore struct{ state.Store }
+
+func (downStore) Exists(context.Context, string) (bool, error) { return false, state.ErrUnavailable }
+
+func TestStoreChecks(t *testing.T) {
+	ctx := context.Background()
+	kv := statememory.New()
+	defer kv.Close()
+	if err := StateStore(kv)(ctx); err != nil {
+		t.Errorf("state store: %v", err)
+	}
+	if err := StateStore(downStore{kv})(ctx); !errors.Is(err, state.ErrUnavailable) {
+		t.Errorf("state store down: %v", err)
+	}
+	// The probe client does not exist; that is an answer, not a failure
+	if err := Storage(storagememory.New())(ctx); err != nil {
+		t.Errorf("storage: %v", err)
+	}
+}
+
+type brokenCodec struct{ tokens.Codec }
+
+func (brokenCodec) Encode(tokens.Claims) (string, error) { return "", errors.New("key file removed") }
+
+func TestSigningKeyCheck(t *testing.T) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := tokens.SigningKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := tokens.NewSignedCodec(key, tokens.Expectations{Issuer: "https://as.example", Type: tokens.TypeAccessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SigningKey(codec)(context.Background()); err != nil {
+		t.Errorf("working key: %v", err)
+	}
+	if err := SigningKey(brokenCodec{codec})(context.Background()); err == nil {
+		t.Error("broken key passed")
+	}
+}
+
+func TestDiscoveryCheck(t *testing.T) {
+	status, docIssuer := http.StatusOK, ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"issuer":%q}`, docIssuer)
+	}))
+	defer srv.Close()
+	issuer := srv.URL
+
+	for _, tt := range []struct {
+		name      string
+		status    int
+		docIssuer string
+		ok        bool
+	}{
+		{"published", http.StatusOK, issuer, true},
+		{"server error", http.StatusInternalServerError, issuer, false},
+		{"other issuer", http.StatusOK, "https://evil.example", false},
+	} {
+		status, docIssuer = tt.status, tt.docIssuer
+		if err := Discovery(srv.Client(), issuer)(context.Background()); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	srv.Close()
+	if err := Discovery(nil, issuer)(context.Background()); err == nil {
+		t.Error("unreachable provider passed")
+	}
+}
@@ -0,0 +1,180 @@
+// Package health serves liveness and readiness probes.
+//
+// Liveness checks only what a restart can fix, such as a signing key that
+// can no longer be used; readiness also checks the dependencies a login
+// needs (Redis, the database, the upstream provider) and fails as soon as
+// the server starts draining, so the load balancer stops sending traffic
+// before the listener closes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Func reports a dependency as healthy by returning nil.
+type Func func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   Func
+	live bool
+}
+
+// Checker runs the registered checks for the probe endpoints.
+type Checker struct {
+	timeout  time.Duration
+	mu       sync.RWMutex
+	checks   []check
+	draining atomic.Bool
+}
+
+// New returns a Checker that gives every check at most timeout, five
+// seconds by default.
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Checker{timeout: timeout}
+}
+
+// AddLiveness registers a check for both probes. A failing liveness check
+// gets the process restarted, so it must not depend on other services.
+func (c *Checker) AddLiveness(name string, fn Func) {
+	c.add(check{name: name, fn: fn, live: true})
+}
+
+// AddReadiness registers a check that only takes the server out of the load
+// balancer while it fails.
+func (c *Checker) AddReadiness(name string, fn Func) {
+	c.add(check{name: name, fn: fn})
+}
+
+func (c *Checker) add(ch check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, ch)
+}
+
+// SetDraining makes readiness fail from now on. Call it when shutdown
+// starts.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body of both probes.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Status values.
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// Live runs the liveness checks.
+func (c *Checker) Live(ctx context.Context) Report {
+	return c.run(ctx, true)
+}
+
+// Ready runs every check and fails while draining.
+func (c *Checker) Ready(ctx context.Context) Report {
+	r := c.run(ctx, false)
+	if c.draining.Load() {
+		r.Status = StatusDraining
+	}
+	return r
+}
+
+// run executes the selected checks concurrently and reports them in
+// registration order.
+func (c *Checker) run(ctx context.Context, liveOnly bool) Report {
+	c.mu.RLock()
+	var checks []check
+	for _, ch := range c.checks {
+		if ch.live || !liveOnly {
+			checks = append(checks, ch)
+		}
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.runOne(ctx, ch)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, r := range results {
+		if r.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) runOne(ctx context.Context, ch check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- ch.fn(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// A check that ignores its context must not hold up the probe.
+		err = ctx.Err()
+	}
+
+	r := Result{Name: ch.name, Status: StatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		r.Status = StatusFail
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// LiveHandler serves the liveness probe, typically on /healthz.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Live(r.Context()))
+	})
+}
+
+// ReadyHandler serves the readiness probe, typically on /readyz.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Ready(r.Context()))
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ok(context.Context) error { return nil }
+
+func probe(t *testing.T, h http.Handler) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("headers %v", rec.Header())
+	}
+	return rec.Code, report
+}
+
+func TestProbes(t *testing.T) {
+	c := New(time.Second)
+	c.AddLiveness("signing_key", ok)
+	c.AddReadiness("storage", ok)
+	c.AddReadiness("state_store", func(context.Context) error { return errors.New("connection refused") })
+
+	// A dependency that is down takes the server out of the load balancer
+	// but does not get it restarted
+	code, live := probe(t, c.LiveHandler())
+	if code != http.StatusOK || live.Status != StatusOK || len(live.Checks) != 1 || live.Checks[0].Name != "signing_key" {
+		t.Errorf("liveness: %d %+v", code, live)
+	}
+	code, ready := probe(t, c.ReadyHandler())
+	if code != http.StatusServiceUnavailable || ready.Status != StatusFail {
+		t.Errorf("readiness: %d %+v", code, ready)
+	}
+	want := []Result{
+		{Name: "signing_key", Status: StatusOK},
+		{Name: "storage", Status: StatusOK},
+		{Name: "state_store", Status: StatusFail, Error: "connection refused"},
+	}
+	if len(ready.Checks) != len(want) {
+		t.Fatalf("readiness checks %+v", ready.Checks)
+	}
+	for i, r := range ready.Checks {
+		r.LatencyMS = 0
+		if r != want[i] {
+			t.Errorf("check %d: %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	// A failing liveness check fails both
+	c.AddLiveness("broken_key", func(context.Context) error { return errors.New("key unusable") })
+	if code, live := probe(t, c.LiveHandler()); code != http.StatusServiceUnavailable || live.Status != StatusFail {
+		t.Errorf("liveness with a broken key: %d %+v", code, live)
+	}
+}
+
+func TestDraining(t *testing.T) {
+	c := New(0)
+	c.AddLiveness("signing_key", ok)
+	c.AddReadiness("storage", ok)
+	c.SetDraining()
+
+	if code, ready := probe(t, c.ReadyHandler()); code != http.StatusServiceUnavailable || ready.Status != StatusDraining {
+		t.Errorf("readiness while draining: %d %+v", code, ready)
+	}
+	if code, live := probe(t, c.LiveHandler()); code != http.StatusOK || live.Status != StatusOK {
+		t.Errorf("liveness while draining: %d %+v", code, live)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	c := New(50 * time.Millisecond)
+	hang := make(chan struct{})
+	defer close(hang)
+	// This check ignores its context; the probe answers anyway
+	c.AddReadiness("upstream", func(context.Context) error {
+		<-hang
+		return nil
+	})
+	c.AddReadiness("storage", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	code, ready := probe(t, c.ReadyHandler())
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("probe took %s", d)
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status %d", code)
+	}
+	for _, r := range ready.Checks {
+		if r.Status != StatusFail || r.Error != context.DeadlineExceeded.Error() {
+			t.Errorf("%+v, want a deadline failure", r)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate that follows its files on disk, so a
+// renewal by cert-manager or certbot is picked up without a restart. A
+// renewed pair that fails to load is logged and the previous one kept.
+type CertReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads the pair once and fails if it is unusable. The files
+// are checked again at most every interval, one minute by default.
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("httpserver: TLS needs both a certificate and a key file")
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate callback.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.checkedAt) >= r.interval {
+		r.checkedAt = now
+		modTime, err := r.latestModTime()
+		if err != nil {
+			log.Printf("httpserver: checking certificate: %v", err)
+		} else if !modTime.Equal(r.modTime) {
+			if err := r.load(modTime); err != nil {
+				log.Printf("httpserver: keeping the previous certificate: %v", err)
+			} else {
+				log.Printf("httpserver: reloaded certificate %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load must be called with mu held, or before r is shared.
+func (r *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("httpserver: loading certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// latestModTime is the newer modification time of the two files; renewals
+// usually replace both, but not always at the same instant.
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("httpserver: %w", err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,141 @@
+// Package httpserver runs an http.Handler the way it should run in
+// production: with timeouts, an optional connection limit, TLS whose
+// certificate is picked up again when it is renewed on disk, HTTP/2, and a
+// graceful drain of in-flight requests when the context is cancelled.
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Options configure the listener. Zero durations disable the respective
+// timeout, except ShutdownTimeout which defaults to 30 seconds.
+type Options struct {
+	Addr string
+
+	// CertFile and KeyFile enable TLS. Both files are checked for changes at
+	// most every CertCheckInterval (default one minute) and reloaded.
+	CertFile          string
+	KeyFile           string
+	CertCheckInterval time.Duration
+
+	// HTTP2 enables HTTP/2 over TLS. H2C enables HTTP/2 without TLS, for
+	// load balancers that talk cleartext HTTP/2 to their backends.
+	HTTP2 bool
+	H2C   bool
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// MaxConnections caps concurrently open connections; 0 is unlimited.
+	// Further connections wait in the kernel's accept queue.
+	MaxConnections int
+
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// once ctx is done.
+	ShutdownTimeout time.Duration
+
+	// OnShutdown runs as soon as ctx is done, e.g. to fail readiness.
+	// DrainDelay then keeps accepting requests for a while, so that load
+	// balancers notice before the listener closes.
+	OnShutdown func()
+	DrainDelay time.Duration
+}
+
+// ListenAndServe serves h on opts.Addr until ctx is done, then stops
+// accepting connections and waits up to opts.ShutdownTimeout for in-flight
+// requests. It returns nil after a complete drain.
+func ListenAndServe(ctx context.Context, h http.Handler, opts Options) error {
+	srv := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+		MaxHeaderBytes:    opts.MaxHeaderBytes,
+		BaseContext:       func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(opts.HTTP2)
+	srv.Protocols.SetUnencryptedHTTP2(opts.H2C)
+
+	useTLS := opts.CertFile != "" || opts.KeyFile != ""
+	if useTLS {
+		certs, err := NewCertReloader(opts.CertFile, opts.KeyFile, opts.CertCheckInterval)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return fmt.Errorf("httpserver: %w", err)
+	}
+	if opts.MaxConnections > 0 {
+		ln = LimitListener(ln, opts.MaxConnections)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			serveErr <- srv.ServeTLS(ln, "", "")
+		} else {
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	log.Printf("httpserver: serving %s on %s", scheme, ln.Addr())
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("httpserver: %w", err)
+	case <-ctx.Done():
+	}
+
+	if opts.OnShutdown != nil {
+		opts.OnShutdown()
+	}
+	if opts.DrainDelay > 0 {
+		log.Printf("httpserver: shutting down, still accepting requests for %s", opts.DrainDelay)
+		select {
+		case <-time.After(opts.DrainDelay):
+		case err := <-serveErr:
+			return fmt.Errorf("httpserver: %w", err)
+		}
+	}
+
+	timeout := opts.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	log.Printf("httpserver: shutting down, draining for up to %s", timeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("httpserver: drain incomplete: %w", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("httpserver: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a loopback address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// serve runs ListenAndServe in the background and waits until it accepts
+// connections. Cancelling the returned context shuts it down; its result
+// arrives on the channel.
+func serve(t *testing.T, h http.Handler, opts Options) (context.CancelFunc, <-chan error) {
+	t.Helper()
+	if opts.Addr == "" {
+		opts.Addr = freeAddr(t)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, finished := make(chan error, 1), make(chan struct{})
+	go func() {
+		done <- ListenAndServe(ctx, h, opts)
+		close(finished)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-finished
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		c, err := net.Dial("tcp", opts.Addr)
+		if err == nil {
+			c.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not listening on %s: %v", opts.Addr, err)
+		}
+	}
+	return cancel, done
+}
+
+// slowHandler answers only when release is closed, after signalling on
+// started.
+func slowHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		io.WriteString(w, "done")
+	})
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var shutdownCalled atomic.Bool
+	addr := freeAddr(t)
+	cancel, done := serve(t, slowHandler(started, release), Options{
+		Addr:            addr,
+		ShutdownTimeout: 5 * time.Second,
+		OnShutdown:      func() { shutdownCalled.Store(true) },
+	})
+
+	type result struct {
+		body string
+		err  error
+	}
+	inflight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			inflight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		inflight <- result{string(b), err}
+	}()
+	<-started
+
+	cancel()
+	// The listener closes while the request is still running
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		c.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("still accepting connections after shutdown began")
+		}
+	}
+	if !shutdownCalled.Load() {
+		t.Error("OnShutdown not called")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("returned before the request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if r := <-inflight; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request: %q, %v", r.body, r.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ListenAndServe = %v, want nil after a complete drain", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	addr := freeAddr(t)
+	cancel, done := serve(t, slowHandler(started, release), Options{Addr: addr, ShutdownTimeout: 50 * time.Millisecond})
+	go http.Get("http://" + addr)
+	<-started
+
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "drain incomplete") {
+			t.Errorf("ListenAndServe = %v, want an incomplete drain", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not give up on the stuck request")
+	}
+}
+
+func TestDrainDelay(t *testing.T) {
+	addr := freeAddr(t)
+	cancel, done := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Options{
+		Addr: addr, DrainDelay: 200 * time.Millisecond,
+	})
+	cancel()
+	// Requests are still served while load balancers catch up
+	time.Sleep(50 * time.Millisecond)
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("request during the drain delay: %v", err)
+	}
+	resp.Body.Close()
+	if err := <-done; err != nil {
+		t.Errorf("ListenAndServe = %v", err)
+	}
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	addr := freeAddr(t)
+	serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Options{
+		Addr: addr, ReadHeaderTimeout: 100 * time.Millisecond,
+	})
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// A client that never finishes its headers is cut off
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: x\r\n")
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	_, err = bufio.NewReader(c).ReadString('\n')
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatal("connection still open after the header timeout")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("closed after %s", d)
+	}
+}
+
+func TestListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	err = ListenAndServe(context.Background(), http.NotFoundHandler(), Options{Addr: ln.Addr().String()})
+	if err == nil || !strings.HasPrefix(err.Error(), "httpserver:") {
+		t.Errorf("ListenAndServe on a taken port = %v", err)
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := LimitListener(inner, 1)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("second connection accepted while the first is open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second connection not accepted after the first closed")
+	}
+}
+
+// writeCert writes a fresh self-signed certificate with the given serial
+// number for 127.0.0.1 to dir and returns the paths.
+func writeCert(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedSerial connects to addr and returns the serial number of the
+// certificate it presents.
+func servedSerial(t *testing.T, addr string) int64 {
+	t.Helper()
+	c, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return c.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+	addr := freeAddr(t)
+	serve(t, http.NotFoundHandler(), Options{
+		Addr: addr, CertFile: certFile, KeyFile: keyFile, CertCheckInterval: time.Millisecond,
+	})
+	if serial := servedSerial(t, addr); serial != 1 {
+		t.Fatalf("serving certificate %d, want 1", serial)
+	}
+
+	// A renewal on disk is served without a restart
+	writeCert(t, dir, 2)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	time.Sleep(5 * time.Millisecond)
+	if serial := servedSerial(t, addr); serial != 2 {
+		t.Errorf("serving certificate %d after renewal, want 2", serial)
+	}
+
+	// A broken renewal keeps the previous certificate
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	later = later.Add(time.Second)
+	os.Chtimes(keyFile, later, later)
+	time.Sleep(5 * time.Millisecond)
+	if serial := servedSerial(t, addr); serial != 2 {
+		t.Errorf("serving certificate %d after a broken renewal, want 2", serial)
+	}
+}
+
+func TestNewCertReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, 1)
+	for _, tt := range []struct {
+		name, cert, key string
+	}{
+		{"no key", certFile, ""},
+		{"missing file", certFile, filepath.Join(dir, "missing")},
+		{"swapped", keyFile, certFile},
+	} {
+		if _, err := NewCertReloader(tt.cert, tt.key, 0); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package loginstate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieName is the pre-auth cookie set by /login.
+const CookieName = "oauth_login"
+
+// Binder ties a state value to the browser through a cookie holding the issue
+// time and an HMAC over state and issue time. The state itself is not in the
+// cookie. One login per browser is in flight at a time; starting a second one
+// invalidates the first. The cookie is left to expire after the callback so a
+// reload of the callback URL is reported as a replay, not as a foreign browser.
+type Binder struct {
+	key    []byte
+	ttl    time.Duration
+	secure bool
+}
+
+// NewBinder returns a binder that signs with key (at least 32 bytes). Cookies
+// are valid for ttl and marked Secure when secure is set.
+func NewBinder(key []byte, ttl time.Duration, secure bool) (*Binder, error) {
+	if len(key) < 32 {
+		return nil, errors.New("loginstate: cookie key must be at least 32 bytes")
+	}
+	return &Binder{key: key, ttl: ttl, secure: secure}, nil
+}
+
+// Bind sets the pre-auth cookie for state.
+func (b *Binder) Bind(w http.ResponseWriter, state string) {
+	iat := make([]byte, 8)
+	binary.BigEndian.PutUint64(iat, uint64(time.Now().Unix()))
+	value := base64.RawURLEncoding.EncodeToString(iat) + "." +
+		base64.RawURLEncoding.EncodeToString(b.mac(state, iat))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(b.ttl.Seconds()),
+		Secure:   b.secure,
+		HttpOnly: true,
+		// Lax, not Strict: the cookie has to come back on the top-level
+		// redirect from the identity provider to /callback.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Verify checks that the request carries the cookie set by Bind for state.
+func (b *Binder) Verify(r *http.Request, state string) error {
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return ErrMismatch
+	}
+	iatPart, macPart, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return ErrMismatch
+	}
+	iat, err := base64.RawURLEncoding.DecodeString(iatPart)
+	if err != nil || len(iat) != 8 {
+		return ErrMismatch
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(macPart)
+	if err != nil || !hmac.Equal(mac, b.mac(state, iat)) {
+		return ErrMismatch
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(iat)), 0)
+	if time.Since(issued) > b.ttl {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (b *Binder) mac(state string, iat []byte) []byte {
+	h := hmac.New(sha256.New, b.key)
+	h.Write(iat)
+	h.Write([]byte(state))
+	return h.Sum(nil)
+}
@@ -0,0 +1,178 @@
+// Package loginstate keeps what the server needs to remember between /login
+// and /callback, and between /callback and the user's answer on the consent
+// page. A state value can be consumed exactly once, and it is bound
+// to the browser that started the login through a signed cookie, so a state
+// leaked from one browser cannot be completed in another.
+package loginstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var (
+	ErrExpired  = errors.New("loginstate: state expired or unknown")
+	ErrReplayed = errors.New("loginstate: state already used")
+	ErrMismatch = errors.New("loginstate: state was issued to a different browser")
+	ErrNonce    = errors.New("loginstate: id_token nonce does not match")
+)
+
+// Key prefixes in the state store: pending logins by state value, markers of
+// used state values, and logins waiting for consent. None is a prefix of
+// another, so a scan of one kind does not pick up the others.
+const (
+	KeyPrefix     = "loginstate:state:"
+	UsedPrefix    = "loginstate:used:"
+	ConsentPrefix = "loginstate:consent:"
+)
+
+// Record is the pending login stored under a state value.
+type Record struct {
+	CodeVerifier string `json:"code_verifier"`
+	ClientID     string `json:"client_id,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+
+	// The rest is set when the login came through /authorize: where the
+	// authorization response goes and what it has to carry back.
+	// RedirectURI is the validated target; RedirectURIParam the
+	// redirect_uri as sent, which the token request has to repeat.
+	RedirectURI      string   `json:"redirect_uri,omitempty"`
+	RedirectURIParam string   `json:"redirect_uri_param,omitempty"`
+	ClientState      string   `json:"client_state,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+
+	// ResponseType is the response_type of the request, empty for code.
+	// ResponseMode is how the response goes back: query (if empty),
+	// fragment or form_post, each possibly with .jwt for JARM. ClientNonce
+	// is the client's nonce, for the ID tokens of the implicit and hybrid
+	// flows.
+	ResponseType string `json:"response_type,omitempty"`
+	ResponseMode string `json:"response_mode,omitempty"`
+	ClientNonce  string `json:"client_nonce,omitempty"`
+
+	// CodeChallenge and CodeChallengeMethod are the client's PKCE
+	// challenge, handed on to the code issued for this login. Not to be
+	// confused with CodeVerifier, ours towards the upstream provider.
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+
+	// DeviceCode is set when the login approves a device (RFC 8628).
+	DeviceCode string `json:"device_code,omitempty"`
+
+	// UILocales are the languages the login asked for with ui_locales,
+	// for the pages shown on the way back.
+	UILocales string `json:"ui_locales,omitempty"`
+}
+
+// Pending is a completed login that waits for the user's consent.
+type Pending struct {
+	Record
+	UserID      string                 `json:"user_id"`
+	UpstreamRef string                 `json:"upstream_ref"`
+	User        map[string]interface{} `json:"user,omitempty"`
+}
+
+// Store keeps pending logins in the state store for ttl.
+type Store struct {
+	kv  state.Store
+	ttl time.Duration
+}
+
+func NewStore(kv state.Store, ttl time.Duration) *Store {
+	return &Store{kv: kv, ttl: ttl}
+}
+
+// TTL is how long a login may take from /login to /callback.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Save stores rec under the state value st. States are random, so a collision means the
+// caller reused one; that is refused rather than overwritten.
+func (s *Store) Save(ctx context.Context, st string, rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ok, err := s.kv.SetNX(ctx, KeyPrefix+st, b, s.ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("loginstate: state already in use")
+	}
+	return nil
+}
+
+// Consume returns the record for st and deletes it. It fails with
+// ErrReplayed if the state was already consumed and ErrExpired if it is
+// unknown or its TTL has passed.
+//
+// GETDEL guarantees a single winner. The "used" marker is written right after,
+// so a replay racing the first attempt may be reported as ErrExpired instead
+// of ErrReplayed; it is refused either way.
+func (s *Store) Consume(ctx context.Context, st string) (Record, error) {
+	var rec Record
+	b, err := s.kv.GetDel(ctx, KeyPrefix+st)
+	if err == state.ErrNotFound {
+		used, err := s.kv.Exists(ctx, UsedPrefix+st)
+		if err != nil {
+			return rec, err
+		}
+		if used {
+			return rec, ErrReplayed
+		}
+		return rec, ErrExpired
+	}
+	if err != nil {
+		return rec, err
+	}
+	if err := s.kv.Set(ctx, UsedPrefix+st, []byte{1}, s.ttl); err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return rec, fmt.Errorf("loginstate: decoding record: %w", err)
+	}
+	return rec, nil
+}
+
+// SavePending keeps p under id until the user answers the consent page.
+func (s *Store) SavePending(ctx context.Context, id string, p Pending) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(ctx, ConsentPrefix+id, b, s.ttl)
+}
+
+// ConsumePending returns the pending login under id and deletes it, so a
+// consent can be answered once. It fails with ErrExpired for an unknown id.
+func (s *Store) ConsumePending(ctx context.Context, id string) (Pending, error) {
+	var p Pending
+	b, err := s.kv.GetDel(ctx, ConsentPrefix+id)
+	if err == state.ErrNotFound {
+		return p, ErrExpired
+	}
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("loginstate: decoding pending login: %w", err)
+	}
+	return p, nil
+}
+
+// CheckNonce compares the nonce of the returned ID token with the one stored
+// for this login.
+func (r Record) CheckNonce(nonce string) error {
+	if r.Nonce == "" || !cryptoutil.Equal(nonce, r.Nonce) {
+		return ErrNonce
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package loginstate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+func TestConsume(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(memory.New(), time.Minute)
+	rec := Record{CodeVerifier: "verifier", ClientID: "web", Nonce: "n-0S6_WzA2Mj"}
+	if err := s.Save(ctx, "st", rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, "st", Record{}); err == nil {
+		t.Error("a state in use was overwritten")
+	}
+
+	got, err := s.Consume(ctx, "st")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CodeVerifier != rec.CodeVerifier || got.ClientID != rec.ClientID {
+		t.Errorf("got %+v", got)
+	}
+	// The nonce survives the round trip and is what the ID token is
+	// checked against.
+	if err := got.CheckNonce("n-0S6_WzA2Mj"); err != nil {
+		t.Errorf("stored nonce refused: %v", err)
+	}
+
+	if _, err := s.Consume(ctx, "st"); !errors.Is(err, ErrReplayed) {
+		t.Errorf("second consume: got %v, want ErrReplayed", err)
+	}
+	if _, err := s.Consume(ctx, "unknown"); !errors.Is(err, ErrExpired) {
+		t.Errorf("unknown state: got %v, want ErrExpired", err)
+	}
+}
+
+func TestConsumeOnce(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(memory.New(), time.Minute)
+	if err := s.Save(ctx, "st", Record{CodeVerifier: "v"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const callers = 20
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		wins int
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Consume(ctx, "st")
+			switch {
+			case err == nil:
+				mu.Lock()
+				wins++
+				mu.Unlock()
+			case !errors.Is(err, ErrReplayed) && !errors.Is(err, ErrExpired):
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Errorf("%d callers consumed the state", wins)
+	}
+}
+
+func TestConsumeExpired(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(memory.New(), 20*time.Millisecond)
+	if err := s.Save(ctx, "st", Record{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := s.Consume(ctx, "st"); !errors.Is(err, ErrExpired) {
+		t.Errorf("got %v, want ErrExpired", err)
+	}
+}
+
+func TestConsumePending(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(memory.New(), time.Minute)
+	p := Pending{Record: Record{ClientID: "web"}, UserID: "u1", UpstreamRef: "ref"}
+	if err := s.SavePending(ctx, "id", p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.ConsumePending(ctx, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != "u1" || got.ClientID != "web" || got.UpstreamRef != "ref" {
+		t.Errorf("got %+v", got)
+	}
+	if _, err := s.ConsumePending(ctx, "id"); !errors.Is(err, ErrExpired) {
+		t.Errorf("second consume: got %v, want ErrExpired", err)
+	}
+}
+
+func TestPrefixesDisjoint(t *testing.T) {
+	prefixes := []string{KeyPrefix, UsedPrefix, ConsentPrefix}
+	for _, a := range prefixes {
+		for _, b := range prefixes {
+			if a != b && strings.HasPrefix(b, a) {
+				t.Errorf("%q is a prefix of %q", a, b)
+			}
+		}
+	}
+}
+
+func TestCheckNonce(t *testing.T) {
+	for _, tt := range []struct {
+		stored, got string
+		ok          bool
+	}{
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "", false},
+		{"", "", false}, // a login without nonce never matches
+		{"", "abc", false},
+	} {
+		err := Record{Nonce: tt.stored}.CheckNonce(tt.got)
+		if tt.ok != (err == nil) {
+			t.Errorf("stored %q, got %q: %v", tt.stored, tt.got, err)
+		}
+		if err != nil && !errors.Is(err, ErrNonce) {
+			t.Errorf("stored %q, got %q: %v, want ErrNonce", tt.stored, tt.got, err)
+		}
+	}
+}
+
+// cookie returns the cookie b sets for st.
+func cookie(t *testing.T, b *Binder, st string) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	b.Bind(rec, st)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CookieName {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	return cookies[0]
+}
+
+func TestBinder(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	b, err := NewBinder(key, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewBinder(bytes.Repeat([]byte{2}, 32), time.Minute, true)
+	expired, _ := NewBinder(key, -time.Second, true)
+	c := cookie(t, b, "st")
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie attributes: %+v", c)
+	}
+
+	iat, mac, _ := strings.Cut(c.Value, ".")
+	flipped := []byte(mac)
+	flipped[0] ^= 1
+	if flipped[0] == '.' {
+		flipped[0] = 'A'
+	}
+
+	for _, tt := range []struct {
+		name   string
+		binder *Binder
+		value  string // empty sends no cookie
+		state  string
+		want   error
+	}{
+		{"valid", b, c.Value, "st", nil},
+		{"other state", b, c.Value, "other", ErrMismatch},
+		{"other key", other, c.Value, "st", ErrMismatch},
+		{"tampered MAC", b, iat + "." + string(flipped), "st", ErrMismatch},
+		{"tampered issue time", b, "AAAAAAAAAAA." + mac, "st", ErrMismatch},
+		{"no MAC", b, iat, "st", ErrMismatch},
+		{"garbage", b, "!!.!!", "st", ErrMismatch},
+		{"no cookie", b, "", "st", ErrMismatch},
+		{"expired", expired, cookie(t, expired, "st").Value, "st", ErrExpired},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/callback", nil)
+		if tt.value != "" {
+			r.AddCookie(&http.Cookie{Name: CookieName, Value: tt.value})
+		}
+		if err := tt.binder.Verify(r, tt.state); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := NewBinder(key[:31], time.Minute, true); err == nil {
+		t.Error("short key accepted")
+	}
+}
@@ -0,0 +1,130 @@
+// Package metrics defines the Prometheus metrics of the authorization
+// server. Every label takes its values from a fixed set, except client,
+// which is limited to MaxClients distinct IDs; the rest are reported as
+// "other", so a flood of made-up client IDs cannot grow the series count.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MaxClients is the number of distinct client IDs that get their own label
+// value.
+const MaxClients = 100
+
+// Label values for clients.
+const (
+	ClientDefault = "default" // /login without a client_id
+	ClientOther   = "other"   // beyond MaxClients
+	ClientUnknown = "unknown" // failed before the client was known
+)
+
+// Result label values.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Metrics holds the collectors. The zero value is not usable; see New and
+// Discard.
+type Metrics struct {
+	LoginsStarted    *prometheus.CounterVec   // client
+	LoginsCompleted  *prometheus.CounterVec   // client, result
+	CodeExchange     *prometheus.HistogramVec // result
+	UserInfo         *prometheus.HistogramVec // result
+	TokensIssued     *prometheus.CounterVec   // grant_type, client, format
+	Introspections   *prometheus.CounterVec   // result
+	Revocations      *prometheus.CounterVec   // endpoint, result
+	StateErrors      *prometheus.CounterVec   // op
+	StateBreakerOpen prometheus.Gauge
+	RateLimited      *prometheus.CounterVec // endpoint, dimension
+
+	mu      sync.Mutex
+	clients map[string]bool
+}
+
+// New creates the collectors and registers them with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	upstreamBuckets := []float64{.025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	m := &Metrics{
+		LoginsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_logins_started_total",
+			Help: "Logins redirected to the upstream provider.",
+		}, []string{"client"}),
+		LoginsCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_logins_completed_total",
+			Help: "Callbacks handled, by outcome.",
+		}, []string{"client", "result"}),
+		CodeExchange: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "oauth_upstream_code_exchange_duration_seconds",
+			Help:    "Authorization code exchanges with the upstream provider.",
+			Buckets: upstreamBuckets,
+		}, []string{"result"}),
+		UserInfo: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "oauth_upstream_userinfo_duration_seconds",
+			Help:    "Userinfo requests to the upstream provider.",
+			Buckets: upstreamBuckets,
+		}, []string{"result"}),
+		TokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_tokens_issued_total",
+			Help: "Access tokens issued.",
+		}, []string{"grant_type", "client", "format"}),
+		Introspections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_token_introspections_total",
+			Help: "Introspection requests, by answer.",
+		}, []string{"result"}),
+		Revocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_token_revocations_total",
+			Help: "Token revocations through /revoke and /logout.",
+		}, []string{"endpoint", "result"}),
+		StateErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_state_store_errors_total",
+			Help: "Failed state store (Redis) operations. Missing keys are not errors.",
+		}, []string{"op"}),
+		StateBreakerOpen: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "oauth_state_store_breaker_open",
+			Help: "1 while the state store circuit breaker is open.",
+		}),
+		RateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth_rate_limited_total",
+			Help: "Requests refused with 429, by the limit that refused them.",
+		}, []string{"endpoint", "dimension"}),
+		clients: make(map[string]bool),
+	}
+	reg.MustRegister(m.LoginsStarted, m.LoginsCompleted, m.CodeExchange, m.UserInfo,
+		m.TokensIssued, m.Introspections, m.Revocations, m.StateErrors, m.StateBreakerOpen, m.RateLimited)
+	return m
+}
+
+// Discard returns metrics that are not exported anywhere, for servers that
+// are run without a registry.
+func Discard() *Metrics {
+	return New(prometheus.NewRegistry())
+}
+
+// Client maps a client ID to its label value.
+func (m *Metrics) Client(id string) string {
+	if id == "" {
+		return ClientDefault
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.clients[id] {
+		return id
+	}
+	if len(m.clients) >= MaxClients {
+		return ClientOther
+	}
+	m.clients[id] = true
+	return id
+}
+
+// Result maps an error to ResultOK or ResultError.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
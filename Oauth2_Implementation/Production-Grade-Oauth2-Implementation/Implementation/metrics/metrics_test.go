@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+// scrape serves reg the way /metrics does and returns the sample lines of
+// the named metric, keyed by their labels.
+func scrape(t *testing.T, reg *prometheus.Registry, name string) map[string]string {
+	t.Helper()
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape: %s", resp.Status)
+	}
+	samples := make(map[string]string)
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		labels, ok := strings.CutPrefix(sc.Text(), name+"{")
+		if !ok {
+			continue
+		}
+		labels, value, _ := strings.Cut(labels, "} ")
+		samples[labels] = value
+	}
+	return samples
+}
+
+func TestClientCardinality(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	// Made-up client IDs beyond the cap share one series
+	for i := 0; i < MaxClients+50; i++ {
+		m.LoginsStarted.WithLabelValues(m.Client(fmt.Sprintf("client-%d", i))).Inc()
+	}
+	// Clients seen before the cap keep their label
+	m.LoginsStarted.WithLabelValues(m.Client("client-0")).Inc()
+	m.LoginsStarted.WithLabelValues(m.Client("")).Inc()
+
+	samples := scrape(t, reg, "oauth_logins_started_total")
+	if len(samples) != MaxClients+2 {
+		t.Errorf("%d series, want %d", len(samples), MaxClients+2)
+	}
+	for labels, want := range map[string]string{
+		`client="client-0"`:  "2",
+		`client="client-99"`: "1",
+		`client="other"`:     "50",
+		`client="default"`:   "1",
+	} {
+		if got := samples[labels]; got != want {
+			t.Errorf("%s = %q, want %q", labels, got, want)
+		}
+	}
+	if _, ok := samples[`client="client-100"`]; ok {
+		t.Error("client beyond the cap got its own series")
+	}
+}
+
+type failingState struct{ state.Store }
+
+func (failingState) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestInstrumentState(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+	kv := memory.New()
+	defer kv.Close()
+
+	s := InstrumentState(failingState{kv}, m)
+	s.Get(ctx, "missing")
+	s.GetDel(ctx, "missing")
+	s.Set(ctx, "k", []byte("v"), time.Minute)
+	s.Set(ctx, "k", []byte("v"), time.Minute)
+
+	samples := scrape(t, reg, "oauth_state_store_errors_total")
+	if len(samples) != 1 || samples[`op="set"`] != "2" {
+		t.Errorf("state errors %v, want only 2 failed sets", samples)
+	}
+}
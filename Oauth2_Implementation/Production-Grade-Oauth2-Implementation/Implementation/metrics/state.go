@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var _ state.Store = (*instrumentedState)(nil)
+
+// InstrumentState counts the failed operations of kv in StateErrors.
+// state.ErrNotFound is an answer, not a failure, and is not counted.
+func InstrumentState(kv state.Store, m *Metrics) state.Store {
+	return &instrumentedState{inner: kv, m: m}
+}
+
+type instrumentedState struct {
+	inner state.Store
+	m     *Metrics
+}
+
+func (s *instrumentedState) observe(op string, err error) {
+	if err != nil && !errors.Is(err, state.ErrNotFound) {
+		s.m.StateErrors.WithLabelValues(op).Inc()
+	}
+}
+
+func (s *instrumentedState) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	err := s.inner.Set(ctx, key, value, ttl)
+	s.observe("set", err)
+	return err
+}
+
+func (s *instrumentedState) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ok, err := s.inner.SetNX(ctx, key, value, ttl)
+	s.observe("setnx", err)
+	return ok, err
+}
+
+func (s *instrumentedState) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.inner.Get(ctx, key)
+	s.observe("get", err)
+	return v, err
+}
+
+func (s *instrumentedState) GetDel(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.inner.GetDel(ctx, key)
+	s.observe("getdel", err)
+	return v, err
+}
+
+func (s *instrumentedState) Exists(ctx context.Context, key string) (bool, error) {
+	ok, err := s.inner.Exists(ctx, key)
+	s.observe("exists", err)
+	return ok, err
+}
+
+func (s *instrumentedState) Del(ctx context.Context, keys ...string) error {
+	err := s.inner.Del(ctx, keys...)
+	s.observe("del", err)
+	return err
+}
+
+func (s *instrumentedState) Close() error {
+	return s.inner.Close()
+}
@@ -0,0 +1,176 @@
+// Package oautherr is the error model of the OAuth endpoints. Every failure
+// a client or user gets to see is an Error with one of the codes of RFC 6749
+// and a description written for them; the internal cause is kept next to it
+// for the log and never leaves the server.
+//
+// The token endpoint answers errors as JSON (RFC 6749 section 5.2), the
+// authorization endpoint as parameters on the client's redirect URI (section
+// 4.1.2.1), and where neither is possible the user gets an error page (see
+// package ui).
+package oautherr
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+// Code is an OAuth error code.
+type Code string
+
+// Error codes of RFC 6749 sections 4.1.2.1 and 5.2.
+const (
+	InvalidRequest          Code = "invalid_request"
+	InvalidClient           Code = "invalid_client"
+	InvalidGrant            Code = "invalid_grant"
+	UnauthorizedClient      Code = "unauthorized_client"
+	UnsupportedGrantType    Code = "unsupported_grant_type"
+	UnsupportedResponseType Code = "unsupported_response_type"
+	InvalidScope            Code = "invalid_scope"
+	AccessDenied            Code = "access_denied"
+	ServerError             Code = "server_error"
+	TemporarilyUnavailable  Code = "temporarily_unavailable"
+)
+
+// Error codes of the device authorization grant, RFC 8628 section 3.5.
+const (
+	AuthorizationPending Code = "authorization_pending"
+	SlowDown             Code = "slow_down"
+	ExpiredToken         Code = "expired_token"
+)
+
+// Error is a failure as reported to the client. Description must not contain
+// anything the client is not supposed to learn; Cause is only logged.
+type Error struct {
+	Code        Code
+	Description string
+	Cause       error
+}
+
+// New returns an Error without an internal cause.
+func New(code Code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// Wrap returns an Error that logs cause when it is written.
+func Wrap(code Code, description string, cause error) *Error {
+	return &Error{Code: code, Description: description, Cause: cause}
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.Cause != nil {
+		msg += " (" + e.Cause.Error() + ")"
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// From turns any error into an Error. Errors that are not one already become
+// temporarily_unavailable while the state store is down and server_error
+// otherwise, with a generic description.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, state.ErrUnavailable) {
+		return Wrap(TemporarilyUnavailable, "The service is temporarily unavailable, please try again later", err)
+	}
+	return Wrap(ServerError, "The request could not be completed", err)
+}
+
+// Status is the HTTP status of the error on the token endpoint and on pages.
+func (e *Error) Status() int {
+	switch e.Code {
+	case InvalidClient:
+		return http.StatusUnauthorized
+	case AccessDenied:
+		return http.StatusForbidden
+	case ServerError:
+		return http.StatusInternalServerError
+	case TemporarilyUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Log turns err into an Error with From and logs it with its cause, before
+// it is answered to r. Clients only see code and description. The polling
+// answers of the device grant are part of the normal flow and not logged.
+func Log(r *http.Request, err error) *Error {
+	e := From(err)
+	switch e.Code {
+	case AuthorizationPending, SlowDown:
+	default:
+		log.Printf("%s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, e)
+	}
+	return e
+}
+
+// WriteJSON answers err as a token endpoint error. invalid_client carries a
+// Basic challenge when the client tried Basic authentication, as section 5.2
+// requires.
+func WriteJSON(w http.ResponseWriter, r *http.Request, err error) {
+	e := Log(r, err)
+	if e.Code == InvalidClient {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth", error="invalid_client"`)
+		}
+	}
+	if e.Code == TemporarilyUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	body := map[string]string{"error": string(e.Code)}
+	if e.Description != "" {
+		body["error_description"] = e.Description
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(body)
+}
+
+// Params logs err like Log and returns it as the error and
+// error_description parameters of an authorization response (section
+// 4.1.2.1).
+func Params(r *http.Request, err error) url.Values {
+	e := Log(r, err)
+	params := url.Values{"error": {string(e.Code)}}
+	if e.Description != "" {
+		params.Set("error_description", e.Description)
+	}
+	return params
+}
+
+// AppendParams adds params to the query of uri, or sets them as its
+// fragment.
+func AppendParams(uri string, params url.Values, fragment bool) string {
+	if fragment {
+		base, _, _ := strings.Cut(uri, "#")
+		return base + "#" + params.Encode()
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
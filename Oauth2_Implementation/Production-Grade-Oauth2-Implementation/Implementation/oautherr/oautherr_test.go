@@ -0,0 +1,175 @@
+package oautherr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+// captureLog redirects the standard logger for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+func TestStatus(t *testing.T) {
+	for _, tt := range []struct {
+		code   Code
+		status int
+	}{
+		{InvalidRequest, http.StatusBadRequest},
+		{InvalidClient, http.StatusUnauthorized},
+		{InvalidGrant, http.StatusBadRequest},
+		{UnauthorizedClient, http.StatusBadRequest},
+		{UnsupportedGrantType, http.StatusBadRequest},
+		{InvalidScope, http.StatusBadRequest},
+		{AccessDenied, http.StatusForbidden},
+		{ServerError, http.StatusInternalServerError},
+		{TemporarilyUnavailable, http.StatusServiceUnavailable},
+		{AuthorizationPending, http.StatusBadRequest},
+		{SlowDown, http.StatusBadRequest},
+		{ExpiredToken, http.StatusBadRequest},
+	} {
+		if got := New(tt.code, "").Status(); got != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.code, got, tt.status)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	cause := errors.New("pq: connection reset")
+	grant := New(InvalidGrant, "The code has expired")
+	for _, tt := range []struct {
+		name string
+		err  error
+		code Code
+	}{
+		{"Error", grant, InvalidGrant},
+		{"wrapped Error", fmt.Errorf("exchanging: %w", grant), InvalidGrant},
+		{"state store down", fmt.Errorf("reading code: %w", state.ErrUnavailable), TemporarilyUnavailable},
+		{"anything else", cause, ServerError},
+	} {
+		e := From(tt.err)
+		if e.Code != tt.code {
+			t.Errorf("%s: code %s, want %s", tt.name, e.Code, tt.code)
+		}
+		if tt.code != InvalidGrant && (!errors.Is(e, tt.err) || strings.Contains(e.Description, "pq:")) {
+			t.Errorf("%s: %+v does not keep the cause to itself", tt.name, e)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	logged := captureLog(t)
+	for _, tt := range []struct {
+		name      string
+		err       error
+		basic     bool
+		status    int
+		challenge string
+		retry     string
+	}{
+		{"invalid_grant", New(InvalidGrant, "The code has expired"), false, http.StatusBadRequest, "", ""},
+		{"invalid_client with Basic", New(InvalidClient, "Client authentication failed"), true, http.StatusUnauthorized, `Basic realm="oauth", error="invalid_client"`, ""},
+		{"invalid_client in the body", New(InvalidClient, "Client authentication failed"), false, http.StatusUnauthorized, "", ""},
+		{"state store down", state.ErrUnavailable, false, http.StatusServiceUnavailable, "", "5"},
+		{"internal failure", errors.New("pq: connection reset"), false, http.StatusInternalServerError, "", ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/token", nil)
+		if tt.basic {
+			req.SetBasicAuth("spa", "wrong")
+		}
+		rec := httptest.NewRecorder()
+		WriteJSON(rec, req, tt.err)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		h := rec.Header()
+		if h.Get("Content-Type") != "application/json" || h.Get("Cache-Control") != "no-store" || h.Get("Pragma") != "no-cache" {
+			t.Errorf("%s: headers %v", tt.name, h)
+		}
+		if h.Get("WWW-Authenticate") != tt.challenge || h.Get("Retry-After") != tt.retry {
+			t.Errorf("%s: challenge %q, Retry-After %q", tt.name, h.Get("WWW-Authenticate"), h.Get("Retry-After"))
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		e := From(tt.err)
+		if len(body) != 2 || body["error"] != string(e.Code) || body["error_description"] != e.Description {
+			t.Errorf("%s: body %v", tt.name, body)
+		}
+		if strings.Contains(rec.Body.String(), "pq:") {
+			t.Errorf("%s: internal cause in the response", tt.name)
+		}
+	}
+	if !strings.Contains(logged.String(), "POST /token") || !strings.Contains(logged.String(), "pq: connection reset") {
+		t.Errorf("cause not logged: %q", logged)
+	}
+}
+
+func TestWriteJSONWithoutDescription(t *testing.T) {
+	captureLog(t)
+	rec := httptest.NewRecorder()
+	WriteJSON(rec, httptest.NewRequest(http.MethodPost, "/token", nil), New(UnsupportedGrantType, ""))
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"error":"unsupported_grant_type"}` {
+		t.Errorf("body %s", got)
+	}
+}
+
+func TestLogSkipsPolling(t *testing.T) {
+	logged := captureLog(t)
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	Log(req, New(AuthorizationPending, ""))
+	Log(req, New(SlowDown, ""))
+	if logged.Len() != 0 {
+		t.Errorf("polling answers logged: %q", logged)
+	}
+	Log(req, New(ExpiredToken, "The device code has expired"))
+	if logged.Len() == 0 {
+		t.Error("expired_token not logged")
+	}
+}
+
+func TestParams(t *testing.T) {
+	captureLog(t)
+	req := httptest.NewRequest(http.MethodGet, "/authorize", nil)
+	got := Params(req, Wrap(AccessDenied, "The user denied the request", errors.New("consent refused")))
+	want := url.Values{"error": {"access_denied"}, "error_description": {"The user denied the request"}}
+	if got.Encode() != want.Encode() {
+		t.Errorf("params %v, want %v", got, want)
+	}
+}
+
+func TestAppendParams(t *testing.T) {
+	params := url.Values{"error": {"access_denied"}, "state": {"xyz"}}
+	for _, tt := range []struct {
+		uri      string
+		fragment bool
+		want     string
+	}{
+		{"https://app.example/cb", false, "https://app.example/cb?error=access_denied&state=xyz"},
+		{"https://app.example/cb?tenant=1", false, "https://app.example/cb?error=access_denied&state=xyz&tenant=1"},
+		{"https://app.example/cb?state=old", false, "https://app.example/cb?error=access_denied&state=xyz"},
+		{"https://app.example/cb", true, "https://app.example/cb#error=access_denied&state=xyz"},
+		{"https://app.example/cb#old", true, "https://app.example/cb#error=access_denied&state=xyz"},
+	} {
+		if got := AppendParams(tt.uri, params, tt.fragment); got != tt.want {
+			t.Errorf("AppendParams(%q, fragment %v) = %q, want %q", tt.uri, tt.fragment, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+var _ Backend = (*Fallback)(nil)
+
+// Fallback uses Primary and, for calls where it fails, Secondary. Once
+// Primary fails it is only tried again after Retry, so an outage does not
+// add a timeout to every request.
+type Fallback struct {
+	Primary   Backend
+	Secondary Backend
+	Retry     time.Duration
+
+	downUntil atomic.Int64 // unix nanoseconds
+}
+
+// NewFallback retries primary every ten seconds while it is down.
+func NewFallback(primary, secondary Backend) *Fallback {
+	return &Fallback{Primary: primary, Secondary: secondary, Retry: 10 * time.Second}
+}
+
+// pick returns the backend for the next call.
+func (f *Fallback) pick() Backend {
+	if time.Now().UnixNano() < f.downUntil.Load() {
+		return f.Secondary
+	}
+	return f.Primary
+}
+
+// failed marks Primary as down after err and reports whether to retry the
+// call on Secondary. A cancelled request says nothing about Primary.
+func (f *Fallback) failed(ctx context.Context, b Backend, err error) bool {
+	if err == nil || b != f.Primary || ctx.Err() != nil {
+		return false
+	}
+	if f.downUntil.Swap(time.Now().Add(f.Retry).UnixNano()) == 0 {
+		log.Printf("ratelimit: primary backend failing, using the fallback: %v", err)
+	}
+	return true
+}
+
+// recovered logs when Primary answers again after an outage.
+func (f *Fallback) recovered(b Backend) {
+	if b == f.Primary && f.downUntil.Swap(0) != 0 {
+		log.Println("ratelimit: primary backend recovered")
+	}
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, l Limit) (Result, error) {
+	b := f.pick()
+	res, err := b.Allow(ctx, key, l)
+	if f.failed(ctx, b, err) {
+		return f.Secondary.Allow(ctx, key, l)
+	}
+	f.recovered(b)
+	return res, err
+}
+
+func (f *Fallback) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	b := f.pick()
+	n, err := b.Fail(ctx, key, window)
+	if f.failed(ctx, b, err) {
+		return f.Secondary.Fail(ctx, key, window)
+	}
+	f.recovered(b)
+	return n, err
+}
+
+func (f *Fallback) Block(ctx context.Context, key string, d time.Duration) error {
+	b := f.pick()
+	err := b.Block(ctx, key, d)
+	if f.failed(ctx, b, err) {
+		return f.Secondary.Block(ctx, key, d)
+	}
+	f.recovered(b)
+	return err
+}
+
+func (f *Fallback) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	b := f.pick()
+	d, err := b.Blocked(ctx, key)
+	if f.failed(ctx, b, err) {
+		return f.Secondary.Blocked(ctx, key)
+	}
+	f.recovered(b)
+	return d, err
+}
+
+func (f *Fallback) Reset(ctx context.Context, key string) error {
+	b := f.pick()
+	err := b.Reset(ctx, key)
+	if f.failed(ctx, b, err) {
+		return f.Secondary.Reset(ctx, key)
+	}
+	f.recovered(b)
+	return err
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Backend = (*Memory)(nil)
+
+// sweepInterval is how often expired entries are dropped.
+const sweepInterval = time.Minute
+
+// Memory is an in-process Backend. Its limits apply per replica.
+type Memory struct {
+	mu      sync.Mutex
+	tats    map[string]time.Time // GCRA theoretical arrival times
+	counts  map[string]counter
+	blocked map[string]time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type counter struct {
+	n       int
+	expires time.Time
+}
+
+// NewMemory returns an empty backend and starts its sweeper; Close stops it.
+func NewMemory() *Memory {
+	m := &Memory{
+		tats:    make(map[string]time.Time),
+		counts:  make(map[string]counter),
+		blocked: make(map[string]time.Time),
+		stop:    make(chan struct{}),
+	}
+	go m.sweep()
+	return m
+}
+
+func (m *Memory) Allow(_ context.Context, key string, l Limit) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, tat := gcra(m.tats[key], now, l)
+	if res.Allowed {
+		m.tats[key] = tat
+	}
+	return res, nil
+}
+
+// gcra takes one request at now from the bucket whose theoretical arrival
+// time is tat, and returns the new one. It is gcraScript in Go.
+func gcra(tat, now time.Time, l Limit) (Result, time.Time) {
+	if tat.Before(now) {
+		tat = now
+	}
+	interval := l.interval()
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-interval * time.Duration(l.burst()))
+	if now.Before(allowAt) {
+		return Result{RetryAfter: allowAt.Sub(now)}, tat
+	}
+	return Result{Allowed: true, Remaining: int(now.Sub(allowAt) / interval)}, newTat
+}
+
+func (m *Memory) Fail(_ context.Context, key string, window time.Duration) (int, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.counts[key]
+	if !now.Before(c.expires) {
+		c = counter{expires: now.Add(window)}
+	}
+	c.n++
+	m.counts[key] = c
+	return c.n, nil
+}
+
+func (m *Memory) Block(_ context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocked[key] = time.Now().Add(d)
+	return nil
+}
+
+func (m *Memory) Blocked(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return max(time.Until(m.blocked[key]), 0), nil
+}
+
+func (m *Memory) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.counts, key)
+	delete(m.blocked, key)
+	return nil
+}
+
+// Close stops the sweeper.
+func (m *Memory) Close() error {
+	m.once.Do(func() { close(m.stop) })
+	return nil
+}
+
+func (m *Memory) sweep() {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-t.C:
+			m.mu.Lock()
+			for k, tat := range m.tats {
+				if tat.Before(now) {
+					delete(m.tats, k)
+				}
+			}
+			for k, c := range m.counts {
+				if c.expires.Before(now) {
+					delete(m.counts, k)
+				}
+			}
+			for k, until := range m.blocked {
+				if until.Before(now) {
+					delete(m.blocked, k)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
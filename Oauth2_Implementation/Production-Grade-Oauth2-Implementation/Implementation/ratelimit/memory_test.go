@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	type step struct {
+		at        time.Duration // since the first request
+		allowed   bool
+		remaining int
+		retry     time.Duration
+	}
+	fiveASecond := Limit{Rate: 5, Period: time.Second}
+	burstOfTwo := Limit{Rate: 10, Period: time.Second, Burst: 2}
+
+	for _, tt := range []struct {
+		name  string
+		limit Limit
+		steps []step
+	}{
+		{"burst then refused", fiveASecond, []step{
+			{0, true, 4, 0},
+			{0, true, 3, 0},
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, 200 * time.Millisecond},
+			{100 * time.Millisecond, false, 0, 100 * time.Millisecond},
+			{200 * time.Millisecond, true, 0, 0},
+			{200 * time.Millisecond, false, 0, 200 * time.Millisecond},
+		}},
+		{"refused requests cost nothing", fiveASecond, []step{
+			{0, true, 4, 0}, {0, true, 3, 0}, {0, true, 2, 0}, {0, true, 1, 0}, {0, true, 0, 0},
+			{0, false, 0, 200 * time.Millisecond},
+			{0, false, 0, 200 * time.Millisecond},
+			{0, false, 0, 200 * time.Millisecond},
+			{200 * time.Millisecond, true, 0, 0},
+		}},
+		{"partial refill", fiveASecond, []step{
+			{0, true, 4, 0}, {0, true, 3, 0}, {0, true, 2, 0}, {0, true, 1, 0}, {0, true, 0, 0},
+			{500 * time.Millisecond, true, 1, 0},
+			{500 * time.Millisecond, true, 0, 0},
+			{500 * time.Millisecond, false, 0, 100 * time.Millisecond},
+		}},
+		{"full refill after a period", fiveASecond, []step{
+			{0, true, 4, 0}, {0, true, 3, 0}, {0, true, 2, 0}, {0, true, 1, 0}, {0, true, 0, 0},
+			{2 * time.Second, true, 4, 0},
+		}},
+		{"steady rate is never refused", fiveASecond, []step{
+			{0, true, 4, 0},
+			{200 * time.Millisecond, true, 4, 0},
+			{400 * time.Millisecond, true, 4, 0},
+			{600 * time.Millisecond, true, 4, 0},
+		}},
+		{"burst smaller than rate", burstOfTwo, []step{
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, 100 * time.Millisecond},
+			{50 * time.Millisecond, false, 0, 50 * time.Millisecond},
+			{100 * time.Millisecond, true, 0, 0},
+			{time.Second, true, 1, 0},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Unix(1700000000, 0)
+			var tat time.Time
+			for i, s := range tt.steps {
+				var res Result
+				res, tat = gcra(tat, start.Add(s.at), tt.limit)
+				want := Result{Allowed: s.allowed, Remaining: s.remaining, RetryAfter: s.retry}
+				if res != want {
+					t.Fatalf("request %d at %s: got %+v, want %+v", i+1, s.at, res, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryAllow(t *testing.T) {
+	m := NewMemory()
+	defer m.Close()
+	ctx := context.Background()
+	l := Limit{Rate: 3, Period: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		if res, _ := m.Allow(ctx, "a", l); !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i+1, res)
+		}
+	}
+	res, _ := m.Allow(ctx, "a", l)
+	if res.Allowed || res.RetryAfter <= 19*time.Minute || res.RetryAfter > 20*time.Minute {
+		t.Errorf("4th request: %+v", res)
+	}
+	if res, _ := m.Allow(ctx, "b", l); !res.Allowed {
+		t.Error("keys share a bucket")
+	}
+}
@@ -0,0 +1,261 @@
+// Package ratelimit protects the auth endpoints. Requests are limited with
+// GCRA (the generic cell rate algorithm, a leaky bucket that stores one
+// timestamp per key) separately per endpoint and per client IP, client_id
+// and user. Repeated failed authentications additionally lock the source out
+// for a delay that doubles with every further failure.
+//
+// The Redis backend shares the limits between replicas; Fallback switches to
+// an in-process Memory backend while Redis is unreachable, so an outage
+// loosens the limits to per-replica ones instead of disabling them.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Rate requests per Period with bursts of up to Burst requests
+// (Rate if zero). The zero Limit is unlimited.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func (l Limit) unlimited() bool {
+	return l.Rate <= 0 || l.Period <= 0
+}
+
+// interval is the time one request adds to the bucket.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// Result is the outcome of one Allow call.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of requests that would still be allowed now.
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed;
+	// zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// Backend keeps the limiter state.
+type Backend interface {
+	// Allow takes one request for key from a bucket shaped by l.
+	Allow(ctx context.Context, key string, l Limit) (Result, error)
+	// Fail counts a failure for key and returns the number of failures in
+	// the window, which starts with the first one.
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Block refuses key for d; Blocked returns the time left.
+	Block(ctx context.Context, key string, d time.Duration) error
+	Blocked(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets the failures and the block of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Rule limits one endpoint per client IP, per client_id and per user.
+type Rule struct {
+	IP     Limit
+	Client Limit
+	User   Limit
+}
+
+// Keys identify the caller of a request. Empty keys are not limited.
+type Keys struct {
+	IP     string
+	Client string
+	User   string
+}
+
+// Penalty slows down repeated failed authentications. The first Free
+// failures within Window cost nothing; each further one blocks the source for
+// Delay, doubling up to MaxDelay.
+type Penalty struct {
+	Free     int
+	Window   time.Duration
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// Options configure a Limiter.
+type Options struct {
+	Backend Backend
+	// Rules are keyed by endpoint name, e.g. "login".
+	Rules   map[string]Rule
+	Penalty Penalty
+	// TrustedProxies may set X-Forwarded-For. Without them the client IP is
+	// the peer address.
+	TrustedProxies []netip.Prefix
+	// OnLimited, if set, is called for every refused request with the
+	// endpoint and the dimension (ip, client, user or penalty) that refused it.
+	OnLimited func(endpoint, dimension string)
+}
+
+// Limiter applies the rules of every endpoint.
+type Limiter struct {
+	opts Options
+}
+
+func New(opts Options) *Limiter {
+	return &Limiter{opts: opts}
+}
+
+// keyPrefix namespaces the limiter keys in a shared Redis.
+const keyPrefix = "ratelimit:"
+
+// Allow takes one request from every bucket of endpoint that keys has a
+// value for, and refuses it if any bucket is empty. Backend errors fail
+// open: the request is allowed and the error is logged, since refusing every
+// login is worse than a short unlimited period.
+func (l *Limiter) Allow(ctx context.Context, endpoint string, keys Keys) Result {
+	rule := l.opts.Rules[endpoint]
+	out := Result{Allowed: true, Remaining: math.MaxInt}
+	for _, d := range []struct {
+		name  string
+		key   string
+		limit Limit
+	}{
+		{"ip", keys.IP, rule.IP},
+		{"client", keys.Client, rule.Client},
+		{"user", keys.User, rule.User},
+	} {
+		if d.key == "" || d.limit.unlimited() {
+			continue
+		}
+		res, err := l.opts.Backend.Allow(ctx, keyPrefix+endpoint+":"+d.name+":"+d.key, d.limit)
+		if err != nil {
+			log.Printf("ratelimit: %s %s: %v", endpoint, d.name, err)
+			continue
+		}
+		if !res.Allowed {
+			l.limited(endpoint, d.name)
+			out.Allowed = false
+			out.RetryAfter = max(out.RetryAfter, res.RetryAfter)
+		}
+		out.Remaining = min(out.Remaining, res.Remaining)
+	}
+	return out
+}
+
+// Penalized returns how long source (e.g. an IP) is still locked out of
+// scope after failed authentications.
+func (l *Limiter) Penalized(ctx context.Context, scope, source string) time.Duration {
+	if l.opts.Penalty.Delay <= 0 {
+		return 0
+	}
+	left, err := l.opts.Backend.Blocked(ctx, l.penaltyKey(scope, source))
+	if err != nil {
+		log.Printf("ratelimit: %s penalty: %v", scope, err)
+		return 0
+	}
+	if left > 0 {
+		l.limited(scope, "penalty")
+	}
+	return left
+}
+
+// Fail records a failed authentication of source and returns the lockout it
+// earned, zero while it is within Penalty.Free.
+func (l *Limiter) Fail(ctx context.Context, scope, source string) time.Duration {
+	p := l.opts.Penalty
+	if p.Delay <= 0 {
+		return 0
+	}
+	key := l.penaltyKey(scope, source)
+	n, err := l.opts.Backend.Fail(ctx, key, p.Window)
+	if err != nil {
+		log.Printf("ratelimit: %s penalty: %v", scope, err)
+		return 0
+	}
+	if n <= p.Free {
+		return 0
+	}
+	delay := p.Delay << min(n-p.Free-1, 30)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	if err := l.opts.Backend.Block(ctx, key, delay); err != nil {
+		log.Printf("ratelimit: %s penalty: %v", scope, err)
+		return 0
+	}
+	return delay
+}
+
+// Forgive clears the failures of source after a successful authentication.
+func (l *Limiter) Forgive(ctx context.Context, scope, source string) {
+	if l.opts.Penalty.Delay <= 0 {
+		return
+	}
+	if err := l.opts.Backend.Reset(ctx, l.penaltyKey(scope, source)); err != nil {
+		log.Printf("ratelimit: %s penalty: %v", scope, err)
+	}
+}
+
+func (l *Limiter) penaltyKey(scope, source string) string {
+	return keyPrefix + "fail:" + scope + ":" + source
+}
+
+func (l *Limiter) limited(endpoint, dimension string) {
+	if l.opts.OnLimited != nil {
+		l.opts.OnLimited(endpoint, dimension)
+	}
+}
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For
+// is only believed as far as the hops are trusted proxies: the rightmost
+// address that is not one is the client.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := peer.Addr().Unmap()
+	if !l.trusted(ip) {
+		return ip.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !l.trusted(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (l *Limiter) trusted(ip netip.Addr) bool {
+	for _, p := range l.opts.TrustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TooManyRequests answers 429 (RFC 6585) with Retry-After in whole seconds
+// (RFC 9110 section 10.2.3), rounded up so that a client that waits exactly
+// that long is let through.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(secs, 1)))
+	http.Error(w, "Too many requests, please retry later", http.StatusTooManyRequests)
+}
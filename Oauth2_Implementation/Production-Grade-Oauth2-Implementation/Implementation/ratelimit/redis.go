@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var _ Backend = (*Redis)(nil)
+
+// gcraScript runs GCRA on the Redis clock, so replicas with skewed clocks
+// share one bucket correctly. Times are in microseconds, which a Lua double
+// holds exactly. Returns {allowed, remaining, retry_after}.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+  tat = now
+end
+local new_tat = tat + interval
+local allow_at = new_tat - interval * burst
+if now < allow_at then
+  return {0, 0, allow_at - now}
+end
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((now - allow_at) / interval), 0}
+`)
+
+// failScript counts failures in a window that starts with the first one.
+var failScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// Redis is a Backend shared by all replicas. Every key is used on its own,
+// so it works with Redis Cluster.
+type Redis struct {
+	rdb redis.UniversalClient
+}
+
+// NewRedis uses rdb, typically the client of the state store. Close is left
+// to its owner.
+func NewRedis(rdb redis.UniversalClient) *Redis {
+	return &Redis{rdb: rdb}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, l Limit) (Result, error) {
+	reply, err := gcraScript.Run(ctx, r.rdb, []string{key}, l.interval().Microseconds(), l.burst()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    reply[0] == 1,
+		Remaining:  int(reply[1]),
+		RetryAfter: time.Duration(reply[2]) * time.Microsecond,
+	}, nil
+}
+
+func (r *Redis) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	n, err := failScript.Run(ctx, r.rdb, []string{key + ":n"}, window.Milliseconds()).Int()
+	return n, err
+}
+
+func (r *Redis) Block(ctx context.Context, key string, d time.Duration) error {
+	return r.rdb.Set(ctx, key+":block", 1, d).Err()
+}
+
+func (r *Redis) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	d, err := r.rdb.PTTL(ctx, key+":block").Result()
+	if err != nil {
+		return 0, err
+	}
+	// -2 and -1 (no key, no expiry) come back as negative durations
+	return max(d, 0), nil
+}
+
+// Reset issues one DEL per key, as the two keys may live in different
+// cluster slots.
+func (r *Redis) Reset(ctx context.Context, key string) error {
+	if err := r.rdb.Del(ctx, key+":n").Err(); err != nil {
+		return err
+	}
+	return r.rdb.Del(ctx, key+":block").Err()
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// handleAuthorize is the authorization endpoint of RFC 6749 section 4.1.1
+// for registered clients. It checks the request and sends the user to the
+// upstream provider; /callback then answers the client with our own code
+// or, for the implicit and hybrid flows of clients with LegacyFlows, tokens.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	// Shares the login limits: every request writes a state key
+	if !s.allow(w, r, "login", ratelimit.Keys{IP: s.limiter.ClientIP(r)}) {
+		return
+	}
+	q := r.URL.Query()
+
+	// Until client and redirect_uri are verified, errors are shown to the
+	// user and never sent to the redirect_uri (section 4.1.2.1)
+	if len(q["client_id"]) > 1 || len(q["redirect_uri"]) > 1 {
+		s.ui.Error(w, r, oautherr.New(oautherr.InvalidRequest, "client_id and redirect_uri may only be given once"))
+		return
+	}
+	clientID := q.Get("client_id")
+	if clientID == "" {
+		s.ui.Error(w, r, oautherr.New(oautherr.InvalidRequest, "client_id is missing"))
+		return
+	}
+	cl, err := s.store.GetClient(r.Context(), clientID)
+	if err != nil {
+		s.ui.Error(w, r, clientError(err))
+		return
+	}
+	redirectParam := q.Get("redirect_uri")
+	redirectURI, ok := redirectTarget(cl, redirectParam)
+	if !ok {
+		s.ui.Error(w, r, oautherr.New(oautherr.InvalidRequest, "redirect_uri is missing or not registered for this client"))
+		return
+	}
+	if !s.allow(w, r, "login", ratelimit.Keys{Client: cl.ID}) {
+		return
+	}
+
+	login := loginstate.Record{
+		ClientID:         cl.ID,
+		RedirectURI:      redirectURI,
+		RedirectURIParam: redirectParam,
+		ClientState:      q.Get("state"),
+		UILocales:        q.Get("ui_locales"),
+	}
+	rt, rtErr := parseResponseType(q.Get("response_type"))
+	mode, modeErr := responseMode(q.Get("response_mode"), rt)
+	if strings.HasSuffix(mode, jwtSuffix) && s.signer == nil {
+		// Clients could not verify an HMAC-signed response; refuse in
+		// the plain mode
+		mode = strings.TrimSuffix(mode, jwtSuffix)
+		if modeErr == nil {
+			modeErr = oautherr.New(oautherr.InvalidRequest, "JWT-secured responses need an asymmetric signing key")
+		}
+	}
+	login.ResponseMode = mode
+	reject := func(e *oautherr.Error) {
+		s.authorizationError(w, r, login, e)
+	}
+	if modeErr != nil {
+		reject(modeErr)
+		return
+	}
+	for _, p := range []string{"response_type", "response_mode", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		if len(q[p]) > 1 {
+			reject(oautherr.New(oautherr.InvalidRequest, p+" may only be given once"))
+			return
+		}
+	}
+	switch {
+	case rtErr != nil:
+		reject(rtErr)
+		return
+	case rt.legacy() && !cl.LegacyFlows:
+		reject(oautherr.New(oautherr.UnauthorizedClient, "This client may only use response_type=code"))
+		return
+	case rt.idToken && s.signer == nil:
+		reject(oautherr.New(oautherr.UnsupportedResponseType, "response_type id_token needs an asymmetric signing key"))
+		return
+	case rt.idToken && q.Get("nonce") == "":
+		// OpenID Connect Core section 3.2.2.1: replay protection for the
+		// ID token, which is not bound to a code exchange
+		reject(oautherr.New(oautherr.InvalidRequest, "nonce is required with response_type id_token"))
+		return
+	}
+	if login.Scopes, err = requestedScopes(cl, q.Get("scope")); err != nil {
+		reject(oautherr.Wrap(oautherr.InvalidScope, "The requested scope is not allowed for this client", err))
+		return
+	}
+	if rt.idToken && !slices.Contains(login.Scopes, "openid") {
+		reject(oautherr.New(oautherr.InvalidScope, "response_type id_token needs the openid scope"))
+		return
+	}
+	login.ResponseType = rt.String()
+	login.ClientNonce = q.Get("nonce")
+	if rt.code {
+		challenge, method, e := codeChallenge(cl, q.Get("code_challenge"), q.Get("code_challenge_method"))
+		if e != nil {
+			reject(e)
+			return
+		}
+		login.CodeChallenge, login.CodeChallengeMethod = challenge, method
+	}
+
+	s.startLogin(w, r, login, reject)
+}
+
+// redirectTarget resolves the redirect_uri of an authorization request. It
+// may only be left out when the client registered exactly one.
+func redirectTarget(cl *storage.Client, param string) (string, bool) {
+	if param == "" {
+		if len(cl.RedirectURIs) != 1 {
+			return "", false
+		}
+		return cl.RedirectURIs[0], true
+	}
+	return param, cl.AllowsRedirectURI(param)
+}
+
+// codeChallenge checks the PKCE parameters of an authorization request (RFC
+// 7636 section 4.4). Public clients have to send a challenge, and plain is
+// only accepted from clients allowed to use it: it protects nothing once the
+// authorization request is observed.
+func codeChallenge(cl *storage.Client, challenge, method string) (string, string, *oautherr.Error) {
+	if challenge == "" {
+		if method != "" {
+			return "", "", oautherr.New(oautherr.InvalidRequest, "code_challenge_method without code_challenge")
+		}
+		if cl.Public() {
+			return "", "", oautherr.New(oautherr.InvalidRequest, "Public clients have to use PKCE; code_challenge is missing")
+		}
+		return "", "", nil
+	}
+	if method == "" {
+		method = cryptoutil.MethodPlain // the default of section 4.3
+	}
+	switch {
+	case method != cryptoutil.MethodPlain && method != cryptoutil.MethodS256:
+		return "", "", oautherr.New(oautherr.InvalidRequest, "Unsupported code_challenge_method; use S256")
+	case method == cryptoutil.MethodPlain && !cl.AllowPlainPKCE:
+		return "", "", oautherr.New(oautherr.InvalidRequest, "code_challenge_method plain is not allowed for this client; use S256")
+	case !cryptoutil.ValidCodeChallenge(method, challenge):
+		return "", "", oautherr.New(oautherr.InvalidRequest, "code_challenge is malformed")
+	}
+	return challenge, method, nil
+}
+
+// requestedScopes checks the scope parameter against the client's
+// registration. Without one the client gets all its registered scopes.
+func requestedScopes(cl *storage.Client, param string) ([]string, error) {
+	requested := strings.Fields(param)
+	if len(requested) == 0 {
+		return cl.Scopes, nil
+	}
+	allowed := make(map[string]bool, len(cl.Scopes))
+	for _, sc := range cl.Scopes {
+		allowed[sc] = true
+	}
+	for _, sc := range requested {
+		if !allowed[sc] {
+			return nil, errors.New("scope " + sc + " is not registered for client " + cl.ID)
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/metrics"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ui"
+)
+
+// grantScopes are the scopes a login ends up with: what the client asked
+// for at /authorize or /device_authorization, or for /login what was asked
+// of the provider.
+func (s *Server) grantScopes(login loginstate.Record) []string {
+	if login.Scopes != nil {
+		return login.Scopes
+	}
+	return s.upstream.Scopes
+}
+
+// needsConsent reports whether the user still has to approve the client
+// for the scopes of p. The default client behind /login is our own and
+// never asks.
+func (s *Server) needsConsent(ctx context.Context, cl *storage.Client, p loginstate.Pending) bool {
+	if cl.ID == "" {
+		return false
+	}
+	consent, err := s.store.GetConsent(ctx, p.UserID, cl.ID)
+	if err != nil {
+		return true
+	}
+	return !consent.Covers(p.Scopes)
+}
+
+// askConsent parks p and shows the consent page, which posts to /consent.
+func (s *Server) askConsent(w http.ResponseWriter, r *http.Request, cl *storage.Client, p loginstate.Pending) error {
+	id, err := cryptoutil.Token(stateBytes)
+	if err != nil {
+		return err
+	}
+	if err := s.loginStates.SavePending(r.Context(), id, p); err != nil {
+		return err
+	}
+	page := &ui.ConsentPage{
+		Page:       ui.Page{UILocales: p.UILocales},
+		ClientName: cl.Name,
+		ClientID:   cl.ID,
+		Scopes:     p.Scopes,
+		ConsentID:  id,
+	}
+	if p.RedirectURI != "" {
+		page.FormTargets = []string{ui.Origin(p.RedirectURI)}
+	}
+	s.ui.Render(w, r, http.StatusOK, ui.PageConsent, page)
+	return nil
+}
+
+// handleConsent takes the user's answer on the consent page.
+func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.ui.Error(w, r, oautherr.New(oautherr.InvalidRequest, "The consent form has to be submitted"))
+		return
+	}
+	if !s.allow(w, r, "callback", ratelimit.Keys{IP: s.limiter.ClientIP(r)}) {
+		return
+	}
+	if err := s.ui.CheckCSRF(r); err != nil {
+		s.ui.Error(w, r, oautherr.Wrap(oautherr.InvalidRequest, "The form has expired, please start again", err))
+		return
+	}
+	p, err := s.loginStates.ConsumePending(r.Context(), r.PostFormValue("consent_id"))
+	if err != nil {
+		s.ui.Error(w, r, stateError(err))
+		return
+	}
+	cl, err := s.lookupClient(r.Context(), p.ClientID)
+	if err != nil {
+		s.ui.Error(w, r, clientError(err))
+		return
+	}
+
+	if r.PostFormValue("action") != "approve" {
+		s.record(r, &audit.Event{Type: audit.EventConsentDenied, UserID: p.UserID, ClientID: cl.ID, Scopes: p.Scopes})
+		if err := s.vault.Delete(r.Context(), p.UpstreamRef); err != nil {
+			log.Println("consent: deleting upstream token:", err)
+		}
+		if p.DeviceCode != "" {
+			if err := s.devices.Deny(r.Context(), p.DeviceCode); err != nil {
+				log.Println("consent: denying device:", err)
+			}
+		}
+		s.loginError(w, r, p.Record, oautherr.New(oautherr.AccessDenied, "The request was denied"))
+		return
+	}
+
+	// Add to what the user allowed before rather than replace it
+	consent := &storage.Consent{UserID: p.UserID, ClientID: cl.ID, Scopes: p.Scopes}
+	if prev, err := s.store.GetConsent(r.Context(), p.UserID, cl.ID); err == nil {
+		consent.Scopes = union(prev.Scopes, p.Scopes)
+	}
+	if err := s.store.SaveConsent(r.Context(), consent); err != nil {
+		s.loginError(w, r, p.Record, oautherr.From(fmt.Errorf("saving consent: %w", err)))
+		return
+	}
+	s.record(r, &audit.Event{Type: audit.EventConsentGranted, UserID: p.UserID, ClientID: cl.ID, Scopes: p.Scopes})
+	s.complete(w, r, cl, p)
+}
+
+// complete records the grant of an authenticated and consented login and
+// answers the way the login was started. It returns the result label for
+// the login metrics.
+func (s *Server) complete(w http.ResponseWriter, r *http.Request, cl *storage.Client, p loginstate.Pending) string {
+	// Record the grant so it can be listed and revoked independently of the
+	// access tokens issued for it
+	grant := &storage.Grant{
+		ClientID:    cl.ID,
+		UserID:      p.UserID,
+		Scopes:      p.Scopes,
+		UpstreamRef: p.UpstreamRef,
+		ExpiresAt:   time.Now().Add(s.grantTTL),
+	}
+	if err := s.store.CreateGrant(r.Context(), grant); err != nil {
+		s.loginError(w, r, p.Record, oautherr.From(fmt.Errorf("storing grant: %w", err)))
+		return "storage_failed"
+	}
+
+	switch {
+	case p.RedirectURI != "":
+		// An /authorize login hands the client a code to redeem at /token
+		// or, in the legacy flows, the tokens themselves
+		return s.authorizationGranted(w, r, cl, p, grant)
+
+	case p.DeviceCode != "":
+		// The device picks up its token on the next poll
+		err := s.devices.Approve(r.Context(), p.DeviceCode, devicecode.Authorization{
+			UserID:      p.UserID,
+			GrantID:     grant.ID,
+			Scopes:      grant.Scopes,
+			UpstreamRef: p.UpstreamRef,
+			User:        p.User,
+		})
+		if err != nil {
+			s.loginError(w, r, p.Record, deviceError(err))
+			return "storage_failed"
+		}
+		s.ui.Render(w, r, http.StatusOK, ui.PageDevice, &ui.DevicePage{Page: ui.Page{UILocales: p.UILocales}, Done: true})
+
+	default:
+		// Issue the access token in the client's format. For JWTs the user
+		// info travels inside the token (encrypted when JWE is configured);
+		// for opaque tokens it stays in Redis and is only visible through
+		// introspection.
+		format := tokens.Format(cl.AccessTokenFormat)
+		claims := accessClaims(cl.ID, p.UserID, grant.ID, p.UpstreamRef, p.User)
+		accessToken, err := s.tokens.Issue(r.Context(), format, claims, cl.AccessTokenTTL)
+		if err != nil {
+			s.loginError(w, r, p.Record, oautherr.From(fmt.Errorf("issuing access token: %w", err)))
+			return "issue_failed"
+		}
+		s.tokenIssued(r, cl, p.UserID, grant, "authorization_code", format)
+
+		// Return the access token + user info in response
+		body := map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(cl.AccessTokenTTL.Seconds()),
+			"user":         p.User,
+		}
+		if format == tokens.FormatJWT {
+			body["jwt_token"] = accessToken
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(body)
+	}
+	return metrics.ResultOK
+}
+
+// loginError answers e the way login was started: on the client's redirect
+// URI for /authorize, as a page for device logins and as JSON for /login.
+func (s *Server) loginError(w http.ResponseWriter, r *http.Request, login loginstate.Record, e *oautherr.Error) {
+	switch {
+	case login.RedirectURI != "":
+		s.authorizationError(w, r, login, e)
+	case login.DeviceCode != "":
+		s.ui.ErrorIn(w, r, login.UILocales, e)
+	default:
+		oautherr.WriteJSON(w, r, e)
+	}
+}
+
+// union returns a followed by the elements of b not in a.
+func union(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	out := append([]string(nil), a...)
+	for _, v := range a {
+		seen[v] = true
+	}
+	for _, v := range b {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ui"
+)
+
+// deviceGrantType is the grant_type of RFC 8628 section 3.4.
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// handleDeviceAuthorization is the device authorization endpoint of RFC 8628
+// section 3.1. Clients authenticate as on /token.
+func (s *Server) handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	cl, ok := s.tokenRequestClient(w, r)
+	if !ok {
+		return
+	}
+	scopes, err := requestedScopes(cl, r.PostForm.Get("scope"))
+	if err != nil {
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.InvalidScope, "The requested scope is not allowed for this client", err))
+		return
+	}
+	deviceCode, userCode, err := s.devices.Start(r.Context(), devicecode.Authorization{ClientID: cl.ID, Scopes: scopes})
+	if err != nil {
+		oautherr.WriteJSON(w, r, oautherr.From(fmt.Errorf("starting device authorization: %w", err)))
+		return
+	}
+
+	verification := s.publicURL + "/device"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          verification,
+		"verification_uri_complete": verification + "?user_code=" + url.QueryEscape(userCode),
+		"expires_in":                int(s.devices.TTL().Seconds()),
+		"interval":                  int(devicecode.Interval.Seconds()),
+	})
+}
+
+// handleDevice is the verification page where users enter the code shown on
+// their device. A valid code starts the login for that device.
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	page := &ui.DevicePage{Page: ui.Page{
+		// The form ends up at the identity provider
+		FormTargets: []string{ui.Origin(s.upstream.Endpoint.AuthURL)},
+	}}
+	if r.Method != http.MethodPost {
+		page.UserCode = r.URL.Query().Get("user_code")
+		s.ui.Render(w, r, http.StatusOK, ui.PageDevice, page)
+		return
+	}
+
+	// User codes are short, so guessing them is limited like secrets
+	ip := s.limiter.ClientIP(r)
+	if s.penalized(w, r, "device", ip) || !s.allow(w, r, "login", ratelimit.Keys{IP: ip}) {
+		return
+	}
+	if err := s.ui.CheckCSRF(r); err != nil {
+		s.ui.Error(w, r, oautherr.Wrap(oautherr.InvalidRequest, "The form has expired, please start again", err))
+		return
+	}
+	page.UserCode = r.PostFormValue("user_code")
+	deviceCode, a, err := s.devices.Lookup(r.Context(), page.UserCode)
+	if errors.Is(err, devicecode.ErrExpired) {
+		s.limiter.Fail(r.Context(), "device", ip)
+		page.Message = "device.invalid_code"
+		s.ui.Render(w, r, http.StatusBadRequest, ui.PageDevice, page)
+		return
+	}
+	if err != nil {
+		s.ui.Error(w, r, deviceError(err))
+		return
+	}
+	s.limiter.Forgive(r.Context(), "device", ip)
+	if _, err := s.lookupClient(r.Context(), a.ClientID); err != nil {
+		s.ui.Error(w, r, clientError(err))
+		return
+	}
+
+	login := loginstate.Record{ClientID: a.ClientID, Scopes: a.Scopes, DeviceCode: deviceCode}
+	s.startLogin(w, r, login, func(e *oautherr.Error) {
+		s.ui.Error(w, r, e)
+	})
+}
+
+// redeemDevice answers grant_type=urn:ietf:params:oauth:grant-type:device_code
+// while the device polls.
+func (s *Server) redeemDevice(w http.ResponseWriter, r *http.Request, cl *storage.Client) {
+	deviceCode := r.PostForm.Get("device_code")
+	if deviceCode == "" {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidRequest, "device_code is missing"))
+		return
+	}
+	// Only the client the code was issued to learns its status
+	a, err := s.devices.Poll(r.Context(), deviceCode)
+	if a.ClientID != "" && a.ClientID != cl.ID {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidGrant, "The device code was issued to another client"))
+		return
+	}
+	if err != nil {
+		oautherr.WriteJSON(w, r, deviceError(err))
+		return
+	}
+	if body, ok := s.issueForGrant(w, r, cl, deviceGrantType, a.UserID, a.GrantID, a.UpstreamRef, a.User); ok {
+		writeTokenResponse(w, body)
+	}
+}
+
+// deviceError maps the errors of the device code store.
+func deviceError(err error) *oautherr.Error {
+	switch {
+	case errors.Is(err, devicecode.ErrPending):
+		return oautherr.New(oautherr.AuthorizationPending, "The user has not approved the device yet")
+	case errors.Is(err, devicecode.ErrSlowDown):
+		return oautherr.New(oautherr.SlowDown, "Polling too fast, wait longer between requests")
+	case errors.Is(err, devicecode.ErrDenied):
+		return oautherr.New(oautherr.AccessDenied, "The user denied the request")
+	case errors.Is(err, devicecode.ErrExpired):
+		return oautherr.Wrap(oautherr.ExpiredToken, "The device code has expired, please start again", err)
+	default:
+		return oautherr.From(fmt.Errorf("device authorization: %w", err))
+	}
+}
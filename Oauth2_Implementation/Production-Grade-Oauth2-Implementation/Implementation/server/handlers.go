@@ -0,0 +1,596 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/metrics"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ui"
+)
+
+func (s *Server) handleMain(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.ui.Render(w, r, http.StatusOK, ui.PageLogin, &ui.LoginPage{LoginURL: "login"})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	// Every login writes a state key, so limit before anything else
+	if !s.allow(w, r, "login", ratelimit.Keys{IP: s.limiter.ClientIP(r)}) {
+		return
+	}
+	clientID := r.URL.Query().Get("client_id")
+	if _, err := s.lookupClient(r.Context(), clientID); err != nil {
+		s.ui.Error(w, r, clientError(err))
+		return
+	}
+	if !s.allow(w, r, "login", ratelimit.Keys{Client: clientID}) {
+		return
+	}
+	login := loginstate.Record{ClientID: clientID, UILocales: r.URL.Query().Get("ui_locales")}
+	s.startLogin(w, r, login, func(e *oautherr.Error) {
+		s.ui.ErrorIn(w, r, login.UILocales, e)
+	})
+}
+
+// stateBytes is the entropy of state values, nonces and consent IDs.
+const stateBytes = 32
+
+// startLogin remembers login under a new state, binds the state to this
+// browser and sends the user to the upstream provider. A failure is passed
+// to fail.
+func (s *Server) startLogin(w http.ResponseWriter, r *http.Request, login loginstate.Record, fail func(*oautherr.Error)) {
+	state, err := cryptoutil.Token(stateBytes)
+	if err != nil {
+		fail(oautherr.From(fmt.Errorf("generating state: %w", err)))
+		return
+	}
+	if login.CodeVerifier, err = cryptoutil.CodeVerifier(); err != nil {
+		fail(oautherr.From(fmt.Errorf("generating code verifier: %w", err)))
+		return
+	}
+	codeChallenge := cryptoutil.S256Challenge(login.CodeVerifier)
+
+	opts := []oauth2.AuthCodeOption{
+		oauth2.AccessTypeOffline, // lets the vault refresh upstream tokens
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", cryptoutil.MethodS256),
+	}
+	if requestsIDToken(s.upstream.Scopes) {
+		if login.Nonce, err = cryptoutil.Token(stateBytes); err != nil {
+			fail(oautherr.From(fmt.Errorf("generating nonce: %w", err)))
+			return
+		}
+		opts = append(opts, oidc.Nonce(login.Nonce))
+	}
+
+	// Store code_verifier, nonce and the requesting client keyed by state, and
+	// bind the state to this browser
+	if err := s.loginStates.Save(r.Context(), state, login); err != nil {
+		span := trace.SpanFromContext(r.Context())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "saving login state")
+		fail(oautherr.From(fmt.Errorf("saving login state: %w", err)))
+		return
+	}
+	s.loginBinder.Bind(w, state)
+	s.metrics.LoginsStarted.WithLabelValues(s.metrics.Client(login.ClientID)).Inc()
+
+	http.Redirect(w, r, s.upstream.AuthCodeURL(state, opts...), http.StatusFound)
+}
+
+// handleCallback completes a login at the upstream provider. Logins started
+// at /authorize end with a redirect to the client carrying our authorization
+// code or an error, device logins with a page telling the user to go back to
+// the device, and logins started at /login with the access token, or an
+// error, as JSON. Registered clients first need the user's consent.
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	state := query.Get("state")
+	code := query.Get("code")
+
+	// Every return below sets result; the client is only labelled once it
+	// is known to be registered
+	clientLabel, result := metrics.ClientUnknown, "error"
+	var clientID, userID string
+	var scopes []string
+	var login loginstate.Record
+	ip := s.limiter.ClientIP(r)
+	defer func() {
+		// Guessing or replaying states slows the source down
+		switch result {
+		case "state_rejected", "id_token_rejected":
+			s.limiter.Fail(r.Context(), "callback", ip)
+		case metrics.ResultOK:
+			s.limiter.Forgive(r.Context(), "callback", ip)
+		}
+
+		e := &audit.Event{Type: audit.EventLogin, UserID: userID, ClientID: clientID, Scopes: scopes}
+		if result != metrics.ResultOK {
+			e.Outcome = audit.OutcomeFailure
+			e.Details = map[string]string{"reason": result}
+		}
+		s.record(r, e)
+
+		s.metrics.LoginsCompleted.WithLabelValues(clientLabel, result).Inc()
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("oauth.client", clientLabel), attribute.String("oauth.login.result", result))
+		if result != metrics.ResultOK {
+			span.SetStatus(codes.Error, result)
+		}
+	}()
+	// Until the login state is consumed there is no verified redirect URI,
+	// and the answer is JSON
+	fail := func(reason string, e *oautherr.Error) {
+		result = reason
+		trace.SpanFromContext(r.Context()).RecordError(e)
+		s.loginError(w, r, login, e)
+	}
+
+	if s.penalized(w, r, "callback", ip) || !s.allow(w, r, "callback", ratelimit.Keys{IP: ip}) {
+		result = "rate_limited"
+		return
+	}
+
+	// The state must belong to this browser and is consumed on first use
+	if err := s.loginBinder.Verify(r, state); err != nil {
+		fail("state_rejected", stateError(err))
+		return
+	}
+	var err error
+	if login, err = s.loginStates.Consume(r.Context(), state); err != nil {
+		fail("state_rejected", stateError(err))
+		return
+	}
+	cl, err := s.lookupClient(r.Context(), login.ClientID)
+	if err != nil {
+		// The redirect URI was only vouched for by the registration
+		login.RedirectURI = ""
+		fail("unknown_client", clientError(err))
+		return
+	}
+	clientLabel, clientID = s.metrics.Client(cl.ID), cl.ID
+
+	// The user declined, or the provider could not log them in
+	if upstreamErr := query.Get("error"); upstreamErr != "" {
+		fail("upstream_error", upstreamError(upstreamErr))
+		return
+	}
+
+	// Exchange authorization code for tokens
+	token, err := s.exchange(r.Context(), code, login.CodeVerifier)
+	if err != nil {
+		fail("exchange_failed", oautherr.Wrap(oautherr.ServerError, "The login could not be completed with the identity provider", err))
+		return
+	}
+
+	// With openid in scope, Google's ID token must carry our nonce
+	var idToken *oidc.IDToken
+	if login.Nonce != "" {
+		if idToken, err = s.verifyIDToken(r.Context(), token, login); err != nil {
+			fail("id_token_rejected", stateError(err))
+			return
+		}
+	}
+
+	// Fetch user info from Google
+	userInfo, err := s.fetchUserInfo(r.Context(), s.upstream.TokenSource(s.upstreamContext(r.Context()), token))
+	if err != nil {
+		fail("userinfo_failed", oautherr.Wrap(oautherr.ServerError, "The user profile could not be read from the identity provider", err))
+		return
+	}
+
+	// Map the Google account onto our own user record
+	subject, _ := userInfo["sub"].(string)
+	if subject == "" {
+		fail("userinfo_failed", oautherr.Wrap(oautherr.ServerError, "The user profile could not be read from the identity provider",
+			errors.New("user info has no subject")))
+		return
+	}
+	if idToken != nil && idToken.Subject != subject {
+		fail("id_token_rejected", oautherr.Wrap(oautherr.AccessDenied, "The response of the identity provider could not be verified",
+			fmt.Errorf("userinfo subject %q does not match id_token subject %q", subject, idToken.Subject)))
+		return
+	}
+	// Only a verified address is kept: admin roles can be assigned by email
+	var email string
+	if emailVerified(userInfo) {
+		email, _ = userInfo["email"].(string)
+	}
+	name, _ := userInfo["name"].(string)
+	user := &storage.User{
+		Provider:    "google",
+		Subject:     subject,
+		Email:       email,
+		Name:        name,
+		LastLoginAt: time.Now(),
+	}
+	if err := s.store.UpsertUser(r.Context(), user); err != nil {
+		fail("storage_failed", oautherr.From(fmt.Errorf("storing user: %w", err)))
+		return
+	}
+	userID = user.ID
+	if !s.allow(w, r, "callback", ratelimit.Keys{User: user.ID}) {
+		result = "rate_limited"
+		return
+	}
+	if user.Disabled {
+		fail("user_disabled", oautherr.New(oautherr.AccessDenied, "This account is disabled"))
+		return
+	}
+
+	// Park the upstream tokens in the vault; only the reference goes in the JWT
+	upstreamRef, err := s.vault.Put(r.Context(), token)
+	if err != nil {
+		fail("storage_failed", oautherr.From(fmt.Errorf("storing upstream token: %w", err)))
+		return
+	}
+
+	// Registered clients need the user's consent to every scope they get;
+	// the consent page continues from here once the user has answered
+	p := loginstate.Pending{Record: login, UserID: user.ID, UpstreamRef: upstreamRef, User: userInfo}
+	p.Scopes = s.grantScopes(login)
+	scopes = p.Scopes
+	if s.needsConsent(r.Context(), cl, p) {
+		if err := s.askConsent(w, r, cl, p); err != nil {
+			fail("storage_failed", oautherr.From(fmt.Errorf("saving pending consent: %w", err)))
+			return
+		}
+		result = metrics.ResultOK
+		return
+	}
+	result = s.complete(w, r, cl, p)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if !s.allow(w, r, "logout", ratelimit.Keys{IP: s.limiter.ClientIP(r)}) {
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token != "" {
+		claims, err := s.revokeToken(r.Context(), token)
+		s.metrics.Revocations.WithLabelValues("logout", metrics.Result(err)).Inc()
+		s.record(r, revocationEvent(audit.EventLogout, claims, err))
+		if err != nil {
+			http.Error(w, "Logout failed, please try again", stateStatus(err))
+			return
+		}
+	}
+	w.Write([]byte("Logged out successfully"))
+}
+
+// handleIntrospect implements RFC 7662 for resource servers. Callers must
+// authenticate as a registered confidential client.
+func (s *Server) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Guessing client secrets locks out that client_id from that address
+	ip := s.limiter.ClientIP(r)
+	id, secret, ok := r.BasicAuth()
+	source := id + "@" + ip
+	if s.penalized(w, r, "client_auth", source) {
+		return
+	}
+	if !ok || !s.authenticateClient(r.Context(), id, secret) {
+		if ok {
+			s.limiter.Fail(r.Context(), "client_auth", source)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+		http.Error(w, "Client authentication failed", http.StatusUnauthorized)
+		return
+	}
+	s.limiter.Forgive(r.Context(), "client_auth", source)
+	if !s.allow(w, r, "introspect", ratelimit.Keys{IP: ip, Client: id}) {
+		return
+	}
+
+	active := false
+	claims, err := s.tokens.Introspect(r.Context(), r.PostFormValue("token"))
+	if err == nil {
+		active, err = s.grantActive(r.Context(), claims)
+	}
+	if err != nil && !errors.Is(err, tokens.ErrInvalidToken) && !errors.Is(err, tokens.ErrExpiredToken) {
+		// Not knowing is not the same as inactive; let the resource server
+		// retry instead of logging the user out.
+		log.Println("introspect:", err)
+		s.metrics.Introspections.WithLabelValues(metrics.ResultError).Inc()
+		http.Error(w, "Introspection temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !active {
+		s.metrics.Introspections.WithLabelValues("inactive").Inc()
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+		return
+	}
+	s.metrics.Introspections.WithLabelValues("active").Inc()
+	resp := map[string]interface{}{"active": true, "token_type": "Bearer"}
+	for k, v := range claims {
+		if k != "upstream_ref" {
+			resp[k] = v
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleRevoke implements RFC 7009. Clients authenticate as on /token and
+// can only revoke their own tokens (section 2.1). Unknown tokens are not an
+// error.
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ip := s.limiter.ClientIP(r)
+	if !s.allow(w, r, "revoke", ratelimit.Keys{IP: ip}) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.InvalidRequest, "The request body could not be parsed", err))
+		return
+	}
+	cl, ok := s.requestClient(w, r, ip)
+	if !ok || !s.allow(w, r, "revoke", ratelimit.Keys{Client: cl.ID}) {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidRequest, "token is missing"))
+		return
+	}
+
+	// RFC 7009 section 2.2.1: 503 tells the client to retry later
+	unavailable := func(err error) {
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.TemporarilyUnavailable, "Revocation temporarily unavailable", err))
+	}
+	claims, err := s.tokens.Introspect(r.Context(), token)
+	if errors.Is(err, tokens.ErrInvalidToken) || errors.Is(err, tokens.ErrExpiredToken) {
+		// Nothing left to revoke
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		s.metrics.Revocations.WithLabelValues("revoke", metrics.ResultError).Inc()
+		unavailable(err)
+		return
+	}
+	if owner, _ := claims["client_id"].(string); owner != cl.ID {
+		err := fmt.Errorf("token of client %q revoked by %q", owner, cl.ID)
+		s.metrics.Revocations.WithLabelValues("revoke", metrics.ResultError).Inc()
+		s.record(r, revocationEvent(audit.EventTokenRevoked, claims, err))
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.UnauthorizedClient, "The token was issued to another client", err))
+		return
+	}
+	claims, err = s.revokeToken(r.Context(), token)
+	s.metrics.Revocations.WithLabelValues("revoke", metrics.Result(err)).Inc()
+	s.record(r, revocationEvent(audit.EventTokenRevoked, claims, err))
+	if err != nil {
+		unavailable(err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// stateError maps a refused login state or ID token to what the user is
+// told; the details are only logged.
+func stateError(err error) *oautherr.Error {
+	switch {
+	case errors.Is(err, loginstate.ErrReplayed):
+		return oautherr.Wrap(oautherr.InvalidRequest, "This login was already completed", err)
+	case errors.Is(err, loginstate.ErrExpired):
+		return oautherr.Wrap(oautherr.InvalidRequest, "Login expired, please start again", err)
+	case errors.Is(err, loginstate.ErrMismatch):
+		return oautherr.Wrap(oautherr.InvalidRequest, "Login was started in a different browser", err)
+	case errors.Is(err, loginstate.ErrNonce):
+		return oautherr.Wrap(oautherr.AccessDenied, "The response of the identity provider could not be verified", err)
+	default:
+		return oautherr.From(fmt.Errorf("reading login state: %w", err))
+	}
+}
+
+// upstreamError maps the error code the upstream provider sent to /callback.
+// Its error_description is the provider's business and is not passed on.
+func upstreamError(code string) *oautherr.Error {
+	cause := fmt.Errorf("upstream provider answered %q", code)
+	switch oautherr.Code(code) {
+	case oautherr.AccessDenied:
+		return oautherr.Wrap(oautherr.AccessDenied, "The login was cancelled or refused", cause)
+	case oautherr.TemporarilyUnavailable:
+		return oautherr.Wrap(oautherr.TemporarilyUnavailable, "The identity provider is temporarily unavailable, please try again later", cause)
+	default:
+		return oautherr.Wrap(oautherr.ServerError, "The identity provider could not complete the login", cause)
+	}
+}
+
+// clientError maps a failed client lookup.
+func clientError(err error) *oautherr.Error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return oautherr.Wrap(oautherr.InvalidRequest, "Unknown client_id", err)
+	}
+	return oautherr.From(fmt.Errorf("looking up client: %w", err))
+}
+
+// stateStatus picks the status for a failed state store call: 503 while the
+// store is known to be down, so clients back off and retry, and 500 otherwise.
+func stateStatus(err error) int {
+	if errors.Is(err, state.ErrUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// exchange redeems an upstream authorization code.
+func (s *Server) exchange(ctx context.Context, code, codeVerifier string) (token *oauth2.Token, err error) {
+	ctx, span := s.startSpan(ctx, "upstream.Exchange")
+	start := time.Now()
+	defer func() {
+		s.metrics.CodeExchange.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+		endSpan(span, err)
+	}()
+
+	return s.upstream.Exchange(s.upstreamContext(ctx), code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+}
+
+// fetchUserInfo calls the upstream userinfo endpoint with the tokens of src.
+func (s *Server) fetchUserInfo(ctx context.Context, src oauth2.TokenSource) (userInfo map[string]interface{}, err error) {
+	ctx, span := s.startSpan(ctx, "upstream.UserInfo")
+	start := time.Now()
+	defer func() {
+		s.metrics.UserInfo.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := oauth2.NewClient(s.upstreamContext(ctx), src).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getting user info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting user info: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		return nil, fmt.Errorf("parsing user info: %w", err)
+	}
+	return userInfo, nil
+}
+
+// emailVerified reports whether userInfo vouches for its email claim. Some
+// providers send email_verified as the string "true" instead of a boolean.
+func emailVerified(userInfo map[string]interface{}) bool {
+	switch v := userInfo["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// verifyIDToken checks the signature, issuer, audience and expiry of the ID
+// token returned with token, and that it carries the nonce of this login.
+func (s *Server) verifyIDToken(ctx context.Context, token *oauth2.Token, login loginstate.Record) (idToken *oidc.IDToken, err error) {
+	ctx, span := s.startSpan(ctx, "upstream.VerifyIDToken")
+	defer func() { endSpan(span, err) }()
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in token response", loginstate.ErrNonce)
+	}
+	idToken, err = s.idTokens.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", loginstate.ErrNonce, err)
+	}
+	if err = login.CheckNonce(idToken.Nonce); err != nil {
+		return nil, err
+	}
+	return idToken, nil
+}
+
+// revokeToken invalidates an access token of either format, the grant it was
+// issued under and the upstream tokens it was pointing at, and returns the
+// token's claims (none for an unknown token). The error is only reported when
+// the token itself could not be revoked; the rest is cleanup that is logged
+// and also ends with the grant or vault TTL.
+func (s *Server) revokeToken(ctx context.Context, token string) (tokens.Claims, error) {
+	claims, err := s.tokens.Revoke(ctx, token)
+	if err != nil {
+		log.Println("revoking token:", err)
+		return nil, err
+	}
+	if id, ok := claims["grant_id"].(string); ok {
+		if err := s.store.RevokeGrant(ctx, id, time.Now()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println("revoking grant:", err)
+		}
+	}
+	if ref, ok := claims["upstream_ref"].(string); ok {
+		if err := s.vault.Delete(ctx, ref); err != nil {
+			log.Println("deleting upstream token:", err)
+		}
+	}
+	return claims, nil
+}
+
+// revocationEvent describes a revocation for the audit trail. Unknown tokens
+// are recorded too, without user or client.
+func revocationEvent(typ string, claims tokens.Claims, err error) *audit.Event {
+	e := &audit.Event{Type: typ}
+	e.UserID, _ = claims["sub"].(string)
+	e.ClientID, _ = claims["client_id"].(string)
+	if id, ok := claims["grant_id"].(string); ok {
+		e.Details = map[string]string{"grant_id": id}
+	}
+	switch {
+	case err != nil:
+		e.Outcome = audit.OutcomeFailure
+		e.Details = map[string]string{"reason": err.Error()}
+	case claims == nil:
+		e.Details = map[string]string{"token": "unknown"}
+	}
+	return e
+}
+
+// grantActive reports whether the grant behind an access token is still in
+// force. Every access token we issue names its grant; a token without
+// grant_id is not one of them. Errors other than a missing grant are
+// returned, since they say nothing about the token.
+func (s *Server) grantActive(ctx context.Context, claims tokens.Claims) (bool, error) {
+	id, ok := claims["grant_id"].(string)
+	if !ok || id == "" {
+		return false, nil
+	}
+	grant, err := s.store.GetGrant(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading grant: %w", err)
+	}
+	return grant.Active(time.Now()), nil
+}
+
+// lookupClient resolves a client_id; the empty ID is the default client.
+func (s *Server) lookupClient(ctx context.Context, id string) (*storage.Client, error) {
+	if id == "" {
+		return s.defaultClient.Load(), nil
+	}
+	return s.store.GetClient(ctx, id)
+}
+
+// authenticateClient checks the credentials of a confidential client.
+func (s *Server) authenticateClient(ctx context.Context, id, secret string) bool {
+	if id == "" {
+		return false
+	}
+	cl, err := s.store.GetClient(ctx, id)
+	if err != nil {
+		return false
+	}
+	return cl.CheckSecret(secret)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// JWKSPath serves the public keys ID tokens are signed with.
+const JWKSPath = "/.well-known/jwks.json"
+
+// idTokenTTL is how long the ID tokens of the implicit and hybrid flows are
+// valid. The client checks them right away; they are not sent anywhere.
+const idTokenTTL = 5 * time.Minute
+
+// idToken signs an ID token for userID towards client clientID (OpenID
+// Connect Core section 3.3.2.11). code and accessToken are the ones in
+// the same authorization or token response, if any; the token carries their
+// c_hash and at_hash so the client can tell they belong together.
+func (s *Server) idToken(clientID, userID, nonce, code, accessToken string) (string, error) {
+	now := time.Now()
+	claims := tokens.Claims{
+		"iss":   s.issuer,
+		"sub":   userID,
+		"aud":   clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(idTokenTTL).Unix(),
+		"nonce": nonce,
+	}
+	alg := s.signer.Algorithm()
+	for claim, v := range map[string]string{"c_hash": code, "at_hash": accessToken} {
+		if v == "" {
+			continue
+		}
+		hash, err := tokens.HalfHash(alg, v)
+		if err != nil {
+			return "", err
+		}
+		claims[claim] = hash
+	}
+	return s.signer.Sign(tokens.TypeJWT, claims)
+}
+
+// handleJWKS publishes the keys ID tokens are verified with. Retired keys
+// stay in the set until tokens signed with them have expired.
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(s.signer.JWKS())
+}
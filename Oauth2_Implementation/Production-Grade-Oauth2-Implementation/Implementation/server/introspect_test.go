@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// unreadableGrants fails every grant lookup.
+type unreadableGrants struct{ storage.Store }
+
+func (unreadableGrants) GetGrant(context.Context, string) (*storage.Grant, error) {
+	return nil, errors.New("database down")
+}
+
+func TestIntrospectGrant(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	ts.createClient(t, &storage.Client{ID: "rs"})
+	revokedAt := time.Now()
+	for _, g := range []*storage.Grant{
+		{ID: "live", ClientID: "spa", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)},
+		{ID: "revoked", ClientID: "spa", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt},
+		{ID: "expired", ClientID: "spa", UserID: "u1", ExpiresAt: time.Now().Add(-time.Minute)},
+	} {
+		if err := ts.store.CreateGrant(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issue := func(grantID string) string {
+		token, err := ts.tokens.Issue(ctx, tokens.FormatOpaque, accessClaims("spa", "u1", grantID, "", nil), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for _, tt := range []struct {
+		grant string
+		want  bool
+	}{
+		{"live", true},
+		{"revoked", false},
+		{"expired", false},
+		{"deleted", false},
+	} {
+		if resp := ts.introspect(t, issue(tt.grant)); resp["active"] != tt.want {
+			t.Errorf("grant %s: %v, want active %v", tt.grant, resp, tt.want)
+		}
+	}
+
+	// Not being able to read the grant is not an inactive token
+	token := issue("live")
+	ts.Server.store = unreadableGrants{ts.store}
+	req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("rs", "secret")
+	rec := httptest.NewRecorder()
+	ts.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unreadable grant: status %d: %s", rec.Code, rec.Body)
+	}
+}
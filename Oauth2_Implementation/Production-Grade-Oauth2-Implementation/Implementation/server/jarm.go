@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// jwtSuffix marks the response modes of JWT Secured Authorization Response
+// Mode for OAuth 2.0 (JARM): query.jwt, fragment.jwt and form_post.jwt carry
+// a single response parameter, a JWT holding what the plain mode would
+// send.
+const jwtSuffix = ".jwt"
+
+// jarmTTL is how long a JWT-secured authorization response is valid. The
+// client checks it when the browser arrives; JARM section 2.1 recommends
+// ten minutes at most.
+const jarmTTL = 5 * time.Minute
+
+// secureResponse packs the parameters of an authorization response to
+// client clientID into a JWT signed with our key, and encrypts it when the
+// client registered a ResponseEncryptionKey (JARM section 2.1). iss and aud
+// let the client check who the response is from and for; that is what the
+// plain parameters cannot prove. The JWT is typed
+// tokens.TypeAuthorizationResponse, so it is no access token at /introspect.
+func (s *Server) secureResponse(ctx context.Context, clientID string, params url.Values) (string, error) {
+	now := time.Now()
+	claims := tokens.Claims{
+		"iss": s.issuer,
+		"aud": clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(jarmTTL).Unix(),
+	}
+	for k := range params {
+		claims[k] = params.Get(k)
+	}
+	signed, err := s.signer.Sign(tokens.TypeAuthorizationResponse, claims)
+	if err != nil {
+		return "", err
+	}
+	cl, err := s.store.GetClient(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	if cl.ResponseEncryptionKey == "" {
+		return signed, nil
+	}
+	key, err := tokens.ParseEncryptionJWK([]byte(cl.ResponseEncryptionKey))
+	if err != nil {
+		return "", fmt.Errorf("client %q: response_encryption_key: %w", clientID, err)
+	}
+	return tokens.EncryptTo(key, signed)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// introspect asks /introspect about token as the resource server rs.
+func (ts *testServer) introspect(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("rs", "secret")
+	rec := httptest.NewRecorder()
+	ts.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("introspect: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestIntrospectRejectsSignedResponses(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	ts.createClient(t, &storage.Client{ID: "rs"})
+	cl := ts.createClient(t, &storage.Client{ID: "spa", RedirectURIs: []string{"https://spa.example/cb"}})
+	grant := &storage.Grant{ID: "grant-1", ClientID: cl.ID, UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := ts.store.CreateGrant(ctx, grant); err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := ts.tokens.Issue(ctx, tokens.FormatJWT, accessClaims(cl.ID, "u1", grant.ID, "", nil), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := ts.introspect(t, access); resp["active"] != true {
+		t.Fatalf("access token: %v, want active", resp)
+	}
+
+	// Both carry everything an access token has, grant_id included
+	response, err := ts.secureResponse(ctx, cl.ID, url.Values{
+		"code": {"c"}, "sub": {"u1"}, "grant_id": {grant.ID}, "client_id": {cl.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := ts.idToken(cl.ID, "u1", "n", "c", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"JARM response": response, "ID token": idToken} {
+		if resp := ts.introspect(t, token); resp["active"] != false {
+			t.Errorf("%s: %v, want inactive", name, resp)
+		}
+	}
+}
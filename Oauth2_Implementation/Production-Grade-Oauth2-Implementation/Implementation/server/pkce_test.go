@@ -0,0 +1,98 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// verifier is a valid code verifier of the minimum length.
+var verifier = strings.Repeat("a", cryptoutil.MinVerifierLength)
+
+func TestCodeChallenge(t *testing.T) {
+	confidential := &storage.Client{ID: "web", SecretHash: storage.HashSecret("secret")}
+	public := &storage.Client{ID: "spa"}
+	plain := &storage.Client{ID: "legacy", SecretHash: storage.HashSecret("secret"), AllowPlainPKCE: true}
+	s256 := cryptoutil.S256Challenge(verifier)
+
+	for _, tt := range []struct {
+		name              string
+		client            *storage.Client
+		challenge, method string
+		wantMethod        string
+		wantErr           bool
+	}{
+		{"S256", public, s256, "S256", "S256", false},
+		{"no PKCE from a confidential client", confidential, "", "", "", false},
+		{"no PKCE from a public client", public, "", "", "", true},
+		{"method without challenge", confidential, "", "S256", "", true},
+		{"plain refused", public, verifier, "plain", "", true},
+		{"plain by default refused", public, verifier, "", "", true},
+		{"plain allowed", plain, verifier, "plain", "plain", false},
+		{"plain by default allowed", plain, verifier, "", "plain", false},
+		{"unknown method", public, s256, "S512", "", true},
+		{"method is case sensitive", public, s256, "s256", "", true},
+		{"S256 challenge not base64url", public, strings.Repeat("+", 43), "S256", "", true},
+		{"S256 challenge too short", public, s256[:42], "S256", "", true},
+		{"plain challenge too short", plain, verifier[1:], "plain", "", true},
+		{"plain challenge too long", plain, strings.Repeat("a", cryptoutil.MaxVerifierLength+1), "plain", "", true},
+		{"plain challenge with a space", plain, verifier[1:] + " ", "plain", "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, method, err := codeChallenge(tt.client, tt.challenge, tt.method)
+			if tt.wantErr {
+				if err == nil || err.Code != oautherr.InvalidRequest {
+					t.Fatalf("got %v, want invalid_request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if challenge != tt.challenge || method != tt.wantMethod {
+				t.Errorf("got %q %q, want %q %q", challenge, method, tt.challenge, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestCheckCodeVerifier(t *testing.T) {
+	s256 := authcode.Code{CodeChallenge: cryptoutil.S256Challenge(verifier), CodeChallengeMethod: cryptoutil.MethodS256}
+	plain := authcode.Code{CodeChallenge: verifier, CodeChallengeMethod: cryptoutil.MethodPlain}
+	long := strings.Repeat("~", cryptoutil.MaxVerifierLength)
+	tooLong := long + "~"
+
+	for _, tt := range []struct {
+		name     string
+		code     authcode.Code
+		verifier string
+		ok       bool
+	}{
+		{"S256", s256, verifier, true},
+		{"plain", plain, verifier, true},
+		{"no PKCE", authcode.Code{}, "", true},
+		{"verifier without challenge", authcode.Code{}, verifier, false},
+		{"missing verifier", s256, "", false},
+		{"wrong verifier", s256, strings.Repeat("b", cryptoutil.MinVerifierLength), false},
+		{"S256 challenge sent as verifier", s256, s256.CodeChallenge, false},
+		{"plain verifier against S256", plain, cryptoutil.S256Challenge(verifier), false},
+		{"longest verifier", authcode.Code{CodeChallenge: cryptoutil.S256Challenge(long), CodeChallengeMethod: cryptoutil.MethodS256}, long, true},
+		{"verifier too long", authcode.Code{CodeChallenge: cryptoutil.S256Challenge(tooLong), CodeChallengeMethod: cryptoutil.MethodS256}, tooLong, false},
+		{"verifier too short", authcode.Code{CodeChallenge: cryptoutil.S256Challenge(verifier[1:]), CodeChallengeMethod: cryptoutil.MethodS256}, verifier[1:], false},
+		{"verifier with a reserved character", authcode.Code{CodeChallenge: cryptoutil.S256Challenge(verifier + "/"), CodeChallengeMethod: cryptoutil.MethodS256}, verifier + "/", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCodeVerifier(tt.code, tt.verifier)
+			if tt.ok && err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !tt.ok && (err == nil || err.Code != oautherr.InvalidGrant) {
+				t.Fatalf("got %v, want invalid_grant", err)
+			}
+		})
+	}
+}
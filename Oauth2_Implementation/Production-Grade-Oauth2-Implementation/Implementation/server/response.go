@@ -0,0 +1,217 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/metrics"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// Response modes of the authorization endpoint: query and fragment of RFC
+// 6749 and OAuth 2.0 Multiple Response Type Encoding Practices, form_post of
+// OAuth 2.0 Form Post Response Mode. Each has a JWT-secured variant, see
+// jwtSuffix; plain jwt picks the one of the default mode.
+const (
+	responseModeQuery    = "query"
+	responseModeFragment = "fragment"
+	responseModeFormPost = "form_post"
+	responseModeJWT      = "jwt"
+)
+
+// responseType is a parsed response_type: what the authorization response
+// carries. Anything but code alone is an implicit or hybrid flow, which
+// puts tokens in the browser and needs storage.Client.LegacyFlows.
+type responseType struct {
+	code, token, idToken bool
+}
+
+// parseResponseType accepts code, token and id_token in any order and
+// combination.
+func parseResponseType(param string) (responseType, *oautherr.Error) {
+	var rt responseType
+	values := strings.Fields(param)
+	if len(values) == 0 {
+		return rt, oautherr.New(oautherr.InvalidRequest, "response_type is missing")
+	}
+	for _, v := range values {
+		var seen *bool
+		switch v {
+		case "code":
+			seen = &rt.code
+		case "token":
+			seen = &rt.token
+		case "id_token":
+			seen = &rt.idToken
+		default:
+			return rt, oautherr.New(oautherr.UnsupportedResponseType, "response_type "+v+" is not supported")
+		}
+		if *seen {
+			return rt, oautherr.New(oautherr.InvalidRequest, "response_type lists "+v+" twice")
+		}
+		*seen = true
+	}
+	return rt, nil
+}
+
+// legacy reports whether rt is an implicit or hybrid flow.
+func (rt responseType) legacy() bool {
+	return rt.token || rt.idToken
+}
+
+// String is rt in the order of the OAuth 2.0 response type registry, empty
+// for code alone.
+func (rt responseType) String() string {
+	if !rt.legacy() {
+		return ""
+	}
+	var values []string
+	if rt.code {
+		values = append(values, "code")
+	}
+	if rt.idToken {
+		values = append(values, "id_token")
+	}
+	if rt.token {
+		values = append(values, "token")
+	}
+	return strings.Join(values, " ")
+}
+
+// responseMode checks the response_mode of a request for rt. Tokens must
+// not travel in the query, where they end up in logs and Referer headers,
+// not even inside a signed JWT (JARM section 2.3.1). jwt is resolved to the
+// JWT-secured default mode. The returned mode is usable even with an error,
+// to send that error.
+func responseMode(param string, rt responseType) (string, *oautherr.Error) {
+	def := responseModeQuery
+	if rt.legacy() {
+		def = responseModeFragment
+	}
+	if param == responseModeJWT {
+		return def + jwtSuffix, nil
+	}
+	base, secured := strings.CutSuffix(param, jwtSuffix)
+	if secured {
+		def += jwtSuffix
+	}
+	switch base {
+	case "":
+		if secured {
+			return def, oautherr.New(oautherr.InvalidRequest, "Unsupported response_mode")
+		}
+		return def, nil
+	case responseModeQuery:
+		if rt.legacy() {
+			return def, oautherr.New(oautherr.InvalidRequest, "response_mode="+param+" cannot carry tokens; use fragment or form_post")
+		}
+		return param, nil
+	case responseModeFragment, responseModeFormPost:
+		return param, nil
+	default:
+		return def, oautherr.New(oautherr.InvalidRequest, "Unsupported response_mode")
+	}
+}
+
+// authorizationResponse sends params and the client's state to the
+// redirect URI of login, in its response mode. The JWT-secured modes send
+// them as a single response parameter; if that JWT cannot be made, the user
+// sees the error instead, since the client would not take anything else.
+func (s *Server) authorizationResponse(w http.ResponseWriter, r *http.Request, login loginstate.Record, params url.Values) {
+	if login.ClientState != "" {
+		params.Set("state", login.ClientState)
+	}
+	mode, secured := strings.CutSuffix(login.ResponseMode, jwtSuffix)
+	if secured {
+		response, err := s.secureResponse(r.Context(), login.ClientID, params)
+		if err != nil {
+			s.ui.ErrorIn(w, r, login.UILocales, oautherr.From(fmt.Errorf("securing authorization response: %w", err)))
+			return
+		}
+		params = url.Values{"response": {response}}
+	}
+	switch mode {
+	case responseModeFormPost:
+		s.ui.FormPost(w, r, login.RedirectURI, params, login.UILocales)
+	case responseModeFragment:
+		http.Redirect(w, r, oautherr.AppendParams(login.RedirectURI, params, true), http.StatusFound)
+	default:
+		http.Redirect(w, r, oautherr.AppendParams(login.RedirectURI, params, false), http.StatusFound)
+	}
+}
+
+// authorizationError sends e to the client of an /authorize login.
+func (s *Server) authorizationError(w http.ResponseWriter, r *http.Request, login loginstate.Record, e *oautherr.Error) {
+	s.authorizationResponse(w, r, login, oautherr.Params(r, e))
+}
+
+// authorizationGranted answers an /authorize login under grant with what
+// its response type asks for: a code to redeem at /token, an access token
+// and an ID token. It returns the result label for the login metrics.
+func (s *Server) authorizationGranted(w http.ResponseWriter, r *http.Request, cl *storage.Client, p loginstate.Pending, grant *storage.Grant) string {
+	rt := responseType{code: true}
+	if p.ResponseType != "" {
+		var e *oautherr.Error
+		if rt, e = parseResponseType(p.ResponseType); e != nil {
+			s.authorizationError(w, r, p.Record, e)
+			return "issue_failed"
+		}
+	}
+	params := url.Values{}
+	var code, accessToken string
+	if rt.code {
+		var err error
+		code, err = s.codes.Issue(r.Context(), authcode.Code{
+			ClientID:    cl.ID,
+			RedirectURI: p.RedirectURIParam,
+			UserID:      p.UserID,
+			GrantID:     grant.ID,
+			Scopes:      grant.Scopes,
+			UpstreamRef: p.UpstreamRef,
+			User:        p.User,
+
+			CodeChallenge:       p.CodeChallenge,
+			CodeChallengeMethod: p.CodeChallengeMethod,
+
+			IDToken: rt.idToken,
+			Nonce:   p.ClientNonce,
+		})
+		if err != nil {
+			s.authorizationError(w, r, p.Record, oautherr.From(fmt.Errorf("issuing authorization code: %w", err)))
+			return "storage_failed"
+		}
+		params.Set("code", code)
+	}
+	if rt.token {
+		format := tokens.Format(cl.AccessTokenFormat)
+		claims := accessClaims(cl.ID, p.UserID, grant.ID, p.UpstreamRef, p.User)
+		var err error
+		if accessToken, err = s.tokens.Issue(r.Context(), format, claims, cl.AccessTokenTTL); err != nil {
+			s.authorizationError(w, r, p.Record, oautherr.From(fmt.Errorf("issuing access token: %w", err)))
+			return "issue_failed"
+		}
+		s.tokenIssued(r, cl, p.UserID, grant, "implicit", format)
+		params.Set("access_token", accessToken)
+		params.Set("token_type", "Bearer")
+		params.Set("expires_in", fmt.Sprint(int(cl.AccessTokenTTL.Seconds())))
+		if len(grant.Scopes) > 0 {
+			params.Set("scope", strings.Join(grant.Scopes, " "))
+		}
+	}
+	if rt.idToken {
+		idToken, err := s.idToken(cl.ID, p.UserID, p.ClientNonce, code, accessToken)
+		if err != nil {
+			s.authorizationError(w, r, p.Record, oautherr.From(fmt.Errorf("signing ID token: %w", err)))
+			return "issue_failed"
+		}
+		params.Set("id_token", idToken)
+	}
+	s.authorizationResponse(w, r, p.Record, params)
+	return metrics.ResultOK
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+func TestParseResponseType(t *testing.T) {
+	for _, tt := range []struct {
+		param  string
+		want   responseType
+		legacy string // String of the parsed type
+		err    oautherr.Code
+	}{
+		{"code", responseType{code: true}, "", ""},
+		{"token", responseType{token: true}, "token", ""},
+		{"id_token", responseType{idToken: true}, "id_token", ""},
+		{"id_token token", responseType{token: true, idToken: true}, "id_token token", ""},
+		{"token id_token", responseType{token: true, idToken: true}, "id_token token", ""},
+		{"code id_token", responseType{code: true, idToken: true}, "code id_token", ""},
+		{"id_token code", responseType{code: true, idToken: true}, "code id_token", ""},
+		{"code token", responseType{code: true, token: true}, "code token", ""},
+		{"token code", responseType{code: true, token: true}, "code token", ""},
+		{"code id_token token", responseType{code: true, token: true, idToken: true}, "code id_token token", ""},
+		{"token  code\tid_token", responseType{code: true, token: true, idToken: true}, "code id_token token", ""},
+		{"", responseType{}, "", oautherr.InvalidRequest},
+		{" ", responseType{}, "", oautherr.InvalidRequest},
+		{"code code", responseType{}, "", oautherr.InvalidRequest},
+		{"token id_token token", responseType{}, "", oautherr.InvalidRequest},
+		{"none", responseType{}, "", oautherr.UnsupportedResponseType},
+		{"Code", responseType{}, "", oautherr.UnsupportedResponseType},
+		{"code device_code", responseType{}, "", oautherr.UnsupportedResponseType},
+	} {
+		rt, err := parseResponseType(tt.param)
+		if tt.err != "" {
+			if err == nil || err.Code != tt.err {
+				t.Errorf("%q: got %v, want %s", tt.param, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.param, err)
+			continue
+		}
+		if rt != tt.want || rt.String() != tt.legacy {
+			t.Errorf("%q: got %+v %q, want %+v %q", tt.param, rt, rt.String(), tt.want, tt.legacy)
+		}
+		if rt.legacy() != (tt.legacy != "") {
+			t.Errorf("%q: legacy() = %v", tt.param, rt.legacy())
+		}
+	}
+}
+
+func TestResponseMode(t *testing.T) {
+	code := responseType{code: true}
+	hybrid := responseType{code: true, idToken: true}
+	implicit := responseType{token: true}
+
+	for _, tt := range []struct {
+		param string
+		rt    responseType
+		want  string
+		fails bool
+	}{
+		{"", code, "query", false},
+		{"", hybrid, "fragment", false},
+		{"", implicit, "fragment", false},
+		{"query", code, "query", false},
+		{"fragment", code, "fragment", false},
+		{"form_post", code, "form_post", false},
+		{"fragment", implicit, "fragment", false},
+		{"form_post", hybrid, "form_post", false},
+		{"jwt", code, "query.jwt", false},
+		{"jwt", implicit, "fragment.jwt", false},
+		{"query.jwt", code, "query.jwt", false},
+		{"fragment.jwt", hybrid, "fragment.jwt", false},
+		{"form_post.jwt", implicit, "form_post.jwt", false},
+
+		// Tokens never go in the query, signed or not; the error is then
+		// sent in the flow's default mode.
+		{"query", implicit, "fragment", true},
+		{"query", hybrid, "fragment", true},
+		{"query.jwt", implicit, "fragment.jwt", true},
+		{"web_message", code, "query", true},
+		{"web_message", implicit, "fragment", true},
+		{".jwt", code, "query.jwt", true},
+		{"QUERY", code, "query", true},
+	} {
+		got, err := responseMode(tt.param, tt.rt)
+		if tt.fails != (err != nil) {
+			t.Errorf("%q for %q: error %v", tt.param, tt.rt, err)
+		}
+		if err != nil && err.Code != oautherr.InvalidRequest {
+			t.Errorf("%q for %q: got %s, want invalid_request", tt.param, tt.rt, err.Code)
+		}
+		if got != tt.want {
+			t.Errorf("%q for %q: mode %q, want %q", tt.param, tt.rt, got, tt.want)
+		}
+	}
+}
+
+// TestHybridTokenResponse redeems the code of each hybrid response type:
+// the token response has an ID token exactly when the authorization
+// response had one (OpenID Connect Core section 3.3.3.8).
+func TestHybridTokenResponse(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	cl := ts.createClient(t, &storage.Client{ID: "web", RedirectURIs: []string{"https://web.example/cb"}, LegacyFlows: true})
+	grant := &storage.Grant{ID: "grant-1", ClientID: cl.ID, UserID: "u1", Scopes: []string{"openid"}, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := ts.store.CreateGrant(ctx, grant); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		responseType string
+		idToken      bool
+	}{
+		{"code", false},
+		{"code token", false},
+		{"code id_token", true},
+		{"code id_token token", true},
+	} {
+		t.Run(tt.responseType, func(t *testing.T) {
+			p := loginstate.Pending{
+				Record: loginstate.Record{
+					ClientID: cl.ID, RedirectURI: "https://web.example/cb", Scopes: grant.Scopes,
+					ResponseType: tt.responseType, ResponseMode: "fragment", ClientNonce: "n-0S6_WzA2Mj",
+				},
+				UserID: "u1",
+			}
+			rec := httptest.NewRecorder()
+			ts.authorizationGranted(rec, httptest.NewRequest(http.MethodGet, "/consent", nil), cl, p, grant)
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fragment, err := url.ParseQuery(location.Fragment)
+			if err != nil || fragment.Get("code") == "" {
+				t.Fatalf("authorization response %q: %v", rec.Header().Get("Location"), err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(url.Values{
+				"grant_type": {"authorization_code"}, "code": {fragment.Get("code")},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth(cl.ID, "secret")
+			rec = httptest.NewRecorder()
+			ts.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("token request: status %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				AccessToken string `json:"access_token"`
+				IDToken     string `json:"id_token"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.idToken {
+				if resp.IDToken != "" {
+					t.Errorf("token response has an ID token")
+				}
+				return
+			}
+
+			tok, err := jwt.ParseSigned(resp.IDToken, []jose.SignatureAlgorithm{ts.codec.Algorithm()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var claims tokens.Claims
+			if err := tok.Claims(ts.codec.JWKS().Keys[0], &claims); err != nil {
+				t.Fatalf("ID token does not verify: %v", err)
+			}
+			atHash, err := tokens.HalfHash(ts.codec.Algorithm(), resp.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for claim, want := range map[string]interface{}{
+				"iss": "https://as.example", "sub": "u1", "aud": cl.ID, "nonce": p.ClientNonce, "at_hash": atHash,
+			} {
+				if claims[claim] != want {
+					t.Errorf("%s = %v, want %v", claim, claims[claim], want)
+				}
+			}
+			if _, ok := claims["c_hash"]; ok {
+				t.Error("ID token from /token has c_hash")
+			}
+		})
+	}
+}
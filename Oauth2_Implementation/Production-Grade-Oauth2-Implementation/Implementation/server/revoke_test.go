@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// revoke POSTs token to /revoke as client id with secret; an empty id
+// sends no credentials.
+func (ts *testServer) revoke(token, id, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/revoke", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if id != "" {
+		req.SetBasicAuth(id, secret)
+	}
+	rec := httptest.NewRecorder()
+	ts.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRevoke(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	ts.createClient(t, &storage.Client{ID: "rs"})
+	ts.createClient(t, &storage.Client{ID: "spa"})
+	ts.createClient(t, &storage.Client{ID: "other"})
+
+	for _, format := range []tokens.Format{tokens.FormatOpaque, tokens.FormatJWT} {
+		grant := &storage.Grant{ID: "grant-" + string(format), ClientID: "spa", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := ts.store.CreateGrant(ctx, grant); err != nil {
+			t.Fatal(err)
+		}
+		token, err := ts.tokens.Issue(ctx, format, accessClaims("spa", "u1", grant.ID, "", nil), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			name, id, secret string
+			status           int
+			err              string
+		}{
+			{"no credentials", "", "", http.StatusUnauthorized, "invalid_client"},
+			{"wrong secret", "spa", "guess", http.StatusUnauthorized, "invalid_client"},
+			{"unknown client", "nobody", "secret", http.StatusUnauthorized, "invalid_client"},
+			{"another client", "other", "secret", http.StatusBadRequest, "unauthorized_client"},
+		} {
+			rec := ts.revoke(token, tt.id, tt.secret)
+			var body struct{ Error string }
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if rec.Code != tt.status || body.Error != tt.err {
+				t.Errorf("%s, %s: status %d %q, want %d %q", format, tt.name, rec.Code, body.Error, tt.status, tt.err)
+			}
+			if resp := ts.introspect(t, token); resp["active"] != true {
+				t.Fatalf("%s, %s: token revoked", format, tt.name)
+			}
+		}
+
+		if rec := ts.revoke(token, "spa", "secret"); rec.Code != http.StatusOK {
+			t.Fatalf("%s: owner: status %d: %s", format, rec.Code, rec.Body)
+		}
+		if resp := ts.introspect(t, token); resp["active"] != false {
+			t.Errorf("%s: %v after revocation, want inactive", format, resp)
+		}
+		// Revoking again, or a token never issued, is not an error
+		for _, token := range []string{token, "unknown"} {
+			if rec := ts.revoke(token, "spa", "secret"); rec.Code != http.StatusOK {
+				t.Errorf("%s: revoking %.10s again: status %d", format, token, rec.Code)
+			}
+		}
+		// Revoking an access token ends its grant
+		if g, err := ts.store.GetGrant(ctx, grant.ID); err != nil || g.Active(time.Now()) {
+			t.Errorf("%s: grant after revocation: %+v, %v", format, g, err)
+		}
+	}
+	if rec := ts.revoke("", "spa", "secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("no token: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,397 @@
+// Package server is the authorization server as an http.Handler. Everything
+// it needs is passed in through Options, so several servers with different
+// configurations can run in one process and other services can mount one on
+// their own mux:
+//
+//	srv, err := server.New(server.Options{...})
+//	mux.Handle("/auth/", http.StripPrefix("/auth", srv))
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/metrics"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ui"
+)
+
+// GoogleUserInfoURL is the default Options.UserInfoURL.
+const GoogleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+// TokenIssuer issues, introspects and revokes our access tokens; implemented
+// by *tokens.Issuer.
+type TokenIssuer interface {
+	Issue(ctx context.Context, format tokens.Format, claims tokens.Claims, ttl time.Duration) (string, error)
+	Introspect(ctx context.Context, token string) (tokens.Claims, error)
+	Revoke(ctx context.Context, token string) (tokens.Claims, error)
+}
+
+// Vault keeps the upstream tokens behind a reference; implemented by
+// *vault.Vault. TokenSource refreshes the token when it has expired.
+type Vault interface {
+	Put(ctx context.Context, tok *oauth2.Token) (string, error)
+	TokenSource(ctx context.Context, ref string) oauth2.TokenSource
+	Delete(ctx context.Context, ref string) error
+}
+
+// LoginStates remembers pending logins, and logins waiting for consent;
+// implemented by *loginstate.Store.
+type LoginStates interface {
+	Save(ctx context.Context, state string, rec loginstate.Record) error
+	Consume(ctx context.Context, state string) (loginstate.Record, error)
+	SavePending(ctx context.Context, id string, p loginstate.Pending) error
+	ConsumePending(ctx context.Context, id string) (loginstate.Pending, error)
+}
+
+// LoginBinder ties a login state to the browser; implemented by
+// *loginstate.Binder.
+type LoginBinder interface {
+	Bind(w http.ResponseWriter, state string)
+	Verify(r *http.Request, state string) error
+}
+
+// AuthCodes keeps the authorization codes issued to our clients; implemented
+// by *authcode.Store.
+type AuthCodes interface {
+	Issue(ctx context.Context, c authcode.Code) (string, error)
+	Redeem(ctx context.Context, code string) (authcode.Code, error)
+}
+
+// Devices keeps the pending device authorizations; implemented by
+// *devicecode.Store.
+type Devices interface {
+	Start(ctx context.Context, a devicecode.Authorization) (deviceCode, userCode string, err error)
+	Lookup(ctx context.Context, userCode string) (string, devicecode.Authorization, error)
+	Approve(ctx context.Context, deviceCode string, approved devicecode.Authorization) error
+	Deny(ctx context.Context, deviceCode string) error
+	Poll(ctx context.Context, deviceCode string) (devicecode.Authorization, error)
+	TTL() time.Duration
+}
+
+// IDTokenVerifier checks upstream ID tokens; implemented by
+// *oidc.IDTokenVerifier.
+type IDTokenVerifier interface {
+	Verify(ctx context.Context, rawIDToken string) (*oidc.IDToken, error)
+}
+
+// Signer signs the ID tokens of the implicit and hybrid flows and publishes
+// the keys to verify them; implemented by *tokens.RotatingCodec. Sign has to
+// set the typ header to typ, so the tokens cannot pass for access tokens.
+type Signer interface {
+	Sign(typ string, claims tokens.Claims) (string, error)
+	Algorithm() jose.SignatureAlgorithm
+	JWKS() jose.JSONWebKeySet
+}
+
+// Options are the dependencies and settings of a Server. Fields without a
+// default are required.
+type Options struct {
+	// Upstream is the identity provider the users log in with.
+	Upstream *oauth2.Config
+	// UserInfoURL is the upstream userinfo endpoint. Defaults to Google's.
+	UserInfoURL string
+	// IDTokenVerifier is required when Upstream.Scopes contain openid.
+	IDTokenVerifier IDTokenVerifier
+
+	Store       storage.Store
+	Tokens      TokenIssuer
+	Vault       Vault
+	LoginStates LoginStates
+	LoginBinder LoginBinder
+	AuthCodes   AuthCodes
+	Devices     Devices
+
+	// Signer signs ID tokens, and its keys are served at JWKSPath.
+	// Without one, response types with id_token are not supported. Its
+	// key should be asymmetric: clients cannot check an HMAC signature.
+	Signer Signer
+	// Issuer is the iss claim of ID tokens. Defaults to the public URL of
+	// the server.
+	Issuer string
+
+	// UI renders the pages users see and sets the security headers on
+	// every response. Defaults to the built-in theme with a random CSRF
+	// key.
+	UI *ui.UI
+	// GrantTTL is how long a grant lasts. Defaults to 30 days.
+	GrantTTL time.Duration
+	// DefaultClient serves /login without a client_id. Defaults to JWT
+	// access tokens valid for an hour.
+	DefaultClient *storage.Client
+
+	// Metrics receives the flow metrics. Defaults to metrics.Discard().
+	Metrics *metrics.Metrics
+	// Audit records logins, consents, issued and revoked tokens. Defaults
+	// to audit.Discard().
+	Audit *audit.Logger
+	// RateLimiter limits the endpoints named login (/login, /authorize and
+	// submitted device codes), callback (also /consent), token (also
+	// /device_authorization), logout, introspect and revoke, and locks out
+	// callers after failed authentications and wrong device codes. Defaults
+	// to no limits.
+	RateLimiter *ratelimit.Limiter
+	// TracerProvider receives a span per request and per upstream call.
+	// Defaults to the otel global provider.
+	TracerProvider trace.TracerProvider
+	// HTTPClient makes the calls to the upstream provider. Defaults to
+	// http.DefaultClient; its transport is wrapped to propagate the trace.
+	HTTPClient *http.Client
+}
+
+// Server serves the login flow, the authorization and token endpoints,
+// introspection and revocation.
+type Server struct {
+	upstream    *oauth2.Config
+	userInfoURL string
+	idTokens    IDTokenVerifier
+	store       storage.Store
+	tokens      TokenIssuer
+	vault       Vault
+	loginStates LoginStates
+	loginBinder LoginBinder
+	codes       AuthCodes
+	devices     Devices
+	signer      Signer
+	issuer      string
+	ui          *ui.UI
+	grantTTL    time.Duration
+	metrics     *metrics.Metrics
+	audit       *audit.Logger
+	limiter     *ratelimit.Limiter
+	traces      trace.TracerProvider
+	tracer      trace.Tracer
+	httpClient  *http.Client
+
+	// publicURL is where the server is reachable, derived from the
+	// upstream redirect URL
+	publicURL string
+
+	defaultClient atomic.Pointer[storage.Client]
+	mux           *http.ServeMux
+	handler       http.Handler
+}
+
+// New checks opts and returns a Server with its routes registered.
+func New(opts Options) (*Server, error) {
+	var errs []error
+	require := func(ok bool, name string) {
+		if !ok {
+			errs = append(errs, errors.New("server: Options."+name+" is required"))
+		}
+	}
+	require(opts.Upstream != nil, "Upstream")
+	require(opts.Store != nil, "Store")
+	require(opts.Tokens != nil, "Tokens")
+	require(opts.Vault != nil, "Vault")
+	require(opts.LoginStates != nil, "LoginStates")
+	require(opts.LoginBinder != nil, "LoginBinder")
+	require(opts.AuthCodes != nil, "AuthCodes")
+	require(opts.Devices != nil, "Devices")
+	if opts.Upstream != nil && requestsIDToken(opts.Upstream.Scopes) {
+		require(opts.IDTokenVerifier != nil, "IDTokenVerifier")
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		upstream:    opts.Upstream,
+		userInfoURL: opts.UserInfoURL,
+		idTokens:    opts.IDTokenVerifier,
+		store:       opts.Store,
+		tokens:      opts.Tokens,
+		vault:       opts.Vault,
+		loginStates: opts.LoginStates,
+		loginBinder: opts.LoginBinder,
+		codes:       opts.AuthCodes,
+		devices:     opts.Devices,
+		signer:      opts.Signer,
+		issuer:      opts.Issuer,
+		ui:          opts.UI,
+		publicURL:   publicURL(opts.Upstream.RedirectURL),
+		grantTTL:    opts.GrantTTL,
+		metrics:     opts.Metrics,
+		audit:       opts.Audit,
+		limiter:     opts.RateLimiter,
+		traces:      opts.TracerProvider,
+		mux:         http.NewServeMux(),
+	}
+	if s.userInfoURL == "" {
+		s.userInfoURL = GoogleUserInfoURL
+	}
+	if s.issuer == "" {
+		s.issuer = s.publicURL
+	}
+	if s.ui == nil {
+		u, err := ui.New(ui.Options{})
+		if err != nil {
+			return nil, err
+		}
+		s.ui = u
+	}
+	if s.metrics == nil {
+		s.metrics = metrics.Discard()
+	}
+	if s.audit == nil {
+		s.audit = audit.Discard()
+	}
+	if s.limiter == nil {
+		s.limiter = ratelimit.New(ratelimit.Options{})
+	}
+	if s.traces == nil {
+		s.traces = otel.GetTracerProvider()
+	}
+	s.tracer = s.traces.Tracer(instrumentationName)
+	s.httpClient = tracedClient(opts.HTTPClient, s.traces)
+	if s.grantTTL <= 0 {
+		s.grantTTL = 30 * 24 * time.Hour
+	}
+	def := opts.DefaultClient
+	if def == nil {
+		def = &storage.Client{AccessTokenFormat: string(tokens.FormatJWT), AccessTokenTTL: time.Hour}
+	}
+	s.defaultClient.Store(def)
+
+	s.routes()
+	s.handler = s.ui.Headers(s.mux)
+	return s, nil
+}
+
+func (s *Server) routes() {
+	s.handle("/", s.handleMain)
+	s.handle("/login", s.handleLogin)
+	s.handle("/authorize", s.handleAuthorize)
+	s.handle("/callback", s.handleCallback)
+	s.handle("/token", s.handleToken)
+	s.handle("/consent", s.handleConsent)
+	s.handle("/device_authorization", s.handleDeviceAuthorization)
+	s.handle("/device", s.handleDevice)
+	s.handle(ui.StylePath, s.ui.ServeStyle)
+	s.handle(ui.ScriptPath, s.ui.ServeScript)
+	if s.signer != nil {
+		s.handle(JWKSPath, s.handleJWKS)
+	}
+	s.handle("/logout", s.handleLogout)
+	s.handle("/introspect", s.handleIntrospect)
+	s.handle("/revoke", s.handleRevoke)
+	s.handle("/userinfo", s.handleUserInfo)
+}
+
+// handle registers h under pattern with a server span named after the
+// pattern. An incoming traceparent header continues the caller's trace.
+func (s *Server) handle(pattern string, h http.HandlerFunc) {
+	s.mux.Handle(pattern, otelhttp.NewHandler(h, pattern, otelhttp.WithTracerProvider(s.traces)))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// publicURL derives the external base URL of the server from the upstream
+// redirect URL, which points at its /callback.
+func publicURL(redirectURL string) string {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/callback")
+}
+
+// SetDefaultClient replaces the client used by /login without a client_id.
+// It is safe to call while serving, e.g. on a configuration reload.
+func (s *Server) SetDefaultClient(c *storage.Client) {
+	s.defaultClient.Store(c)
+}
+
+// instrumentationName names the tracer of this package.
+const instrumentationName = "oauth2-implementation/server"
+
+// tracedClient returns a copy of c (http.DefaultClient if nil) whose
+// requests are spans that pass the trace context on.
+func tracedClient(c *http.Client, tp trace.TracerProvider) *http.Client {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	traced := *c
+	traced.Transport = otelhttp.NewTransport(c.Transport, otelhttp.WithTracerProvider(tp))
+	return &traced
+}
+
+// upstreamContext makes the oauth2 package use the traced client.
+func (s *Server) upstreamContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+}
+
+// startSpan starts a span for one step of a handler.
+func (s *Server) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, name)
+}
+
+// endSpan marks span failed when err is set and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// record adds e to the audit trail. A failing sink is logged but does not
+// fail the request; the chain shows the gap.
+func (s *Server) record(r *http.Request, e *audit.Event) {
+	e.RemoteIP = s.limiter.ClientIP(r)
+	if err := s.audit.Record(r.Context(), e); err != nil {
+		log.Println(err)
+	}
+}
+
+// allow applies the rate limits of endpoint to keys and answers 429 when
+// one is exceeded.
+func (s *Server) allow(w http.ResponseWriter, r *http.Request, endpoint string, keys ratelimit.Keys) bool {
+	res := s.limiter.Allow(r.Context(), endpoint, keys)
+	if !res.Allowed {
+		ratelimit.TooManyRequests(w, res.RetryAfter)
+	}
+	return res.Allowed
+}
+
+// penalized answers 429 while source is locked out of scope after failed
+// authentications.
+func (s *Server) penalized(w http.ResponseWriter, r *http.Request, scope, source string) bool {
+	if left := s.limiter.Penalized(r.Context(), scope, source); left > 0 {
+		ratelimit.TooManyRequests(w, left)
+		return true
+	}
+	return false
+}
+
+// requestsIDToken reports whether the upstream scopes ask for an ID token.
+func requestsIDToken(scopes []string) bool {
+	for _, s := range scopes {
+		if s == oidc.ScopeOpenID {
+			return true
+		}
+	}
+	return false
+}
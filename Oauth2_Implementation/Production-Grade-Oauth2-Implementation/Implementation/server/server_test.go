@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"golang.org/x/oauth2"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/devicecode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/loginstate"
+	statememory "oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/memory"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/vault"
+)
+
+// testServer is a Server on in-memory stores, signing with a fresh EC key.
+type testServer struct {
+	*Server
+	codec *tokens.RotatingCodec
+	store *memory.Store
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	kv := statememory.New()
+	t.Cleanup(func() { kv.Close() })
+
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := tokens.NewRotatingCodec(func() (jose.JSONWebKey, error) { return tokens.SigningKey(sk) },
+		tokens.Expectations{Issuer: "https://as.example", Type: tokens.TypeAccessToken}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := vault.NewKeyRing("test", make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binder, err := loginstate.NewBinder(make([]byte, 32), time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &oauth2.Config{ClientID: "upstream", RedirectURL: "https://as.example/callback"}
+	store := memory.New()
+	s, err := New(Options{
+		Upstream:    upstream,
+		Store:       store,
+		Tokens:      tokens.NewIssuer(codec, kv),
+		Vault:       vault.New(kv, keys, upstream, time.Hour),
+		LoginStates: loginstate.NewStore(kv, time.Minute),
+		LoginBinder: binder,
+		AuthCodes:   authcode.NewStore(kv, time.Minute),
+		Devices:     devicecode.NewStore(kv, time.Minute),
+		Signer:      codec,
+		Issuer:      "https://as.example",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{Server: s, codec: codec, store: store}
+}
+
+// createClient registers c, confidential with secret "secret" unless it
+// already has a SecretHash.
+func (ts *testServer) createClient(t *testing.T, c *storage.Client) *storage.Client {
+	t.Helper()
+	if c.SecretHash == "" {
+		c.SecretHash = storage.HashSecret("secret")
+	}
+	if c.AccessTokenFormat == "" {
+		c.AccessTokenFormat = string(tokens.FormatJWT)
+		c.AccessTokenTTL = time.Hour
+	}
+	if err := ts.store.CreateClient(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/audit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/authcode"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+// handleToken is the token endpoint of RFC 6749 section 4.1.3: clients
+// redeem the codes /callback hands out after an /authorize login, and devices
+// poll for their token (RFC 8628 section 3.4). Errors are answered as JSON as
+// in section 5.2.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	cl, ok := s.tokenRequestClient(w, r)
+	if !ok {
+		return
+	}
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		s.redeemCode(w, r, cl)
+	case deviceGrantType:
+		s.redeemDevice(w, r, cl)
+	case "":
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidRequest, "grant_type is missing"))
+	default:
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.UnsupportedGrantType, "grant_type "+grantType+" is not supported"))
+	}
+}
+
+// tokenRequestClient checks a POST to /token or /device_authorization and
+// authenticates its client. Otherwise it answers the error and returns
+// false.
+func (s *Server) tokenRequestClient(w http.ResponseWriter, r *http.Request) (*storage.Client, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidRequest, "Requests have to be POSTed"))
+		return nil, false
+	}
+	ip := s.limiter.ClientIP(r)
+	if !s.allow(w, r, "token", ratelimit.Keys{IP: ip}) {
+		return nil, false
+	}
+	if err := r.ParseForm(); err != nil {
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.InvalidRequest, "The request body could not be parsed", err))
+		return nil, false
+	}
+
+	cl, ok := s.requestClient(w, r, ip)
+	if !ok || !s.allow(w, r, "token", ratelimit.Keys{Client: cl.ID}) {
+		return nil, false
+	}
+	return cl, true
+}
+
+// requestClient authenticates the client of a parsed form POST from ip.
+// Confidential clients authenticate with Basic or client_secret_post,
+// public clients only name themselves. Guessing secrets locks out that
+// client_id from that address, as on /introspect. On failure it answers the
+// error and returns false.
+func (s *Server) requestClient(w http.ResponseWriter, r *http.Request, ip string) (*storage.Client, bool) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	} else if form := r.PostForm.Get("client_id"); form != "" && form != id {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidRequest, "client_id does not match the client credentials"))
+		return nil, false
+	}
+	source := id + "@" + ip
+	if s.penalized(w, r, "client_auth", source) {
+		return nil, false
+	}
+	cl, err := s.tokenClient(r, id, secret)
+	if err != nil {
+		var e *oautherr.Error
+		if errors.As(err, &e) && e.Code == oautherr.InvalidClient && id != "" {
+			s.limiter.Fail(r.Context(), "client_auth", source)
+		}
+		oautherr.WriteJSON(w, r, err)
+		return nil, false
+	}
+	s.limiter.Forgive(r.Context(), "client_auth", source)
+	return cl, true
+}
+
+// tokenClient authenticates the client of a token or revocation request.
+func (s *Server) tokenClient(r *http.Request, id, secret string) (*storage.Client, error) {
+	failed := oautherr.New(oautherr.InvalidClient, "Client authentication failed")
+	if id == "" {
+		return nil, failed
+	}
+	cl, err := s.store.GetClient(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, failed
+	}
+	if err != nil {
+		return nil, oautherr.From(fmt.Errorf("looking up client: %w", err))
+	}
+	if !cl.Public() && !cl.CheckSecret(secret) {
+		return nil, failed
+	}
+	return cl, nil
+}
+
+// redeemCode answers grant_type=authorization_code.
+func (s *Server) redeemCode(w http.ResponseWriter, r *http.Request, cl *storage.Client) {
+	code := r.PostForm.Get("code")
+	if code == "" {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidRequest, "code is missing"))
+		return
+	}
+	c, err := s.codes.Redeem(r.Context(), code)
+	switch {
+	case errors.Is(err, authcode.ErrReplayed):
+		// Whoever redeemed it first may not be the client; end the grant
+		// and every token issued under it (section 4.1.2)
+		s.revokeReplayedGrant(r, cl, c.GrantID)
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.InvalidGrant, "The authorization code was already used", err))
+		return
+	case errors.Is(err, authcode.ErrInvalid):
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.InvalidGrant, "The authorization code is invalid or expired", err))
+		return
+	case err != nil:
+		oautherr.WriteJSON(w, r, oautherr.From(fmt.Errorf("redeeming authorization code: %w", err)))
+		return
+	}
+	if c.ClientID != cl.ID {
+		oautherr.WriteJSON(w, r, oautherr.Wrap(oautherr.InvalidGrant, "The authorization code was issued to another client",
+			fmt.Errorf("code of client %q redeemed by %q", c.ClientID, cl.ID)))
+		return
+	}
+	if c.RedirectURI != "" && c.RedirectURI != r.PostForm.Get("redirect_uri") {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidGrant, "redirect_uri does not match the authorization request"))
+		return
+	}
+	if e := checkCodeVerifier(c, r.PostForm.Get("code_verifier")); e != nil {
+		oautherr.WriteJSON(w, r, e)
+		return
+	}
+	body, ok := s.issueForGrant(w, r, cl, "authorization_code", c.UserID, c.GrantID, c.UpstreamRef, c.User)
+	if !ok {
+		return
+	}
+	if c.IDToken {
+		// The hybrid flow's token response repeats the ID token, bound
+		// to the new access token by at_hash
+		idToken, err := s.idToken(cl.ID, c.UserID, c.Nonce, "", body["access_token"].(string))
+		if err != nil {
+			oautherr.WriteJSON(w, r, oautherr.From(fmt.Errorf("signing ID token: %w", err)))
+			return
+		}
+		body["id_token"] = idToken
+	}
+	writeTokenResponse(w, body)
+}
+
+// checkCodeVerifier checks the code_verifier of a token request against the
+// challenge the code was issued with (RFC 7636 section 4.6). A verifier for
+// a code issued without challenge is refused as well: accepting it would let
+// an attacker who strips the challenge from the authorization request pass
+// for a client using PKCE (RFC 9700 section 2.1.1).
+func checkCodeVerifier(c authcode.Code, verifier string) *oautherr.Error {
+	switch {
+	case c.CodeChallenge == "" && verifier == "":
+		return nil
+	case c.CodeChallenge == "":
+		return oautherr.New(oautherr.InvalidGrant, "code_verifier was sent, but the authorization request had no code_challenge")
+	case verifier == "":
+		return oautherr.New(oautherr.InvalidGrant, "code_verifier is missing")
+	case !cryptoutil.VerifyCodeChallenge(c.CodeChallengeMethod, c.CodeChallenge, verifier):
+		return oautherr.New(oautherr.InvalidGrant, "code_verifier does not match the code_challenge")
+	}
+	return nil
+}
+
+// issueForGrant issues an access token for the grant a code or device code
+// was issued under, unless it was revoked meanwhile, and returns the token
+// response for writeTokenResponse. Otherwise it answers the error and
+// returns false.
+func (s *Server) issueForGrant(w http.ResponseWriter, r *http.Request, cl *storage.Client, grantType, userID, grantID, upstreamRef string, user map[string]interface{}) (map[string]interface{}, bool) {
+	grant, err := s.store.GetGrant(r.Context(), grantID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		oautherr.WriteJSON(w, r, oautherr.From(fmt.Errorf("reading grant: %w", err)))
+		return nil, false
+	}
+	if err != nil || !grant.Active(time.Now()) {
+		oautherr.WriteJSON(w, r, oautherr.New(oautherr.InvalidGrant, "The authorization was revoked"))
+		return nil, false
+	}
+
+	format := tokens.Format(cl.AccessTokenFormat)
+	claims := accessClaims(cl.ID, userID, grant.ID, upstreamRef, user)
+	accessToken, err := s.tokens.Issue(r.Context(), format, claims, cl.AccessTokenTTL)
+	if err != nil {
+		oautherr.WriteJSON(w, r, oautherr.From(fmt.Errorf("issuing access token: %w", err)))
+		return nil, false
+	}
+	s.tokenIssued(r, cl, userID, grant, grantType, format)
+
+	body := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(cl.AccessTokenTTL.Seconds()),
+	}
+	if len(grant.Scopes) > 0 {
+		body["scope"] = strings.Join(grant.Scopes, " ")
+	}
+	return body, true
+}
+
+// writeTokenResponse sends a successful token response (RFC 6749 section
+// 5.1).
+func writeTokenResponse(w http.ResponseWriter, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(body)
+}
+
+// revokeReplayedGrant revokes the grant of an authorization code that was
+// redeemed twice.
+func (s *Server) revokeReplayedGrant(r *http.Request, cl *storage.Client, grantID string) {
+	e := &audit.Event{
+		Type: audit.EventTokenRevoked, ClientID: cl.ID,
+		Details: map[string]string{"grant_id": grantID, "reason": "authorization code replayed"},
+	}
+	if err := s.store.RevokeGrant(r.Context(), grantID, time.Now()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println("revoking grant of replayed code:", err)
+		e.Outcome = audit.OutcomeFailure
+	}
+	s.record(r, e)
+}
+
+// accessClaims are the claims of an access token issued under a grant.
+func accessClaims(clientID, userID, grantID, upstreamRef string, userInfo map[string]interface{}) tokens.Claims {
+	claims := tokens.Claims{
+		"sub":          userID,
+		"grant_id":     grantID,
+		"upstream_ref": upstreamRef,
+		"user":         userInfo, // Include user details
+	}
+	if clientID != "" {
+		claims["client_id"] = clientID
+	}
+	return claims
+}
+
+// tokenIssued counts and audits an access token issued under grant.
+func (s *Server) tokenIssued(r *http.Request, cl *storage.Client, userID string, grant *storage.Grant, grantType string, format tokens.Format) {
+	s.metrics.TokensIssued.WithLabelValues(grantType, s.metrics.Client(cl.ID), string(format)).Inc()
+	s.record(r, &audit.Event{
+		Type: audit.EventTokenIssued, UserID: userID, ClientID: cl.ID, Scopes: grant.Scopes,
+		Details: map[string]string{"grant_type": grantType, "grant_id": grant.ID, "format": string(format)},
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/ratelimit"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/vault"
+)
+
+// handleUserInfo is the UserInfo endpoint of OpenID Connect Core section
+// 5.3. It answers with the profile the upstream provider has for the user
+// now, read with the upstream token the vault keeps for the access token's
+// session and refreshed there when it has expired. sub is our user ID, not
+// the provider's.
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.allow(w, r, "userinfo", ratelimit.Keys{IP: s.limiter.ClientIP(r)}) {
+		return
+	}
+	// RFC 6750 section 3: a missing token gets the challenge without an
+	// error code
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		http.Error(w, "An access token is required", http.StatusUnauthorized)
+		return
+	}
+	invalid := func(reason string) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo", error="invalid_token"`)
+		http.Error(w, reason, http.StatusUnauthorized)
+	}
+
+	active := false
+	claims, err := s.tokens.Introspect(r.Context(), raw)
+	if err == nil {
+		active, err = s.grantActive(r.Context(), claims)
+	}
+	if err != nil && !errors.Is(err, tokens.ErrInvalidToken) && !errors.Is(err, tokens.ErrExpiredToken) {
+		log.Println("userinfo:", err)
+		http.Error(w, "User info temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if !active {
+		invalid("The access token is invalid or expired")
+		return
+	}
+	userID, _ := claims["sub"].(string)
+	if !s.allow(w, r, "userinfo", ratelimit.Keys{User: userID}) {
+		return
+	}
+	ref, _ := claims["upstream_ref"].(string)
+	if ref == "" {
+		invalid("The access token has no upstream session")
+		return
+	}
+
+	profile, err := s.fetchUserInfo(r.Context(), s.vault.TokenSource(s.upstreamContext(r.Context()), ref))
+	if errors.Is(err, vault.ErrNotFound) {
+		// The session ended or its upstream tokens expired from the vault
+		invalid("The session of the access token has ended")
+		return
+	}
+	if err != nil {
+		log.Println("userinfo:", fmt.Errorf("reading upstream profile: %w", err))
+		http.Error(w, "The user profile could not be read from the identity provider", http.StatusBadGateway)
+		return
+	}
+	profile["sub"] = userID
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(profile)
+}
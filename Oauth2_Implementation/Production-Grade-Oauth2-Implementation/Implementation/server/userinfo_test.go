@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/tokens"
+)
+
+func TestEmailVerified(t *testing.T) {
+	for _, tt := range []struct {
+		claim interface{}
+		want  bool
+	}{
+		{true, true},
+		{"true", true},
+		{false, false},
+		{"false", false},
+		{"TRUE", false},
+		{1, false},
+		{nil, false},
+	} {
+		userInfo := map[string]interface{}{"email": "a@example.com"}
+		if tt.claim != nil {
+			userInfo["email_verified"] = tt.claim
+		}
+		if got := emailVerified(userInfo); got != tt.want {
+			t.Errorf("email_verified %#v: got %v, want %v", tt.claim, got, tt.want)
+		}
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	// The upstream provider: a token endpoint that rotates the refresh
+	// token, and a userinfo endpoint that only takes the current token
+	var refreshes atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			if r.FormValue("refresh_token") != "r1" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			refreshes.Add(1)
+			io.WriteString(w, `{"access_token":"fresh","refresh_token":"r2","token_type":"Bearer","expires_in":3600}`)
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer fresh" {
+				http.Error(w, `{"error":"invalid_token"}`, http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, `{"sub":"google-1","email":"a@example.com","email_verified":true,"name":"A"}`)
+		}
+	}))
+	defer upstream.Close()
+
+	ts := newTestServer(t)
+	ts.upstream.Endpoint = oauth2.Endpoint{TokenURL: upstream.URL + "/token", AuthStyle: oauth2.AuthStyleInParams}
+	ts.userInfoURL = upstream.URL + "/userinfo"
+	ctx := context.Background()
+
+	// The stored upstream token has expired and has to be refreshed
+	ref, err := ts.vault.Put(ctx, &oauth2.Token{AccessToken: "stale", RefreshToken: "r1", Expiry: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt := time.Now()
+	for _, g := range []*storage.Grant{
+		{ID: "live", ClientID: "spa", UserID: "u1", UpstreamRef: ref, ExpiresAt: time.Now().Add(time.Hour)},
+		{ID: "revoked", ClientID: "spa", UserID: "u1", UpstreamRef: ref, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt},
+	} {
+		if err := ts.store.CreateGrant(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issue := func(grantID, ref string) string {
+		token, err := ts.tokens.Issue(ctx, tokens.FormatJWT, accessClaims("spa", "u1", grantID, ref, nil), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		ts.ServeHTTP(rec, req)
+		return rec
+	}
+
+	live := issue("live", ref)
+	for i := 0; i < 2; i++ {
+		rec := get(live)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var profile map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil {
+			t.Fatal(err)
+		}
+		if profile["sub"] != "u1" || profile["email"] != "a@example.com" {
+			t.Errorf("profile %v", profile)
+		}
+	}
+	// The refreshed token went back into the vault and is reused
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("%d refreshes, want 1", n)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		coded bool // error="invalid_token" in the challenge
+	}{
+		{"no token", "", false},
+		{"forged", "forged", true},
+		{"revoked grant", issue("revoked", ref), true},
+		{"no upstream session", issue("live", ""), true},
+	} {
+		rec := get(tt.token)
+		challenge := rec.Header().Get("WWW-Authenticate")
+		if rec.Code != http.StatusUnauthorized || !strings.HasPrefix(challenge, "Bearer") ||
+			strings.Contains(challenge, `error="invalid_token"`) != tt.coded {
+			t.Errorf("%s: status %d, challenge %q", tt.name, rec.Code, challenge)
+		}
+	}
+
+	// Once the session's upstream tokens are gone the access token is
+	// useless here
+	if err := ts.vault.Delete(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get(live); rec.Code != http.StatusUnauthorized {
+		t.Errorf("after vault delete: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,148 @@
+// Package memory is an in-process state.Store. It is meant for a single
+// replica, tests and local development; state is lost on restart and not
+// shared between processes.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var (
+	_ state.Store     = (*Store)(nil)
+	_ state.Inspector = (*Store)(nil)
+)
+
+// sweepInterval is how often expired keys are dropped. Reads ignore expired
+// keys regardless, so this only bounds memory.
+const sweepInterval = time.Minute
+
+type item struct {
+	value   []byte
+	expires time.Time // zero for no expiry
+}
+
+func (it item) expired(now time.Time) bool {
+	return !it.expires.IsZero() && !now.Before(it.expires)
+}
+
+type Store struct {
+	mu    sync.Mutex
+	items map[string]item
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// New returns an empty store and starts its sweeper; Close stops it.
+func New() *Store {
+	s := &Store{items: make(map[string]item), stop: make(chan struct{})}
+	go s.sweep()
+	return s
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = newItem(value, ttl)
+	return nil
+}
+
+func (s *Store) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it, ok := s.items[key]; ok && !it.expired(time.Now()) {
+		return false, nil
+	}
+	s.items[key] = newItem(value, ttl)
+	return true, nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[key]
+	if !ok || it.expired(time.Now()) {
+		return nil, state.ErrNotFound
+	}
+	return append([]byte(nil), it.value...), nil
+}
+
+func (s *Store) GetDel(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[key]
+	if !ok || it.expired(time.Now()) {
+		return nil, state.ErrNotFound
+	}
+	delete(s.items, key)
+	return it.value, nil
+}
+
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[key]
+	return ok && !it.expired(time.Now()), nil
+}
+
+func (s *Store) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	it, ok := s.items[key]
+	if !ok || it.expired(now) {
+		return 0, state.ErrNotFound
+	}
+	if it.expires.IsZero() {
+		return 0, nil
+	}
+	return it.expires.Sub(now), nil
+}
+
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.items, k)
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *Store) sweep() {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-t.C:
+			s.dropExpired(now)
+		}
+	}
+}
+
+func (s *Store) dropExpired(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, it := range s.items {
+		if it.expired(now) {
+			delete(s.items, k)
+		}
+	}
+}
+
+func newItem(value []byte, ttl time.Duration) item {
+	it := item{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		it.expires = time.Now().Add(ttl)
+	}
+	return it
+}
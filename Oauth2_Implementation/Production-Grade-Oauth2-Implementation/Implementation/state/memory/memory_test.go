@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/statetest"
+)
+
+func TestConformance(t *testing.T) {
+	s := New()
+	defer s.Close()
+	if err := statetest.TestStore(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	defer s.Close()
+	s.Set(ctx, "expiring", []byte("v"), time.Minute)
+	s.Set(ctx, "lasting", []byte("v"), time.Hour)
+	s.Set(ctx, "forever", []byte("v"), 0)
+
+	s.dropExpired(time.Now().Add(2 * time.Minute))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items["expiring"]; ok {
+		t.Error("expired key kept")
+	}
+	if len(s.items) != 2 {
+		t.Errorf("%d keys left, want 2", len(s.items))
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	s := New()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
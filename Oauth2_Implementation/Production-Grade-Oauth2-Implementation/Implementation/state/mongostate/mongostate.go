@@ -0,0 +1,162 @@
+// Package mongostate is the state.Store for deployments that run MongoDB
+// but no Redis. Every key is a document in one collection whose TTL index
+// removes authorization and device codes, login sessions, opaque tokens,
+// revocations and vault records once they expire. The TTL monitor only runs
+// about once a minute, so reads filter out expired documents themselves.
+package mongostate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var (
+	_ state.Store     = (*Store)(nil)
+	_ state.Inspector = (*Store)(nil)
+)
+
+// Collection is where the keys live.
+const Collection = "oauth_state"
+
+type Store struct {
+	client *mongo.Client // nil when the caller owns the connection
+	coll   *mongo.Collection
+}
+
+// entry is a key. ExpiresAt is missing for keys without a TTL.
+type entry struct {
+	Key       string     `bson:"_id"`
+	Value     []byte     `bson:"value"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+// Open connects to uri, verifies the connection and keeps the keys in the
+// named database.
+func Open(ctx context.Context, uri, database string) (*Store, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("mongostate: connecting: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongostate: connecting: %w", err)
+	}
+	s := New(client.Database(database))
+	s.client = client
+	return s, nil
+}
+
+// New uses an existing database handle. Close does not disconnect it.
+func New(db *mongo.Database) *Store {
+	return &Store{coll: db.Collection(Collection)}
+}
+
+// EnsureIndexes creates the TTL index. It is idempotent and safe to run
+// from every replica at startup.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("mongostate: creating TTL index: %w", err)
+	}
+	return nil
+}
+
+func newEntry(key string, value []byte, ttl time.Duration) entry {
+	e := entry{Key: key, Value: value}
+	if ttl > 0 {
+		// BSON dates have millisecond precision; round up so a key never
+		// expires early
+		at := time.Now().Add(ttl + time.Millisecond - 1).Truncate(time.Millisecond)
+		e.ExpiresAt = &at
+	}
+	return e
+}
+
+// live matches key unless it has expired.
+func live(key string) bson.M {
+	return bson.M{"_id": key, "$or": bson.A{
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"expires_at": bson.M{"$exists": false}},
+	}}
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": key}, newEntry(key, value, ttl), options.Replace().SetUpsert(true))
+	return err
+}
+
+// SetNX replaces only an expired document; for a live one the upsert
+// collides with its _id, which is what makes it atomic.
+func (s *Store) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	_, err := s.coll.ReplaceOne(ctx,
+		bson.M{"_id": key, "expires_at": bson.M{"$lte": time.Now()}},
+		newEntry(key, value, ttl),
+		options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	var e entry
+	return decode(s.coll.FindOne(ctx, live(key)), &e)
+}
+
+func (s *Store) GetDel(ctx context.Context, key string) ([]byte, error) {
+	var e entry
+	return decode(s.coll.FindOneAndDelete(ctx, live(key)), &e)
+}
+
+func decode(res *mongo.SingleResult, e *entry) ([]byte, error) {
+	err := res.Decode(e)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, state.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := s.coll.CountDocuments(ctx, live(key), options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (s *Store) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var e entry
+	if _, err := decode(s.coll.FindOne(ctx, live(key)), &e); err != nil {
+		return 0, err
+	}
+	if e.ExpiresAt == nil {
+		return 0, nil
+	}
+	return time.Until(*e.ExpiresAt), nil
+}
+
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := s.coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	return err
+}
+
+func (s *Store) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Disconnect(context.Background())
+}
@@ -0,0 +1,91 @@
+package mongostate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/statetest"
+)
+
+func TestMock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+	ns := "oauth." + Collection
+
+	mt.Run("SetNX on a live key", func(mt *mtest.T) {
+		s := New(mt.DB)
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key"}))
+		if ok, err := s.SetNX(ctx, "k", []byte("v"), time.Minute); ok || err != nil {
+			mt.Errorf("SetNX = %v, %v, want false, nil", ok, err)
+		}
+	})
+
+	mt.Run("SetNX on a free key", func(mt *mtest.T) {
+		s := New(mt.DB)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		if ok, err := s.SetNX(ctx, "k", []byte("v"), time.Minute); !ok || err != nil {
+			mt.Errorf("SetNX = %v, %v, want true, nil", ok, err)
+		}
+		cmd := mt.GetStartedEvent().Command
+		if _, err := cmd.LookupErr("updates", "0", "q", "expires_at", "$lte"); err != nil {
+			mt.Errorf("SetNX may only replace expired keys: %s", cmd)
+		}
+	})
+
+	mt.Run("Get", func(mt *mtest.T) {
+		s := New(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: "k"}, {Key: "value", Value: []byte("v")}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+		)
+		if v, err := s.Get(ctx, "k"); err != nil || string(v) != "v" {
+			mt.Errorf("Get = %q, %v", v, err)
+		}
+		if _, err := mt.GetStartedEvent().Command.LookupErr("filter", "$or"); err != nil {
+			mt.Errorf("Get does not filter out expired keys")
+		}
+		if _, err := s.Get(ctx, "missing"); !errors.Is(err, state.ErrNotFound) {
+			mt.Errorf("Get(missing) = %v, want ErrNotFound", err)
+		}
+	})
+
+	mt.Run("EnsureIndexes", func(mt *mtest.T) {
+		s := New(mt.DB)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := s.EnsureIndexes(ctx); err != nil {
+			mt.Fatal(err)
+		}
+		v, err := mt.GetStartedEvent().Command.LookupErr("indexes", "0", "expireAfterSeconds")
+		if err != nil || v.AsInt64() != 0 {
+			mt.Errorf("no TTL index on expires_at")
+		}
+	})
+}
+
+// TestServer runs the conformance suite against the MongoDB named by
+// MONGOSTORE_URI.
+func TestServer(t *testing.T) {
+	uri := os.Getenv("MONGOSTORE_URI")
+	if uri == "" {
+		t.Skip("MONGOSTORE_URI is not set")
+	}
+	ctx := context.Background()
+	s, err := Open(ctx, uri, "oauth_statetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := statetest.TestStore(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package redisstate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Topologies accepted in Options.Mode.
+const (
+	Standalone = "standalone"
+	Sentinel   = "sentinel"
+	Cluster    = "cluster"
+)
+
+// Options describes how to reach Redis.
+type Options struct {
+	Mode string // standalone (default), sentinel or cluster
+	// Addrs is the server for standalone, the sentinels for sentinel and
+	// the seed nodes for cluster.
+	Addrs      []string
+	MasterName string // sentinel only
+
+	// Username selects a Redis 6 ACL user; leave empty for AUTH <password>.
+	Username string
+	Password string
+	// Sentinels may have their own credentials.
+	SentinelUsername string
+	SentinelPassword string
+
+	DB  int // not supported by cluster
+	TLS TLSOptions
+}
+
+type TLSOptions struct {
+	Enabled    bool
+	CAFile     string // PEM bundle; the system pool when empty
+	CertFile   string // client certificate for mutual TLS
+	KeyFile    string
+	ServerName string // overrides the name checked in the server certificate
+}
+
+// Config builds the tls.Config, or nil when TLS is disabled.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: o.ServerName}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("redisstate: reading CA file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("redisstate: no certificates in CA file")
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("redisstate: loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// NewClient connects to the topology described by o. Retries are left to the
+// resilient wrapper, so the client itself does not retry commands.
+func NewClient(o Options) (redis.UniversalClient, error) {
+	if len(o.Addrs) == 0 {
+		return nil, errors.New("redisstate: no Redis address configured")
+	}
+	tlsConfig, err := o.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	u := &redis.UniversalOptions{
+		Addrs:            o.Addrs,
+		DB:               o.DB,
+		Username:         o.Username,
+		Password:         o.Password,
+		SentinelUsername: o.SentinelUsername,
+		SentinelPassword: o.SentinelPassword,
+		MasterName:       o.MasterName,
+		TLSConfig:        tlsConfig,
+		MaxRetries:       -1,
+	}
+
+	switch o.Mode {
+	case "", Standalone:
+		if len(o.Addrs) != 1 {
+			return nil, errors.New("redisstate: standalone mode takes exactly one address")
+		}
+		return redis.NewClient(u.Simple()), nil
+	case Sentinel:
+		if o.MasterName == "" {
+			return nil, errors.New("redisstate: sentinel mode needs a master name")
+		}
+		return redis.NewFailoverClient(u.Failover()), nil
+	case Cluster:
+		if o.DB != 0 {
+			return nil, errors.New("redisstate: Redis Cluster only has database 0")
+		}
+		return redis.NewClusterClient(u.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("redisstate: unknown mode %q", o.Mode)
+	}
+}
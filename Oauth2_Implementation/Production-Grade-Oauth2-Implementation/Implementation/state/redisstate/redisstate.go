@@ -0,0 +1,98 @@
+// Package redisstate is the state.Store for deployments with more than one
+// replica. It works with a single Redis, Sentinel failover and Redis Cluster;
+// GETDEL needs Redis 6.2 or later.
+package redisstate
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var (
+	_ state.Store     = (*Store)(nil)
+	_ state.Inspector = (*Store)(nil)
+)
+
+type Store struct {
+	rdb redis.UniversalClient
+}
+
+// New wraps rdb. Close closes it.
+func New(rdb redis.UniversalClient) *Store {
+	return &Store{rdb: rdb}
+}
+
+// Client exposes the underlying client for health checks.
+func (s *Store) Client() redis.UniversalClient {
+	return s.rdb
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *Store) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.rdb.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, state.ErrNotFound
+	}
+	return b, err
+}
+
+func (s *Store) GetDel(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.rdb.GetDel(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, state.ErrNotFound
+	}
+	return b, err
+}
+
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// TTL maps the replies of PTTL, which go-redis passes on unscaled: -2 for a
+// missing key, -1 for one without expiry.
+func (s *Store) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.rdb.PTTL(ctx, key).Result()
+	switch {
+	case err != nil:
+		return 0, err
+	case ttl == -2:
+		return 0, state.ErrNotFound
+	case ttl < 0:
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Del issues one DEL per key, so the keys may live in different cluster
+// slots.
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	switch len(keys) {
+	case 0:
+		return nil
+	case 1:
+		return s.rdb.Del(ctx, keys[0]).Err()
+	}
+	_, err := s.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, k := range keys {
+			p.Del(ctx, k)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *Store) Close() error {
+	return s.rdb.Close()
+}
@@ -0,0 +1,29 @@
+package redisstate
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/statetest"
+)
+
+// The conformance suite needs a server (Redis 6.2 or later); it runs
+// against REDISSTATE_ADDR, e.g.
+//
+//	REDISSTATE_ADDR=localhost:6379 go test ./state/redisstate
+func TestConformance(t *testing.T) {
+	addr := os.Getenv("REDISSTATE_ADDR")
+	if addr == "" {
+		t.Skip("REDISSTATE_ADDR is not set")
+	}
+	rdb, err := NewClient(Options{Addrs: []string{addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(rdb)
+	defer s.Close()
+	if err := statetest.TestStore(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,248 @@
+// Package resilient wraps a state.Store with retries and a circuit breaker.
+//
+// Only idempotent operations (Get, Exists, Set, Del) are retried. SetNX and
+// GetDel are not: if a reply is lost after the backend applied the command, a
+// retry would report a collision for our own write or lose the value, which
+// is worse than surfacing the error. A login that hits such an error is
+// simply started again.
+package resilient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var _ state.Store = (*Store)(nil)
+
+type Options struct {
+	// MaxAttempts bounds calls per idempotent operation, including the
+	// first. Default 3.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; it doubles for each
+	// further retry up to MaxBackoff, with full jitter. Defaults 50ms and 1s.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// FailureThreshold consecutive failures open the breaker for Cooldown,
+	// after which a single probe is let through. Defaults 5 and 10s.
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	// OnStateChange, if set, is called when the breaker opens or closes.
+	OnStateChange func(open bool)
+}
+
+func (o *Options) setDefaults() {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 50 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Second
+	}
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = 5
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = 10 * time.Second
+	}
+}
+
+type Store struct {
+	inner   state.Store
+	opts    Options
+	breaker breaker
+}
+
+func New(inner state.Store, opts Options) *Store {
+	opts.setDefaults()
+	return &Store{
+		inner: inner,
+		opts:  opts,
+		breaker: breaker{
+			threshold: opts.FailureThreshold,
+			cooldown:  opts.Cooldown,
+			onChange:  opts.OnStateChange,
+		},
+	}
+}
+
+// Open reports whether the breaker is currently rejecting calls.
+func (s *Store) Open() bool {
+	return s.breaker.isOpen()
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.do(ctx, true, func() error { return s.inner.Set(ctx, key, value, ttl) })
+}
+
+func (s *Store) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	var ok bool
+	err := s.do(ctx, false, func() (err error) {
+		ok, err = s.inner.SetNX(ctx, key, value, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	var b []byte
+	err := s.do(ctx, true, func() (err error) {
+		b, err = s.inner.Get(ctx, key)
+		return err
+	})
+	return b, err
+}
+
+func (s *Store) GetDel(ctx context.Context, key string) ([]byte, error) {
+	var b []byte
+	err := s.do(ctx, false, func() (err error) {
+		b, err = s.inner.GetDel(ctx, key)
+		return err
+	})
+	return b, err
+}
+
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	var ok bool
+	err := s.do(ctx, true, func() (err error) {
+		ok, err = s.inner.Exists(ctx, key)
+		return err
+	})
+	return ok, err
+}
+
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	return s.do(ctx, true, func() error { return s.inner.Del(ctx, keys...) })
+}
+
+func (s *Store) Close() error {
+	return s.inner.Close()
+}
+
+func (s *Store) do(ctx context.Context, idempotent bool, call func() error) error {
+	attempts := 1
+	if idempotent {
+		attempts = s.opts.MaxAttempts
+	}
+	backoff := s.opts.BaseBackoff
+	for i := 1; ; i++ {
+		ok, probe := s.breaker.allow()
+		if !ok {
+			return state.ErrUnavailable
+		}
+		err := call()
+		o := outcomeOf(ctx, err)
+		s.breaker.record(probe, o)
+		if o != failed || i >= attempts {
+			return err
+		}
+
+		// Full jitter keeps replicas from retrying in lockstep.
+		delay := time.Duration(rand.Int63n(int64(backoff) + 1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		if backoff *= 2; backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+}
+
+// outcome is what a call says about the backend's health.
+type outcome int
+
+const (
+	ignored outcome = iota // nothing: the caller gave up
+	succeeded
+	failed
+)
+
+// outcomeOf classifies the result of a call. Missing keys are an answer
+// from a healthy backend; the caller giving up says nothing either way.
+func outcomeOf(ctx context.Context, err error) outcome {
+	switch {
+	case err == nil, errors.Is(err, state.ErrNotFound):
+		return succeeded
+	case ctx.Err() != nil:
+		return ignored
+	default:
+		return failed
+	}
+}
+
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(open bool)
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow lets calls through while closed. Once the cooldown of an open breaker
+// has passed, exactly one probe is admitted until its result is recorded;
+// probe tells the caller that its call is that probe.
+func (b *breaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true, false
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// record counts the outcome of a call allow admitted. While the breaker is
+// open only its probe decides: success closes it, failure opens it for
+// another cooldown. Calls admitted before it opened that finish late are not
+// counted, so they neither close it nor free the probe slot.
+func (b *breaker) record(probe bool, o outcome) {
+	b.mu.Lock()
+	wasOpen := b.failures >= b.threshold
+	switch {
+	case probe:
+		b.probing = false
+		switch o {
+		case succeeded:
+			b.failures = 0
+		case failed:
+			b.openUntil = time.Now().Add(b.cooldown)
+		}
+	case wasOpen:
+	case o == failed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = time.Now().Add(b.cooldown)
+		}
+	case o == succeeded:
+		b.failures = 0
+	}
+	isOpen := b.failures >= b.threshold
+	onChange := b.onChange
+	b.mu.Unlock()
+
+	if onChange != nil && wasOpen != isOpen {
+		onChange(isOpen)
+	}
+}
+
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && time.Now().Before(b.openUntil)
+}
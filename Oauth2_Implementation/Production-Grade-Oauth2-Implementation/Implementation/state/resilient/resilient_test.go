@@ -0,0 +1,243 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+var errDown = errors.New("connection refused")
+
+// flaky fails its first failures calls and counts every call. While gate
+// is set, calls wait for it to close first.
+type flaky struct {
+	state.Store
+	failures atomic.Int32
+	calls    atomic.Int32
+	gate     chan struct{}
+}
+
+func newFlaky(t *testing.T) *flaky {
+	kv := memory.New()
+	t.Cleanup(func() { kv.Close() })
+	return &flaky{Store: kv}
+}
+
+func (f *flaky) call() error {
+	f.calls.Add(1)
+	if f.gate != nil {
+		<-f.gate
+	}
+	if f.failures.Add(-1) >= 0 {
+		return errDown
+	}
+	return nil
+}
+
+func (f *flaky) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	return f.Store.Get(ctx, key)
+}
+
+func (f *flaky) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	if err := f.call(); err != nil {
+		return false, err
+	}
+	return f.Store.SetNX(ctx, key, value, ttl)
+}
+
+func (f *flaky) GetDel(ctx context.Context, key string) ([]byte, error) {
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	return f.Store.GetDel(ctx, key)
+}
+
+var fast = Options{BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, FailureThreshold: 100}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		failures int32
+		calls    int32
+		err      error
+	}{
+		{"recovers", 2, 3, nil},
+		{"gives up", 5, 3, errDown},
+	} {
+		inner := newFlaky(t)
+		inner.Set(ctx, "k", []byte("v"), time.Minute)
+		inner.failures.Store(tt.failures)
+		_, err := New(inner, fast).Get(ctx, "k")
+		if !errors.Is(err, tt.err) || inner.calls.Load() != tt.calls {
+			t.Errorf("%s: %v after %d calls, want %v after %d", tt.name, err, inner.calls.Load(), tt.err, tt.calls)
+		}
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	ctx := context.Background()
+	for name, call := range map[string]func(*Store) error{
+		"SetNX": func(s *Store) error {
+			_, err := s.SetNX(ctx, "k", []byte("v"), time.Minute)
+			return err
+		},
+		"GetDel": func(s *Store) error {
+			_, err := s.GetDel(ctx, "k")
+			return err
+		},
+	} {
+		inner := newFlaky(t)
+		inner.failures.Store(1)
+		if err := call(New(inner, fast)); !errors.Is(err, errDown) || inner.calls.Load() != 1 {
+			t.Errorf("%s: %v after %d calls, want one failed call", name, err, inner.calls.Load())
+		}
+	}
+
+	// A missing key is an answer, not a failure
+	inner := newFlaky(t)
+	s := New(inner, Options{FailureThreshold: 1})
+	for i := 0; i < 3; i++ {
+		if _, err := s.Get(ctx, "missing"); err != state.ErrNotFound {
+			t.Fatalf("got %v, want ErrNotFound", err)
+		}
+	}
+	if inner.calls.Load() != 3 || s.Open() {
+		t.Errorf("%d calls, open %v", inner.calls.Load(), s.Open())
+	}
+}
+
+func TestRetryStopsWhenCallerGivesUp(t *testing.T) {
+	inner := newFlaky(t)
+	inner.failures.Store(10)
+	s := New(inner, Options{BaseBackoff: time.Hour, MaxBackoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := s.Get(ctx, "k"); !errors.Is(err, errDown) {
+		t.Errorf("got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("returned after %s", d)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	inner := newFlaky(t)
+	inner.Set(ctx, "k", []byte("v"), time.Minute)
+	var changes []bool
+	var mu sync.Mutex
+	s := New(inner, Options{
+		MaxAttempts: 1, FailureThreshold: 3, Cooldown: 30 * time.Millisecond,
+		OnStateChange: func(open bool) {
+			mu.Lock()
+			changes = append(changes, open)
+			mu.Unlock()
+		},
+	})
+	get := func() error {
+		_, err := s.Get(ctx, "k")
+		return err
+	}
+
+	// Closed: failures count up to the threshold, then it opens
+	inner.failures.Store(3)
+	for i := 0; i < 3; i++ {
+		if err := get(); !errors.Is(err, errDown) {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if !s.Open() {
+		t.Fatal("not open after 3 failures")
+	}
+
+	// Open: refused without reaching the backend
+	if err := get(); err != state.ErrUnavailable || inner.calls.Load() != 3 {
+		t.Fatalf("open: %v after %d calls", err, inner.calls.Load())
+	}
+
+	// Half-open: one probe at a time; a failed probe opens it again
+	time.Sleep(40 * time.Millisecond)
+	inner.failures.Store(1)
+	inner.gate = make(chan struct{})
+	probe := make(chan error)
+	go func() { probe <- get() }()
+	for inner.calls.Load() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		if err := get(); err != state.ErrUnavailable {
+			t.Fatalf("second probe admitted: %v", err)
+		}
+	}
+	close(inner.gate)
+	if err := <-probe; !errors.Is(err, errDown) {
+		t.Fatalf("probe: %v", err)
+	}
+	inner.gate = nil
+	if err := get(); err != state.ErrUnavailable {
+		t.Fatalf("after failed probe: %v, want ErrUnavailable", err)
+	}
+
+	// A successful probe closes it
+	time.Sleep(40 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("call %d after recovery: %v", i+1, err)
+		}
+	}
+	if s.Open() {
+		t.Error("still open after a successful probe")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("state changes %v, want [true false]", changes)
+	}
+}
+
+func TestBreakerLateResults(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: 20 * time.Millisecond}
+
+	// A call admitted while closed finishes after another one opened it
+	ok, late := b.allow()
+	if !ok || late {
+		t.Fatal("closed breaker refused")
+	}
+	b.record(false, failed)
+	b.record(late, succeeded)
+	if ok, _ := b.allow(); ok {
+		t.Fatal("late success closed the breaker")
+	}
+
+	// Nor does it free the probe slot in half-open
+	time.Sleep(30 * time.Millisecond)
+	ok, probe := b.allow()
+	if !ok || !probe {
+		t.Fatal("no probe after the cooldown")
+	}
+	b.record(false, failed)
+	if ok, _ := b.allow(); ok {
+		t.Fatal("second probe admitted after a late failure")
+	}
+
+	// A probe whose caller gave up proves nothing and frees the slot
+	b.record(probe, ignored)
+	if b.failures < b.threshold {
+		t.Fatal("abandoned probe closed the breaker")
+	}
+	if ok, probe := b.allow(); !ok || !probe {
+		t.Fatal("no new probe after an abandoned one")
+	}
+}
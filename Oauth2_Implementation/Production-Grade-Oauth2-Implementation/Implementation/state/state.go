@@ -0,0 +1,41 @@
+// Package state defines the short-lived key/value store behind login state,
+// opaque access tokens, the revocation list and the upstream token vault.
+// Everything in it expires on its own; durable data belongs in storage.
+package state
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("state: key not found")
+	// ErrUnavailable is returned without contacting the backend while it is
+	// considered down.
+	ErrUnavailable = errors.New("state: store unavailable")
+)
+
+// Store is a key/value store with per-key expiry. Implementations must make
+// SetNX and GetDel atomic across every process sharing the store.
+type Store interface {
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores value only if key does not exist and reports whether it
+	// did.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Get returns ErrNotFound for missing and expired keys.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// GetDel returns the value and deletes the key in one step, so that only
+	// one caller can ever receive it.
+	GetDel(ctx context.Context, key string) ([]byte, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+// Inspector is implemented by stores that can tell how long a key has left,
+// for operator tools. TTL returns zero for a key without expiry and
+// ErrNotFound for missing and expired keys.
+type Inspector interface {
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
@@ -0,0 +1,285 @@
+// Package statetest is the conformance suite for state backends. Every
+// implementation of state.Store must pass TestStore; the in-memory backend
+// is the reference and needs no external service.
+//
+// The suite only touches keys under a random prefix and deletes what it
+// creates, so it can run against a shared server:
+//
+//	s := redisstate.New(redis.NewClient(&redis.Options{Addr: addr}))
+//	if err := statetest.TestStore(ctx, s); err != nil {
+//		t.Fatal(err)
+//	}
+package statetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// ttl is the lifetime of the keys that are meant to expire during the
+// suite; every backend keeps expiry to the millisecond.
+const ttl = 100 * time.Millisecond
+
+// racers is how many callers compete for one key in the atomicity checks.
+const racers = 16
+
+// TestStore exercises every method of s and reports all deviations from the
+// state contract as one joined error. It sleeps for a few hundred
+// milliseconds to let keys expire. Backends that also implement
+// state.Inspector are checked for that too.
+func TestStore(ctx context.Context, s state.Store) error {
+	c := &checker{ctx: ctx, s: s}
+	id, err := storage.NewID()
+	if err != nil {
+		return fmt.Errorf("NewID: %w", err)
+	}
+	c.prefix = "statetest:" + id + ":"
+	defer s.Del(ctx, c.created...)
+
+	c.values()
+	c.prefixes()
+	c.expiry()
+	c.setNX()
+	c.getDel()
+	c.del()
+	if i, ok := s.(state.Inspector); ok {
+		c.inspect(i)
+	}
+	return errors.Join(c.errs...)
+}
+
+type checker struct {
+	ctx     context.Context
+	s       state.Store
+	prefix  string
+	created []string
+	errs    []error
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+// expect records a failure unless err matches want (nil for success).
+func (c *checker) expect(op string, err, want error) bool {
+	if want == nil && err != nil {
+		c.errorf("%s: unexpected error: %v", op, err)
+		return false
+	}
+	if want != nil && !errors.Is(err, want) {
+		c.errorf("%s: got error %v, want %v", op, err, want)
+		return false
+	}
+	return true
+}
+
+// key returns a key of the suite, remembered for the final cleanup.
+func (c *checker) key(name string) string {
+	key := c.prefix + name
+	c.created = append(c.created, key)
+	return key
+}
+
+// value checks that key holds want.
+func (c *checker) value(op, key, want string) {
+	got, err := c.s.Get(c.ctx, key)
+	if c.expect(op, err, nil) && string(got) != want {
+		c.errorf("%s: got %q, want %q", op, got, want)
+	}
+}
+
+// gone checks that key reads as missing through Get and Exists.
+func (c *checker) gone(op, key string) {
+	_, err := c.s.Get(c.ctx, key)
+	c.expect(op+": Get", err, state.ErrNotFound)
+	ok, err := c.s.Exists(c.ctx, key)
+	if c.expect(op+": Exists", err, nil) && ok {
+		c.errorf("%s: Exists reports the key", op)
+	}
+}
+
+func (c *checker) values() {
+	key := c.key("value")
+	c.gone("missing key", key)
+	if _, err := c.s.GetDel(c.ctx, key); !c.expect("GetDel missing key", err, state.ErrNotFound) {
+		return
+	}
+
+	// The store keeps its own copy of the value, and callers get theirs
+	value := []byte("first")
+	c.expect("Set", c.s.Set(c.ctx, key, value, time.Minute), nil)
+	value[0] = 'X'
+	got, err := c.s.Get(c.ctx, key)
+	if c.expect("Get", err, nil) {
+		if string(got) != "first" {
+			c.errorf("Get: got %q after the caller changed its slice, want %q", got, "first")
+		}
+		got[0] = 'Y'
+	}
+	c.value("Get after the caller changed the result", key, "first")
+	ok, err := c.s.Exists(c.ctx, key)
+	if c.expect("Exists", err, nil) && !ok {
+		c.errorf("Exists: key not reported")
+	}
+
+	c.expect("Set over a live key", c.s.Set(c.ctx, key, []byte("second"), time.Minute), nil)
+	c.value("Get after overwrite", key, "second")
+
+	// Binary values survive the round trip
+	binary := c.key("binary")
+	c.expect("Set binary", c.s.Set(c.ctx, binary, []byte{0, 0xff, '\n', 0}, time.Minute), nil)
+	c.value("Get binary", binary, "\x00\xff\n\x00")
+}
+
+// prefixes checks that keys sharing a prefix, as the namespaces of the
+// state's users do, are independent of each other.
+func (c *checker) prefixes() {
+	short, long := c.key("p"), c.key("p:used")
+	c.expect("Set short", c.s.Set(c.ctx, short, []byte("short"), time.Minute), nil)
+	c.expect("Set long", c.s.Set(c.ctx, long, []byte("long"), time.Minute), nil)
+	if v, err := c.s.GetDel(c.ctx, short); c.expect("GetDel short", err, nil) && string(v) != "short" {
+		c.errorf("GetDel short: got %q", v)
+	}
+	c.value("Get long after GetDel of its prefix", long, "long")
+	c.expect("Del long", c.s.Del(c.ctx, long), nil)
+	c.gone("after Del long", long)
+	c.gone("after GetDel short", short)
+}
+
+func (c *checker) expiry() {
+	short, long := c.key("expiring"), c.key("lasting")
+	c.expect("Set short TTL", c.s.Set(c.ctx, short, []byte("v"), ttl), nil)
+	c.expect("Set long TTL", c.s.Set(c.ctx, long, []byte("v"), time.Minute), nil)
+	nx := c.key("expiring-nx")
+	if ok, err := c.s.SetNX(c.ctx, nx, []byte("v"), ttl); c.expect("SetNX short TTL", err, nil) && !ok {
+		c.errorf("SetNX short TTL: free key refused")
+	}
+	c.value("Get before expiry", short, "v")
+
+	time.Sleep(3 * ttl)
+	c.gone("expired Set", short)
+	c.gone("expired SetNX", nx)
+	if _, err := c.s.GetDel(c.ctx, short); c.expect("GetDel expired key", err, state.ErrNotFound) {
+		c.value("Get unexpired key", long, "v")
+	}
+}
+
+func (c *checker) setNX() {
+	key := c.key("nx")
+	if ok, err := c.s.SetNX(c.ctx, key, []byte("a"), time.Minute); c.expect("SetNX free key", err, nil) && !ok {
+		c.errorf("SetNX free key: refused")
+	}
+	if ok, err := c.s.SetNX(c.ctx, key, []byte("b"), time.Minute); c.expect("SetNX live key", err, nil) && ok {
+		c.errorf("SetNX live key: accepted")
+	}
+	c.value("Get after refused SetNX", key, "a")
+
+	// An expired key is free again
+	expiring := c.key("nx-expiring")
+	c.expect("Set short TTL", c.s.Set(c.ctx, expiring, []byte("a"), ttl), nil)
+	time.Sleep(3 * ttl)
+	if ok, err := c.s.SetNX(c.ctx, expiring, []byte("b"), time.Minute); c.expect("SetNX expired key", err, nil) && !ok {
+		c.errorf("SetNX expired key: refused")
+	}
+	c.value("Get after SetNX over an expired key", expiring, "b")
+
+	// Of many callers racing for a free key exactly one wins
+	raced := c.key("nx-race")
+	wins := c.race(func(i int) (bool, error) {
+		return c.s.SetNX(c.ctx, raced, []byte{byte(i)}, time.Minute)
+	})
+	if wins != 1 {
+		c.errorf("SetNX race: %d winners, want 1", wins)
+	}
+}
+
+func (c *checker) getDel() {
+	key := c.key("getdel")
+	c.expect("Set", c.s.Set(c.ctx, key, []byte("once"), time.Minute), nil)
+	if v, err := c.s.GetDel(c.ctx, key); c.expect("GetDel", err, nil) && string(v) != "once" {
+		c.errorf("GetDel: got %q, want %q", v, "once")
+	}
+	c.gone("after GetDel", key)
+	_, err := c.s.GetDel(c.ctx, key)
+	c.expect("second GetDel", err, state.ErrNotFound)
+
+	// Of many callers racing for one value exactly one receives it, as one
+	// authorization code must be redeemed only once
+	c.expect("Set race key", c.s.Set(c.ctx, key, []byte("once"), time.Minute), nil)
+	wins := c.race(func(int) (bool, error) {
+		v, err := c.s.GetDel(c.ctx, key)
+		if errors.Is(err, state.ErrNotFound) {
+			return false, nil
+		}
+		if err == nil && string(v) != "once" {
+			return false, fmt.Errorf("got %q", v)
+		}
+		return err == nil, err
+	})
+	if wins != 1 {
+		c.errorf("GetDel race: %d callers received the value, want 1", wins)
+	}
+}
+
+func (c *checker) del() {
+	a, b, missing := c.key("del-a"), c.key("del-b"), c.key("del-missing")
+	c.expect("Set a", c.s.Set(c.ctx, a, []byte("a"), time.Minute), nil)
+	c.expect("Set b", c.s.Set(c.ctx, b, []byte("b"), time.Minute), nil)
+	c.expect("Del several keys, one missing", c.s.Del(c.ctx, a, b, missing), nil)
+	c.gone("after Del a", a)
+	c.gone("after Del b", b)
+	c.expect("Del no keys", c.s.Del(c.ctx), nil)
+}
+
+// race runs op from racers goroutines at once and counts those for which it
+// reported true.
+func (c *checker) race(op func(i int) (bool, error)) int {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		wins  int
+		start = make(chan struct{})
+	)
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			ok, err := op(i)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				wins++
+			}
+			c.expect("racing call", err, nil)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return wins
+}
+
+func (c *checker) inspect(i state.Inspector) {
+	lasting, forever, expiring := c.key("ttl-lasting"), c.key("ttl-forever"), c.key("ttl-expiring")
+	c.expect("Set with TTL", c.s.Set(c.ctx, lasting, []byte("v"), time.Minute), nil)
+	c.expect("Set without TTL", c.s.Set(c.ctx, forever, []byte("v"), 0), nil)
+	c.expect("Set short TTL", c.s.Set(c.ctx, expiring, []byte("v"), ttl), nil)
+
+	if d, err := i.TTL(c.ctx, lasting); c.expect("TTL", err, nil) && (d <= 50*time.Second || d > time.Minute) {
+		c.errorf("TTL: got %s, want about a minute", d)
+	}
+	if d, err := i.TTL(c.ctx, forever); c.expect("TTL without expiry", err, nil) && d != 0 {
+		c.errorf("TTL without expiry: got %s, want 0", d)
+	}
+	_, err := i.TTL(c.ctx, c.key("ttl-missing"))
+	c.expect("TTL of a missing key", err, state.ErrNotFound)
+	time.Sleep(3 * ttl)
+	_, err = i.TTL(c.ctx, expiring)
+	c.expect("TTL of an expired key", err, state.ErrNotFound)
+}
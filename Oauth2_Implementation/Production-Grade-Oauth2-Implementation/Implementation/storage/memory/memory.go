@@ -0,0 +1,357 @@
+// Package memory is an in-process storage.Store for tests and local
+// development. Nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+var (
+	_ storage.Store      = (*Store)(nil)
+	_ storage.AuditStore = (*Store)(nil)
+)
+
+type consentKey struct{ userID, clientID string }
+
+type Store struct {
+	mu       sync.RWMutex
+	clients  map[string]storage.Client
+	users    map[string]storage.User
+	subjects map[string]string // provider + "\x00" + subject -> user ID
+	grants   map[string]storage.Grant
+	consents map[consentKey]storage.Consent
+	audit    []storage.AuditEvent
+}
+
+func New() *Store {
+	return &Store{
+		clients:  make(map[string]storage.Client),
+		users:    make(map[string]storage.User),
+		subjects: make(map[string]string),
+		grants:   make(map[string]storage.Grant),
+		consents: make(map[consentKey]storage.Consent),
+	}
+}
+
+func (s *Store) Close() error { return nil }
+
+func (s *Store) CreateClient(ctx context.Context, c *storage.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c.ID]; ok {
+		return storage.ErrConflict
+	}
+	now := time.Now().UTC()
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = now
+	}
+	c.UpdatedAt = now
+	s.clients[c.ID] = cloneClient(*c)
+	return nil
+}
+
+func (s *Store) GetClient(ctx context.Context, id string) (*storage.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	c = cloneClient(c)
+	return &c, nil
+}
+
+func (s *Store) UpdateClient(ctx context.Context, c *storage.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.clients[c.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	c.CreatedAt = old.CreatedAt
+	c.UpdatedAt = time.Now().UTC()
+	s.clients[c.ID] = cloneClient(*c)
+	return nil
+}
+
+func (s *Store) DeleteClient(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.clients, id)
+	return nil
+}
+
+func (s *Store) ListClients(ctx context.Context) ([]*storage.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*storage.Client, 0, len(s.clients))
+	for _, c := range s.clients {
+		c = cloneClient(c)
+		out = append(out, &c)
+	}
+	return out, nil
+}
+
+func (s *Store) UpsertUser(ctx context.Context, u *storage.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	key := u.Provider + "\x00" + u.Subject
+	if id, ok := s.subjects[key]; ok {
+		existing := s.users[id]
+		existing.Email = u.Email
+		existing.Name = u.Name
+		existing.LastLoginAt = u.LastLoginAt
+		existing.UpdatedAt = now
+		s.users[id] = existing
+		*u = existing
+		return nil
+	}
+	if u.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		u.ID = newID
+	}
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	s.users[u.ID] = *u
+	s.subjects[key] = u.ID
+	return nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*storage.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &u, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, u *storage.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[u.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	// Provider and subject identify the user upstream and never change.
+	u.Provider, u.Subject, u.CreatedAt = old.Provider, old.Subject, old.CreatedAt
+	u.UpdatedAt = time.Now().UTC()
+	s.users[u.ID] = *u
+	return nil
+}
+
+func (s *Store) CreateGrant(ctx context.Context, g *storage.Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		g.ID = newID
+	}
+	if _, ok := s.grants[g.ID]; ok {
+		return storage.ErrConflict
+	}
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = time.Now().UTC()
+	}
+	s.grants[g.ID] = cloneGrant(*g)
+	return nil
+}
+
+func (s *Store) GetGrant(ctx context.Context, id string) (*storage.Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.grants[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	g = cloneGrant(g)
+	return &g, nil
+}
+
+func (s *Store) GetGrantByRefreshToken(ctx context.Context, hash string) (*storage.Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, g := range s.grants {
+		if g.RefreshTokenHash != "" && g.RefreshTokenHash == hash {
+			g = cloneGrant(g)
+			return &g, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (s *Store) RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.grants[id]
+	if !ok || g.RefreshTokenHash != oldHash {
+		return storage.ErrNotFound
+	}
+	g.RefreshTokenHash = newHash
+	s.grants[id] = g
+	return nil
+}
+
+func (s *Store) RevokeGrant(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.grants[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if g.RevokedAt == nil {
+		at = at.UTC()
+		g.RevokedAt = &at
+		s.grants[id] = g
+	}
+	return nil
+}
+
+func (s *Store) ListGrantsByUser(ctx context.Context, userID string) ([]*storage.Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*storage.Grant
+	for _, g := range s.grants {
+		if g.UserID == userID {
+			g = cloneGrant(g)
+			out = append(out, &g)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) ListGrantsByClient(ctx context.Context, clientID string) ([]*storage.Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*storage.Grant
+	for _, g := range s.grants {
+		if g.ClientID == clientID {
+			g = cloneGrant(g)
+			out = append(out, &g)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) DeleteExpiredGrants(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, g := range s.grants {
+		if g.ExpiresAt.Before(before) {
+			delete(s.grants, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) GetConsent(ctx context.Context, userID, clientID string) (*storage.Consent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.consents[consentKey{userID, clientID}]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	c.Scopes = append([]string(nil), c.Scopes...)
+	return &c, nil
+}
+
+func (s *Store) SaveConsent(ctx context.Context, c *storage.Consent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.GrantedAt.IsZero() {
+		c.GrantedAt = time.Now().UTC()
+	}
+	stored := *c
+	stored.Scopes = append([]string(nil), c.Scopes...)
+	s.consents[consentKey{c.UserID, c.ClientID}] = stored
+	return nil
+}
+
+func (s *Store) DeleteConsent(ctx context.Context, userID, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := consentKey{userID, clientID}
+	if _, ok := s.consents[key]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.consents, key)
+	return nil
+}
+
+func (s *Store) AppendAuditEvent(ctx context.Context, e *storage.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		e.ID = newID
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	s.audit = append(s.audit, cloneAuditEvent(*e))
+	return nil
+}
+
+func (s *Store) ListAuditEvents(ctx context.Context, since time.Time, limit int) ([]*storage.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*storage.AuditEvent
+	for _, e := range s.audit {
+		if !e.Time.Before(since) {
+			e = cloneAuditEvent(e)
+			out = append(out, &e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func cloneClient(c storage.Client) storage.Client {
+	c.RedirectURIs = append([]string(nil), c.RedirectURIs...)
+	c.Scopes = append([]string(nil), c.Scopes...)
+	return c
+}
+
+func cloneGrant(g storage.Grant) storage.Grant {
+	g.Scopes = append([]string(nil), g.Scopes...)
+	if g.RevokedAt != nil {
+		at := *g.RevokedAt
+		g.RevokedAt = &at
+	}
+	return g
+}
+
+func cloneAuditEvent(e storage.AuditEvent) storage.AuditEvent {
+	if e.Details != nil {
+		details := make(map[string]string, len(e.Details))
+		for k, v := range e.Details {
+			details[k] = v
+		}
+		e.Details = details
+	}
+	return e
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	if err := storagetest.TestStore(context.Background(), New()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func (s *Store) AppendAuditEvent(ctx context.Context, e *storage.AuditEvent) error {
+	if e.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		e.ID = newID
+	}
+	if e.Time.IsZero() {
+		e.Time = now()
+	}
+	_, err := s.audit.InsertOne(ctx, auditDoc{
+		ID:       e.ID,
+		Time:     toMillis(e.Time),
+		Type:     e.Type,
+		UserID:   e.UserID,
+		ClientID: e.ClientID,
+		RemoteIP: e.RemoteIP,
+		Details:  e.Details,
+	})
+	return mapError(err)
+}
+
+func (s *Store) ListAuditEvents(ctx context.Context, since time.Time, limit int) ([]*storage.AuditEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cur, err := s.audit.Find(ctx, bson.M{"time": bson.M{"$gte": since.UTC()}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []auditDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make([]*storage.AuditEvent, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, &storage.AuditEvent{
+			ID:       d.ID,
+			Time:     d.Time.UTC(),
+			Type:     d.Type,
+			UserID:   d.UserID,
+			ClientID: d.ClientID,
+			RemoteIP: d.RemoteIP,
+			Details:  d.Details,
+		})
+	}
+	return out, nil
+}
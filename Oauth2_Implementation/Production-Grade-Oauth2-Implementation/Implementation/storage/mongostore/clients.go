@@ -0,0 +1,78 @@
+package mongostore
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func (s *Store) CreateClient(ctx context.Context, c *storage.Client) error {
+	ts := now()
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = ts
+	}
+	c.UpdatedAt = ts
+	_, err := s.clients.InsertOne(ctx, fromClient(c))
+	return mapError(err)
+}
+
+func (s *Store) GetClient(ctx context.Context, id string) (*storage.Client, error) {
+	var d clientDoc
+	if err := s.clients.FindOne(ctx, bson.M{"_id": id}).Decode(&d); err != nil {
+		return nil, mapError(err)
+	}
+	return d.client(), nil
+}
+
+func (s *Store) UpdateClient(ctx context.Context, c *storage.Client) error {
+	c.UpdatedAt = now()
+	d := fromClient(c)
+	var old clientDoc
+	err := s.clients.FindOneAndUpdate(ctx, bson.M{"_id": c.ID}, bson.M{"$set": bson.M{
+		"secret_hash":              d.SecretHash,
+		"name":                     d.Name,
+		"redirect_uris":            d.RedirectURIs,
+		"scopes":                   d.Scopes,
+		"access_token_format":      d.AccessTokenFormat,
+		"access_token_ttl_seconds": d.AccessTokenTTL,
+		"allow_plain_pkce":         d.AllowPlainPKCE,
+		"legacy_flows":             d.LegacyFlows,
+		"response_encryption_key":  d.ResponseEncryptionKey,
+		"updated_at":               d.UpdatedAt,
+	}}).Decode(&old)
+	if err != nil {
+		return mapError(err)
+	}
+	c.CreatedAt = old.CreatedAt.UTC()
+	return nil
+}
+
+func (s *Store) DeleteClient(ctx context.Context, id string) error {
+	res, err := s.clients.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ListClients(ctx context.Context) ([]*storage.Client, error) {
+	cur, err := s.clients.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []clientDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make([]*storage.Client, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, d.client())
+	}
+	return out, nil
+}
@@ -0,0 +1,45 @@
+package mongostore
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func (s *Store) GetConsent(ctx context.Context, userID, clientID string) (*storage.Consent, error) {
+	var d consentDoc
+	if err := s.consents.FindOne(ctx, bson.M{"_id": consentKey{userID, clientID}}).Decode(&d); err != nil {
+		return nil, mapError(err)
+	}
+	return &storage.Consent{
+		UserID:    d.ID.UserID,
+		ClientID:  d.ID.ClientID,
+		Scopes:    d.Scopes,
+		GrantedAt: d.GrantedAt.UTC(),
+	}, nil
+}
+
+func (s *Store) SaveConsent(ctx context.Context, c *storage.Consent) error {
+	if c.GrantedAt.IsZero() {
+		c.GrantedAt = now()
+	}
+	key := consentKey{c.UserID, c.ClientID}
+	_, err := s.consents.ReplaceOne(ctx, bson.M{"_id": key},
+		consentDoc{ID: key, Scopes: nonNil(c.Scopes), GrantedAt: toMillis(c.GrantedAt)},
+		options.Replace().SetUpsert(true))
+	return mapError(err)
+}
+
+func (s *Store) DeleteConsent(ctx context.Context, userID, clientID string) error {
+	res, err := s.consents.DeleteOne(ctx, bson.M{"_id": consentKey{userID, clientID}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
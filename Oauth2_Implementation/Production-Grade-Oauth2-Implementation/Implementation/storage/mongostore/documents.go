@@ -0,0 +1,164 @@
+package mongostore
+
+import (
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// The document types pin the BSON field names; the storage types carry no
+// driver tags.
+
+type clientDoc struct {
+	ID                    string    `bson:"_id"`
+	SecretHash            string    `bson:"secret_hash"`
+	Name                  string    `bson:"name"`
+	RedirectURIs          []string  `bson:"redirect_uris"`
+	Scopes                []string  `bson:"scopes"`
+	AccessTokenFormat     string    `bson:"access_token_format"`
+	AccessTokenTTL        int64     `bson:"access_token_ttl_seconds"`
+	AllowPlainPKCE        bool      `bson:"allow_plain_pkce,omitempty"`
+	LegacyFlows           bool      `bson:"legacy_flows,omitempty"`
+	ResponseEncryptionKey string    `bson:"response_encryption_key,omitempty"`
+	CreatedAt             time.Time `bson:"created_at"`
+	UpdatedAt             time.Time `bson:"updated_at"`
+}
+
+func fromClient(c *storage.Client) clientDoc {
+	return clientDoc{
+		ID:                    c.ID,
+		SecretHash:            c.SecretHash,
+		Name:                  c.Name,
+		RedirectURIs:          nonNil(c.RedirectURIs),
+		Scopes:                nonNil(c.Scopes),
+		AccessTokenFormat:     c.AccessTokenFormat,
+		AccessTokenTTL:        int64(c.AccessTokenTTL / time.Second),
+		AllowPlainPKCE:        c.AllowPlainPKCE,
+		LegacyFlows:           c.LegacyFlows,
+		ResponseEncryptionKey: c.ResponseEncryptionKey,
+		CreatedAt:             toMillis(c.CreatedAt),
+		UpdatedAt:             toMillis(c.UpdatedAt),
+	}
+}
+
+func (d clientDoc) client() *storage.Client {
+	return &storage.Client{
+		ID:                    d.ID,
+		SecretHash:            d.SecretHash,
+		Name:                  d.Name,
+		RedirectURIs:          d.RedirectURIs,
+		Scopes:                d.Scopes,
+		AccessTokenFormat:     d.AccessTokenFormat,
+		AccessTokenTTL:        time.Duration(d.AccessTokenTTL) * time.Second,
+		AllowPlainPKCE:        d.AllowPlainPKCE,
+		LegacyFlows:           d.LegacyFlows,
+		ResponseEncryptionKey: d.ResponseEncryptionKey,
+		CreatedAt:             d.CreatedAt.UTC(),
+		UpdatedAt:             d.UpdatedAt.UTC(),
+	}
+}
+
+type userDoc struct {
+	ID          string     `bson:"_id"`
+	Provider    string     `bson:"provider"`
+	Subject     string     `bson:"subject"`
+	Email       string     `bson:"email"`
+	Name        string     `bson:"name"`
+	Disabled    bool       `bson:"disabled"`
+	CreatedAt   time.Time  `bson:"created_at"`
+	UpdatedAt   time.Time  `bson:"updated_at"`
+	LastLoginAt *time.Time `bson:"last_login_at,omitempty"`
+}
+
+func (d userDoc) user() *storage.User {
+	u := &storage.User{
+		ID:        d.ID,
+		Provider:  d.Provider,
+		Subject:   d.Subject,
+		Email:     d.Email,
+		Name:      d.Name,
+		Disabled:  d.Disabled,
+		CreatedAt: d.CreatedAt.UTC(),
+		UpdatedAt: d.UpdatedAt.UTC(),
+	}
+	if d.LastLoginAt != nil {
+		u.LastLoginAt = d.LastLoginAt.UTC()
+	}
+	return u
+}
+
+type grantDoc struct {
+	ID               string     `bson:"_id"`
+	ClientID         string     `bson:"client_id"`
+	UserID           string     `bson:"user_id"`
+	Scopes           []string   `bson:"scopes"`
+	UpstreamRef      string     `bson:"upstream_ref"`
+	RefreshTokenHash string     `bson:"refresh_token_hash,omitempty"`
+	CreatedAt        time.Time  `bson:"created_at"`
+	ExpiresAt        time.Time  `bson:"expires_at"`
+	RevokedAt        *time.Time `bson:"revoked_at,omitempty"`
+}
+
+func fromGrant(g *storage.Grant) grantDoc {
+	d := grantDoc{
+		ID:               g.ID,
+		ClientID:         g.ClientID,
+		UserID:           g.UserID,
+		Scopes:           nonNil(g.Scopes),
+		UpstreamRef:      g.UpstreamRef,
+		RefreshTokenHash: g.RefreshTokenHash,
+		CreatedAt:        toMillis(g.CreatedAt),
+		ExpiresAt:        toMillis(g.ExpiresAt),
+	}
+	if g.RevokedAt != nil {
+		at := toMillis(*g.RevokedAt)
+		d.RevokedAt = &at
+	}
+	return d
+}
+
+func (d grantDoc) grant() *storage.Grant {
+	g := &storage.Grant{
+		ID:               d.ID,
+		ClientID:         d.ClientID,
+		UserID:           d.UserID,
+		Scopes:           d.Scopes,
+		UpstreamRef:      d.UpstreamRef,
+		RefreshTokenHash: d.RefreshTokenHash,
+		CreatedAt:        d.CreatedAt.UTC(),
+		ExpiresAt:        d.ExpiresAt.UTC(),
+	}
+	if d.RevokedAt != nil {
+		at := d.RevokedAt.UTC()
+		g.RevokedAt = &at
+	}
+	return g
+}
+
+type consentKey struct {
+	UserID   string `bson:"user_id"`
+	ClientID string `bson:"client_id"`
+}
+
+type consentDoc struct {
+	ID        consentKey `bson:"_id"`
+	Scopes    []string   `bson:"scopes"`
+	GrantedAt time.Time  `bson:"granted_at"`
+}
+
+type auditDoc struct {
+	ID       string            `bson:"_id"`
+	Time     time.Time         `bson:"time"`
+	Type     string            `bson:"type"`
+	UserID   string            `bson:"user_id,omitempty"`
+	ClientID string            `bson:"client_id,omitempty"`
+	RemoteIP string            `bson:"remote_ip,omitempty"`
+	Details  map[string]string `bson:"details,omitempty"`
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
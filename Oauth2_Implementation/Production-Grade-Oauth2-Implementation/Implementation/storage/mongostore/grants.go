@@ -0,0 +1,109 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func (s *Store) CreateGrant(ctx context.Context, g *storage.Grant) error {
+	if g.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		g.ID = newID
+	}
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = now()
+	}
+	_, err := s.grants.InsertOne(ctx, fromGrant(g))
+	return mapError(err)
+}
+
+func (s *Store) GetGrant(ctx context.Context, id string) (*storage.Grant, error) {
+	return s.findGrant(ctx, bson.M{"_id": id})
+}
+
+func (s *Store) GetGrantByRefreshToken(ctx context.Context, hash string) (*storage.Grant, error) {
+	if hash == "" {
+		return nil, storage.ErrNotFound
+	}
+	return s.findGrant(ctx, bson.M{"refresh_token_hash": hash})
+}
+
+func (s *Store) findGrant(ctx context.Context, filter bson.M) (*storage.Grant, error) {
+	var d grantDoc
+	if err := s.grants.FindOne(ctx, filter).Decode(&d); err != nil {
+		return nil, mapError(err)
+	}
+	return d.grant(), nil
+}
+
+func (s *Store) RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) error {
+	update := bson.M{"$set": bson.M{"refresh_token_hash": newHash}}
+	if newHash == "" {
+		update = bson.M{"$unset": bson.M{"refresh_token_hash": ""}}
+	}
+	res, err := s.grants.UpdateOne(ctx, bson.M{"_id": id, "refresh_token_hash": oldHash}, update)
+	if err != nil {
+		return mapError(err)
+	}
+	if res.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) RevokeGrant(ctx context.Context, id string, at time.Time) error {
+	res, err := s.grants.UpdateOne(ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": toMillis(at)}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+	// Nothing matched: either already revoked, which is fine, or missing.
+	_, err = s.GetGrant(ctx, id)
+	return err
+}
+
+func (s *Store) ListGrantsByUser(ctx context.Context, userID string) ([]*storage.Grant, error) {
+	return s.listGrants(ctx, bson.M{"user_id": userID})
+}
+
+func (s *Store) ListGrantsByClient(ctx context.Context, clientID string) ([]*storage.Grant, error) {
+	return s.listGrants(ctx, bson.M{"client_id": clientID})
+}
+
+// listGrants returns the grants matching filter, oldest first.
+func (s *Store) listGrants(ctx context.Context, filter bson.M) ([]*storage.Grant, error) {
+	cur, err := s.grants.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []grantDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make([]*storage.Grant, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, d.grant())
+	}
+	return out, nil
+}
+
+func (s *Store) DeleteExpiredGrants(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.grants.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before.UTC()}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,132 @@
+// Package mongostore implements storage.Store and storage.AuditStore on
+// MongoDB. Grants, which carry the refresh tokens and login sessions, are
+// removed by a TTL index once they expire, so DeleteExpiredGrants is only a
+// backstop for the minute-granular TTL monitor. Codes, login sessions and
+// opaque tokens are ephemeral state; state/mongostate keeps them in the same
+// database, under a TTL index of their own.
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+var (
+	_ storage.Store      = (*Store)(nil)
+	_ storage.AuditStore = (*Store)(nil)
+)
+
+// Collection names.
+const (
+	clientsCollection  = "oauth_clients"
+	usersCollection    = "oauth_users"
+	grantsCollection   = "oauth_grants"
+	consentsCollection = "oauth_consents"
+	auditCollection    = "oauth_audit_events"
+)
+
+type Store struct {
+	client   *mongo.Client // nil when the caller owns the connection
+	clients  *mongo.Collection
+	users    *mongo.Collection
+	grants   *mongo.Collection
+	consents *mongo.Collection
+	audit    *mongo.Collection
+}
+
+// Open connects to uri, verifies the connection and uses the named database.
+func Open(ctx context.Context, uri, database string) (*Store, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("mongostore: connecting: %w", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongostore: connecting: %w", err)
+	}
+	s := New(client.Database(database))
+	s.client = client
+	return s, nil
+}
+
+// New uses an existing database handle. Close does not disconnect it.
+func New(db *mongo.Database) *Store {
+	return &Store{
+		clients:  db.Collection(clientsCollection),
+		users:    db.Collection(usersCollection),
+		grants:   db.Collection(grantsCollection),
+		consents: db.Collection(consentsCollection),
+		audit:    db.Collection(auditCollection),
+	}
+}
+
+func (s *Store) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Disconnect(context.Background())
+}
+
+// EnsureIndexes creates the unique and TTL indexes the store relies on. It is
+// idempotent and safe to run from every replica at startup.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		s.users: {{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		s.grants: {
+			{
+				// Only grants that currently hold a refresh token take part.
+				Keys: bson.D{{Key: "refresh_token_hash", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"refresh_token_hash": bson.M{"$type": "string"}}),
+			},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+			{Keys: bson.D{{Key: "client_id", Value: 1}}},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+		s.audit: {{Keys: bson.D{{Key: "time", Value: 1}}}},
+	}
+	for coll, models := range indexes {
+		if _, err := coll.Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("mongostore: creating indexes on %s: %w", coll.Name(), err)
+		}
+	}
+	return nil
+}
+
+// mapError translates driver errors into the storage sentinels.
+func mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return storage.ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return storage.ErrConflict
+	default:
+		return err
+	}
+}
+
+// now is truncated to milliseconds, the precision of BSON dates, so values
+// read back compare equal to what was written.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func toMillis(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
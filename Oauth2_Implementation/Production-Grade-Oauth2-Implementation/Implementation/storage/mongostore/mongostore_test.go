@@ -0,0 +1,104 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage/storagetest"
+)
+
+// The conformance suite needs a server; it runs against MONGOSTORE_URI, e.g.
+//
+//	MONGOSTORE_URI=mongodb://localhost:27017 go test ./storage/mongostore
+//
+// Without one, the driver's mock deployment checks how the store maps
+// documents and errors.
+func TestConformance(t *testing.T) {
+	uri := os.Getenv("MONGOSTORE_URI")
+	if uri == "" {
+		t.Skip("MONGOSTORE_URI is not set")
+	}
+	ctx := context.Background()
+	s, err := Open(ctx, uri, "oauth_storagetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := storagetest.TestStore(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// toDoc turns v into the document a server would return for it.
+func toDoc(t *testing.T, v interface{}) bson.D {
+	t.Helper()
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+	ns := "oauth." + clientsCollection
+
+	mt.Run("duplicate key is a conflict", func(mt *mtest.T) {
+		s := New(mt.DB)
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key"}))
+		if err := s.CreateClient(ctx, &storage.Client{ID: "a"}); !errors.Is(err, storage.ErrConflict) {
+			mt.Errorf("CreateClient = %v, want ErrConflict", err)
+		}
+	})
+
+	mt.Run("no document is not found", func(mt *mtest.T) {
+		s := New(mt.DB)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		if _, err := s.GetClient(ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+			mt.Errorf("GetClient = %v, want ErrNotFound", err)
+		}
+	})
+
+	mt.Run("client round-trips", func(mt *mtest.T) {
+		s := New(mt.DB)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		want := &storage.Client{
+			ID:                    "a",
+			SecretHash:            storage.HashSecret("secret"),
+			Name:                  "A",
+			RedirectURIs:          []string{"https://a.example/cb"},
+			Scopes:                []string{"openid"},
+			AccessTokenFormat:     "jwt",
+			AccessTokenTTL:        time.Hour,
+			AllowPlainPKCE:        true,
+			LegacyFlows:           true,
+			ResponseEncryptionKey: `{"kty":"EC"}`,
+			CreatedAt:             now,
+			UpdatedAt:             now,
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, toDoc(mt.T, fromClient(want))))
+		got, err := s.GetClient(ctx, "a")
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			mt.Errorf("GetClient = %+v, want %+v", got, want)
+		}
+	})
+}
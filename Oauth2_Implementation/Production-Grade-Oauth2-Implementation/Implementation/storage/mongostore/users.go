@@ -0,0 +1,73 @@
+package mongostore
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func (s *Store) UpsertUser(ctx context.Context, u *storage.User) error {
+	ts := now()
+	id := u.ID
+	if id == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		id = newID
+	}
+	set := bson.M{"email": u.Email, "name": u.Name, "updated_at": ts}
+	if !u.LastLoginAt.IsZero() {
+		set["last_login_at"] = toMillis(u.LastLoginAt)
+	}
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"_id": id, "disabled": false, "created_at": ts},
+	}
+	filter := bson.M{"provider": u.Provider, "subject": u.Subject}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var d userDoc
+	err := s.users.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+	if mongo.IsDuplicateKeyError(err) {
+		// Two first logins raced on the unique index; the loser now matches
+		// the winner's document.
+		err = s.users.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+	}
+	if err != nil {
+		return mapError(err)
+	}
+	*u = *d.user()
+	return nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*storage.User, error) {
+	var d userDoc
+	if err := s.users.FindOne(ctx, bson.M{"_id": id}).Decode(&d); err != nil {
+		return nil, mapError(err)
+	}
+	return d.user(), nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, u *storage.User) error {
+	set := bson.M{"email": u.Email, "name": u.Name, "disabled": u.Disabled, "updated_at": now()}
+	update := bson.M{"$set": set}
+	if u.LastLoginAt.IsZero() {
+		update["$unset"] = bson.M{"last_login_at": ""}
+	} else {
+		set["last_login_at"] = toMillis(u.LastLoginAt)
+	}
+
+	var d userDoc
+	err := s.users.FindOneAndUpdate(ctx, bson.M{"_id": u.ID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&d)
+	if err != nil {
+		return mapError(err)
+	}
+	*u = *d.user()
+	return nil
+}
@@ -0,0 +1,99 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+const clientColumns = `id, secret_hash, name, redirect_uris, scopes, access_token_format,
+	access_token_ttl_seconds, allow_plain_pkce, legacy_flows, response_encryption_key, created_at, updated_at`
+
+func (s *Store) CreateClient(ctx context.Context, c *storage.Client) error {
+	ts := now()
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = ts
+	}
+	c.UpdatedAt = ts
+	_, err := s.exec(ctx, `INSERT INTO oauth_clients (`+clientColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.SecretHash, c.Name, encodeList(c.RedirectURIs), encodeList(c.Scopes),
+		c.AccessTokenFormat, int64(c.AccessTokenTTL/time.Second), c.AllowPlainPKCE, c.LegacyFlows,
+		c.ResponseEncryptionKey, c.CreatedAt.UTC(), c.UpdatedAt)
+	if isUniqueViolation(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) GetClient(ctx context.Context, id string) (*storage.Client, error) {
+	row := s.queryRow(ctx, `SELECT `+clientColumns+` FROM oauth_clients WHERE id = ?`, id)
+	return scanClient(row)
+}
+
+func (s *Store) UpdateClient(ctx context.Context, c *storage.Client) error {
+	c.UpdatedAt = now()
+	err := affected(s.exec(ctx, `UPDATE oauth_clients SET secret_hash = ?, name = ?, redirect_uris = ?,
+		scopes = ?, access_token_format = ?, access_token_ttl_seconds = ?, allow_plain_pkce = ?,
+		legacy_flows = ?, response_encryption_key = ?, updated_at = ? WHERE id = ?`,
+		c.SecretHash, c.Name, encodeList(c.RedirectURIs), encodeList(c.Scopes),
+		c.AccessTokenFormat, int64(c.AccessTokenTTL/time.Second), c.AllowPlainPKCE, c.LegacyFlows,
+		c.ResponseEncryptionKey, c.UpdatedAt, c.ID))
+	if err != nil {
+		return err
+	}
+	return s.queryRow(ctx, `SELECT created_at FROM oauth_clients WHERE id = ?`, c.ID).Scan(&c.CreatedAt)
+}
+
+func (s *Store) DeleteClient(ctx context.Context, id string) error {
+	return affected(s.exec(ctx, `DELETE FROM oauth_clients WHERE id = ?`, id))
+}
+
+func (s *Store) ListClients(ctx context.Context) ([]*storage.Client, error) {
+	rows, err := s.query(ctx, `SELECT `+clientColumns+` FROM oauth_clients ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*storage.Client
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanClient(row scanner) (*storage.Client, error) {
+	var (
+		c                   storage.Client
+		redirectURIs, scope string
+		ttlSeconds          int64
+	)
+	err := row.Scan(&c.ID, &c.SecretHash, &c.Name, &redirectURIs, &scope, &c.AccessTokenFormat,
+		&ttlSeconds, &c.AllowPlainPKCE, &c.LegacyFlows, &c.ResponseEncryptionKey, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.RedirectURIs, err = decodeList(redirectURIs); err != nil {
+		return nil, err
+	}
+	if c.Scopes, err = decodeList(scope); err != nil {
+		return nil, err
+	}
+	c.AccessTokenTTL = time.Duration(ttlSeconds) * time.Second
+	c.CreatedAt, c.UpdatedAt = c.CreatedAt.UTC(), c.UpdatedAt.UTC()
+	return &c, nil
+}
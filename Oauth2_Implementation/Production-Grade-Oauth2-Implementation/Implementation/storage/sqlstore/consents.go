@@ -0,0 +1,49 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+func (s *Store) GetConsent(ctx context.Context, userID, clientID string) (*storage.Consent, error) {
+	var (
+		c      storage.Consent
+		scopes string
+	)
+	err := s.queryRow(ctx, `SELECT user_id, client_id, scopes, granted_at FROM oauth_consents
+		WHERE user_id = ? AND client_id = ?`, userID, clientID).Scan(&c.UserID, &c.ClientID, &scopes, &c.GrantedAt)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Scopes, err = decodeList(scopes); err != nil {
+		return nil, err
+	}
+	c.GrantedAt = c.GrantedAt.UTC()
+	return &c, nil
+}
+
+func (s *Store) SaveConsent(ctx context.Context, c *storage.Consent) error {
+	if c.GrantedAt.IsZero() {
+		c.GrantedAt = now()
+	}
+	var query string
+	switch s.dialect {
+	case Postgres:
+		query = `INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes, granted_at = EXCLUDED.granted_at`
+	default:
+		query = `INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE scopes = VALUES(scopes), granted_at = VALUES(granted_at)`
+	}
+	_, err := s.exec(ctx, query, c.UserID, c.ClientID, encodeList(c.Scopes), c.GrantedAt.UTC())
+	return err
+}
+
+func (s *Store) DeleteConsent(ctx context.Context, userID, clientID string) error {
+	return affected(s.exec(ctx, `DELETE FROM oauth_consents WHERE user_id = ? AND client_id = ?`, userID, clientID))
+}
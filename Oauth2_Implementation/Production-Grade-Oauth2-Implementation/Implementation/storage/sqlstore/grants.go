@@ -0,0 +1,125 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+const grantColumns = `id, client_id, user_id, scopes, upstream_ref, refresh_token_hash,
+	created_at, expires_at, revoked_at`
+
+func (s *Store) CreateGrant(ctx context.Context, g *storage.Grant) error {
+	if g.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		g.ID = newID
+	}
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = now()
+	}
+	_, err := s.exec(ctx, `INSERT INTO oauth_grants (`+grantColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		g.ID, g.ClientID, g.UserID, encodeList(g.Scopes), g.UpstreamRef, nullString(g.RefreshTokenHash),
+		g.CreatedAt.UTC(), g.ExpiresAt.UTC(), nullTime(g.RevokedAt))
+	if isUniqueViolation(err) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) GetGrant(ctx context.Context, id string) (*storage.Grant, error) {
+	return scanGrant(s.queryRow(ctx, `SELECT `+grantColumns+` FROM oauth_grants WHERE id = ?`, id))
+}
+
+func (s *Store) GetGrantByRefreshToken(ctx context.Context, hash string) (*storage.Grant, error) {
+	if hash == "" {
+		return nil, storage.ErrNotFound
+	}
+	return scanGrant(s.queryRow(ctx, `SELECT `+grantColumns+` FROM oauth_grants WHERE refresh_token_hash = ?`, hash))
+}
+
+func (s *Store) RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) error {
+	return affected(s.exec(ctx, `UPDATE oauth_grants SET refresh_token_hash = ?
+		WHERE id = ? AND refresh_token_hash = ?`, nullString(newHash), id, oldHash))
+}
+
+func (s *Store) RevokeGrant(ctx context.Context, id string, at time.Time) error {
+	res, err := s.exec(ctx, `UPDATE oauth_grants SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		at.UTC().Truncate(time.Microsecond), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// Nothing changed: either already revoked, which is fine, or missing.
+	_, err = s.GetGrant(ctx, id)
+	return err
+}
+
+func (s *Store) ListGrantsByUser(ctx context.Context, userID string) ([]*storage.Grant, error) {
+	return s.listGrants(ctx, "user_id", userID)
+}
+
+func (s *Store) ListGrantsByClient(ctx context.Context, clientID string) ([]*storage.Grant, error) {
+	return s.listGrants(ctx, "client_id", clientID)
+}
+
+// listGrants returns the grants whose column equals value, oldest first.
+func (s *Store) listGrants(ctx context.Context, column, value string) ([]*storage.Grant, error) {
+	rows, err := s.query(ctx, `SELECT `+grantColumns+` FROM oauth_grants WHERE `+column+` = ? ORDER BY created_at`, value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*storage.Grant
+	for rows.Next() {
+		g, err := scanGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteExpiredGrants(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.exec(ctx, `DELETE FROM oauth_grants WHERE expires_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanGrant(row scanner) (*storage.Grant, error) {
+	var (
+		g       storage.Grant
+		scopes  string
+		refresh sql.NullString
+		revoked sql.NullTime
+	)
+	err := row.Scan(&g.ID, &g.ClientID, &g.UserID, &scopes, &g.UpstreamRef, &refresh,
+		&g.CreatedAt, &g.ExpiresAt, &revoked)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g.Scopes, err = decodeList(scopes); err != nil {
+		return nil, err
+	}
+	g.RefreshTokenHash = refresh.String
+	g.CreatedAt, g.ExpiresAt = g.CreatedAt.UTC(), g.ExpiresAt.UTC()
+	if revoked.Valid {
+		at := revoked.Time.UTC()
+		g.RevokedAt = &at
+	}
+	return &g, nil
+}
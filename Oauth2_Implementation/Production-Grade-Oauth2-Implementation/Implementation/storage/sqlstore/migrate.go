@@ -0,0 +1,199 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// migrationLockID is an arbitrary constant ("oauth" in ASCII) shared by every
+// replica, so only one of them applies migrations at a time.
+const migrationLockID = 0x6f61757468
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Migrate applies every migration in migrations/<dialect> that has not been
+// recorded in schema_migrations yet, in version order. Files are named
+// NNNN_description.sql and are never edited once released; schema changes
+// always go into a new file.
+func (s *Store) Migrate(ctx context.Context) error {
+	pending, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+
+	// Session level locks need a single connection for lock and unlock.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := s.lock(ctx, conn); err != nil {
+		return fmt.Errorf("sqlstore: acquiring migration lock: %w", err)
+	}
+	defer s.unlock(context.Background(), conn)
+
+	timestamp := "TIMESTAMPTZ"
+	if s.dialect == MySQL {
+		timestamp = "DATETIME(6)"
+	}
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT       NOT NULL PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at `+timestamp+` NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("sqlstore: creating schema_migrations: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		if applied[m.version] {
+			continue
+		}
+		if err := s.apply(ctx, conn, m); err != nil {
+			return fmt.Errorf("sqlstore: applying migration %04d_%s: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// apply runs one migration in a transaction. MySQL commits DDL implicitly, so
+// there a failed migration can leave partial changes behind; keep MySQL
+// migrations to one logical change per file.
+func (s *Store) apply(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(m.sql) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+		m.version, m.name, now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) lock(ctx context.Context, conn *sql.Conn) error {
+	switch s.dialect {
+	case Postgres:
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+		return err
+	default:
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", "oauth_migrations").Scan(&got); err != nil {
+			return err
+		}
+		if got.Int64 != 1 {
+			return fmt.Errorf("timed out")
+		}
+		return nil
+	}
+}
+
+func (s *Store) unlock(ctx context.Context, conn *sql.Conn) {
+	switch s.dialect {
+	case Postgres:
+		conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+	default:
+		conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", "oauth_migrations")
+	}
+}
+
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("sqlstore: no migrations for dialect %q", dialect)
+	}
+
+	var out []migration
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("sqlstore: migration %q is not named NNNN_description.sql", e.Name())
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("sqlstore: migration %q has no numeric version", e.Name())
+		}
+		body, err := fs.ReadFile(migrations, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, migration{version: version, name: name, sql: string(body)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].version < out[j].version })
+	for i := 1; i < len(out); i++ {
+		if out[i].version == out[i-1].version {
+			return nil, fmt.Errorf("sqlstore: duplicate migration version %d", out[i].version)
+		}
+	}
+	return out, nil
+}
+
+// splitStatements splits a migration file on semicolons that end a line.
+// Migrations must not contain procedural blocks with inner semicolons.
+func splitStatements(body string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			stmt := strings.TrimSuffix(strings.TrimSpace(cur.String()), ";")
+			if stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			cur.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(cur.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
@@ -0,0 +1,47 @@
+CREATE TABLE oauth_clients (
+    id                       VARCHAR(128) NOT NULL PRIMARY KEY,
+    secret_hash              VARCHAR(64)  NOT NULL DEFAULT '',
+    name                     VARCHAR(255) NOT NULL DEFAULT '',
+    redirect_uris            TEXT         NOT NULL,
+    scopes                   TEXT         NOT NULL,
+    access_token_format      VARCHAR(16)  NOT NULL DEFAULT 'jwt',
+    access_token_ttl_seconds BIGINT       NOT NULL DEFAULT 3600,
+    created_at               DATETIME(6)  NOT NULL,
+    updated_at               DATETIME(6)  NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE oauth_users (
+    id            VARCHAR(64)  NOT NULL PRIMARY KEY,
+    provider      VARCHAR(64)  NOT NULL,
+    subject       VARCHAR(255) NOT NULL,
+    email         VARCHAR(320) NOT NULL DEFAULT '',
+    name          VARCHAR(255) NOT NULL DEFAULT '',
+    disabled      BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at    DATETIME(6)  NOT NULL,
+    updated_at    DATETIME(6)  NOT NULL,
+    last_login_at DATETIME(6)  NULL,
+    UNIQUE KEY oauth_users_provider_subject (provider, subject)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE oauth_grants (
+    id                 VARCHAR(64)  NOT NULL PRIMARY KEY,
+    client_id          VARCHAR(128) NOT NULL,
+    user_id            VARCHAR(64)  NOT NULL,
+    scopes             TEXT         NOT NULL,
+    upstream_ref       VARCHAR(128) NOT NULL DEFAULT '',
+    refresh_token_hash VARCHAR(64)  NULL,
+    created_at         DATETIME(6)  NOT NULL,
+    expires_at         DATETIME(6)  NOT NULL,
+    revoked_at         DATETIME(6)  NULL,
+    UNIQUE KEY oauth_grants_refresh_token_hash (refresh_token_hash),
+    KEY oauth_grants_user_id (user_id),
+    KEY oauth_grants_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE oauth_consents (
+    user_id    VARCHAR(64)  NOT NULL,
+    client_id  VARCHAR(128) NOT NULL,
+    scopes     TEXT         NOT NULL,
+    granted_at DATETIME(6)  NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
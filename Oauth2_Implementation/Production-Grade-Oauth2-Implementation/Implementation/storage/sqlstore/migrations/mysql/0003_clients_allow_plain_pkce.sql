@@ -0,0 +1 @@
+ALTER TABLE oauth_clients ADD COLUMN allow_plain_pkce BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE oauth_clients ADD COLUMN response_encryption_key TEXT NOT NULL;
@@ -0,0 +1,47 @@
+CREATE TABLE oauth_clients (
+    id                       VARCHAR(128) PRIMARY KEY,
+    secret_hash              VARCHAR(64)  NOT NULL DEFAULT '',
+    name                     VARCHAR(255) NOT NULL DEFAULT '',
+    redirect_uris            TEXT         NOT NULL,
+    scopes                   TEXT         NOT NULL,
+    access_token_format      VARCHAR(16)  NOT NULL DEFAULT 'jwt',
+    access_token_ttl_seconds BIGINT       NOT NULL DEFAULT 3600,
+    created_at               TIMESTAMPTZ  NOT NULL,
+    updated_at               TIMESTAMPTZ  NOT NULL
+);
+
+CREATE TABLE oauth_users (
+    id            VARCHAR(64)  PRIMARY KEY,
+    provider      VARCHAR(64)  NOT NULL,
+    subject       VARCHAR(255) NOT NULL,
+    email         VARCHAR(320) NOT NULL DEFAULT '',
+    name          VARCHAR(255) NOT NULL DEFAULT '',
+    disabled      BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMPTZ  NOT NULL,
+    updated_at    TIMESTAMPTZ  NOT NULL,
+    last_login_at TIMESTAMPTZ  NULL,
+    CONSTRAINT oauth_users_provider_subject UNIQUE (provider, subject)
+);
+
+CREATE TABLE oauth_grants (
+    id                 VARCHAR(64)  PRIMARY KEY,
+    client_id          VARCHAR(128) NOT NULL,
+    user_id            VARCHAR(64)  NOT NULL,
+    scopes             TEXT         NOT NULL,
+    upstream_ref       VARCHAR(128) NOT NULL DEFAULT '',
+    refresh_token_hash VARCHAR(64)  NULL UNIQUE,
+    created_at         TIMESTAMPTZ  NOT NULL,
+    expires_at         TIMESTAMPTZ  NOT NULL,
+    revoked_at         TIMESTAMPTZ  NULL
+);
+
+CREATE INDEX oauth_grants_user_id ON oauth_grants (user_id);
+CREATE INDEX oauth_grants_expires_at ON oauth_grants (expires_at);
+
+CREATE TABLE oauth_consents (
+    user_id    VARCHAR(64)  NOT NULL,
+    client_id  VARCHAR(128) NOT NULL,
+    scopes     TEXT         NOT NULL,
+    granted_at TIMESTAMPTZ  NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE oauth_clients ADD COLUMN legacy_flows BOOLEAN NOT NULL DEFAULT FALSE;
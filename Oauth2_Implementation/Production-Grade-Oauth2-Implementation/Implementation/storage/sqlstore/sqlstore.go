@@ -0,0 +1,176 @@
+// Package sqlstore implements storage.Store on PostgreSQL and MySQL through
+// database/sql. Queries are written once with '?' placeholders and rebound for
+// the dialect; only upserts and locking differ between the two.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// Dialect names accepted by Open.
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+)
+
+var _ storage.Store = (*Store)(nil)
+
+type Store struct {
+	db      *sql.DB
+	dialect string
+}
+
+// Open connects to dsn with the given dialect and verifies the connection.
+// For MySQL, parseTime and a UTC location are forced on so DATETIME columns
+// round-trip as time.Time, and clientFoundRows so an UPDATE that changes
+// nothing is not mistaken for a missing row.
+func Open(ctx context.Context, dialect, dsn string) (*Store, error) {
+	switch dialect {
+	case Postgres:
+	case MySQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("sqlstore: parsing MySQL DSN: %w", err)
+		}
+		cfg.ParseTime = true
+		cfg.Loc = time.UTC
+		cfg.ClientFoundRows = true // UPDATEs report matched rows, like PostgreSQL
+		dsn = cfg.FormatDSN()
+	default:
+		return nil, fmt.Errorf("sqlstore: unsupported dialect %q", dialect)
+	}
+
+	db, err := sql.Open(dialect, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(20)
+	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(30 * time.Minute)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlstore: connecting to %s: %w", dialect, err)
+	}
+	return New(db, dialect), nil
+}
+
+// New wraps an existing connection pool.
+func New(db *sql.DB, dialect string) *Store {
+	return &Store{db: db, dialect: dialect}
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// DB exposes the pool for health checks.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// rebind rewrites '?' placeholders to '$n' for PostgreSQL.
+func (s *Store) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *Store) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.rebind(query), args...)
+}
+
+// isUniqueViolation recognises duplicate key errors from both drivers.
+func isUniqueViolation(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1062 // ER_DUP_ENTRY
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" // unique_violation
+	}
+	return false
+}
+
+// affected maps "no rows changed" to storage.ErrNotFound.
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func encodeList(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+	b, _ := json.Marshal(list)
+	return string(b)
+}
+
+func decodeList(s string) ([]string, error) {
+	var list []string
+	if s == "" {
+		return list, nil
+	}
+	if err := json.Unmarshal([]byte(s), &list); err != nil {
+		return nil, fmt.Errorf("sqlstore: decoding list column: %w", err)
+	}
+	return list, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil || t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// now is truncated to microseconds, the precision of both TIMESTAMPTZ and
+// DATETIME(6), so values read back compare equal to what was written.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,91 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+const userColumns = `id, provider, subject, email, name, disabled, created_at, updated_at, last_login_at`
+
+func (s *Store) UpsertUser(ctx context.Context, u *storage.User) error {
+	ts := now()
+	if u.ID == "" {
+		newID, err := storage.NewID()
+		if err != nil {
+			return err
+		}
+		u.ID = newID
+	}
+	lastLogin := nullTime(&u.LastLoginAt)
+
+	var query string
+	switch s.dialect {
+	case Postgres:
+		query = `INSERT INTO oauth_users (` + userColumns + `)
+			VALUES (?, ?, ?, ?, ?, FALSE, ?, ?, ?)
+			ON CONFLICT (provider, subject) DO UPDATE SET
+				email = EXCLUDED.email, name = EXCLUDED.name,
+				last_login_at = EXCLUDED.last_login_at, updated_at = EXCLUDED.updated_at`
+	default:
+		query = `INSERT INTO oauth_users (` + userColumns + `)
+			VALUES (?, ?, ?, ?, ?, FALSE, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				email = VALUES(email), name = VALUES(name),
+				last_login_at = VALUES(last_login_at), updated_at = VALUES(updated_at)`
+	}
+	if _, err := s.exec(ctx, query, u.ID, u.Provider, u.Subject, u.Email, u.Name, ts, ts, lastLogin); err != nil {
+		return err
+	}
+
+	// Read back the row: on conflict the stored ID, flags and creation time win.
+	row := s.queryRow(ctx, `SELECT `+userColumns+` FROM oauth_users WHERE provider = ? AND subject = ?`,
+		u.Provider, u.Subject)
+	stored, err := scanUser(row)
+	if err != nil {
+		return err
+	}
+	*u = *stored
+	return nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*storage.User, error) {
+	return scanUser(s.queryRow(ctx, `SELECT `+userColumns+` FROM oauth_users WHERE id = ?`, id))
+}
+
+func (s *Store) UpdateUser(ctx context.Context, u *storage.User) error {
+	u.UpdatedAt = now()
+	err := affected(s.exec(ctx, `UPDATE oauth_users SET email = ?, name = ?, disabled = ?,
+		last_login_at = ?, updated_at = ? WHERE id = ?`,
+		u.Email, u.Name, u.Disabled, nullTime(&u.LastLoginAt), u.UpdatedAt, u.ID))
+	if err != nil {
+		return err
+	}
+	stored, err := s.GetUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	*u = *stored
+	return nil
+}
+
+func scanUser(row scanner) (*storage.User, error) {
+	var (
+		u         storage.User
+		lastLogin sql.NullTime
+	)
+	err := row.Scan(&u.ID, &u.Provider, &u.Subject, &u.Email, &u.Name, &u.Disabled,
+		&u.CreatedAt, &u.UpdatedAt, &lastLogin)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt, u.UpdatedAt = u.CreatedAt.UTC(), u.UpdatedAt.UTC()
+	if lastLogin.Valid {
+		u.LastLoginAt = lastLogin.Time.UTC()
+	}
+	return &u, nil
+}
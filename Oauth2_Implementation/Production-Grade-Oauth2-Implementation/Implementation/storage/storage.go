@@ -0,0 +1,244 @@
+// Package storage defines the durable entities of the authorization server and
+// the interfaces every storage backend implements. Short-lived data such as
+// login state and authorization codes does not belong here; it lives in the
+// state store (see the state package).
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+)
+
+var (
+	ErrNotFound = errors.New("storage: not found")
+	ErrConflict = errors.New("storage: already exists")
+)
+
+// Client is a registered OAuth client.
+type Client struct {
+	ID           string
+	SecretHash   string // hex SHA-256 of the client secret; empty for public clients
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+
+	// AccessTokenFormat is "jwt" or "opaque".
+	AccessTokenFormat string
+	AccessTokenTTL    time.Duration
+
+	// AllowPlainPKCE lets the client send code_challenge_method=plain.
+	// Otherwise only S256 is accepted (RFC 7636 section 4.2).
+	AllowPlainPKCE bool
+	// LegacyFlows lets the client use the implicit and hybrid flows:
+	// response types with token or id_token, which put tokens in the
+	// browser's address bar or history.
+	LegacyFlows bool
+	// ResponseEncryptionKey is a public JWK (JSON) that JWT-secured
+	// authorization responses to the client are encrypted to. Empty means
+	// they are only signed.
+	ResponseEncryptionKey string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Public reports whether the client has no secret and must use PKCE.
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// CheckSecret compares secret with the stored hash in constant time.
+func (c *Client) CheckSecret(secret string) bool {
+	if c.Public() {
+		return false
+	}
+	return cryptoutil.Equal(HashSecret(secret), c.SecretHash)
+}
+
+// AllowsRedirectURI reports whether uri is registered for the client. Matching
+// is exact, as required by the OAuth 2.0 Security BCP.
+func (c *Client) AllowsRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRedirectURI reports why uri cannot be registered as a redirect URI,
+// or nil if it can. It must be absolute and without fragment (RFC 6749
+// section 3.1.2) and use https, or http on a loopback host for native apps
+// (RFC 8252 section 7.3). Other schemes such as javascript: or data: would
+// run in the authorization server's origin once a form_post page or a
+// redirect takes the browser there.
+func CheckRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("%q is not an absolute URI without a fragment", uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+		return fmt.Errorf("%q uses http, which is only allowed for loopback hosts; use https", uri)
+	}
+	return fmt.Errorf("%q uses the scheme %s; redirect URIs must use https", uri, u.Scheme)
+}
+
+// MinSecretLength is the shortest client secret CheckClientSecret accepts.
+const MinSecretLength = 32
+
+// CheckClientSecret reports why secret cannot be a client secret, or nil if
+// it can. Secrets are stored with a fast unsalted hash, which only holds up
+// for random secrets; a length of MinSecretLength keeps out passwords and
+// placeholders, but operators should still generate them, e.g. with
+// openssl rand -base64 32.
+func CheckClientSecret(secret string) error {
+	if len(secret) < MinSecretLength {
+		return fmt.Errorf("client secret has %d characters, at least %d are required", len(secret), MinSecretLength)
+	}
+	return nil
+}
+
+// HashSecret returns the form in which client secrets are stored. The admin
+// API and oauthctl generate secrets with 256 bits of entropy and configured
+// ones have to pass CheckClientSecret, so a fast hash is sufficient.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewID returns a random 128-bit identifier for users and grants.
+func NewID() (string, error) {
+	return cryptoutil.HexToken(16)
+}
+
+// User is an end user, identified upstream by Provider and Subject.
+type User struct {
+	ID          string
+	Provider    string
+	Subject     string
+	Email       string // verified by the provider; empty otherwise
+	Name        string
+	Disabled    bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+// Grant is a durable authorization: a user allowed a client a set of scopes.
+// Refresh tokens are bound to a grant; revoking the grant invalidates them.
+type Grant struct {
+	ID               string
+	ClientID         string
+	UserID           string
+	Scopes           []string
+	UpstreamRef      string // reference into the upstream token vault
+	RefreshTokenHash string
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+}
+
+// Active reports whether the grant can still be used at now.
+func (g *Grant) Active(now time.Time) bool {
+	return g.RevokedAt == nil && now.Before(g.ExpiresAt)
+}
+
+// Consent records the scopes a user has approved for a client.
+type Consent struct {
+	UserID    string
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+// Covers reports whether the consent includes every scope in scopes.
+func (c *Consent) Covers(scopes []string) bool {
+	granted := make(map[string]bool, len(c.Scopes))
+	for _, s := range c.Scopes {
+		granted[s] = true
+	}
+	for _, s := range scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// AuditEvent is one entry of the security audit trail.
+type AuditEvent struct {
+	ID       string
+	Time     time.Time
+	Type     string // e.g. "login", "token.issued", "grant.revoked"
+	UserID   string
+	ClientID string
+	RemoteIP string
+	Details  map[string]string
+}
+
+type ClientStore interface {
+	CreateClient(ctx context.Context, c *Client) error
+	GetClient(ctx context.Context, id string) (*Client, error)
+	UpdateClient(ctx context.Context, c *Client) error
+	DeleteClient(ctx context.Context, id string) error
+	ListClients(ctx context.Context) ([]*Client, error)
+}
+
+type UserStore interface {
+	// UpsertUser creates the user for (Provider, Subject) or updates its
+	// profile fields, and fills in u.ID and the timestamps.
+	UpsertUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, id string) (*User, error)
+	UpdateUser(ctx context.Context, u *User) error
+}
+
+type GrantStore interface {
+	CreateGrant(ctx context.Context, g *Grant) error
+	GetGrant(ctx context.Context, id string) (*Grant, error)
+	GetGrantByRefreshToken(ctx context.Context, hash string) (*Grant, error)
+	// RotateRefreshToken swaps the refresh token hash only if it still equals
+	// oldHash, so a refresh token can be redeemed once.
+	RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) error
+	RevokeGrant(ctx context.Context, id string, at time.Time) error
+	ListGrantsByUser(ctx context.Context, userID string) ([]*Grant, error)
+	ListGrantsByClient(ctx context.Context, clientID string) ([]*Grant, error)
+	DeleteExpiredGrants(ctx context.Context, before time.Time) (int64, error)
+}
+
+type ConsentStore interface {
+	GetConsent(ctx context.Context, userID, clientID string) (*Consent, error)
+	SaveConsent(ctx context.Context, c *Consent) error
+	DeleteConsent(ctx context.Context, userID, clientID string) error
+}
+
+// AuditStore is implemented by backends that can keep the audit trail. It is
+// not part of Store; check for it with a type assertion.
+type AuditStore interface {
+	AppendAuditEvent(ctx context.Context, e *AuditEvent) error
+	// ListAuditEvents returns up to limit events at or after since, oldest
+	// first.
+	ListAuditEvents(ctx context.Context, since time.Time, limit int) ([]*AuditEvent, error)
+}
+
+// Store is implemented by every storage backend.
+type Store interface {
+	ClientStore
+	UserStore
+	GrantStore
+	ConsentStore
+	Close() error
+}
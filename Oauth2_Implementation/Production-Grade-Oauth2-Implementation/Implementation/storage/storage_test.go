@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCheckRedirectURI(t *testing.T) {
+	for _, tt := range []struct {
+		uri string
+		ok  bool
+	}{
+		{"https://app.example/cb", true},
+		{"https://app.example:8443/cb?tenant=a", true},
+		{"http://127.0.0.1:51004/cb", true},
+		{"http://[::1]/cb", true},
+		{"http://localhost:3000/cb", true},
+		{"http://app.example/cb", false},
+		{"http://127.0.0.1.app.example/cb", false},
+		{"https://app.example/cb#frag", false},
+		{"/cb", false},
+		{"https:///cb", false},
+		{"javascript:alert(document.domain)", false},
+		{"JavaScript://app.example/%0aalert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"com.example.app:/cb", false},
+		{"", false},
+	} {
+		err := CheckRedirectURI(tt.uri)
+		if tt.ok != (err == nil) {
+			t.Errorf("%q: got %v", tt.uri, err)
+		}
+	}
+}
+
+func TestCheckClientSecret(t *testing.T) {
+	for _, tt := range []struct {
+		secret string
+		ok     bool
+	}{
+		{"", false},
+		{"secret", false},
+		{"correct horse battery staple", false},
+		{strings.Repeat("x", MinSecretLength-1), false},
+		{strings.Repeat("x", MinSecretLength), true},
+		{"q0Zz8fJ6dPp5dIuX0sXGm1qY3r2TQb8uK1nGm8aJ4cE", true},
+	} {
+		err := CheckClientSecret(tt.secret)
+		if tt.ok != (err == nil) {
+			t.Errorf("%q: got %v", tt.secret, err)
+		}
+	}
+
+	// The stored hash checks out for the secret and nothing else
+	c := &Client{SecretHash: HashSecret("q0Zz8fJ6dPp5dIuX0sXGm1qY3r2TQb8uK1nGm8aJ4cE")}
+	if !c.CheckSecret("q0Zz8fJ6dPp5dIuX0sXGm1qY3r2TQb8uK1nGm8aJ4cE") || c.CheckSecret("q0Zz8fJ6dPp5dIuX0sXGm1qY3r2TQb8uK1nGm8aJ4cF") {
+		t.Error("CheckSecret does not match HashSecret")
+	}
+	if (&Client{}).CheckSecret("") {
+		t.Error("public client accepted a secret")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := hex.DecodeString(id); err != nil || len(b) != 16 {
+			t.Fatalf("%q is not 128 bits in hex", id)
+		}
+		if seen[id] {
+			t.Fatalf("%q generated twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,339 @@
+// Package storagetest is the conformance suite for storage backends. Every
+// implementation of storage.Store must pass TestStore; the in-memory backend
+// is the reference and needs no external service.
+//
+// The suite only creates records with random IDs and never lists or deletes
+// records it did not create, so it can run against a shared database:
+//
+//	s, _ := sqlstore.Open(ctx, sqlstore.Postgres, dsn)
+//	s.Migrate(ctx)
+//	if err := storagetest.TestStore(ctx, s); err != nil {
+//		t.Fatal(err)
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/storage"
+)
+
+// precision is the coarsest timestamp resolution among the backends (BSON
+// dates); round-tripped times must agree to within it.
+const precision = time.Millisecond
+
+// TestStore exercises every method of s and reports all deviations from the
+// storage contract as one joined error. Backends that also implement
+// storage.AuditStore are checked for that too.
+func TestStore(ctx context.Context, s storage.Store) error {
+	c := &checker{ctx: ctx, s: s}
+	c.clients()
+	c.users()
+	c.grants()
+	c.consents()
+	if a, ok := s.(storage.AuditStore); ok {
+		c.audit(a)
+	}
+	return errors.Join(c.errs...)
+}
+
+type checker struct {
+	ctx  context.Context
+	s    storage.Store
+	errs []error
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+// expect records a failure unless err matches want (nil for success).
+func (c *checker) expect(op string, err, want error) bool {
+	if want == nil && err != nil {
+		c.errorf("%s: unexpected error: %v", op, err)
+		return false
+	}
+	if want != nil && !errors.Is(err, want) {
+		c.errorf("%s: got error %v, want %v", op, err, want)
+		return false
+	}
+	return true
+}
+
+// id returns a random ID for a record of the suite.
+func (c *checker) id() string {
+	id, err := storage.NewID()
+	if err != nil {
+		c.errorf("NewID: %v", err)
+	}
+	return id
+}
+
+func sameTime(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -precision && d < precision
+}
+
+func (c *checker) clients() {
+	ctx, s := c.ctx, c.s
+	in := &storage.Client{
+		ID:                "conformance-" + c.id(),
+		SecretHash:        storage.HashSecret("secret"),
+		Name:              "Conformance",
+		RedirectURIs:      []string{"https://a.example/cb", "https://b.example/cb"},
+		Scopes:            []string{"openid", "email"},
+		AccessTokenFormat: "opaque",
+		AccessTokenTTL:    15 * time.Minute,
+		AllowPlainPKCE:    true,
+		LegacyFlows:       true,
+
+		ResponseEncryptionKey: `{"kty":"EC","crv":"P-256","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}`,
+	}
+	if !c.expect("CreateClient", s.CreateClient(ctx, in), nil) {
+		return
+	}
+	defer s.DeleteClient(ctx, in.ID)
+	if in.CreatedAt.IsZero() || in.UpdatedAt.IsZero() {
+		c.errorf("CreateClient: timestamps not filled in")
+	}
+	c.expect("CreateClient duplicate", s.CreateClient(ctx, &storage.Client{ID: in.ID}), storage.ErrConflict)
+
+	got, err := s.GetClient(ctx, in.ID)
+	if c.expect("GetClient", err, nil) {
+		if got.SecretHash != in.SecretHash || got.Name != in.Name ||
+			!reflect.DeepEqual(got.RedirectURIs, in.RedirectURIs) || !reflect.DeepEqual(got.Scopes, in.Scopes) ||
+			got.AccessTokenFormat != in.AccessTokenFormat || got.AccessTokenTTL != in.AccessTokenTTL ||
+			got.AllowPlainPKCE != in.AllowPlainPKCE || got.LegacyFlows != in.LegacyFlows ||
+			got.ResponseEncryptionKey != in.ResponseEncryptionKey {
+			c.errorf("GetClient: got %+v, want %+v", got, in)
+		}
+		if !got.CheckSecret("secret") {
+			c.errorf("GetClient: stored secret hash does not verify")
+		}
+	}
+
+	createdAt := in.CreatedAt
+	in.Name = "Renamed"
+	in.RedirectURIs = []string{"https://c.example/cb"}
+	in.AllowPlainPKCE = false
+	in.LegacyFlows = false
+	in.ResponseEncryptionKey = ""
+	if c.expect("UpdateClient", s.UpdateClient(ctx, in), nil) {
+		got, err := s.GetClient(ctx, in.ID)
+		if c.expect("GetClient after update", err, nil) {
+			if got.Name != "Renamed" || !reflect.DeepEqual(got.RedirectURIs, in.RedirectURIs) || got.AllowPlainPKCE || got.LegacyFlows ||
+				got.ResponseEncryptionKey != "" {
+				c.errorf("UpdateClient: changes not stored, got %+v", got)
+			}
+			if !sameTime(got.CreatedAt, createdAt) {
+				c.errorf("UpdateClient: CreatedAt changed from %v to %v", createdAt, got.CreatedAt)
+			}
+		}
+	}
+	c.expect("UpdateClient missing", s.UpdateClient(ctx, &storage.Client{ID: "missing-" + c.id()}), storage.ErrNotFound)
+
+	list, err := s.ListClients(ctx)
+	if c.expect("ListClients", err, nil) {
+		found := false
+		for _, l := range list {
+			found = found || l.ID == in.ID
+		}
+		if !found {
+			c.errorf("ListClients: %s missing", in.ID)
+		}
+	}
+
+	c.expect("DeleteClient", s.DeleteClient(ctx, in.ID), nil)
+	_, err = s.GetClient(ctx, in.ID)
+	c.expect("GetClient after delete", err, storage.ErrNotFound)
+	c.expect("DeleteClient twice", s.DeleteClient(ctx, in.ID), storage.ErrNotFound)
+}
+
+func (c *checker) users() {
+	ctx, s := c.ctx, c.s
+	subject := c.id()
+	first := &storage.User{Provider: "conformance", Subject: subject, Email: "a@example.com", LastLoginAt: time.Now()}
+	if !c.expect("UpsertUser create", s.UpsertUser(ctx, first), nil) {
+		return
+	}
+	if first.ID == "" || first.CreatedAt.IsZero() {
+		c.errorf("UpsertUser: ID or CreatedAt not filled in: %+v", first)
+	}
+
+	second := &storage.User{Provider: "conformance", Subject: subject, Email: "b@example.com", Name: "B"}
+	if c.expect("UpsertUser update", s.UpsertUser(ctx, second), nil) {
+		if second.ID != first.ID {
+			c.errorf("UpsertUser: same subject got new ID %s, want %s", second.ID, first.ID)
+		}
+		if second.Email != "b@example.com" || second.Name != "B" {
+			c.errorf("UpsertUser: profile not updated: %+v", second)
+		}
+		if !sameTime(second.CreatedAt, first.CreatedAt) {
+			c.errorf("UpsertUser: CreatedAt changed on update")
+		}
+	}
+
+	first.Disabled = true
+	if c.expect("UpdateUser", s.UpdateUser(ctx, first), nil) {
+		// A later login must not re-enable the account.
+		again := &storage.User{Provider: "conformance", Subject: subject, Email: "c@example.com"}
+		if c.expect("UpsertUser after disable", s.UpsertUser(ctx, again), nil) && !again.Disabled {
+			c.errorf("UpsertUser: re-enabled a disabled user")
+		}
+		got, err := s.GetUser(ctx, first.ID)
+		if c.expect("GetUser", err, nil) && (!got.Disabled || got.Subject != subject) {
+			c.errorf("GetUser: got %+v", got)
+		}
+	}
+
+	_, err := s.GetUser(ctx, "missing-"+c.id())
+	c.expect("GetUser missing", err, storage.ErrNotFound)
+	c.expect("UpdateUser missing", s.UpdateUser(ctx, &storage.User{ID: "missing-" + c.id()}), storage.ErrNotFound)
+}
+
+func (c *checker) grants() {
+	ctx, s := c.ctx, c.s
+	userID := "conformance-" + c.id()
+	hash := storage.HashSecret(c.id())
+	g := &storage.Grant{
+		ClientID:         "conformance-" + c.id(),
+		UserID:           userID,
+		Scopes:           []string{"openid"},
+		UpstreamRef:      "ref",
+		RefreshTokenHash: hash,
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	if !c.expect("CreateGrant", s.CreateGrant(ctx, g), nil) {
+		return
+	}
+	c.expect("CreateGrant duplicate", s.CreateGrant(ctx, &storage.Grant{ID: g.ID, ExpiresAt: g.ExpiresAt}), storage.ErrConflict)
+
+	got, err := s.GetGrant(ctx, g.ID)
+	if c.expect("GetGrant", err, nil) {
+		if got.UserID != userID || got.UpstreamRef != "ref" || !reflect.DeepEqual(got.Scopes, g.Scopes) ||
+			!sameTime(got.ExpiresAt, g.ExpiresAt) || !got.Active(time.Now()) {
+			c.errorf("GetGrant: got %+v, want %+v", got, g)
+		}
+	}
+	if got, err := s.GetGrantByRefreshToken(ctx, hash); c.expect("GetGrantByRefreshToken", err, nil) && got.ID != g.ID {
+		c.errorf("GetGrantByRefreshToken: got grant %s, want %s", got.ID, g.ID)
+	}
+	_, err = s.GetGrantByRefreshToken(ctx, "")
+	c.expect("GetGrantByRefreshToken empty", err, storage.ErrNotFound)
+
+	// Grants without a refresh token must not collide with each other.
+	for i := 0; i < 2; i++ {
+		c.expect("CreateGrant without refresh token", s.CreateGrant(ctx, &storage.Grant{
+			UserID: userID, ExpiresAt: time.Now().Add(time.Hour),
+		}), nil)
+	}
+
+	next := storage.HashSecret(c.id())
+	c.expect("RotateRefreshToken", s.RotateRefreshToken(ctx, g.ID, hash, next), nil)
+	c.expect("RotateRefreshToken replay", s.RotateRefreshToken(ctx, g.ID, hash, storage.HashSecret("x")), storage.ErrNotFound)
+	_, err = s.GetGrantByRefreshToken(ctx, hash)
+	c.expect("GetGrantByRefreshToken rotated", err, storage.ErrNotFound)
+
+	list, err := s.ListGrantsByUser(ctx, userID)
+	if c.expect("ListGrantsByUser", err, nil) && len(list) != 3 {
+		c.errorf("ListGrantsByUser: got %d grants, want 3", len(list))
+	}
+	list, err = s.ListGrantsByClient(ctx, g.ClientID)
+	if c.expect("ListGrantsByClient", err, nil) && (len(list) != 1 || list[0].ID != g.ID) {
+		c.errorf("ListGrantsByClient: got %d grants, want grant %s", len(list), g.ID)
+	}
+
+	at := time.Now()
+	c.expect("RevokeGrant", s.RevokeGrant(ctx, g.ID, at), nil)
+	c.expect("RevokeGrant twice", s.RevokeGrant(ctx, g.ID, at.Add(time.Minute)), nil)
+	if got, err := s.GetGrant(ctx, g.ID); c.expect("GetGrant after revoke", err, nil) {
+		if got.RevokedAt == nil || !sameTime(*got.RevokedAt, at) {
+			c.errorf("RevokeGrant: RevokedAt = %v, want %v", got.RevokedAt, at)
+		}
+		if got.Active(time.Now()) {
+			c.errorf("RevokeGrant: grant still active")
+		}
+	}
+	c.expect("RevokeGrant missing", s.RevokeGrant(ctx, "missing-"+c.id(), at), storage.ErrNotFound)
+
+	expired := &storage.Grant{UserID: userID, ExpiresAt: time.Now().Add(-time.Hour)}
+	if c.expect("CreateGrant expired", s.CreateGrant(ctx, expired), nil) {
+		_, err := s.DeleteExpiredGrants(ctx, time.Now())
+		c.expect("DeleteExpiredGrants", err, nil)
+		_, err = s.GetGrant(ctx, expired.ID)
+		c.expect("GetGrant expired", err, storage.ErrNotFound)
+		_, err = s.GetGrant(ctx, g.ID)
+		c.expect("GetGrant unexpired after DeleteExpiredGrants", err, nil)
+	}
+}
+
+func (c *checker) consents() {
+	ctx, s := c.ctx, c.s
+	userID, clientID := "conformance-"+c.id(), "conformance"
+	_, err := s.GetConsent(ctx, userID, clientID)
+	c.expect("GetConsent missing", err, storage.ErrNotFound)
+
+	in := &storage.Consent{UserID: userID, ClientID: clientID, Scopes: []string{"openid", "email"}}
+	if !c.expect("SaveConsent", s.SaveConsent(ctx, in), nil) {
+		return
+	}
+	if got, err := s.GetConsent(ctx, userID, clientID); c.expect("GetConsent", err, nil) && !got.Covers(in.Scopes) {
+		c.errorf("GetConsent: got scopes %v, want %v", got.Scopes, in.Scopes)
+	}
+
+	in.Scopes = []string{"openid"}
+	c.expect("SaveConsent replace", s.SaveConsent(ctx, in), nil)
+	if got, err := s.GetConsent(ctx, userID, clientID); c.expect("GetConsent after replace", err, nil) &&
+		!reflect.DeepEqual(got.Scopes, in.Scopes) {
+		c.errorf("SaveConsent: scopes not replaced, got %v", got.Scopes)
+	}
+
+	c.expect("DeleteConsent", s.DeleteConsent(ctx, userID, clientID), nil)
+	c.expect("DeleteConsent twice", s.DeleteConsent(ctx, userID, clientID), storage.ErrNotFound)
+}
+
+func (c *checker) audit(a storage.AuditStore) {
+	ctx := c.ctx
+	since := time.Now().Add(-time.Second)
+	marker := c.id()
+	events := []*storage.AuditEvent{
+		{Time: since.Add(200 * time.Millisecond), Type: "conformance.second", Details: map[string]string{"run": marker}},
+		{Time: since.Add(100 * time.Millisecond), Type: "conformance.first", UserID: "u", ClientID: "c",
+			RemoteIP: "192.0.2.1", Details: map[string]string{"run": marker}},
+	}
+	for _, e := range events {
+		if !c.expect("AppendAuditEvent", a.AppendAuditEvent(ctx, e), nil) {
+			return
+		}
+		if e.ID == "" {
+			c.errorf("AppendAuditEvent: ID not filled in")
+		}
+	}
+
+	list, err := a.ListAuditEvents(ctx, since, 0)
+	if !c.expect("ListAuditEvents", err, nil) {
+		return
+	}
+	var ours []*storage.AuditEvent
+	for _, e := range list {
+		if e.Details["run"] == marker {
+			ours = append(ours, e)
+		}
+	}
+	if len(ours) != 2 || ours[0].Type != "conformance.first" || ours[1].Type != "conformance.second" {
+		c.errorf("ListAuditEvents: got %d events in wrong order or missing", len(ours))
+		return
+	}
+	if ours[0].UserID != "u" || ours[0].ClientID != "c" || ours[0].RemoteIP != "192.0.2.1" ||
+		!sameTime(ours[0].Time, events[1].Time) {
+		c.errorf("ListAuditEvents: got %+v, want %+v", ours[0], events[1])
+	}
+
+	if list, err := a.ListAuditEvents(ctx, since, 1); c.expect("ListAuditEvents limit", err, nil) && len(list) != 1 {
+		c.errorf("ListAuditEvents: limit 1 returned %d events", len(list))
+	}
+}
@@ -0,0 +1,82 @@
+// Package tokens turns claim sets into the tokens the server hands out and
+// back again. A Codec hides whether a token is only signed (JWS) or signed
+// and then encrypted (JWE), so handlers never touch the JOSE library directly.
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+var (
+	ErrInvalidToken = errors.New("tokens: invalid token")
+	ErrExpiredToken = errors.New("tokens: token expired")
+)
+
+// Token types, the typ header of a JWT (RFC 8725 section 3.11). Access
+// tokens are TypeAccessToken (RFC 9068 section 2.1); a codec expecting it
+// turns away ID tokens and authorization responses signed with the same key.
+const (
+	TypeJWT                   = "JWT"
+	TypeAccessToken           = "at+jwt"
+	TypeAuthorizationResponse = "oauth-authz-resp+jwt"
+)
+
+// Claims is the claim set carried by a token.
+type Claims map[string]interface{}
+
+// Codec encodes claims into a compact token and decodes them back after
+// verifying signature, encryption and the registered time claims.
+type Codec interface {
+	Encode(claims Claims) (string, error)
+	Decode(raw string) (Claims, error)
+}
+
+// Expectations are checked against every decoded token. Zero values are
+// skipped, except Type: tokens are encoded with it and must carry it, and
+// it defaults to TypeJWT.
+type Expectations struct {
+	Issuer   string
+	Audience []string
+	Leeway   time.Duration
+	Type     string
+}
+
+func (e Expectations) typ() string {
+	if e.Type == "" {
+		return TypeJWT
+	}
+	return e.Type
+}
+
+func (e Expectations) validate(claims Claims) error {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var registered jwt.Claims
+	if err := json.Unmarshal(raw, &registered); err != nil {
+		return ErrInvalidToken
+	}
+
+	leeway := e.Leeway
+	if leeway == 0 {
+		leeway = jwt.DefaultLeeway
+	}
+	err = registered.ValidateWithLeeway(jwt.Expected{
+		Issuer:      e.Issuer,
+		AnyAudience: e.Audience,
+		Time:        time.Now(),
+	}, leeway)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, jwt.ErrExpired):
+		return ErrExpiredToken
+	default:
+		return ErrInvalidToken
+	}
+}
@@ -0,0 +1,33 @@
+package tokens
+
+import (
+	"crypto"
+	_ "crypto/sha256" // register the hashes HalfHash uses
+	_ "crypto/sha512"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// HalfHash computes the at_hash or c_hash claim of an ID token for value:
+// the left half of its hash, base64url encoded, with the hash of the ID
+// token's signature algorithm (OpenID Connect Core section 3.3.2.11).
+// EdDSA uses SHA-512, the hash of Ed25519.
+func HalfHash(alg jose.SignatureAlgorithm, value string) (string, error) {
+	var h crypto.Hash
+	switch alg {
+	case jose.HS256, jose.RS256, jose.PS256, jose.ES256:
+		h = crypto.SHA256
+	case jose.HS384, jose.RS384, jose.PS384, jose.ES384:
+		h = crypto.SHA384
+	case jose.HS512, jose.RS512, jose.PS512, jose.ES512, jose.EdDSA:
+		h = crypto.SHA512
+	default:
+		return "", fmt.Errorf("tokens: no hash known for algorithm %q", alg)
+	}
+	d := h.New()
+	d.Write([]byte(value))
+	sum := d.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
@@ -0,0 +1,52 @@
+package tokens
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+func TestHalfHash(t *testing.T) {
+	// The code and c_hash of the example ID token in OpenID Connect Core
+	// appendix A.4; at_hash is computed the same way. The at_hash printed
+	// in appendix A.3 does not match the access token printed next to it,
+	// so that example is not used.
+	const code = "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk"
+	for _, alg := range []jose.SignatureAlgorithm{jose.RS256, jose.PS256, jose.ES256, jose.HS256} {
+		got, err := HalfHash(alg, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "LDktKdoQak3Pk0cnXxCltA"; got != want {
+			t.Errorf("%s: got %q, want %q", alg, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		alg  jose.SignatureAlgorithm
+		size int
+	}{
+		{jose.RS384, 24},
+		{jose.ES384, 24},
+		{jose.RS512, 32},
+		{jose.ES512, 32},
+		{jose.EdDSA, 32},
+	} {
+		got, err := HalfHash(tt.alg, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(got)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.alg, err)
+		}
+		if len(b) != tt.size {
+			t.Errorf("%s: %d bytes, want %d", tt.alg, len(b), tt.size)
+		}
+	}
+
+	if _, err := HalfHash("none", code); err == nil {
+		t.Error("hash for alg none")
+	}
+}
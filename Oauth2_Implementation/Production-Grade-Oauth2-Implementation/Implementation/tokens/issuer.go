@@ -0,0 +1,172 @@
+package tokens
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+// Format selects how an access token is represented on the wire.
+type Format string
+
+const (
+	// FormatJWT tokens are self-contained and produced by the Codec.
+	FormatJWT Format = "jwt"
+	// FormatOpaque tokens are random reference strings whose claims stay in
+	// the state store; resource servers resolve them through introspection.
+	FormatOpaque Format = "opaque"
+)
+
+const (
+	// ReferencePrefix and RevokedPrefix name the opaque tokens (see
+	// ReferenceKey) and the revoked JWT IDs in the state store.
+	ReferencePrefix = "at:"
+	RevokedPrefix   = "revoked:"
+
+	// referenceBytes gives opaque tokens 256 bits of entropy.
+	referenceBytes = 32
+)
+
+// ParseFormat accepts "jwt" and "opaque"; an empty string means FormatJWT.
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", FormatJWT:
+		return FormatJWT, nil
+	case FormatOpaque:
+		return FormatOpaque, nil
+	default:
+		return "", fmt.Errorf("tokens: unknown token format %q", s)
+	}
+}
+
+// Issuer issues access tokens in either format and gives both the same
+// lifetime, introspection and revocation behaviour.
+type Issuer struct {
+	codec Codec
+	kv    state.Store
+}
+
+func NewIssuer(codec Codec, kv state.Store) *Issuer {
+	return &Issuer{codec: codec, kv: kv}
+}
+
+// Issue stamps jti, iat and exp onto claims and returns the encoded token.
+func (i *Issuer) Issue(ctx context.Context, format Format, claims Claims, ttl time.Duration) (string, error) {
+	id, err := cryptoutil.Token(referenceBytes)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	stamped := Claims{}
+	for k, v := range claims {
+		stamped[k] = v
+	}
+	stamped["jti"] = id
+	stamped["iat"] = now.Unix()
+	stamped["exp"] = now.Add(ttl).Unix()
+
+	if format != FormatOpaque {
+		return i.codec.Encode(stamped)
+	}
+
+	token, err := cryptoutil.Token(referenceBytes)
+	if err != nil {
+		return "", err
+	}
+	metadata, err := json.Marshal(stamped)
+	if err != nil {
+		return "", err
+	}
+	if err := i.kv.Set(ctx, ReferenceKey(token), metadata, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Introspect returns the claims of an active token. Expired, revoked and
+// unknown tokens all yield ErrInvalidToken or ErrExpiredToken.
+func (i *Issuer) Introspect(ctx context.Context, token string) (Claims, error) {
+	var claims Claims
+	if isReference(token) {
+		metadata, err := i.kv.Get(ctx, ReferenceKey(token))
+		if err == state.ErrNotFound {
+			return nil, ErrInvalidToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metadata, &claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	claims, err := i.codec.Decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if jti, ok := claims["jti"].(string); ok {
+		revoked, err := i.kv.Exists(ctx, RevokedPrefix+jti)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
+	}
+	return claims, nil
+}
+
+// Revoke invalidates token. Opaque tokens are deleted; JWTs cannot be recalled,
+// so their jti is put on a deny list until the token would have expired
+// anyway. Revoking an unknown or already invalid token is not an error
+// (RFC 7009 section 2.2).
+func (i *Issuer) Revoke(ctx context.Context, token string) (Claims, error) {
+	if isReference(token) {
+		metadata, err := i.kv.GetDel(ctx, ReferenceKey(token))
+		if err == state.ErrNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var claims Claims
+		if err := json.Unmarshal(metadata, &claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	claims, err := i.codec.Decode(token)
+	if err != nil {
+		return nil, nil
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	ttl := time.Until(time.Unix(int64(exp), 0))
+	if jti == "" || ttl <= 0 {
+		return claims, nil
+	}
+	return claims, i.kv.Set(ctx, RevokedPrefix+jti, []byte{1}, ttl)
+}
+
+// ReferenceKey is the state store key of an opaque token. It holds a hash
+// of the token, so a copy of the state store does not hand out usable
+// tokens.
+func ReferenceKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return ReferencePrefix + hex.EncodeToString(sum[:])
+}
+
+// isReference reports whether token looks like an opaque token rather than a
+// compact JWS or JWE, which always contain dots.
+func isReference(token string) bool {
+	return !strings.Contains(token, ".")
+}
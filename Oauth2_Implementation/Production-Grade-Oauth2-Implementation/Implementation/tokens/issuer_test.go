@@ -0,0 +1,153 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+func testIssuer(t *testing.T) (*Issuer, *memory.Store) {
+	t.Helper()
+	kv := memory.New()
+	t.Cleanup(func() { kv.Close() })
+	return NewIssuer(testRotatingCodec(t), kv), kv
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Format
+		fail bool
+	}{
+		{"", FormatJWT, false},
+		{"jwt", FormatJWT, false},
+		{"JWT", FormatJWT, false},
+		{"opaque", FormatOpaque, false},
+		{"Opaque", FormatOpaque, false},
+		{"reference", "", true},
+	} {
+		got, err := ParseFormat(tt.in)
+		if (err != nil) != tt.fail || got != tt.want {
+			t.Errorf("%q: got %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestIssueOpaque(t *testing.T) {
+	issuer, kv := testIssuer(t)
+	ctx := context.Background()
+
+	token, err := issuer.Issue(ctx, FormatOpaque, Claims{"sub": "u1", "grant_id": "g1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(token, ".") || len(token) < 43 {
+		t.Fatalf("opaque token %q", token)
+	}
+	// Only the hash of the token is stored
+	if ok, _ := kv.Exists(ctx, ReferencePrefix+token); ok {
+		t.Error("token stored under its own value")
+	}
+	if ok, _ := kv.Exists(ctx, ReferenceKey(token)); !ok {
+		t.Error("token not stored under its reference key")
+	}
+
+	claims, err := issuer.Introspect(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "u1" || claims["grant_id"] != "g1" {
+		t.Errorf("claims %v", claims)
+	}
+	for _, c := range []string{"jti", "iat", "exp"} {
+		if claims[c] == nil {
+			t.Errorf("no %s in %v", c, claims)
+		}
+	}
+
+	if _, err := issuer.Introspect(ctx, token+"x"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestIssueOpaqueExpires(t *testing.T) {
+	issuer, _ := testIssuer(t)
+	ctx := context.Background()
+	token, err := issuer.Issue(ctx, FormatOpaque, Claims{"sub": "u1"}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := issuer.Introspect(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired token: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	for _, format := range []Format{FormatOpaque, FormatJWT} {
+		issuer, _ := testIssuer(t)
+		ctx := context.Background()
+		token, err := issuer.Issue(ctx, format, Claims{"sub": "u1"}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := issuer.Revoke(ctx, token)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if claims["sub"] != "u1" {
+			t.Errorf("%s: revoked claims %v", format, claims)
+		}
+		if _, err := issuer.Introspect(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: revoked token: %v, want ErrInvalidToken", format, err)
+		}
+
+		// RFC 7009 section 2.2: revoking again, or a token never issued,
+		// is not an error
+		if claims, err := issuer.Revoke(ctx, token); err != nil || (format == FormatOpaque && claims != nil) {
+			t.Errorf("%s: second revocation: %v, %v", format, claims, err)
+		}
+		if claims, err := issuer.Revoke(ctx, "unknown"); claims != nil || err != nil {
+			t.Errorf("%s: unknown token: %v, %v", format, claims, err)
+		}
+	}
+}
+
+// failingStore fails every read.
+type failingStore struct{ state.Store }
+
+var errDown = errors.New("state store down")
+
+func (failingStore) Get(context.Context, string) ([]byte, error)    { return nil, errDown }
+func (failingStore) GetDel(context.Context, string) ([]byte, error) { return nil, errDown }
+func (failingStore) Exists(context.Context, string) (bool, error)   { return false, errDown }
+
+func TestIntrospectStoreError(t *testing.T) {
+	issuer, kv := testIssuer(t)
+	ctx := context.Background()
+	opaque, err := issuer.Issue(ctx, FormatOpaque, Claims{"sub": "u1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := issuer.Issue(ctx, FormatJWT, Claims{"sub": "u1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An outage must not look like an invalid token
+	down := NewIssuer(issuer.codec, failingStore{kv})
+	for name, token := range map[string]string{"opaque": opaque, "jwt": jwt} {
+		if _, err := down.Introspect(ctx, token); !errors.Is(err, errDown) {
+			t.Errorf("%s: introspect got %v, want the store error", name, err)
+		}
+	}
+	if _, err := down.Revoke(ctx, opaque); !errors.Is(err, errDown) {
+		t.Errorf("opaque: revoke got %v, want the store error", err)
+	}
+}
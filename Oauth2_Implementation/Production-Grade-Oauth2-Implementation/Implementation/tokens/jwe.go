@@ -0,0 +1,96 @@
+package tokens
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// ContentEncryption is the only JWE content encryption the server emits or
+// accepts.
+const ContentEncryption = jose.A256GCM
+
+// EncryptedCodec produces nested JWTs: the claims are signed by the wrapped
+// SignedCodec and the resulting JWS is encrypted to key (RFC 7519 section 11.2).
+// Only holders of the private half of key can read the claims.
+type EncryptedCodec struct {
+	signed    *SignedCodec
+	key       jose.JSONWebKey
+	encrypter jose.Encrypter
+}
+
+// NewEncryptedCodec encrypts tokens signed by signed to key, which must be a
+// private key created with EncryptionKey.
+func NewEncryptedCodec(signed *SignedCodec, key jose.JSONWebKey) (*EncryptedCodec, error) {
+	encrypter, err := jose.NewEncrypter(
+		ContentEncryption,
+		jose.Recipient{
+			Algorithm: jose.KeyAlgorithm(key.Algorithm),
+			Key:       key.Public().Key,
+			KeyID:     key.KeyID,
+		},
+		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tokens: creating encrypter: %w", err)
+	}
+	return &EncryptedCodec{signed: signed, key: key, encrypter: encrypter}, nil
+}
+
+// EncryptTo encrypts the compact JWS signed to key, a public key from
+// ParseEncryptionJWK, making it a nested JWT that only the holder of the
+// private half can read.
+func EncryptTo(key jose.JSONWebKey, signed string) (string, error) {
+	encrypter, err := jose.NewEncrypter(
+		ContentEncryption,
+		jose.Recipient{Algorithm: jose.KeyAlgorithm(key.Algorithm), Key: key.Key, KeyID: key.KeyID},
+		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("tokens: creating encrypter: %w", err)
+	}
+	enc, err := encrypter.Encrypt([]byte(signed))
+	if err != nil {
+		return "", fmt.Errorf("tokens: encrypting: %w", err)
+	}
+	return enc.CompactSerialize()
+}
+
+func (c *EncryptedCodec) Encode(claims Claims) (string, error) {
+	return jwt.SignedAndEncrypted(c.signed.signer, c.encrypter).Claims(c.signed.stamp(claims)).Serialize()
+}
+
+func (c *EncryptedCodec) Decode(raw string) (Claims, error) {
+	// jwt.ParseSignedAndEncrypted refuses asymmetric key management because an
+	// encrypted-only JWT would be forgeable by anyone holding the public key.
+	// That does not apply here: the inner JWS is always verified, so parse the
+	// JWE layer directly.
+	enc, err := jose.ParseEncryptedCompact(
+		raw,
+		[]jose.KeyAlgorithm{jose.KeyAlgorithm(c.key.Algorithm)},
+		[]jose.ContentEncryption{ContentEncryption},
+	)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if cty, _ := enc.Header.ExtraHeaders[jose.HeaderContentType].(string); !strings.EqualFold(cty, "JWT") {
+		return nil, ErrInvalidToken
+	}
+	inner, err := enc.Decrypt(c.key.Key)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	tok, err := jwt.ParseSigned(string(inner), c.signed.algs)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return c.signed.verify(tok)
+}
+
+// JWKS returns the signing keys of the inner JWS. The encryption key is private
+// to the server and is not published.
+func (c *EncryptedCodec) JWKS() jose.JSONWebKeySet {
+	return c.signed.JWKS()
+}
@@ -0,0 +1,147 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+func testSignedCodec(t *testing.T) *SignedCodec {
+	t.Helper()
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := SigningKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewSignedCodec(key, Expectations{Issuer: "https://as.example", Type: TypeAccessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+func testEncryptionKey(t *testing.T, rsaKey bool, alg string) jose.JSONWebKey {
+	t.Helper()
+	var sk crypto.Signer
+	var err error
+	if rsaKey {
+		sk, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		sk, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := EncryptionKey(sk, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptedCodec(t *testing.T) {
+	signed := testSignedCodec(t)
+	claims := Claims{"sub": "u1", "secret_claim": "hidden", "exp": time.Now().Add(time.Minute).Unix()}
+
+	for _, tt := range []struct {
+		name string
+		rsa  bool
+		alg  string
+	}{
+		{"RSA-OAEP-256", true, ""},
+		{"RSA-OAEP", true, "RSA-OAEP"},
+		{"ECDH-ES", false, ""},
+		{"ECDH-ES+A256KW", false, "ECDH-ES+A256KW"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := NewEncryptedCodec(signed, testEncryptionKey(t, tt.rsa, tt.alg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, err := codec.Encode(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts := strings.Split(raw, ".")
+			if len(parts) != 5 {
+				t.Fatalf("%d parts, want a compact JWE", len(parts))
+			}
+			ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[3])
+			if strings.Contains(string(ciphertext), "hidden") {
+				t.Error("claims readable without the key")
+			}
+
+			got, err := codec.Decode(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got["sub"] != "u1" || got["secret_claim"] != "hidden" || got["iss"] != "https://as.example" {
+				t.Errorf("claims %v", got)
+			}
+
+			// Another key of the same kind cannot open it
+			other, err := NewEncryptedCodec(signed, testEncryptionKey(t, tt.rsa, tt.alg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := other.Decode(raw); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("wrong key: %v, want ErrInvalidToken", err)
+			}
+
+			// Nor is a bare JWS accepted in place of the JWE, or a
+			// tampered ciphertext
+			jws, err := signed.Encode(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts[3] = base64.RawURLEncoding.EncodeToString(append(ciphertext[:len(ciphertext)-1], ciphertext[len(ciphertext)-1]^1))
+			for name, raw := range map[string]string{"JWS": jws, "tampered": strings.Join(parts, ".")} {
+				if _, err := codec.Decode(raw); !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("%s: %v, want ErrInvalidToken", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptedCodecVerifiesInnerJWS(t *testing.T) {
+	key := testEncryptionKey(t, false, "")
+	codec, err := NewEncryptedCodec(testSignedCodec(t), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Anyone with the public key can encrypt; a JWS signed with a key the
+	// codec does not know must still be refused
+	forged, err := testSignedCodec(t).Encode(Claims{"sub": "admin", "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := EncryptTo(key.Public(), forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode(raw); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("forged inner JWS: %v, want ErrInvalidToken", err)
+	}
+
+	// Expired tokens are reported as such through the JWE layer too
+	expired, err := codec.Encode(Claims{"sub": "u1", "exp": time.Now().Add(-time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode(expired); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expired: %v, want ErrExpiredToken", err)
+	}
+}
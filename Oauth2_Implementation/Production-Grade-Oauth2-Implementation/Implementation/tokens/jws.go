@@ -0,0 +1,134 @@
+package tokens
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// SignedCodec produces compact JWS tokens. Tokens signed by any of the
+// verification keys are still accepted, which keeps old tokens valid while a
+// signing key is being rotated out.
+type SignedCodec struct {
+	key    jose.JSONWebKey
+	keys   map[string]jose.JSONWebKey
+	algs   []jose.SignatureAlgorithm
+	signer jose.Signer
+	expect Expectations
+}
+
+// NewSignedCodec signs with key and verifies with key plus verify.
+func NewSignedCodec(key jose.JSONWebKey, expect Expectations, verify ...jose.JSONWebKey) (*SignedCodec, error) {
+	signer, err := newSigner(key, expect.typ())
+	if err != nil {
+		return nil, err
+	}
+
+	c := &SignedCodec{
+		key:    key,
+		keys:   make(map[string]jose.JSONWebKey),
+		signer: signer,
+		expect: expect,
+	}
+	seen := make(map[jose.SignatureAlgorithm]bool)
+	for _, k := range append([]jose.JSONWebKey{key}, verify...) {
+		c.keys[k.KeyID] = k
+		alg := jose.SignatureAlgorithm(k.Algorithm)
+		if !seen[alg] {
+			seen[alg] = true
+			c.algs = append(c.algs, alg)
+		}
+	}
+	return c, nil
+}
+
+func newSigner(key jose.JSONWebKey, typ string) (jose.Signer, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key.Key},
+		(&jose.SignerOptions{}).WithType(jose.ContentType(typ)).WithHeader("kid", key.KeyID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tokens: creating signer: %w", err)
+	}
+	return signer, nil
+}
+
+func (c *SignedCodec) Encode(claims Claims) (string, error) {
+	return jwt.Signed(c.signer).Claims(c.stamp(claims)).Serialize()
+}
+
+// SignAs signs claims like Encode but with the token type typ, for JWTs
+// other than the ones the codec decodes. Decode rejects them unless typ is
+// the expected type.
+func (c *SignedCodec) SignAs(typ string, claims Claims) (string, error) {
+	signer, err := newSigner(c.key, typ)
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(c.stamp(claims)).Serialize()
+}
+
+// stamp fills in the issuer and audience the codec expects on decode when
+// the caller did not set them.
+func (c *SignedCodec) stamp(claims Claims) map[string]interface{} {
+	out := make(map[string]interface{}, len(claims)+2)
+	for k, v := range claims {
+		out[k] = v
+	}
+	if _, ok := out["iss"]; !ok && c.expect.Issuer != "" {
+		out["iss"] = c.expect.Issuer
+	}
+	if _, ok := out["aud"]; !ok && len(c.expect.Audience) > 0 {
+		out["aud"] = jwt.Audience(c.expect.Audience)
+	}
+	return out
+}
+
+func (c *SignedCodec) Decode(raw string) (Claims, error) {
+	tok, err := jwt.ParseSigned(raw, c.algs)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return c.verify(tok)
+}
+
+func (c *SignedCodec) verify(tok *jwt.JSONWebToken) (Claims, error) {
+	if len(tok.Headers) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if typ, _ := tok.Headers[0].ExtraHeaders[jose.HeaderType].(string); !strings.EqualFold(typ, c.expect.typ()) {
+		return nil, ErrInvalidToken
+	}
+	key, ok := c.keys[tok.Headers[0].KeyID]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	var verifyKey interface{} = key.Key
+	if _, symmetric := key.Key.([]byte); !symmetric {
+		verifyKey = key.Public()
+	}
+
+	claims := Claims{}
+	if err := tok.Claims(verifyKey, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := c.expect.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// JWKS returns the public halves of the asymmetric keys known to the codec,
+// suitable for serving from a jwks_uri. Shared HMAC secrets are never included.
+func (c *SignedCodec) JWKS() jose.JSONWebKeySet {
+	var set jose.JSONWebKeySet
+	for _, k := range c.keys {
+		if _, symmetric := k.Key.([]byte); symmetric {
+			continue
+		}
+		set.Keys = append(set.Keys, k.Public())
+	}
+	return set
+}
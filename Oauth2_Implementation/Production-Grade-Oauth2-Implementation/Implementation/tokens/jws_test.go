@@ -0,0 +1,107 @@
+package tokens
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+func testRotatingCodec(t *testing.T) *RotatingCodec {
+	t.Helper()
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewRotatingCodec(func() (jose.JSONWebKey, error) { return SigningKey(sk) },
+		Expectations{Issuer: "https://as.example", Type: TypeAccessToken}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+func TestDecodeRequiresType(t *testing.T) {
+	codec := testRotatingCodec(t)
+	claims := Claims{"sub": "u1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	access, err := codec.Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode(access); err != nil {
+		t.Fatalf("Decode(access token) = %v", err)
+	}
+	for _, typ := range []string{TypeJWT, TypeAuthorizationResponse} {
+		raw, err := codec.Sign(typ, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := codec.Decode(raw); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Decode(%s token) = %v, want ErrInvalidToken", typ, err)
+		}
+	}
+}
+
+func TestAudience(t *testing.T) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := SigningKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := func(aud ...string) *SignedCodec {
+		c, err := NewSignedCodec(key, Expectations{Issuer: "https://as.example", Audience: aud, Type: TypeAccessToken})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	api, billing, unchecked := codec("https://api.example"), codec("https://billing.example", "https://api.example"), codec()
+	claims := Claims{"sub": "u1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	raw, err := api.Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := api.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["aud"] != "https://api.example" {
+		t.Errorf("aud %v", got["aud"])
+	}
+	if _, err := billing.Decode(raw); err != nil {
+		t.Errorf("one of several audiences: %v", err)
+	}
+
+	// Tokens without our audience, or for another one, are refused
+	unstamped, err := unchecked.Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := codec("https://other.example").Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, raw := range map[string]string{"no aud": unstamped, "other aud": other} {
+		if _, err := api.Decode(raw); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	// An aud set by the caller, as on ID tokens, is kept
+	raw, err = api.Encode(Claims{"sub": "u1", "aud": "client-1", "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := unchecked.Decode(raw); err != nil || got["aud"] != "client-1" {
+		t.Errorf("caller's aud: %v, %v", got["aud"], err)
+	}
+}
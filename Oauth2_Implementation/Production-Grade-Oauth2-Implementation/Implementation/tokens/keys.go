@@ -0,0 +1,159 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// LoadPrivateKey reads a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// ParsePrivateKeyPEM parses the first private key block found in data.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("tokens: no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("tokens: unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("tokens: unsupported PEM block %q", block.Type)
+}
+
+// HMACKey wraps a shared secret as an HS256 signing key. RFC 7518 requires
+// the secret to be at least as long as the hash output.
+func HMACKey(secret []byte) (jose.JSONWebKey, error) {
+	if len(secret) < sha256.Size {
+		return jose.JSONWebKey{}, fmt.Errorf("tokens: HS256 secret must be at least %d bytes", sha256.Size)
+	}
+	sum := sha256.Sum256(secret)
+	return jose.JSONWebKey{
+		Key:       secret,
+		KeyID:     base64.RawURLEncoding.EncodeToString(sum[:8]),
+		Algorithm: string(jose.HS256),
+		Use:       "sig",
+	}, nil
+}
+
+// SigningKey wraps an asymmetric private key, picking the JWS algorithm from
+// the key type and deriving the key ID from its RFC 7638 thumbprint.
+func SigningKey(key crypto.Signer) (jose.JSONWebKey, error) {
+	var alg jose.SignatureAlgorithm
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		alg = jose.RS256
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			alg = jose.ES256
+		case elliptic.P384():
+			alg = jose.ES384
+		case elliptic.P521():
+			alg = jose.ES512
+		default:
+			return jose.JSONWebKey{}, errors.New("tokens: unsupported EC curve")
+		}
+	case ed25519.PrivateKey:
+		alg = jose.EdDSA
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("tokens: unsupported signing key type %T", key)
+	}
+	return withThumbprint(jose.JSONWebKey{Key: key, Algorithm: string(alg), Use: "sig"})
+}
+
+// EncryptionKey wraps an RSA or EC private key for JWE key management. An
+// empty alg selects RSA-OAEP-256 for RSA keys and ECDH-ES for EC keys.
+func EncryptionKey(key crypto.Signer, alg string) (jose.JSONWebKey, error) {
+	alg, err := encryptionAlg(key.Public(), alg)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	return withThumbprint(jose.JSONWebKey{Key: key, Algorithm: alg, Use: "enc"})
+}
+
+// ParseEncryptionJWK reads the public RSA or EC key, as a JWK, that a party
+// wants tokens encrypted to. Its alg defaults like that of EncryptionKey.
+func ParseEncryptionJWK(data []byte) (jose.JSONWebKey, error) {
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(data); err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("tokens: parsing JWK: %w", err)
+	}
+	if !jwk.IsPublic() {
+		return jose.JSONWebKey{}, errors.New("tokens: encryption JWK must be a public key")
+	}
+	if jwk.Use != "" && jwk.Use != "enc" {
+		return jose.JSONWebKey{}, fmt.Errorf("tokens: JWK with use %q cannot encrypt", jwk.Use)
+	}
+	alg, err := encryptionAlg(jwk.Key, jwk.Algorithm)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	jwk.Algorithm = alg
+	if jwk.KeyID == "" {
+		return withThumbprint(jwk)
+	}
+	return jwk, nil
+}
+
+// encryptionAlg checks alg against the type of the public key pub.
+func encryptionAlg(pub crypto.PublicKey, alg string) (string, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		switch jose.KeyAlgorithm(alg) {
+		case "":
+			alg = string(jose.RSA_OAEP_256)
+		case jose.RSA_OAEP, jose.RSA_OAEP_256:
+		default:
+			return "", fmt.Errorf("tokens: %s cannot be used with an RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		switch jose.KeyAlgorithm(alg) {
+		case "":
+			alg = string(jose.ECDH_ES)
+		case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		default:
+			return "", fmt.Errorf("tokens: %s cannot be used with an EC key", alg)
+		}
+	default:
+		return "", fmt.Errorf("tokens: unsupported encryption key type %T", pub)
+	}
+	return alg, nil
+}
+
+func withThumbprint(jwk jose.JSONWebKey) (jose.JSONWebKey, error) {
+	public := jwk.Public()
+	thumb, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumb)
+	return jwk, nil
+}
@@ -0,0 +1,123 @@
+package tokens
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// ErrKeyUnchanged is returned by Rotate when the key source still yields the
+// current signing key.
+var ErrKeyUnchanged = errors.New("tokens: signing key unchanged")
+
+// maxRetiredKeys is how many previous signing keys stay valid for
+// verification after rotations.
+const maxRetiredKeys = 3
+
+// RotatingCodec signs with a key that can be replaced while serving. Keys it
+// signed with before stay valid for verification, so tokens issued before a
+// rotation keep working until they expire.
+type RotatingCodec struct {
+	load   func() (jose.JSONWebKey, error)
+	expect Expectations
+	wrap   func(*SignedCodec) (Codec, error)
+
+	mu      sync.Mutex // serializes Rotate
+	retired []jose.JSONWebKey
+	current atomic.Pointer[rotation]
+}
+
+type rotation struct {
+	key    jose.JSONWebKey
+	signed *SignedCodec
+	codec  Codec
+}
+
+// NewRotatingCodec signs with the key load returns now and after every
+// Rotate. wrap, if set, wraps each signed codec, e.g. with
+// NewEncryptedCodec.
+func NewRotatingCodec(load func() (jose.JSONWebKey, error), expect Expectations, wrap func(*SignedCodec) (Codec, error)) (*RotatingCodec, error) {
+	c := &RotatingCodec{load: load, expect: expect, wrap: wrap}
+	key, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.use(key); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *RotatingCodec) Encode(claims Claims) (string, error) {
+	return c.current.Load().codec.Encode(claims)
+}
+
+func (c *RotatingCodec) Decode(raw string) (Claims, error) {
+	return c.current.Load().codec.Decode(raw)
+}
+
+// Sign signs claims as a typ token with the current key, skipping the
+// encryption Encode may add. It is for tokens that go to clients rather
+// than resource servers, such as ID tokens, which clients verify against
+// the JWKS. Decode only takes them if typ is the expected type.
+func (c *RotatingCodec) Sign(typ string, claims Claims) (string, error) {
+	return c.current.Load().signed.SignAs(typ, claims)
+}
+
+// Algorithm is the JWS algorithm of the current signing key.
+func (c *RotatingCodec) Algorithm() jose.SignatureAlgorithm {
+	return jose.SignatureAlgorithm(c.current.Load().key.Algorithm)
+}
+
+// KeyID is the kid of the current signing key.
+func (c *RotatingCodec) KeyID() string {
+	return c.current.Load().key.KeyID
+}
+
+// JWKS returns the public halves of the current and retired asymmetric keys.
+func (c *RotatingCodec) JWKS() jose.JSONWebKeySet {
+	return c.current.Load().signed.JWKS()
+}
+
+// Rotate loads the signing key again and signs with it from now on. The
+// previous key is kept for verification. It returns the new key ID, or
+// ErrKeyUnchanged if the source still has the current key.
+func (c *RotatingCodec) Rotate() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, err := c.load()
+	if err != nil {
+		return "", err
+	}
+	prev := c.current.Load().key
+	if key.KeyID == prev.KeyID {
+		return "", ErrKeyUnchanged
+	}
+	retired := append([]jose.JSONWebKey{prev}, c.retired...)
+	if len(retired) > maxRetiredKeys {
+		retired = retired[:maxRetiredKeys]
+	}
+	c.retired = retired
+	if err := c.use(key); err != nil {
+		return "", err
+	}
+	return key.KeyID, nil
+}
+
+// use switches to signing with key.
+func (c *RotatingCodec) use(key jose.JSONWebKey) error {
+	signed, err := NewSignedCodec(key, c.expect, c.retired...)
+	if err != nil {
+		return err
+	}
+	var codec Codec = signed
+	if c.wrap != nil {
+		if codec, err = c.wrap(signed); err != nil {
+			return err
+		}
+	}
+	c.current.Store(&rotation{key: key, signed: signed, codec: codec})
+	return nil
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+const instrumentationName = "oauth2-implementation/tracing"
+
+var _ state.Store = (*tracedState)(nil)
+
+// InstrumentState wraps every operation of kv in a client span named after
+// it (state.Get, state.SetNX, ...). Keys hold tokens and login states, so
+// only their prefix is recorded. state.ErrNotFound is recorded as a miss,
+// not as an error.
+func InstrumentState(kv state.Store, tp trace.TracerProvider) state.Store {
+	return &tracedState{inner: kv, tracer: tp.Tracer(instrumentationName)}
+}
+
+type tracedState struct {
+	inner  state.Store
+	tracer trace.Tracer
+}
+
+func (s *tracedState) start(ctx context.Context, op string, keys ...string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("db.operation.name", op)}
+	if len(keys) > 0 {
+		attrs = append(attrs, attribute.String("state.key_prefix", keyPrefix(keys[0])))
+	}
+	return s.tracer.Start(ctx, "state."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func end(span trace.Span, err error) {
+	switch {
+	case errors.Is(err, state.ErrNotFound):
+		span.SetAttributes(attribute.Bool("state.hit", false))
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// keyPrefix returns the namespace of key, e.g. "loginstate:state:" for a login state.
+func keyPrefix(key string) string {
+	if i := strings.LastIndexByte(key, ':'); i >= 0 {
+		return key[:i+1]
+	}
+	return ""
+}
+
+func (s *tracedState) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, span := s.start(ctx, "Set", key)
+	err := s.inner.Set(ctx, key, value, ttl)
+	end(span, err)
+	return err
+}
+
+func (s *tracedState) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ctx, span := s.start(ctx, "SetNX", key)
+	ok, err := s.inner.SetNX(ctx, key, value, ttl)
+	span.SetAttributes(attribute.Bool("state.set", ok))
+	end(span, err)
+	return ok, err
+}
+
+func (s *tracedState) Get(ctx context.Context, key string) ([]byte, error) {
+	ctx, span := s.start(ctx, "Get", key)
+	v, err := s.inner.Get(ctx, key)
+	end(span, err)
+	return v, err
+}
+
+func (s *tracedState) GetDel(ctx context.Context, key string) ([]byte, error) {
+	ctx, span := s.start(ctx, "GetDel", key)
+	v, err := s.inner.GetDel(ctx, key)
+	end(span, err)
+	return v, err
+}
+
+func (s *tracedState) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, span := s.start(ctx, "Exists", key)
+	ok, err := s.inner.Exists(ctx, key)
+	span.SetAttributes(attribute.Bool("state.hit", ok))
+	end(span, err)
+	return ok, err
+}
+
+func (s *tracedState) Del(ctx context.Context, keys ...string) error {
+	ctx, span := s.start(ctx, "Del", keys...)
+	err := s.inner.Del(ctx, keys...)
+	end(span, err)
+	return err
+}
+
+func (s *tracedState) Close() error {
+	return s.inner.Close()
+}
@@ -0,0 +1,125 @@
+// Package tracing sets up OpenTelemetry for the authorization server: the
+// exporter chosen by configuration, W3C trace context propagation, and spans
+// around the state store. HTTP handlers and outbound calls are instrumented
+// with otelhttp where they are created.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters accepted in Options.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Options select where spans go.
+type Options struct {
+	// Exporter is one of the Exporter constants; empty means none.
+	Exporter string
+
+	// Endpoint is the OTLP/HTTP collector as host:port. Empty falls back to
+	// OTEL_EXPORTER_OTLP_ENDPOINT and then localhost:4318. Insecure sends
+	// the spans without TLS.
+	Endpoint string
+	Insecure bool
+
+	// File receives one JSON document per span with the file exporter. It is
+	// appended to, so spans of several runs can be compared offline.
+	File string
+
+	ServiceName string
+
+	// SampleRatio is the share of new traces that are recorded. Requests
+	// carrying a traceparent follow the caller's decision.
+	SampleRatio float64
+}
+
+// Provider is the installed tracer provider.
+type Provider struct {
+	*sdktrace.TracerProvider
+	out io.Closer
+}
+
+// Setup creates the exporter and installs the provider and the W3C trace
+// context and baggage propagators as the otel globals. With no exporter the
+// propagators are still installed, so trace context is passed on unchanged.
+// Shutdown flushes the spans still buffered.
+func Setup(ctx context.Context, opts Options) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	p := &Provider{}
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", ExporterNone:
+	case ExporterOTLP:
+		var httpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, httpOpts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			break
+		}
+		p.out = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		if p.out != nil {
+			p.out.Close()
+		}
+		return nil, fmt.Errorf("tracing: %s exporter: %w", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	}
+	if exporter != nil {
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+	p.TracerProvider = sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(p.TracerProvider)
+	return p, nil
+}
+
+// Shutdown exports the remaining spans and closes the output file.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	err := p.TracerProvider.Shutdown(ctx)
+	if p.out != nil {
+		err = errors.Join(err, p.out.Close())
+	}
+	return err
+}
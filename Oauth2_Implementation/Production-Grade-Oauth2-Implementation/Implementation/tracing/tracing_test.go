@@ -0,0 +1,191 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+func attr(s sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+type downStore struct{ state.Store }
+
+func (downStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestInstrumentState(t *testing.T) {
+	ctx := context.Background()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	kv := memory.New()
+	defer kv.Close()
+	s := InstrumentState(downStore{kv}, tp)
+
+	kv.Set(ctx, "loginstate:state:opaque-state", []byte("v"), time.Minute)
+	s.Get(ctx, "loginstate:state:opaque-state")
+	s.GetDel(ctx, "token:secret-token-value")
+	s.Set(ctx, "revoked:jti", []byte("1"), time.Minute)
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("%d spans, want 3", len(spans))
+	}
+	for i, want := range []struct {
+		name, prefix string
+		hit          bool // state.hit=false recorded
+		status       codes.Code
+	}{
+		{"state.Get", "loginstate:state:", false, codes.Unset},
+		{"state.GetDel", "token:", true, codes.Unset},
+		{"state.Set", "revoked:", false, codes.Error},
+	} {
+		span := spans[i]
+		if span.Name() != want.name || span.SpanKind() != trace.SpanKindClient {
+			t.Errorf("span %d: %s (%s), want client span %s", i, span.Name(), span.SpanKind(), want.name)
+		}
+		if v, _ := attr(span, "state.key_prefix"); v.AsString() != want.prefix {
+			t.Errorf("%s: key prefix %q, want %q", want.name, v.AsString(), want.prefix)
+		}
+		// A miss is not an error
+		if v, ok := attr(span, "state.hit"); ok != want.hit || (ok && v.AsBool()) {
+			t.Errorf("%s: state.hit %v (recorded %v)", want.name, v.AsBool(), ok)
+		}
+		if span.Status().Code != want.status {
+			t.Errorf("%s: status %v, want %v", want.name, span.Status(), want.status)
+		}
+		// Keys hold tokens; only their prefix may leave the process
+		for _, kv := range span.Attributes() {
+			if strings.Contains(kv.Value.Emit(), "secret-token-value") || strings.Contains(kv.Value.Emit(), "opaque-state") {
+				t.Errorf("%s: key recorded in %s", want.name, kv.Key)
+			}
+		}
+	}
+}
+
+// TestHandlerSpans checks the wiring the server relies on: Setup's
+// propagator continues the caller's trace in the handler span, and the
+// state store spans of the request are its children.
+func TestHandlerSpans(t *testing.T) {
+	ctx := context.Background()
+	p, err := Setup(ctx, Options{ServiceName: "oauth-test", SampleRatio: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(ctx)
+	rec := tracetest.NewSpanRecorder()
+	p.RegisterSpanProcessor(rec)
+
+	kv := memory.New()
+	defer kv.Close()
+	traced := InstrumentState(kv, p)
+	h := otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traced.Exists(r.Context(), "session:id")
+	}), "/callback", otelhttp.WithTracerProvider(p))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	// Sampled by the caller although the ratio is 0
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans, want the handler and the state span", len(spans))
+	}
+	stateSpan, handler := spans[0], spans[1]
+	if handler.Name() != "/callback" || handler.SpanKind() != trace.SpanKindServer {
+		t.Errorf("handler span %s (%s)", handler.Name(), handler.SpanKind())
+	}
+	if handler.SpanContext().TraceID().String() != traceID || handler.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("handler span did not continue the caller's trace: %s", handler.SpanContext().TraceID())
+	}
+	if stateSpan.Name() != "state.Exists" || stateSpan.Parent().SpanID() != handler.SpanContext().SpanID() {
+		t.Errorf("state span %s is not a child of the handler span", stateSpan.Name())
+	}
+	if v, _ := attr(stateSpan, "state.hit"); v.AsBool() {
+		t.Error("state.hit for a missing key")
+	}
+	if res := handler.Resource(); !res.Set().HasValue("service.name") {
+		t.Errorf("resource %v has no service name", res)
+	} else if v, _ := res.Set().Value("service.name"); v.AsString() != "oauth-test" {
+		t.Errorf("service.name %q", v.AsString())
+	}
+
+	// Without a caller's decision the ratio applies
+	rec.Reset()
+	resp, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := len(rec.Ended()); n != 0 {
+		t.Errorf("%d spans recorded at ratio 0", n)
+	}
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "spans.json")
+	p, err := Setup(ctx, Options{Exporter: ExporterFile, File: file, ServiceName: "oauth-test", SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := p.Tracer("test").Start(ctx, "login")
+	span.End()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported struct{ Name string }
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&exported); err != nil || exported.Name != "login" {
+		t.Errorf("file holds %q: %v", b, err)
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, opts := range []Options{
+		{Exporter: "zipkin"},
+		{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "missing", "spans.json")},
+	} {
+		if _, err := Setup(ctx, opts); err == nil || !strings.HasPrefix(err.Error(), "tracing:") {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+}
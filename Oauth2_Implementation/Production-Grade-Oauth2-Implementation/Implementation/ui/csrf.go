@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+)
+
+// CSRFCookieName is the cookie holding the browser's CSRF secret.
+const CSRFCookieName = "oauth_csrf"
+
+// CSRFField is the form field that carries the token.
+const CSRFField = "csrf_token"
+
+var ErrCSRF = errors.New("ui: CSRF token missing or invalid")
+
+// csrf implements signed double-submit tokens: the browser holds a random
+// secret in a cookie, and forms carry an HMAC of it. Another site can make
+// the browser send the cookie but cannot read it, so it cannot produce the
+// token.
+type csrf struct {
+	key    []byte
+	secure bool
+}
+
+func newCSRF(key []byte, secure bool) csrf {
+	// Derive a key of our own, so the one passed in can be shared with
+	// other cookie signing without the tokens being interchangeable
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("csrf"))
+	return csrf{key: mac.Sum(nil), secure: secure}
+}
+
+// token returns the form token for the browser of r, setting the secret
+// cookie first if there is none.
+func (c csrf) token(w http.ResponseWriter, r *http.Request) (string, error) {
+	secret := ""
+	if ck, err := r.Cookie(CSRFCookieName); err == nil && ck.Value != "" {
+		secret = ck.Value
+	} else {
+		var err error
+		if secret, err = cryptoutil.Token(32); err != nil {
+			return "", err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     CSRFCookieName,
+			Value:    secret,
+			Path:     "/",
+			Secure:   c.secure,
+			HttpOnly: true,
+			// Lax: pages such as consent are reached by a redirect from
+			// the identity provider, and the form on them must see the
+			// same secret the page was rendered with
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return base64.RawURLEncoding.EncodeToString(c.mac(secret)), nil
+}
+
+// check compares the token posted in the form with the cookie.
+func (c csrf) check(r *http.Request) error {
+	ck, err := r.Cookie(CSRFCookieName)
+	if err != nil || ck.Value == "" {
+		return ErrCSRF
+	}
+	token, err := base64.RawURLEncoding.DecodeString(r.PostFormValue(CSRFField))
+	if err != nil || !hmac.Equal(token, c.mac(ck.Value)) {
+		return ErrCSRF
+	}
+	return nil
+}
+
+func (c csrf) mac(secret string) []byte {
+	m := hmac.New(sha256.New, c.key)
+	m.Write([]byte(secret))
+	return m.Sum(nil)
+}
@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// catalog maps message keys to the text of one language. Keys are dotted,
+// e.g. consent.allow; scope descriptions are scope.<name> and error texts
+// error.<code>.
+type catalog map[string]string
+
+// locale is one language the pages can be shown in.
+type locale struct {
+	tag      language.Tag
+	messages catalog
+	fallback *locale
+}
+
+// text returns the message for key, from the fallback language if this one
+// lacks it, and ok false if neither has it.
+func (l *locale) text(key string) (string, bool) {
+	for ; l != nil; l = l.fallback {
+		if msg, ok := l.messages[key]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// locales are the languages of the UI and how to choose between them.
+type locales struct {
+	byTag   []*locale
+	matcher language.Matcher
+}
+
+// loadLocales reads the built-in catalogs and then dir, whose <tag>.json
+// files add languages or override messages of built-in ones. The default
+// language comes first and is the fallback of all others.
+func loadLocales(dir, defaultLang string) (*locales, error) {
+	if defaultLang == "" {
+		defaultLang = "en"
+	}
+	catalogs := make(map[string]catalog)
+	var order []string
+	add := func(fsys fs.FS, name string) error {
+		tag, err := language.Parse(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return fmt.Errorf("ui: locale file %s: %w", name, err)
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("ui: %w", err)
+		}
+		var c catalog
+		if err := json.Unmarshal(b, &c); err != nil {
+			return fmt.Errorf("ui: locale file %s: %w", name, err)
+		}
+		key := tag.String()
+		if catalogs[key] == nil {
+			catalogs[key] = make(catalog)
+			order = append(order, key)
+		}
+		for k, v := range c {
+			catalogs[key][k] = v
+		}
+		return nil
+	}
+
+	builtinLocales, err := fs.Sub(builtin, "locales")
+	if err != nil {
+		return nil, err
+	}
+	sources := []fs.FS{builtinLocales}
+	if dir != "" {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("ui: locales directory %s not found", dir)
+		}
+		sources = append(sources, os.DirFS(dir))
+	}
+	for _, fsys := range sources {
+		names, err := fs.Glob(fsys, "*.json")
+		if err != nil {
+			return nil, fmt.Errorf("ui: %w", err)
+		}
+		for _, name := range names {
+			if err := add(fsys, path.Base(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	def, err := language.Parse(defaultLang)
+	if err != nil {
+		return nil, fmt.Errorf("ui: default locale: %w", err)
+	}
+	if catalogs[def.String()] == nil {
+		return nil, fmt.Errorf("ui: no messages for the default locale %s", def)
+	}
+	first := &locale{tag: def, messages: catalogs[def.String()]}
+	ls := &locales{byTag: []*locale{first}}
+	for _, key := range order {
+		if key == def.String() {
+			continue
+		}
+		ls.byTag = append(ls.byTag, &locale{tag: language.MustParse(key), messages: catalogs[key], fallback: first})
+	}
+	tags := make([]language.Tag, len(ls.byTag))
+	for i, l := range ls.byTag {
+		tags[i] = l.tag
+	}
+	ls.matcher = language.NewMatcher(tags)
+	return ls, nil
+}
+
+// negotiate picks the language for r. The OpenID Connect ui_locales of the
+// login, or of the request itself, win over the browser's Accept-Language;
+// without a match the default language is used.
+func (ls *locales) negotiate(r *http.Request, uiLocales string) *locale {
+	if uiLocales == "" {
+		uiLocales = r.URL.Query().Get("ui_locales")
+	}
+	var requested []language.Tag
+	for _, s := range strings.Fields(uiLocales) {
+		if tag, err := language.Parse(s); err == nil {
+			requested = append(requested, tag)
+		}
+	}
+	if l := ls.match(requested); l != nil {
+		return l
+	}
+	accepted, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if l := ls.match(accepted); l != nil {
+		return l
+	}
+	return ls.byTag[0]
+}
+
+func (ls *locales) match(prefs []language.Tag) *locale {
+	if len(prefs) == 0 {
+		return nil
+	}
+	_, i, confidence := ls.matcher.Match(prefs...)
+	if confidence == language.No {
+		return nil
+	}
+	return ls.byTag[i]
+}
@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	u, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, acceptLanguage, query, uiLocales string
+		lang, title                            string
+	}{
+		{"no preference", "", "", "", "en", "Sign in"},
+		{"exact", "de", "", "", "de", "Anmelden"},
+		{"region", "es-MX,es;q=0.9", "", "", "es", "Iniciar sesión"},
+		{"quality order", "de;q=0.3, fr;q=0.8, en;q=0.5", "", "", "fr", "Connexion"},
+		{"unavailable first choice", "ja, de;q=0.5", "", "", "de", "Anmelden"},
+		{"nothing available", "ja, zh-CN;q=0.8", "", "", "en", "Sign in"},
+		{"malformed header", "de;q=oops,,;", "", "", "en", "Sign in"},
+		{"wildcard", "*", "", "", "en", "Sign in"},
+		{"ui_locales of the login", "de", "", "fr es", "fr", "Connexion"},
+		{"ui_locales on the request", "de", "es", "", "es", "Iniciar sesión"},
+		{"unavailable ui_locales", "de", "", "ja", "de", "Anmelden"},
+		{"malformed ui_locales", "fr", "", "not_a_tag!", "fr", "Connexion"},
+	} {
+		target := "/"
+		if tt.query != "" {
+			target += "?ui_locales=" + tt.query
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if tt.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		u.Render(rec, req, http.StatusOK, PageLogin, &LoginPage{Page: Page{UILocales: tt.uiLocales}, LoginURL: "/login"})
+
+		if got := rec.Header().Get("Content-Language"); got != tt.lang {
+			t.Errorf("%s: Content-Language %q, want %q", tt.name, got, tt.lang)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, `<html lang="`+tt.lang+`">`) || !strings.Contains(body, tt.title) {
+			t.Errorf("%s: page not in %s:\n%s", tt.name, tt.lang, body)
+		}
+		if vary := rec.Header().Values("Vary"); !slices.Contains(vary, "Accept-Language") {
+			t.Errorf("%s: Vary %v", tt.name, vary)
+		}
+	}
+}
+
+func TestLocalesDir(t *testing.T) {
+	dir := t.TempDir()
+	// A new language with only some messages, and an override of a
+	// built-in one
+	os.WriteFile(filepath.Join(dir, "it.json"), []byte(`{"login.title": "Accedi"}`), 0o600)
+	os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"login.title": "Einloggen"}`), 0o600)
+	ls, err := loadLocales(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		acceptLanguage, key, want string
+	}{
+		{"it", "login.title", "Accedi"},
+		{"it", "login.button", "Log in with Google"}, // from the default language
+		{"de", "login.title", "Einloggen"},
+		{"de", "login.button", "Mit Google anmelden"}, // the rest of the built-in catalog stays
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", tt.acceptLanguage)
+		p := &Page{locale: ls.negotiate(req, "")}
+		if got := p.T(tt.key); got != tt.want {
+			t.Errorf("%s %s = %q, want %q", tt.acceptLanguage, tt.key, got, tt.want)
+		}
+	}
+	p := &Page{locale: ls.byTag[0]}
+	if got := p.T("no.such.key"); got != "no.such.key" {
+		t.Errorf("missing message shown as %q", got)
+	}
+}
+
+func TestDefaultLocale(t *testing.T) {
+	ls, err := loadLocales("", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "ja")
+	if l := ls.negotiate(req, ""); l.tag.String() != "fr" {
+		t.Errorf("fallback to %s, want fr", l.tag)
+	}
+}
+
+func TestLoadLocalesErrors(t *testing.T) {
+	badName, badJSON := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(badName, "not_a_tag!.json"), []byte(`{}`), 0o600)
+	os.WriteFile(filepath.Join(badJSON, "it.json"), []byte(`{"login.title": `), 0o600)
+	for _, tt := range []struct {
+		name, dir, defaultLang string
+	}{
+		{"missing directory", filepath.Join(badName, "missing"), ""},
+		{"file name not a language", badName, ""},
+		{"malformed catalog", badJSON, ""},
+		{"malformed default", "", "not_a_tag!"},
+		{"default without messages", "", "ja"},
+	} {
+		if _, err := loadLocales(tt.dir, tt.defaultLang); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// Posts the authorization response on the form_post page back to the client.
+document.forms[0].submit();
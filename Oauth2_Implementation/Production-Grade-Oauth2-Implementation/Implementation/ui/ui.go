@@ -0,0 +1,357 @@
+// Package ui renders the pages users see: login, consent, error, device and
+// the form_post page that carries authorization responses.
+// Pages are html/template files embedded in the binary; a theme directory
+// can replace any of them, and the stylesheet, without a rebuild. Every page
+// gets the security headers and, where it has a form, a CSRF token.
+//
+// The pages take their texts from message catalogs, one JSON file per
+// language (locales/en.json, ...), and are shown in the language asked for
+// with ui_locales or else Accept-Language. More languages, or other
+// wording, are dropped into a locales directory as <tag>.json.
+package ui
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/oautherr"
+)
+
+//go:embed templates static locales
+var builtin embed.FS
+
+// Page names, which are also the template file names without .html.
+const (
+	PageLogin   = "login"
+	PageConsent = "consent"
+	PageError   = "error"
+	PageDevice  = "device"
+	// PageFormPost posts an authorization response to the client
+	// (response_mode=form_post); it is rendered by FormPost.
+	PageFormPost = "form_post"
+)
+
+// StylePath and ScriptPath are where the server serves the stylesheet and
+// the script that submits the form_post page.
+const (
+	StylePath  = "/ui/style.css"
+	ScriptPath = "/ui/form_post.js"
+)
+
+// Options configure the UI. The zero value uses the built-in theme and a
+// random CSRF key, which does not survive a restart or work across replicas.
+type Options struct {
+	// ThemeDir may contain layout.html, login.html, consent.html,
+	// error.html, device.html, form_post.html, style.css and form_post.js;
+	// missing files fall back to the built-in ones.
+	ThemeDir string
+	// ProductName is shown in titles and headings. Defaults to "OAuth2 Server".
+	ProductName string
+	// CSRFKey signs CSRF tokens (at least 32 bytes).
+	CSRFKey []byte
+	// SecureCookies marks the CSRF cookie Secure.
+	SecureCookies bool
+	// HSTSMaxAge enables Strict-Transport-Security; zero leaves it off.
+	HSTSMaxAge time.Duration
+	// LocalesDir may contain <tag>.json message catalogs, e.g. pt-BR.json,
+	// that add languages or override messages of the built-in ones.
+	LocalesDir string
+	// DefaultLocale is used when no requested language is available, and
+	// fills in messages other languages lack. Defaults to en.
+	DefaultLocale string
+}
+
+// UI holds the parsed pages.
+type UI struct {
+	pages       map[string]*template.Template
+	style       []byte
+	script      []byte
+	productName string
+	csrf        csrf
+	hstsMaxAge  time.Duration
+	locales     *locales
+}
+
+// Page is the part of the data every page has. The UI fills it in, except
+// for FormTargets and UILocales.
+type Page struct {
+	ProductName string
+	StyleURL    string
+	CSRFToken   string
+	// Lang is the negotiated language, for the lang attribute.
+	Lang string
+	// UILocales are the languages the client asked for at /authorize,
+	// space separated; they win over Accept-Language.
+	UILocales string
+	// FormTargets are the origins a form on the page may end up at after
+	// redirects, e.g. the identity provider or the client. They are added
+	// to the form-action of the Content-Security-Policy.
+	FormTargets []string
+
+	locale *locale
+	// script allows the page our script, see ScriptPath
+	script bool
+}
+
+func (p *Page) page() *Page { return p }
+
+// T returns the message for key in the page's language, formatted with args
+// if there are any. Missing messages show their key.
+func (p *Page) T(key string, args ...interface{}) string {
+	msg, ok := p.locale.text(key)
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Scope describes an OAuth scope for the consent page; scopes without a
+// scope.<name> message are shown as they are.
+func (p *Page) Scope(name string) string {
+	if msg, ok := p.locale.text("scope." + name); ok {
+		return msg
+	}
+	return name
+}
+
+// view is implemented by every page type through the embedded Page.
+type view interface {
+	page() *Page
+}
+
+// LoginPage is the start page.
+type LoginPage struct {
+	Page
+	LoginURL string
+}
+
+// ConsentPage asks the user to let a client act on their behalf.
+type ConsentPage struct {
+	Page
+	ClientName string
+	ClientID   string
+	Scopes     []string
+	ConsentID  string
+}
+
+// ErrorPage explains a failure that cannot be sent to a client.
+type ErrorPage struct {
+	Page
+	Code        string
+	Description string
+}
+
+// Explanation describes Code in the page's language, with error.<code> or
+// else the generic error.other.
+func (p *ErrorPage) Explanation() string {
+	if msg, ok := p.locale.text("error." + p.Code); ok {
+		return msg
+	}
+	return p.T("error.other")
+}
+
+// DevicePage is where users enter the code shown on their device. Message
+// is the key of a message to show above the form.
+type DevicePage struct {
+	Page
+	UserCode string
+	Message  string
+	Done     bool
+}
+
+// FormPostPage carries an authorization response to the client in a form
+// that submits itself (OAuth 2.0 Form Post Response Mode).
+type FormPostPage struct {
+	Page
+	// Action is left to html/template to escape, which replaces a URI with
+	// an unsafe scheme such as javascript: should one ever get registered.
+	Action    string
+	Fields    []FormField
+	ScriptURL string
+}
+
+// FormField is a hidden field of FormPostPage.
+type FormField struct {
+	Name, Value string
+}
+
+// New parses the pages and loads the stylesheet.
+func New(opts Options) (*UI, error) {
+	u := &UI{pages: make(map[string]*template.Template), productName: opts.ProductName, hstsMaxAge: opts.HSTSMaxAge}
+	if u.productName == "" {
+		u.productName = "OAuth2 Server"
+	}
+	key := opts.CSRFKey
+	if key == nil {
+		var err error
+		if key, err = cryptoutil.Bytes(32); err != nil {
+			return nil, fmt.Errorf("ui: %w", err)
+		}
+	}
+	if len(key) < 32 {
+		return nil, errors.New("ui: CSRF key must be at least 32 bytes")
+	}
+	u.csrf = newCSRF(key, opts.SecureCookies)
+	locales, err := loadLocales(opts.LocalesDir, opts.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	u.locales = locales
+	if opts.ThemeDir != "" {
+		// A typo would otherwise silently fall back to the built-in theme
+		if fi, err := os.Stat(opts.ThemeDir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("ui: theme directory %s not found", opts.ThemeDir)
+		}
+	}
+
+	read := func(name string) ([]byte, error) {
+		if opts.ThemeDir != "" {
+			b, err := os.ReadFile(filepath.Join(opts.ThemeDir, filepath.Base(name)))
+			if err == nil {
+				return b, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("ui: %w", err)
+			}
+		}
+		return builtin.ReadFile(name)
+	}
+	layout, err := read("templates/layout.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{PageLogin, PageConsent, PageError, PageDevice, PageFormPost} {
+		content, err := read("templates/" + name + ".html")
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.New(name).Parse(string(layout))
+		if err == nil {
+			_, err = t.Parse(string(content))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ui: %s: %w", name, err)
+		}
+		u.pages[name] = t
+	}
+	if u.style, err = read("static/style.css"); err != nil {
+		return nil, err
+	}
+	if u.script, err = read("static/form_post.js"); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Render writes page name with data and status, in the language negotiated
+// for r. A CSRF token is issued for every page, so any form on it can be
+// posted back.
+func (u *UI) Render(w http.ResponseWriter, r *http.Request, status int, name string, data view) {
+	p := data.page()
+	p.ProductName = u.productName
+	// Relative, so the pages keep working under a mount prefix; they all
+	// sit at the top level of the server
+	p.StyleURL = strings.TrimPrefix(StylePath, "/")
+	token, err := u.csrf.token(w, r)
+	if err != nil {
+		log.Printf("ui: rendering %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	p.CSRFToken = token
+	p.locale = u.locales.negotiate(r, p.UILocales)
+	p.Lang = p.locale.tag.String()
+
+	// Render into a buffer so a template error does not leave half a page
+	var buf bytes.Buffer
+	if err := u.pages[name].ExecuteTemplate(&buf, "layout", data); err != nil {
+		log.Printf("ui: rendering %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Language", p.Lang)
+	h.Add("Vary", "Accept-Language")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Content-Security-Policy", contentSecurityPolicy(p.FormTargets, p.script))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// Error logs err and shows it to the user as an error page, explaining its
+// code in the user's language. Only the code and description of the
+// oautherr.Error are shown.
+func (u *UI) Error(w http.ResponseWriter, r *http.Request, err error) {
+	u.ErrorIn(w, r, "", err)
+}
+
+// ErrorIn is Error for a login that asked for uiLocales.
+func (u *UI) ErrorIn(w http.ResponseWriter, r *http.Request, uiLocales string, err error) {
+	e := oautherr.Log(r, err)
+	if e.Code == oautherr.TemporarilyUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	u.Render(w, r, e.Status(), PageError, &ErrorPage{
+		Page:        Page{UILocales: uiLocales},
+		Code:        string(e.Code),
+		Description: e.Description,
+	})
+}
+
+// FormPost answers with a page that posts params to redirectURI, a
+// registered redirect URI of the client. Browsers without scripts show a
+// button instead.
+func (u *UI) FormPost(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values, uiLocales string) {
+	page := &FormPostPage{
+		Page:      Page{UILocales: uiLocales, FormTargets: []string{Origin(redirectURI)}, script: true},
+		Action:    redirectURI,
+		ScriptURL: strings.TrimPrefix(ScriptPath, "/"),
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range params[name] {
+			page.Fields = append(page.Fields, FormField{Name: name, Value: v})
+		}
+	}
+	u.Render(w, r, http.StatusOK, PageFormPost, page)
+}
+
+// CheckCSRF verifies the CSRF token of a form POST.
+func (u *UI) CheckCSRF(r *http.Request) error {
+	return u.csrf.check(r)
+}
+
+// ServeScript serves the script of the form_post page.
+func (u *UI) ServeScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(u.script)
+}
+
+// ServeStyle serves the stylesheet of the theme.
+func (u *UI) ServeStyle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(u.style)
+}
@@ -0,0 +1,28 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFormPostEscapesAction(t *testing.T) {
+	u, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		redirectURI, action string
+	}{
+		{"https://app.example/cb?a=1&b=2", `action="https://app.example/cb?a=1&amp;b=2"`},
+		{"javascript:alert(document.domain)", `action="#ZgotmplZ"`},
+	} {
+		rec := httptest.NewRecorder()
+		u.FormPost(rec, httptest.NewRequest(http.MethodGet, "/callback", nil), tt.redirectURI, url.Values{"code": {"c"}}, "")
+		if body := rec.Body.String(); !strings.Contains(body, tt.action) {
+			t.Errorf("%s: no %s in\n%s", tt.redirectURI, tt.action, body)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownKEK = errors.New("vault: record sealed with an unknown key-encryption key")
+
+// KeyRing holds the key-encryption keys (KEKs). New records are always sealed
+// with the current KEK; older KEKs are kept only to open existing records until
+// they expire or are re-sealed.
+type KeyRing struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewKeyRing creates a ring whose current KEK is key, a 32 byte AES-256 key.
+func NewKeyRing(id string, key []byte) (*KeyRing, error) {
+	kr := &KeyRing{keys: make(map[string][]byte)}
+	if err := kr.Add(id, key); err != nil {
+		return nil, err
+	}
+	kr.currentID = id
+	return kr, nil
+}
+
+// Add registers a retired KEK that can still open records.
+func (kr *KeyRing) Add(id string, key []byte) error {
+	if id == "" {
+		return errors.New("vault: KEK id must not be empty")
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("vault: KEK %q must be 32 bytes, got %d", id, len(key))
+	}
+	kr.keys[id] = key
+	return nil
+}
+
+// ParseKeyRing builds a ring from base64 encoded keys: current is the active
+// KEK and previous is an optional comma separated list of id=key pairs.
+func ParseKeyRing(id, current, previous string) (*KeyRing, error) {
+	key, err := decodeKey(current)
+	if err != nil {
+		return nil, fmt.Errorf("vault: decoding KEK %q: %w", id, err)
+	}
+	kr, err := NewKeyRing(id, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range strings.Split(previous, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		oldID, encoded, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("vault: previous KEK %q is not in id=key form", pair)
+		}
+		oldKey, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("vault: decoding KEK %q: %w", oldID, err)
+		}
+		if err := kr.Add(oldID, oldKey); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return key, nil
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// envelope is the at-rest form of a record. The payload is encrypted with a
+// fresh data-encryption key (DEK) and only the DEK is encrypted with the KEK,
+// so rotating the KEK never requires touching payloads.
+type envelope struct {
+	KEKID      string `json:"kid"`
+	WrappedDEK []byte `json:"dek"`
+	Ciphertext []byte `json:"ct"`
+}
+
+func (kr *KeyRing) seal(plaintext, aad []byte) (*envelope, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	ciphertext, err := gcmSeal(dek, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := gcmSeal(kr.keys[kr.currentID], dek, []byte(kr.currentID))
+	if err != nil {
+		return nil, err
+	}
+	return &envelope{KEKID: kr.currentID, WrappedDEK: wrapped, Ciphertext: ciphertext}, nil
+}
+
+func (kr *KeyRing) open(env *envelope, aad []byte) ([]byte, error) {
+	kek, ok := kr.keys[env.KEKID]
+	if !ok {
+		return nil, ErrUnknownKEK
+	}
+	dek, err := gcmOpen(kek, env.WrappedDEK, []byte(env.KEKID))
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(dek, env.Ciphertext, aad)
+}
+
+// gcmSeal returns nonce || ciphertext.
+func gcmSeal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, sealed, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("vault: ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
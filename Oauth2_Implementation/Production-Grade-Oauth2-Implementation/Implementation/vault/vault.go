@@ -0,0 +1,194 @@
+// Package vault stores the tokens we receive from the upstream identity
+// provider on the server side, so that they never have to travel inside the
+// tokens we issue. Records are envelope encrypted with AES-GCM before they are
+// written to the state store; callers only ever see an opaque reference ID.
+//
+// Consumers read a record back through TokenSource or Client, as the
+// server's /userinfo endpoint does, and never refresh tokens themselves:
+// Token refreshes an expiring record with the upstream provider, once
+// across replicas, and writes the result back under the same reference.
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/cryptoutil"
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state"
+)
+
+var ErrNotFound = errors.New("vault: no token stored under this reference")
+
+const (
+	// KeyPrefix and LockPrefix name the sealed records and the refresh
+	// locks in the state store. Locks live outside KeyPrefix, so every key
+	// under it is a sealed record.
+	KeyPrefix  = "vault:"
+	LockPrefix = "vault-lock:"
+
+	// refreshSkew refreshes tokens slightly before they expire so a backend
+	// never receives a token that dies in flight.
+	refreshSkew = time.Minute
+	lockTTL     = 10 * time.Second
+)
+
+// Vault keeps upstream oauth2 tokens encrypted at rest and refreshes them on
+// demand with the upstream provider.
+type Vault struct {
+	kv       state.Store
+	keys     *KeyRing
+	upstream *oauth2.Config
+	ttl      time.Duration
+}
+
+// New returns a vault that seals records with keys and refreshes them through
+// upstream. Records live for ttl after they were last written.
+func New(kv state.Store, keys *KeyRing, upstream *oauth2.Config, ttl time.Duration) *Vault {
+	return &Vault{kv: kv, keys: keys, upstream: upstream, ttl: ttl}
+}
+
+// Put stores tok and returns the reference to embed in our own tokens.
+func (v *Vault) Put(ctx context.Context, tok *oauth2.Token) (string, error) {
+	ref, err := cryptoutil.Token(32)
+	if err != nil {
+		return "", err
+	}
+	if err := v.store(ctx, ref, tok); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// Token returns a valid upstream token for ref, refreshing it with the upstream
+// provider and writing the new token back when it is about to expire.
+func (v *Vault) Token(ctx context.Context, ref string) (*oauth2.Token, error) {
+	tok, err := v.load(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !needsRefresh(tok) {
+		return tok, nil
+	}
+	if tok.RefreshToken == "" {
+		return nil, fmt.Errorf("vault: upstream token expired and has no refresh token")
+	}
+
+	// Only one replica refreshes a given record; the others wait for it and
+	// read the result, since most providers rotate refresh tokens on use.
+	locked, err := v.kv.SetNX(ctx, LockPrefix+ref, []byte{1}, lockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return v.waitForRefresh(ctx, ref)
+	}
+	defer v.kv.Del(ctx, LockPrefix+ref)
+
+	// Only the refresh token goes in: given the whole token, oauth2 would
+	// hand it back unchanged while its own, shorter expiry skew still
+	// considers it valid
+	fresh, err := v.upstream.TokenSource(ctx, &oauth2.Token{RefreshToken: tok.RefreshToken}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("vault: refreshing upstream token: %w", err)
+	}
+	if err := v.store(ctx, ref, fresh); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// Delete forgets the upstream token for ref.
+func (v *Vault) Delete(ctx context.Context, ref string) error {
+	return v.kv.Del(ctx, KeyPrefix+ref)
+}
+
+// TokenSource adapts the record for ref to an oauth2.TokenSource, so backends
+// can call the upstream API without ever handling refresh themselves.
+func (v *Vault) TokenSource(ctx context.Context, ref string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSourceWithExpiry(nil, &source{ctx: ctx, v: v, ref: ref}, refreshSkew)
+}
+
+// Client returns an HTTP client authorized with the upstream token for ref.
+func (v *Vault) Client(ctx context.Context, ref string) *http.Client {
+	return oauth2.NewClient(ctx, v.TokenSource(ctx, ref))
+}
+
+type source struct {
+	ctx context.Context
+	v   *Vault
+	ref string
+}
+
+func (s *source) Token() (*oauth2.Token, error) {
+	return s.v.Token(s.ctx, s.ref)
+}
+
+func (v *Vault) waitForRefresh(ctx context.Context, ref string) (*oauth2.Token, error) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.Now().Add(lockTTL)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		tok, err := v.load(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !needsRefresh(tok) {
+			return tok, nil
+		}
+	}
+	return nil, errors.New("vault: timed out waiting for concurrent refresh")
+}
+
+func (v *Vault) store(ctx context.Context, ref string, tok *oauth2.Token) error {
+	plaintext, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	env, err := v.keys.seal(plaintext, []byte(ref))
+	if err != nil {
+		return err
+	}
+	record, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return v.kv.Set(ctx, KeyPrefix+ref, record, v.ttl)
+}
+
+func (v *Vault) load(ctx context.Context, ref string) (*oauth2.Token, error) {
+	record, err := v.kv.Get(ctx, KeyPrefix+ref)
+	if err == state.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var env envelope
+	if err := json.Unmarshal(record, &env); err != nil {
+		return nil, err
+	}
+	plaintext, err := v.keys.open(&env, []byte(ref))
+	if err != nil {
+		return nil, err
+	}
+	var tok oauth2.Token
+	if err := json.Unmarshal(plaintext, &tok); err != nil {
+		return nil, err
+	}
+	return &tok, nil
+}
+
+func needsRefresh(tok *oauth2.Token) bool {
+	return !tok.Expiry.IsZero() && time.Until(tok.Expiry) < refreshSkew
+}
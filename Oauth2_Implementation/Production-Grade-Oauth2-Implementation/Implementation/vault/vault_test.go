@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"oauth2-implementation/Oauth2_Implementation/Production-Grade-Oauth2-Implementation/Implementation/state/memory"
+)
+
+// fakeUpstream is a token endpoint that answers every refresh with a new
+// access token and counts the refreshes.
+func fakeUpstream(t *testing.T) (*oauth2.Config, *atomic.Int32) {
+	t.Helper()
+	var refreshes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "refresh_token" || r.PostFormValue("refresh_token") != "rt" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		refreshes.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "fresh",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}, &refreshes
+}
+
+func newTestVault(t *testing.T, upstream *oauth2.Config) *Vault {
+	t.Helper()
+	kv := memory.New()
+	t.Cleanup(func() { kv.Close() })
+	keys, err := NewKeyRing("test", make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(kv, keys, upstream, time.Hour)
+}
+
+func TestTokenRefreshesWithinSkew(t *testing.T) {
+	ctx := context.Background()
+	upstream, refreshes := fakeUpstream(t)
+	v := newTestVault(t, upstream)
+
+	for _, tc := range []struct {
+		name        string
+		expiresIn   time.Duration
+		wantToken   string
+		wantRefresh int32
+	}{
+		{"valid", time.Hour, "old", 0},
+		// Inside refreshSkew but still valid to oauth2's own 10s check
+		{"within skew", 30 * time.Second, "fresh", 1},
+		{"expired", -time.Minute, "fresh", 1},
+	} {
+		refreshes.Store(0)
+		ref, err := v.Put(ctx, &oauth2.Token{AccessToken: "old", RefreshToken: "rt", Expiry: time.Now().Add(tc.expiresIn)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok, err := v.Token(ctx, ref)
+		if err != nil {
+			t.Fatalf("%s: Token: %v", tc.name, err)
+		}
+		if tok.AccessToken != tc.wantToken || refreshes.Load() != tc.wantRefresh {
+			t.Errorf("%s: got %q after %d refreshes, want %q after %d", tc.name, tok.AccessToken, refreshes.Load(), tc.wantToken, tc.wantRefresh)
+		}
+
+		// The refreshed token is stored, along with the refresh token the
+		// provider did not rotate
+		stored, err := v.load(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.AccessToken != tc.wantToken || stored.RefreshToken != "rt" || needsRefresh(stored) {
+			t.Errorf("%s: stored %+v", tc.name, stored)
+		}
+	}
+}